@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -16,6 +19,22 @@ type Config struct {
 	SupabaseServiceKey string
 	SupabaseJWTSecret  string
 	AllowedOrigins     []string
+	// 送信者がメッセージを編集・削除できる期間（送信時刻から）
+	MessageEditWindow time.Duration
+	// 連絡先（電話番号・メール・LINE ID など）を含む投稿の扱い。例: "inquiry=block,due_diligence=mask"
+	ContactPolicy string
+	// 取引メールの送信先SMTP（SMTP_HOSTが空の場合はメールを作成しない）
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	EmailFrom    string
+	// プロバイダからのバウンス通知（POST /api/email/bounces）の共有シークレット。空の場合は受け付けない
+	EmailBounceSecret string
+	// 購入確定時に買い手へ案内する運営の振込先（複数行可）
+	EscrowBankAccount string
+	// バックエンドの前段にあるリバースプロキシの数（X-Forwarded-For からクライアントIPを取り出す）。0 の場合はヘッダーを信用しない
+	TrustedProxyHops int
 }
 
 // IsProduction returns true if the environment is production
@@ -23,6 +42,11 @@ func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
 }
 
+// EmailEnabled returns true if transactional emails are sent over SMTP
+func (c *Config) EmailEnabled() bool {
+	return c.SMTPHost != ""
+}
+
 // IsSecureCookie returns true if cookies should use the Secure flag (HTTPS only)
 func (c *Config) IsSecureCookie() bool {
 	return c.IsProduction()
@@ -41,6 +65,16 @@ func LoadConfig() *Config {
 		SupabaseServiceKey: getEnv("SUPABASE_SERVICE_ROLE_KEY", ""),
 		SupabaseJWTSecret:  getEnv("SUPABASE_JWT_SECRET", ""),
 		AllowedOrigins:     parseAllowedOrigins(),
+		MessageEditWindow:  time.Duration(getEnvInt("MESSAGE_EDIT_WINDOW_MINUTES", 15)) * time.Minute,
+		ContactPolicy:      getEnv("CONTACT_POLICY", ""),
+		SMTPHost:           getEnv("SMTP_HOST", ""),
+		SMTPPort:           getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:       getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:       getEnv("SMTP_PASSWORD", ""),
+		EmailFrom:          getEnv("EMAIL_FROM", ""),
+		EmailBounceSecret:  getEnv("EMAIL_BOUNCE_WEBHOOK_SECRET", ""),
+		EscrowBankAccount:  strings.ReplaceAll(getEnv("ESCROW_BANK_ACCOUNT", ""), `\n`, "\n"),
+		TrustedProxyHops:   getEnvInt("TRUSTED_PROXY_HOPS", 0),
 	}
 
 	// 必須の環境変数をチェック
@@ -73,6 +107,10 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("SUPABASE_JWT_SECRET is required")
 	}
 
+	if c.SMTPHost != "" && c.EmailFrom == "" {
+		return fmt.Errorf("EMAIL_FROM is required when SMTP_HOST is set")
+	}
+
 	return nil
 }
 
@@ -84,6 +122,14 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+	return value
+}
+
 // parseAllowedOrigins parses ALLOWED_ORIGINS environment variable
 // Format: comma-separated list of origins, e.g., "http://localhost:3000,https://yourdomain.com"
 func parseAllowedOrigins() []string {
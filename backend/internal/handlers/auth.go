@@ -435,6 +435,9 @@ func (s *Server) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	if req.NDAFlag != nil {
 		updateData["nda_flag"] = *req.NDAFlag
 	}
+	if req.PreferredLanguage != nil {
+		updateData["preferred_language"] = *req.PreferredLanguage
+	}
 
 	// 更新するフィールドがない場合
 	if len(updateData) == 0 {
@@ -175,6 +175,18 @@ func (s *Server) ListPostComments(w http.ResponseWriter, r *http.Request, postID
 		return
 	}
 
+	// ブロックした利用者のコメント（と返信数）は本人には表示しない
+	blocked := s.usersBlockedBy(client, userID)
+	if len(blocked) > 0 {
+		visible := comments[:0]
+		for _, comment := range comments {
+			if !blocked[comment.UserID] {
+				visible = append(visible, comment)
+			}
+		}
+		comments = visible
+	}
+
 	// コメントがない場合は早期リターン
 	if len(comments) == 0 {
 		response.Success(w, http.StatusOK, []models.PostCommentWithDetails{})
@@ -276,16 +288,19 @@ func (s *Server) ListPostComments(w http.ResponseWriter, r *http.Request, postID
 		// 返信数を取得
 		type ReplyRow struct {
 			CommentID string `json:"comment_id"`
+			UserID    string `json:"user_id"`
 		}
 		var replies []ReplyRow
 		_, err = client.From("comment_replies").
-			Select("comment_id", "", false).
+			Select("comment_id, user_id", "", false).
 			In("comment_id", commentIDs).
 			ExecuteTo(&replies)
 
 		if err == nil {
 			for _, reply := range replies {
-				replyCounts[reply.CommentID]++
+				if !blocked[reply.UserID] {
+					replyCounts[reply.CommentID]++
+				}
 			}
 		}
 
@@ -395,12 +410,22 @@ func (s *Server) CreatePostComment(w http.ResponseWriter, r *http.Request, postI
 		fmt.Printf("[CreatePostComment] WARNING: Comment contains malicious content: %v\n", contentResult.Errors)
 	}
 
+	// 公開コメントでの連絡先（電話番号・メール・LINE IDなど）の交換を防ぐ
+	contacts := s.screenContacts("CreatePostComment", userID, contentResult.Sanitized, func() string {
+		return models.ContactContextPublic
+	})
+	if contacts.blocked() {
+		s.recordContactFlag("CreatePostComment", userID, contacts, models.ContactSourceComment, "", "", postID)
+		http.Error(w, contacts.blockedMessage(), http.StatusUnprocessableEntity)
+		return
+	}
+
 	client := s.supabase.GetAuthenticatedClient(accessToken)
 
 	commentData := map[string]interface{}{
 		"post_id":  postID,
 		"user_id":  userID,
-		"content":  contentResult.Sanitized,
+		"content":  contacts.Text,
 	}
 
 	var createdComments []models.PostComment
@@ -439,7 +464,10 @@ func (s *Server) CreatePostComment(w http.ResponseWriter, r *http.Request, postI
 		IsLiked:       false,
 		ReplyCount:    0,
 		Replies:       []models.CommentReplyWithDetails{},
+		ContactWarning: contacts.warning(),
 	}
+	s.recordContactFlag("CreatePostComment", userID, contacts, models.ContactSourceComment, createdComments[0].ID, "", postID)
+	s.notifyPostComment(userID, createdComments[0])
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -571,10 +599,11 @@ func (s *Server) UpdateComment(w http.ResponseWriter, r *http.Request, commentID
 	// Check if comment exists and user is the author
 	type CommentInfo struct {
 		UserID string `json:"user_id"`
+		PostID string `json:"post_id"`
 	}
 	var commentsInfo []CommentInfo
 	_, err := client.From("post_comments").
-		Select("user_id", "", false).
+		Select("user_id, post_id", "", false).
 		Eq("id", commentID).
 		Limit(1, "").
 		ExecuteTo(&commentsInfo)
@@ -601,8 +630,17 @@ func (s *Server) UpdateComment(w http.ResponseWriter, r *http.Request, commentID
 		fmt.Printf("[UpdateComment] WARNING: Comment contains malicious content: %v\n", contentResult.Errors)
 	}
 
+	contacts := s.screenContacts("UpdateComment", userID, contentResult.Sanitized, func() string {
+		return models.ContactContextPublic
+	})
+	if contacts.blocked() {
+		s.recordContactFlag("UpdateComment", userID, contacts, models.ContactSourceComment, commentID, "", commentsInfo[0].PostID)
+		http.Error(w, contacts.blockedMessage(), http.StatusUnprocessableEntity)
+		return
+	}
+
 	updateData := map[string]interface{}{
-		"content": contentResult.Sanitized,
+		"content": contacts.Text,
 	}
 
 	_, _, err = client.From("post_comments").
@@ -614,6 +652,7 @@ func (s *Server) UpdateComment(w http.ResponseWriter, r *http.Request, commentID
 		http.Error(w, "Failed to update comment", http.StatusInternalServerError)
 		return
 	}
+	s.recordContactFlag("UpdateComment", userID, contacts, models.ContactSourceComment, commentID, "", commentsInfo[0].PostID)
 
 	s.GetComment(w, r, commentID)
 }
@@ -693,6 +732,17 @@ func (s *Server) ListCommentReplies(w http.ResponseWriter, r *http.Request, comm
 		return
 	}
 
+	// ブロックした利用者の返信は本人には表示しない
+	if blocked := s.usersBlockedBy(client, userID); len(blocked) > 0 {
+		visible := replies[:0]
+		for _, reply := range replies {
+			if !blocked[reply.UserID] {
+				visible = append(visible, reply)
+			}
+		}
+		replies = visible
+	}
+
 	if len(replies) == 0 {
 		response.Success(w, http.StatusOK, []models.CommentReplyWithDetails{})
 		return
@@ -863,12 +913,21 @@ func (s *Server) CreateCommentReply(w http.ResponseWriter, r *http.Request, comm
 		fmt.Printf("[CreateCommentReply] WARNING: Reply contains malicious content: %v\n", contentResult.Errors)
 	}
 
+	contacts := s.screenContacts("CreateCommentReply", userID, contentResult.Sanitized, func() string {
+		return models.ContactContextPublic
+	})
+	if contacts.blocked() {
+		s.recordContactFlag("CreateCommentReply", userID, contacts, models.ContactSourceCommentReply, "", "", "")
+		http.Error(w, contacts.blockedMessage(), http.StatusUnprocessableEntity)
+		return
+	}
+
 	client := s.supabase.GetAuthenticatedClient(accessToken)
 
 	replyData := map[string]interface{}{
 		"comment_id": commentID,
 		"user_id":    userID,
-		"content":    contentResult.Sanitized,
+		"content":    contacts.Text,
 	}
 
 	var createdReplies []models.CommentReply
@@ -901,9 +960,12 @@ func (s *Server) CreateCommentReply(w http.ResponseWriter, r *http.Request, comm
 	}
 
 	result := models.CommentReplyWithDetails{
-		CommentReply:  createdReplies[0],
-		AuthorProfile: authorProfile,
+		CommentReply:   createdReplies[0],
+		AuthorProfile:  authorProfile,
+		ContactWarning: contacts.warning(),
 	}
+	s.recordContactFlag("CreateCommentReply", userID, contacts, models.ContactSourceCommentReply, createdReplies[0].ID, "", "")
+	s.notifyCommentReply(userID, createdReplies[0])
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -970,8 +1032,17 @@ func (s *Server) UpdateReply(w http.ResponseWriter, r *http.Request, replyID str
 		fmt.Printf("[UpdateReply] WARNING: Reply contains malicious content: %v\n", contentResult.Errors)
 	}
 
+	contacts := s.screenContacts("UpdateReply", userID, contentResult.Sanitized, func() string {
+		return models.ContactContextPublic
+	})
+	if contacts.blocked() {
+		s.recordContactFlag("UpdateReply", userID, contacts, models.ContactSourceCommentReply, replyID, "", "")
+		http.Error(w, contacts.blockedMessage(), http.StatusUnprocessableEntity)
+		return
+	}
+
 	updateData := map[string]interface{}{
-		"content": contentResult.Sanitized,
+		"content": contacts.Text,
 	}
 
 	_, _, err = client.From("comment_replies").
@@ -983,6 +1054,7 @@ func (s *Server) UpdateReply(w http.ResponseWriter, r *http.Request, replyID str
 		http.Error(w, "Failed to update reply", http.StatusInternalServerError)
 		return
 	}
+	s.recordContactFlag("UpdateReply", userID, contacts, models.ContactSourceCommentReply, replyID, "", "")
 
 	// Fetch updated reply
 	var updatedReplies []models.CommentReply
@@ -1011,8 +1083,9 @@ func (s *Server) UpdateReply(w http.ResponseWriter, r *http.Request, replyID str
 	}
 
 	result := models.CommentReplyWithDetails{
-		CommentReply:  updatedReplies[0],
-		AuthorProfile: authorProfile,
+		CommentReply:   updatedReplies[0],
+		AuthorProfile:  authorProfile,
+		ContactWarning: contacts.warning(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1182,6 +1255,7 @@ func (s *Server) ToggleCommentLike(w http.ResponseWriter, r *http.Request, comme
 			http.Error(w, "Failed to like comment", http.StatusInternalServerError)
 			return
 		}
+		s.notifyCommentLike(userID, commentID)
 	}
 
 	s.GetCommentLikes(w, r, commentID)
@@ -1451,6 +1525,7 @@ func (s *Server) ToggleReplyLike(w http.ResponseWriter, r *http.Request, replyID
 			http.Error(w, "Failed to like reply", http.StatusInternalServerError)
 			return
 		}
+		s.notifyReplyLike(userID, replyID)
 	}
 
 	s.GetReplyLikes(w, r, replyID)
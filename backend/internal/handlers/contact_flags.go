@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	defaultContactFlagLimit = 50
+	maxContactFlagLimit     = 200
+)
+
+// contactCheck is the result of screening a text for off-platform contact details
+type contactCheck struct {
+	Context  string
+	Action   models.ContactAction
+	Matches  []models.ContactMatch
+	Original string
+	Text     string // 保存する本文（mask の場合は伏せ字にしたもの）
+}
+
+// flagged reports whether contact details were found and the policy does not allow them
+func (c contactCheck) flagged() bool {
+	return len(c.Matches) > 0 && c.Action != models.ContactActionAllow
+}
+
+// blocked reports whether the text must not be posted
+func (c contactCheck) blocked() bool {
+	return c.flagged() && c.Action == models.ContactActionBlock
+}
+
+// warning returns the notice for the sender of a text posted with contact details
+func (c contactCheck) warning() *models.ContactWarning {
+	if !c.flagged() || c.blocked() {
+		return nil
+	}
+	message := "Sharing contact details before the deal is agreed is against the terms of use. Please keep the conversation on the platform."
+	if c.Action == models.ContactActionMask {
+		message = "Contact details were hidden. Please keep the conversation on the platform until the deal is agreed."
+	}
+	return &models.ContactWarning{
+		Action:  c.Action,
+		Kinds:   services.ContactKinds(c.Matches),
+		Message: message,
+	}
+}
+
+// blockedMessage is the error returned when a text is blocked
+func (c contactCheck) blockedMessage() string {
+	kinds := make([]string, 0, len(c.Matches))
+	for _, kind := range services.ContactKinds(c.Matches) {
+		kinds = append(kinds, string(kind))
+	}
+	if c.Context == models.ContactContextPublic {
+		return fmt.Sprintf("Contact details (%s) cannot be posted in public comments", strings.Join(kinds, ", "))
+	}
+	return fmt.Sprintf("Contact details (%s) cannot be shared at this stage of the deal", strings.Join(kinds, ", "))
+}
+
+// screenContacts detects contact details in text and applies the policy of the context.
+// context is resolved only when contact details are found (it may query the deal state).
+func (s *Server) screenContacts(handler string, userID string, text string, context func() string) contactCheck {
+	check := contactCheck{Action: models.ContactActionAllow, Original: text, Text: text}
+	matches := s.contacts.Detect(text)
+	if len(matches) == 0 {
+		return check
+	}
+	// 運営は手続きの案内などで連絡先を送ることがあるため対象外
+	if s.isOperator(s.supabase.GetServiceClient(), userID) {
+		return check
+	}
+
+	check.Matches = matches
+	check.Context = context()
+	check.Action = s.contacts.Action(check.Context)
+	if check.Action == models.ContactActionMask {
+		check.Text = s.contacts.Mask(text, matches)
+	}
+	log.Printf("[%s] ⚠️ Contact details %v from %s (context=%s, action=%s)", handler, services.ContactKinds(matches), userID, check.Context, check.Action)
+	return check
+}
+
+// urlHost returns the host name of a URL ("" when it cannot be parsed)
+func urlHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// threadContactContext returns the policy key of a thread: the deal stage of a deal room, otherwise inquiry
+func (s *Server) threadContactContext(threadID string) string {
+	serviceClient := s.supabase.GetServiceClient()
+	var rows []threadRow
+	_, err := serviceClient.From("threads").
+		Select(threadSelectColumns, "", false).
+		Eq("id", threadID).
+		ExecuteTo(&rows)
+	if err != nil || len(rows) == 0 {
+		log.Printf("[threadContactContext] ⚠️ Failed to query thread %s: %v", threadID, err)
+		return string(models.DealStageInquiry)
+	}
+	thread := threadFromRow(rows[0])
+	if thread.ThreadType != models.ThreadTypeDealRoom || thread.RelatedPostID == nil {
+		return string(models.DealStageInquiry)
+	}
+	state, err := s.fetchDealRoomState(serviceClient, thread)
+	if err != nil {
+		log.Printf("[threadContactContext] ⚠️ Failed to fetch deal state of thread %s: %v", threadID, err)
+		return string(models.DealStageInquiry)
+	}
+	return string(state.Stage)
+}
+
+// contactFlagInsert is a row of contact_flags
+type contactFlagInsert struct {
+	UserID     string                `json:"user_id"`
+	SourceType models.ContactSource  `json:"source_type"`
+	SourceID   *string               `json:"source_id"`
+	ThreadID   *string               `json:"thread_id"`
+	PostID     *string               `json:"post_id"`
+	Context    string                `json:"context"`
+	Action     models.ContactAction  `json:"action"`
+	Kinds      []models.ContactKind  `json:"kinds"`
+	Matches    []models.ContactMatch `json:"matches"`
+	Text       string                `json:"text"`
+}
+
+// recordContactFlag keeps a flagged text for operators. Empty IDs are stored as null.
+// 記録に失敗しても投稿そのものは止めない
+func (s *Server) recordContactFlag(handler string, userID string, check contactCheck, source models.ContactSource, sourceID, threadID, postID string) {
+	if !check.flagged() {
+		return
+	}
+	optional := func(v string) *string {
+		if v == "" {
+			return nil
+		}
+		return &v
+	}
+	flag := contactFlagInsert{
+		UserID:     userID,
+		SourceType: source,
+		SourceID:   optional(sourceID),
+		ThreadID:   optional(threadID),
+		PostID:     optional(postID),
+		Context:    check.Context,
+		Action:     check.Action,
+		Kinds:      services.ContactKinds(check.Matches),
+		Matches:    check.Matches,
+		Text:       check.Original,
+	}
+	_, _, err := s.supabase.GetServiceClient().From("contact_flags").
+		Insert(flag, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		log.Printf("[%s] ❌ Failed to record contact flag for %s: %v", handler, userID, err)
+	}
+}
+
+// HandleContactFlags routes /api/contact-flags requests (operators only)
+func (s *Server) HandleContactFlags(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+	if !s.isOperator(s.supabase.GetAuthenticatedClient(accessToken), userID) {
+		log.Printf("[HandleContactFlags] ❌ User %s is not an operator", userID)
+		response.Error(w, http.StatusForbidden, "Only operators can view contact flags")
+		return
+	}
+
+	flagID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/contact-flags"), "/")
+	switch {
+	case flagID == "" && r.Method == http.MethodGet:
+		s.ListContactFlags(w, r)
+	case flagID != "" && strings.HasSuffix(flagID, "/review") && r.Method == http.MethodPut:
+		s.ReviewContactFlag(w, strings.TrimSuffix(flagID, "/review"), userID)
+	default:
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// ListContactFlags returns flagged texts, newest first
+// GET /api/contact-flags?status=open|reviewed|all&user_id=&source_type=&limit=&offset=
+func (s *Server) ListContactFlags(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultContactFlagLimit
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 {
+		limit = min(v, maxContactFlagLimit)
+	}
+	offset := 0
+	if v, err := strconv.Atoi(query.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+
+	// 🔒 SECURITY: 伏せ字にする前の本文を含むため、RLSポリシーのない contact_flags を service role で参照する
+	builder := s.supabase.GetServiceClient().From("contact_flags").
+		Select("*", "", false)
+	switch query.Get("status") {
+	case "", "open":
+		builder = builder.Is("reviewed_at", "null")
+	case "reviewed":
+		builder = builder.Not("reviewed_at", "is", "null")
+	case "all":
+	default:
+		response.Error(w, http.StatusBadRequest, "status must be open, reviewed or all")
+		return
+	}
+	if v := query.Get("user_id"); v != "" {
+		builder = builder.Eq("user_id", v)
+	}
+	if v := query.Get("source_type"); v != "" {
+		builder = builder.Eq("source_type", v)
+	}
+
+	var flags []models.ContactFlag
+	_, err := builder.
+		Order("created_at", nil).
+		Range(offset, offset+limit-1, "").
+		ExecuteTo(&flags)
+	if err != nil {
+		log.Printf("[ListContactFlags] Failed to query contact flags: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query contact flags")
+		return
+	}
+	if flags == nil {
+		flags = []models.ContactFlag{}
+	}
+
+	response.Success(w, http.StatusOK, flags)
+}
+
+// ReviewContactFlag marks a flag as reviewed by the operator
+// PUT /api/contact-flags/:id/review
+func (s *Server) ReviewContactFlag(w http.ResponseWriter, flagID string, operatorID string) {
+	var updated []models.ContactFlag
+	_, err := s.supabase.GetServiceClient().From("contact_flags").
+		Update(map[string]interface{}{
+			"reviewed_at": time.Now().UTC().Format(time.RFC3339),
+			"reviewed_by": operatorID,
+		}, "", "").
+		Eq("id", flagID).
+		ExecuteTo(&updated)
+	if err != nil {
+		log.Printf("[ReviewContactFlag] ❌ Failed to update contact flag %s: %v", flagID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to update contact flag")
+		return
+	}
+	if len(updated) == 0 {
+		response.Error(w, http.StatusNotFound, "Contact flag not found")
+		return
+	}
+
+	log.Printf("[ReviewContactFlag] ✓ Contact flag %s reviewed by %s", flagID, operatorID)
+	response.Success(w, http.StatusOK, updated[0])
+}
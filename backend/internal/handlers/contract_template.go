@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const contractDocumentsBucket = "contract-documents"
+
+// ListContractTemplates returns the available contract templates
+// GET /api/contract-templates?type=nda&language=ja
+func (s *Server) ListContractTemplates(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodGet) {
+		return
+	}
+
+	contractType := r.URL.Query().Get("type")
+	language := r.URL.Query().Get("language")
+
+	templates := make([]models.ContractTemplateInfo, 0)
+	for _, t := range services.ListContractTemplates() {
+		if contractType != "" && string(t.Type) != contractType {
+			continue
+		}
+		if language != "" && t.Language != language {
+			continue
+		}
+		templates = append(templates, t)
+	}
+	response.Success(w, http.StatusOK, templates)
+}
+
+// GenerateContract fills a contract template with profile, listing and negotiated terms,
+// renders it to PDF and attaches it to the thread as a thread_contract_documents entry
+// POST /api/contracts/generate (?preview=true returns the PDF without saving it)
+func (s *Server) GenerateContract(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.GenerateContractRequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+	language := req.Language
+	if language == "" {
+		language = "ja"
+	}
+
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+	serviceClient := s.supabase.GetServiceClient()
+
+	// スレッドの参加者で、契約書を作成できる役割（売り手・買い手）であることを確認
+	if _, ok := s.requireThreadPermission(w, "GenerateContract", req.ThreadID, userID, models.ThreadPermissionUploadContract); !ok {
+		return
+	}
+	participants, err := s.threadParticipantRoles(serviceClient, req.ThreadID)
+	if err != nil {
+		log.Printf("[GenerateContract] Failed to query participants: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to verify thread participants")
+		return
+	}
+	// 契約の当事者になれるのは売り手・買い手の役割の参加者のみ（アドバイザー・運営は除く）
+	participantIDs := make([]string, 0, len(participants))
+	var sellerIDs, buyerIDs []string
+	for _, p := range participants {
+		switch models.ThreadRole(p.Role) {
+		case models.ThreadRoleSeller:
+			sellerIDs = append(sellerIDs, p.UserID)
+		case models.ThreadRoleBuyer:
+			buyerIDs = append(buyerIDs, p.UserID)
+		default:
+			continue
+		}
+		participantIDs = append(participantIDs, p.UserID)
+	}
+
+	var threads []threadRow
+	_, err = client.From("threads").
+		Select(threadSelectColumns, "", false).
+		Eq("id", req.ThreadID).
+		ExecuteTo(&threads)
+	if err != nil || len(threads) == 0 {
+		log.Printf("[GenerateContract] Thread not found: %v", err)
+		response.Error(w, http.StatusNotFound, "Thread not found")
+		return
+	}
+	thread := threads[0]
+
+	var post *models.Post
+	if thread.RelatedPostID != nil && *thread.RelatedPostID != "" {
+		var posts []models.Post
+		_, err = client.From("posts").
+			Select("*", "", false).
+			Eq("id", *thread.RelatedPostID).
+			ExecuteTo(&posts)
+		if err != nil {
+			log.Printf("[GenerateContract] Failed to query post: %v", err)
+			response.Error(w, http.StatusInternalServerError, "Failed to query post")
+			return
+		}
+		if len(posts) > 0 {
+			post = &posts[0]
+		}
+	}
+
+	// 売り手: 指定がなければ案件の投稿者（案件がなければ唯一の売り手）。買い手: 指定がなければ唯一の買い手
+	sellerID := ndaStringValue(req.SellerUserID)
+	if sellerID == "" && post != nil {
+		sellerID = post.AuthorUserID
+	}
+	if sellerID == "" && len(sellerIDs) == 1 {
+		sellerID = sellerIDs[0]
+	}
+	if sellerID == "" {
+		response.Error(w, http.StatusBadRequest, "seller_user_id is required for threads without a listing")
+		return
+	}
+	buyerID := ndaStringValue(req.BuyerUserID)
+	if buyerID == "" {
+		for _, pid := range buyerIDs {
+			if pid == sellerID {
+				continue
+			}
+			if buyerID != "" {
+				response.Error(w, http.StatusBadRequest, "buyer_user_id is required for threads with more than one buyer")
+				return
+			}
+			buyerID = pid
+		}
+	}
+	if buyerID == "" || buyerID == sellerID || !containsString(participantIDs, sellerID) || !containsString(participantIDs, buyerID) {
+		response.Error(w, http.StatusBadRequest, "Seller and buyer must be different participants of this thread")
+		return
+	}
+
+	// 🔒 SECURITY: 契約書は両当事者が閲覧するため、案件情報は買い手の公開範囲でマスクしてから差し込む
+	var listing services.ContractListing
+	if post != nil {
+		masked := *post
+		relation := services.ViewerMember
+		if buyerID == post.AuthorUserID {
+			relation = services.ViewerOwner
+		} else if covered, err := newNDAResolver(serviceClient, buyerID).Covers(post.AuthorUserID, post.AuthorOrgID, post.ID); err != nil {
+			log.Printf("[GenerateContract] ⚠️ Failed to check NDA for buyer %s: %v", buyerID, err)
+		} else if covered {
+			relation = services.ViewerNDA
+		}
+		services.ApplyPostVisibility(&masked, relation)
+		listing = services.ContractListing{ID: masked.ID, Title: masked.Title, Price: masked.Price}
+	}
+
+	parties, err := s.fetchContractParties(serviceClient, sellerID, buyerID)
+	if err != nil {
+		log.Printf("[GenerateContract] Failed to query profiles: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query party profiles")
+		return
+	}
+
+	now := time.Now().UTC()
+	documentID := uuid.New().String()
+	info, text, err := services.RenderContractText(req.ContractType, language, req.Version, services.ContractTemplateData{
+		DocumentID: documentID,
+		Date:       now,
+		Seller:     parties[sellerID],
+		Buyer:      parties[buyerID],
+		Listing:    listing,
+		Terms:      req.Terms,
+	})
+	if errors.Is(err, services.ErrContractTemplateNotFound) {
+		response.Error(w, http.StatusNotFound, "Contract template not found")
+		return
+	}
+	if err != nil {
+		log.Printf("[GenerateContract] Failed to render template: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to render contract")
+		return
+	}
+
+	pdf := services.RenderContractPDF(info, text, now)
+	sum := sha256.Sum256(pdf)
+	documentHash := hex.EncodeToString(sum[:])
+	fileName := fmt.Sprintf("%s_v%d_%s.pdf", info.Title, info.Version, info.Language)
+
+	if r.URL.Query().Get("preview") == "true" {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", "inline; filename*=UTF-8''"+url.PathEscape(fileName))
+		w.Header().Set("X-Document-Hash", documentHash)
+		w.WriteHeader(http.StatusOK)
+		w.Write(pdf)
+		return
+	}
+
+	storagePath := fmt.Sprintf("%s/%s.pdf", userID, documentID)
+	filePath, err := s.supabase.UploadFile(userID, contractDocumentsBucket, storagePath, pdf, "application/pdf")
+	if err != nil {
+		log.Printf("[GenerateContract] Failed to upload to storage: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to upload contract")
+		return
+	}
+
+	type contractDocumentInsert struct {
+		ThreadID         string `json:"thread_id"`
+		UploadedBy       string `json:"uploaded_by"`
+		ContractType     string `json:"contract_type"`
+		FilePath         string `json:"file_path"`
+		FileName         string `json:"file_name"`
+		FileSize         int64  `json:"file_size"`
+		ContentType      string `json:"content_type"`
+		TemplateVersion  int    `json:"template_version"`
+		TemplateLanguage string `json:"template_language"`
+		DocumentHash     string `json:"document_hash"`
+	}
+
+	var inserted []struct {
+		ID string `json:"id"`
+	}
+	_, err = client.From("thread_contract_documents").
+		Insert(contractDocumentInsert{
+			ThreadID:         req.ThreadID,
+			UploadedBy:       userID,
+			ContractType:     string(req.ContractType),
+			FilePath:         filePath,
+			FileName:         fileName,
+			FileSize:         int64(len(pdf)),
+			ContentType:      "application/pdf",
+			TemplateVersion:  info.Version,
+			TemplateLanguage: info.Language,
+			DocumentHash:     documentHash,
+		}, false, "", "", "").
+		ExecuteTo(&inserted)
+	if err != nil {
+		log.Printf("[GenerateContract] Failed to save contract document: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to save contract document information")
+		return
+	}
+
+	result := models.GeneratedContract{
+		ThreadID:     req.ThreadID,
+		ContractType: req.ContractType,
+		Template:     info,
+		FilePath:     filePath,
+		FileName:     fileName,
+		FileSize:     int64(len(pdf)),
+		DocumentHash: documentHash,
+	}
+	if len(inserted) > 0 {
+		result.ID = inserted[0].ID
+		result.SignedURL = s.protectedFileURLString("GenerateContract", userID, models.ProtectedFileContractDocument, result.ID)
+		s.publishThreadEvent("GenerateContract", req.ThreadID, "", models.RealtimeEventContractUploaded, models.RealtimeContractUploaded{
+			ID:           result.ID,
+			ContractType: string(req.ContractType),
+			FileName:     fileName,
+			UploadedBy:   userID,
+		})
+	}
+
+	log.Printf("[GenerateContract] ✓ Generated %s v%d (%s) for thread %s", info.Type, info.Version, info.Language, req.ThreadID)
+	response.Success(w, http.StatusCreated, result)
+}
+
+// threadParticipantIDs returns the user IDs of the thread participants
+func (s *Server) threadParticipantIDs(client *supabase.Client, threadID string) ([]string, error) {
+	var rows []participantRow
+	_, err := client.From("thread_participants").
+		Select("thread_id, user_id", "", false).
+		Eq("thread_id", threadID).
+		ExecuteTo(&rows)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.UserID)
+	}
+	return ids, nil
+}
+
+// fetchContractParties loads the profile fields filled into contracts
+// 🔒 SECURITY: 相手方のプロフィールを参照するためService Clientを使用し、契約書に必要な列のみ取得する
+func (s *Server) fetchContractParties(client *supabase.Client, userIDs ...string) (map[string]services.ContractParty, error) {
+	var rows []struct {
+		ID          string  `json:"id"`
+		DisplayName string  `json:"display_name"`
+		CompanyName *string `json:"company_name"`
+		Prefecture  *string `json:"prefecture"`
+	}
+	_, err := client.From("profiles").
+		Select("id, display_name, company_name, prefecture", "", false).
+		In("id", userIDs).
+		ExecuteTo(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	parties := make(map[string]services.ContractParty, len(rows))
+	for _, row := range rows {
+		parties[row.ID] = services.ContractParty{
+			DisplayName: row.DisplayName,
+			CompanyName: ndaStringValue(row.CompanyName),
+			Prefecture:  ndaStringValue(row.Prefecture),
+		}
+	}
+	return parties, nil
+}
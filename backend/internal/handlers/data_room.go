@@ -0,0 +1,1141 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	dataRoomFilesBucket = "data-room-files"
+	// プロキシURLの有効期限。URLは閲覧者に紐づき、転送されても他人は開けない
+	dataRoomURLTTL          = 60 * time.Second
+	defaultDataRoomLogLimit = 100
+	maxDataRoomLogLimit     = 500
+)
+
+var (
+	errDataRoomNotFound    = errors.New("data room not found")
+	errDataRoomNoGrant     = errors.New("no active data room grant")
+	errDataRoomNDARequired = errors.New("signed nda required")
+)
+
+// データルームに置けるファイル。PDFと画像は閲覧者の透かしを入れて配信する
+var dataRoomAllowedTypes = map[string]bool{
+	"application/pdf":               true,
+	"image/jpeg":                    true,
+	"image/png":                     true,
+	"image/gif":                     true,
+	"text/csv":                      true,
+	"application/msword":            true, // .doc
+	"application/vnd.ms-excel":      true, // .xls
+	"application/vnd.ms-powerpoint": true, // .ppt
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true, // .docx
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true, // .xlsx
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true, // .pptx
+}
+
+// dataRoomAccess is the resolved access of a user to a data room
+type dataRoomAccess struct {
+	room    models.DataRoom
+	post    models.Post
+	isOwner bool
+	grant   *models.DataRoomGrant
+	folders []models.DataRoomFolder
+	// nil = ルーム全体を閲覧可能
+	allowedFolders map[string]bool
+}
+
+// canSeeFolder reports whether the folder (nil = top level) is inside the grant
+func (a *dataRoomAccess) canSeeFolder(folderID *string) bool {
+	if a.allowedFolders == nil {
+		return true
+	}
+	return folderID != nil && a.allowedFolders[*folderID]
+}
+
+// HandleDataRooms handles /api/data-rooms
+// GET: the data room of a post (?post_id=), POST: open a data room for my post
+func (s *Server) HandleDataRooms(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.GetDataRoomByPost(w, r)
+	case http.MethodPost:
+		s.CreateDataRoom(w, r)
+	default:
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleDataRoomByID routes /api/data-rooms/:id[/folders|files|grants|report|logs[/...]]
+func (s *Server) HandleDataRoomByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 || parts[2] == "" {
+		response.Error(w, http.StatusBadRequest, "Data room ID required")
+		return
+	}
+	roomID := parts[2]
+	rest := parts[3:]
+
+	route := func(method string, handler func()) {
+		if r.Method != method {
+			response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		handler()
+	}
+
+	switch {
+	case len(rest) == 0:
+		route(http.MethodGet, func() { s.GetDataRoom(w, r, roomID) })
+	case len(rest) == 1 && rest[0] == "folders":
+		route(http.MethodPost, func() { s.CreateDataRoomFolder(w, r, roomID) })
+	case len(rest) == 2 && rest[0] == "folders":
+		route(http.MethodDelete, func() { s.DeleteDataRoomFolder(w, r, roomID, rest[1]) })
+	case len(rest) == 1 && rest[0] == "files":
+		route(http.MethodPost, func() { s.UploadDataRoomFile(w, r, roomID) })
+	case len(rest) == 2 && rest[0] == "files":
+		route(http.MethodDelete, func() { s.DeleteDataRoomFile(w, r, roomID, rest[1]) })
+	case len(rest) == 3 && rest[0] == "files" && rest[2] == "url":
+		route(http.MethodPost, func() { s.CreateDataRoomFileURL(w, r, roomID, rest[1]) })
+	case len(rest) == 1 && rest[0] == "grants":
+		if r.Method == http.MethodGet {
+			s.ListDataRoomGrants(w, r, roomID)
+		} else {
+			route(http.MethodPost, func() { s.UpsertDataRoomGrant(w, r, roomID) })
+		}
+	case len(rest) == 2 && rest[0] == "grants":
+		route(http.MethodDelete, func() { s.RevokeDataRoomGrant(w, r, roomID, rest[1]) })
+	case len(rest) == 1 && rest[0] == "report":
+		route(http.MethodGet, func() { s.GetDataRoomAccessReport(w, r, roomID) })
+	case len(rest) == 1 && rest[0] == "logs":
+		route(http.MethodGet, func() { s.ListDataRoomAccessLogs(w, r, roomID) })
+	default:
+		response.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// CreateDataRoom opens the data room of a post (author only)
+// POST /api/data-rooms
+func (s *Server) CreateDataRoom(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.CreateDataRoomRequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+	post, err := s.fetchPostForRevenueVerification(client, req.PostID)
+	if err != nil {
+		log.Printf("[CreateDataRoom] Failed to query post %s: %v", req.PostID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query post")
+		return
+	}
+	if post == nil {
+		response.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if post.AuthorUserID != userID {
+		log.Printf("[CreateDataRoom] ❌ User %s is not the author of post %s", userID, req.PostID)
+		response.Error(w, http.StatusForbidden, "Only the author can open a data room")
+		return
+	}
+
+	title := post.Title
+	if req.Title != nil {
+		title = strings.TrimSpace(*req.Title)
+	}
+	insert := map[string]interface{}{
+		"post_id":       post.ID,
+		"owner_user_id": userID,
+		"title":         title,
+	}
+	if req.Description != nil && strings.TrimSpace(*req.Description) != "" {
+		insert["description"] = strings.TrimSpace(*req.Description)
+	}
+
+	var rooms []models.DataRoom
+	_, err = s.supabase.GetServiceClient().From("data_rooms").
+		Insert(insert, false, "", "", "").
+		ExecuteTo(&rooms)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			response.Error(w, http.StatusConflict, "A data room already exists for this post")
+			return
+		}
+		log.Printf("[CreateDataRoom] Failed to create data room: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to create data room")
+		return
+	}
+	if len(rooms) == 0 {
+		response.Error(w, http.StatusInternalServerError, "Failed to create data room")
+		return
+	}
+
+	log.Printf("[CreateDataRoom] ✓ Opened data room %s for post %s", rooms[0].ID, post.ID)
+	response.Success(w, http.StatusCreated, models.DataRoomDetail{
+		DataRoom: rooms[0],
+		IsOwner:  true,
+		Folders:  []models.DataRoomFolder{},
+		Files:    []models.DataRoomFile{},
+	})
+}
+
+// GetDataRoomByPost returns the data room of a post for its author or a granted buyer
+// GET /api/data-rooms?post_id=
+func (s *Server) GetDataRoomByPost(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+	postID := r.URL.Query().Get("post_id")
+	if postID == "" {
+		response.Error(w, http.StatusBadRequest, "post_id is required")
+		return
+	}
+
+	var rooms []models.DataRoom
+	_, err := s.supabase.GetServiceClient().From("data_rooms").
+		Select("*", "", false).
+		Eq("post_id", postID).
+		ExecuteTo(&rooms)
+	if err != nil {
+		log.Printf("[GetDataRoomByPost] Failed to query data room for post %s: %v", postID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query data room")
+		return
+	}
+	if len(rooms) == 0 {
+		response.Error(w, http.StatusNotFound, "Data room not found")
+		return
+	}
+
+	s.writeDataRoomDetail(w, "GetDataRoomByPost", rooms[0].ID, userID)
+}
+
+// GetDataRoom returns the folders and files visible to the user
+// GET /api/data-rooms/:id
+func (s *Server) GetDataRoom(w http.ResponseWriter, r *http.Request, roomID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+	s.writeDataRoomDetail(w, "GetDataRoom", roomID, userID)
+}
+
+func (s *Server) writeDataRoomDetail(w http.ResponseWriter, handler string, roomID string, userID string) {
+	access, err := s.resolveDataRoomAccess(roomID, userID)
+	if s.handleDataRoomAccessError(w, handler, err) {
+		return
+	}
+
+	files, err := s.fetchDataRoomFiles(roomID)
+	if err != nil {
+		log.Printf("[%s] Failed to query files of %s: %v", handler, roomID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query data room files")
+		return
+	}
+
+	detail := models.DataRoomDetail{
+		DataRoom: access.room,
+		IsOwner:  access.isOwner,
+		Grant:    access.grant,
+		Folders:  make([]models.DataRoomFolder, 0, len(access.folders)),
+		Files:    make([]models.DataRoomFile, 0, len(files)),
+	}
+	for _, folder := range access.folders {
+		if access.allowedFolders == nil || access.allowedFolders[folder.ID] {
+			detail.Folders = append(detail.Folders, folder)
+		}
+	}
+	for _, file := range files {
+		if access.canSeeFolder(file.FolderID) {
+			file.Watermarked = services.WatermarkSupported(file.ContentType)
+			detail.Files = append(detail.Files, file)
+		}
+	}
+
+	response.Success(w, http.StatusOK, detail)
+}
+
+// CreateDataRoomFolder creates a folder (author only)
+// POST /api/data-rooms/:id/folders
+func (s *Server) CreateDataRoomFolder(w http.ResponseWriter, r *http.Request, roomID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.CreateDataRoomFolderRequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	access, ok := s.requireDataRoomOwner(w, "CreateDataRoomFolder", roomID, userID)
+	if !ok {
+		return
+	}
+	if req.ParentID != nil && !dataRoomHasFolder(access.folders, *req.ParentID) {
+		response.Error(w, http.StatusBadRequest, "Parent folder not found in this data room")
+		return
+	}
+
+	insert := map[string]interface{}{
+		"room_id":    roomID,
+		"parent_id":  req.ParentID,
+		"name":       strings.TrimSpace(req.Name),
+		"created_by": userID,
+	}
+	var folders []models.DataRoomFolder
+	_, err := s.supabase.GetServiceClient().From("data_room_folders").
+		Insert(insert, false, "", "", "").
+		ExecuteTo(&folders)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			response.Error(w, http.StatusConflict, "A folder with the same name already exists")
+			return
+		}
+		log.Printf("[CreateDataRoomFolder] Failed to create folder: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to create folder")
+		return
+	}
+	if len(folders) == 0 {
+		response.Error(w, http.StatusInternalServerError, "Failed to create folder")
+		return
+	}
+
+	log.Printf("[CreateDataRoomFolder] ✓ Created folder %s in data room %s", folders[0].ID, roomID)
+	response.Success(w, http.StatusCreated, folders[0])
+}
+
+// DeleteDataRoomFolder deletes an empty folder (author only)
+// DELETE /api/data-rooms/:id/folders/:folderId
+func (s *Server) DeleteDataRoomFolder(w http.ResponseWriter, r *http.Request, roomID string, folderID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	access, ok := s.requireDataRoomOwner(w, "DeleteDataRoomFolder", roomID, userID)
+	if !ok {
+		return
+	}
+	if !dataRoomHasFolder(access.folders, folderID) {
+		response.Error(w, http.StatusNotFound, "Folder not found")
+		return
+	}
+
+	// 中身のあるフォルダは削除できない（誤操作で資料をまとめて消さないため）
+	for _, folder := range access.folders {
+		if folder.ParentID != nil && *folder.ParentID == folderID {
+			response.Error(w, http.StatusConflict, "Folder is not empty")
+			return
+		}
+	}
+	files, err := s.fetchDataRoomFiles(roomID)
+	if err != nil {
+		log.Printf("[DeleteDataRoomFolder] Failed to query files of %s: %v", roomID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query data room files")
+		return
+	}
+	for _, file := range files {
+		if file.FolderID != nil && *file.FolderID == folderID {
+			response.Error(w, http.StatusConflict, "Folder is not empty")
+			return
+		}
+	}
+
+	_, _, err = s.supabase.GetServiceClient().From("data_room_folders").
+		Delete("minimal", "").
+		Eq("id", folderID).
+		Eq("room_id", roomID).
+		Execute()
+	if err != nil {
+		log.Printf("[DeleteDataRoomFolder] Failed to delete folder %s: %v", folderID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to delete folder")
+		return
+	}
+
+	log.Printf("[DeleteDataRoomFolder] ✓ Deleted folder %s from data room %s", folderID, roomID)
+	response.Success(w, http.StatusOK, map[string]string{"message": "Folder deleted"})
+}
+
+// UploadDataRoomFile uploads a file into the private data-room-files bucket (author only)
+// POST /api/data-rooms/:id/files (multipart/form-data: file, folder_id)
+func (s *Server) UploadDataRoomFile(w http.ResponseWriter, r *http.Request, roomID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	access, ok := s.requireDataRoomOwner(w, "UploadDataRoomFile", roomID, userID)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseMultipartForm(50 << 20); err != nil { // 50MB max
+		log.Printf("[UploadDataRoomFile] Failed to parse form: %v", err)
+		response.Error(w, http.StatusBadRequest, "Failed to parse form data")
+		return
+	}
+
+	var folderID *string
+	if v := r.FormValue("folder_id"); v != "" {
+		if !dataRoomHasFolder(access.folders, v) {
+			response.Error(w, http.StatusBadRequest, "Folder not found in this data room")
+			return
+		}
+		folderID = &v
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		log.Printf("[UploadDataRoomFile] Failed to get file: %v", err)
+		response.Error(w, http.StatusBadRequest, "No file provided")
+		return
+	}
+	defer file.Close()
+
+	fileData, err := io.ReadAll(file)
+	if err != nil {
+		log.Printf("[UploadDataRoomFile] Failed to read file: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to read file")
+		return
+	}
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	contentType := http.DetectContentType(fileData)
+	// Office文書（zip形式）やCSVは中身から判別できないため拡張子で判定する
+	if contentType == "application/octet-stream" || contentType == "application/zip" || strings.HasPrefix(contentType, "text/plain") {
+		if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+			contentType = strings.Split(mimeType, ";")[0]
+		}
+	}
+	if !dataRoomAllowedTypes[contentType] {
+		response.Error(w, http.StatusBadRequest, "Invalid file type. Only PDF, images, CSV, Word, Excel and PowerPoint files are allowed")
+		return
+	}
+
+	// 🔒 SECURITY: 透かしを入れられないPDF（暗号化・破損）は配信時に素通しになるため受け付けない
+	if services.WatermarkSupported(contentType) {
+		if _, _, err := services.ApplyWatermark(s.config.SupabaseJWTSecret, contentType, fileData, services.Watermark{UserID: userID, Timestamp: time.Now()}); err != nil {
+			log.Printf("[UploadDataRoomFile] ❌ Cannot watermark %s: %v", header.Filename, err)
+			response.Error(w, http.StatusBadRequest, "This file cannot be watermarked (encrypted or damaged files are not allowed)")
+			return
+		}
+	}
+
+	storagePath := fmt.Sprintf("%s/%s%s", roomID, uuid.New().String(), ext)
+	filePath, err := s.supabase.UploadFile(userID, dataRoomFilesBucket, storagePath, fileData, contentType)
+	if err != nil {
+		log.Printf("[UploadDataRoomFile] Failed to upload to storage: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to upload file")
+		return
+	}
+
+	sum := sha256.Sum256(fileData)
+	insert := map[string]interface{}{
+		"room_id":      roomID,
+		"folder_id":    folderID,
+		"file_name":    header.Filename,
+		"file_path":    filePath,
+		"file_size":    len(fileData),
+		"content_type": contentType,
+		"sha256":       hex.EncodeToString(sum[:]),
+		"uploaded_by":  userID,
+	}
+	var files []models.DataRoomFile
+	_, err = s.supabase.GetServiceClient().From("data_room_files").
+		Insert(insert, false, "", "", "").
+		ExecuteTo(&files)
+	if err != nil || len(files) == 0 {
+		log.Printf("[UploadDataRoomFile] Failed to save file information: %v", err)
+		if delErr := s.supabase.DeleteFile(dataRoomFilesBucket, filePath); delErr != nil {
+			log.Printf("[UploadDataRoomFile] ⚠️ Failed to remove orphaned file %s: %v", filePath, delErr)
+		}
+		response.Error(w, http.StatusInternalServerError, "Failed to save file information")
+		return
+	}
+
+	uploaded := files[0]
+	uploaded.Watermarked = services.WatermarkSupported(uploaded.ContentType)
+	log.Printf("[UploadDataRoomFile] ✓ Uploaded %s (%s, %d bytes) to data room %s", uploaded.ID, contentType, len(fileData), roomID)
+	response.Success(w, http.StatusCreated, uploaded)
+}
+
+// DeleteDataRoomFile hides a file from the room (author only).
+// The row is kept so that the access report still shows who opened it.
+// DELETE /api/data-rooms/:id/files/:fileId
+func (s *Server) DeleteDataRoomFile(w http.ResponseWriter, r *http.Request, roomID string, fileID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	if _, ok := s.requireDataRoomOwner(w, "DeleteDataRoomFile", roomID, userID); !ok {
+		return
+	}
+
+	var updated []models.DataRoomFile
+	_, err := s.supabase.GetServiceClient().From("data_room_files").
+		Update(map[string]interface{}{"deleted_at": time.Now().UTC()}, "", "").
+		Eq("id", fileID).
+		Eq("room_id", roomID).
+		Is("deleted_at", "null").
+		ExecuteTo(&updated)
+	if err != nil {
+		log.Printf("[DeleteDataRoomFile] Failed to delete file %s: %v", fileID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to delete file")
+		return
+	}
+	if len(updated) == 0 {
+		response.Error(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	// ストレージからは削除する（ログの参照用に行のみ残す）
+	if err := s.supabase.DeleteFile(dataRoomFilesBucket, updated[0].FilePath); err != nil {
+		log.Printf("[DeleteDataRoomFile] ⚠️ Failed to remove %s from storage: %v", updated[0].FilePath, err)
+	}
+
+	log.Printf("[DeleteDataRoomFile] ✓ Deleted file %s from data room %s", fileID, roomID)
+	response.Success(w, http.StatusOK, map[string]string{"message": "File deleted"})
+}
+
+// CreateDataRoomFileURL issues a short-lived proxy URL bound to the viewer.
+// The file is watermarked with the viewer identity and logged when the URL is opened.
+// POST /api/data-rooms/:id/files/:fileId/url
+func (s *Server) CreateDataRoomFileURL(w http.ResponseWriter, r *http.Request, roomID string, fileID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.CreateFileURLRequest
+	if r.ContentLength != 0 && !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+	if req.Action == "" {
+		req.Action = models.FileAccessView
+	}
+
+	access, err := s.resolveDataRoomAccess(roomID, userID)
+	if s.handleDataRoomAccessError(w, "CreateDataRoomFileURL", err) {
+		return
+	}
+	if req.Action == models.FileAccessDownload && !access.isOwner && !access.grant.CanDownload {
+		response.Error(w, http.StatusForbidden, "Downloading is not allowed for this data room")
+		return
+	}
+
+	file, err := s.fetchDataRoomFile(roomID, fileID)
+	if err != nil {
+		log.Printf("[CreateDataRoomFileURL] Failed to query file %s: %v", fileID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query file")
+		return
+	}
+	if file == nil || !access.canSeeFolder(file.FolderID) {
+		response.Error(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	fileURL, err := s.protectedFileURL(userID, models.ProtectedFileDataRoom, file.ID, req.Action, dataRoomURLTTL)
+	if err != nil {
+		log.Printf("[CreateDataRoomFileURL] Failed to sign token: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to create file URL")
+		return
+	}
+
+	response.Success(w, http.StatusOK, fileURL)
+}
+
+// resolveDataRoomFile checks the grant, NDA and folder scope for a file served by ServeProtectedFile.
+// They are checked again because they may have been revoked since the URL was issued.
+func (s *Server) resolveDataRoomFile(userID string, fileID string, action models.FileAccessAction) (*protectedFile, error) {
+	var files []models.DataRoomFile
+	_, err := s.supabase.GetServiceClient().From("data_room_files").
+		Select("*", "", false).
+		Eq("id", fileID).
+		Is("deleted_at", "null").
+		ExecuteTo(&files)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errProtectedFileNotFound
+	}
+	file := files[0]
+
+	access, err := s.resolveDataRoomAccess(file.RoomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !access.canSeeFolder(file.FolderID) {
+		return nil, errProtectedFileNotFound
+	}
+	if action == models.FileAccessDownload && !access.isOwner && !access.grant.CanDownload {
+		return nil, errDownloadNotAllowed
+	}
+
+	return &protectedFile{
+		bucket:      dataRoomFilesBucket,
+		path:        file.FilePath,
+		fileName:    file.FileName,
+		contentType: file.ContentType,
+		record: func(r *http.Request, userID string, action models.FileAccessAction) (string, error) {
+			logID, err := s.recordDataRoomAccess(r, file, userID, action)
+			if err != nil {
+				return "", err
+			}
+			return dataRoomTracePrefix + strconv.FormatInt(logID, 10), nil
+		},
+	}, nil
+}
+
+// ListDataRoomGrants lists the buyers granted access (author only)
+// GET /api/data-rooms/:id/grants
+func (s *Server) ListDataRoomGrants(w http.ResponseWriter, r *http.Request, roomID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	if _, ok := s.requireDataRoomOwner(w, "ListDataRoomGrants", roomID, userID); !ok {
+		return
+	}
+
+	grants, err := s.fetchDataRoomGrants(roomID)
+	if err != nil {
+		log.Printf("[ListDataRoomGrants] Failed to query grants of %s: %v", roomID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query grants")
+		return
+	}
+
+	response.Success(w, http.StatusOK, grants)
+}
+
+// UpsertDataRoomGrant grants a buyer access to the room or some folders, or updates the grant (author only).
+// The buyer must hold a signed NDA covering the post.
+// POST /api/data-rooms/:id/grants
+func (s *Server) UpsertDataRoomGrant(w http.ResponseWriter, r *http.Request, roomID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.UpsertDataRoomGrantRequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	access, ok := s.requireDataRoomOwner(w, "UpsertDataRoomGrant", roomID, userID)
+	if !ok {
+		return
+	}
+	if req.BuyerUserID == userID {
+		response.Error(w, http.StatusBadRequest, "You cannot grant access to yourself")
+		return
+	}
+	for _, folderID := range req.FolderIDs {
+		if !dataRoomHasFolder(access.folders, folderID) {
+			response.Error(w, http.StatusBadRequest, "Folder not found in this data room")
+			return
+		}
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	covered, err := s.checkNDAAgreement(serviceClient, req.BuyerUserID, access.post.AuthorUserID, access.post.AuthorOrgID, access.post.ID)
+	if err != nil {
+		log.Printf("[UpsertDataRoomGrant] Failed to check NDA for buyer %s: %v", req.BuyerUserID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to check NDA")
+		return
+	}
+	if !covered {
+		response.Error(w, http.StatusConflict, "The buyer has not signed an NDA covering this listing")
+		return
+	}
+
+	var folderIDs []string
+	if len(req.FolderIDs) > 0 {
+		folderIDs = req.FolderIDs
+	}
+	now := time.Now().UTC()
+	row := map[string]interface{}{
+		"room_id":       roomID,
+		"buyer_user_id": req.BuyerUserID,
+		"folder_ids":    folderIDs,
+		"can_download":  req.CanDownload,
+		"expires_at":    req.ExpiresAt,
+		"granted_by":    userID,
+		"revoked_at":    nil,
+		"revoked_by":    nil,
+		"updated_at":    now,
+	}
+	var grants []models.DataRoomGrant
+	_, err = serviceClient.From("data_room_grants").
+		Upsert(row, "room_id,buyer_user_id", "", "").
+		ExecuteTo(&grants)
+	if err != nil || len(grants) == 0 {
+		log.Printf("[UpsertDataRoomGrant] Failed to save grant: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to save grant")
+		return
+	}
+	grant := grants[0]
+
+	link := fmt.Sprintf("/data-rooms/%s", roomID)
+	body := access.room.Title
+	resourceType := "data_room"
+	s.createNotifications([]notificationInsert{{
+		UserID:       req.BuyerUserID,
+		Type:         models.NotificationTypeDataRoomGranted,
+		Title:        "データルームの閲覧が許可されました",
+		Body:         &body,
+		Link:         &link,
+		ActorUserID:  &userID,
+		ResourceType: &resourceType,
+		ResourceID:   &roomID,
+		Data: map[string]interface{}{
+			"post_id":      access.post.ID,
+			"can_download": grant.CanDownload,
+			"expires_at":   grant.ExpiresAt,
+		},
+	}})
+
+	log.Printf("[UpsertDataRoomGrant] ✓ Granted buyer %s access to data room %s", req.BuyerUserID, roomID)
+	response.Success(w, http.StatusOK, grant)
+}
+
+// RevokeDataRoomGrant revokes the access of a buyer (author only)
+// DELETE /api/data-rooms/:id/grants/:buyerUserId
+func (s *Server) RevokeDataRoomGrant(w http.ResponseWriter, r *http.Request, roomID string, buyerUserID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	if _, ok := s.requireDataRoomOwner(w, "RevokeDataRoomGrant", roomID, userID); !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	var updated []models.DataRoomGrant
+	_, err := s.supabase.GetServiceClient().From("data_room_grants").
+		Update(map[string]interface{}{
+			"revoked_at": now,
+			"revoked_by": userID,
+			"updated_at": now,
+		}, "", "").
+		Eq("room_id", roomID).
+		Eq("buyer_user_id", buyerUserID).
+		Is("revoked_at", "null").
+		ExecuteTo(&updated)
+	if err != nil {
+		log.Printf("[RevokeDataRoomGrant] Failed to revoke grant: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to revoke grant")
+		return
+	}
+	if len(updated) == 0 {
+		response.Error(w, http.StatusNotFound, "Grant not found")
+		return
+	}
+
+	log.Printf("[RevokeDataRoomGrant] ✓ Revoked access of buyer %s to data room %s", buyerUserID, roomID)
+	response.Success(w, http.StatusOK, updated[0])
+}
+
+// GetDataRoomAccessReport returns views and downloads per buyer and file (author only)
+// GET /api/data-rooms/:id/report
+func (s *Server) GetDataRoomAccessReport(w http.ResponseWriter, r *http.Request, roomID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	if _, ok := s.requireDataRoomOwner(w, "GetDataRoomAccessReport", roomID, userID); !ok {
+		return
+	}
+
+	var rows []struct {
+		UserID          *string   `json:"user_id"`
+		FileID          string    `json:"file_id"`
+		Views           int64     `json:"views"`
+		Downloads       int64     `json:"downloads"`
+		FirstAccessedAt time.Time `json:"first_accessed_at"`
+		LastAccessedAt  time.Time `json:"last_accessed_at"`
+	}
+	if err := s.supabase.CallRPC("get_data_room_access_report", map[string]interface{}{"p_room_id": roomID}, &rows); err != nil {
+		log.Printf("[GetDataRoomAccessReport] Failed to aggregate access logs of %s: %v", roomID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to build access report")
+		return
+	}
+
+	grants, err := s.fetchDataRoomGrants(roomID)
+	if err != nil {
+		log.Printf("[GetDataRoomAccessReport] Failed to query grants of %s: %v", roomID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query grants")
+		return
+	}
+
+	// 削除済みのファイルもレポートには名前を出す
+	var files []models.DataRoomFile
+	_, err = s.supabase.GetServiceClient().From("data_room_files").
+		Select("id, file_name", "", false).
+		Eq("room_id", roomID).
+		ExecuteTo(&files)
+	if err != nil {
+		log.Printf("[GetDataRoomAccessReport] ⚠️ Failed to query file names of %s: %v", roomID, err)
+	}
+	fileNames := make(map[string]string, len(files))
+	for _, f := range files {
+		fileNames[f.ID] = f.FileName
+	}
+
+	reports := make(map[string]*models.DataRoomBuyerReport)
+	order := make([]string, 0, len(grants))
+	for i := range grants {
+		reports[grants[i].BuyerUserID] = &models.DataRoomBuyerReport{
+			UserID:      grants[i].BuyerUserID,
+			DisplayName: grants[i].BuyerDisplayName,
+			Grant:       &grants[i],
+			Files:       []models.DataRoomFileAccess{},
+		}
+		order = append(order, grants[i].BuyerUserID)
+	}
+	for _, row := range rows {
+		// 売り手自身の閲覧はレポートに含めない
+		if row.UserID == nil || *row.UserID == userID {
+			continue
+		}
+		report, exists := reports[*row.UserID]
+		if !exists {
+			report = &models.DataRoomBuyerReport{UserID: *row.UserID, Files: []models.DataRoomFileAccess{}}
+			reports[*row.UserID] = report
+			order = append(order, *row.UserID)
+		}
+		report.Files = append(report.Files, models.DataRoomFileAccess{
+			FileID:          row.FileID,
+			FileName:        fileNames[row.FileID],
+			Views:           row.Views,
+			Downloads:       row.Downloads,
+			FirstAccessedAt: row.FirstAccessedAt,
+			LastAccessedAt:  row.LastAccessedAt,
+		})
+		report.Views += row.Views
+		report.Downloads += row.Downloads
+		report.FilesAccessed++
+		if report.LastAccessedAt == nil || row.LastAccessedAt.After(*report.LastAccessedAt) {
+			last := row.LastAccessedAt
+			report.LastAccessedAt = &last
+		}
+	}
+
+	// 付与が取り消された買い手は表示名を個別に補う
+	missing := make([]string, 0)
+	for _, id := range order {
+		if reports[id].DisplayName == "" {
+			missing = append(missing, id)
+		}
+	}
+	names := s.fetchDisplayNames(s.supabase.GetServiceClient(), missing...)
+
+	result := make([]models.DataRoomBuyerReport, 0, len(order))
+	for _, id := range order {
+		report := reports[id]
+		if report.DisplayName == "" {
+			report.DisplayName = names[id]
+		}
+		sort.Slice(report.Files, func(i, j int) bool {
+			return report.Files[i].LastAccessedAt.After(report.Files[j].LastAccessedAt)
+		})
+		result = append(result, *report)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i].LastAccessedAt, result[j].LastAccessedAt
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.After(*b)
+	})
+
+	response.Success(w, http.StatusOK, result)
+}
+
+// ListDataRoomAccessLogs returns the raw access log (author only)
+// GET /api/data-rooms/:id/logs?user_id=&file_id=&limit=&offset=
+func (s *Server) ListDataRoomAccessLogs(w http.ResponseWriter, r *http.Request, roomID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	if _, ok := s.requireDataRoomOwner(w, "ListDataRoomAccessLogs", roomID, userID); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultDataRoomLogLimit
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 {
+		limit = min(v, maxDataRoomLogLimit)
+	}
+	offset := 0
+	if v, err := strconv.Atoi(query.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+
+	builder := s.supabase.GetServiceClient().From("data_room_access_logs").
+		Select("*", "", false).
+		Eq("room_id", roomID)
+	if v := query.Get("user_id"); v != "" {
+		builder = builder.Eq("user_id", v)
+	}
+	if v := query.Get("file_id"); v != "" {
+		builder = builder.Eq("file_id", v)
+	}
+
+	var logs []models.DataRoomAccessLog
+	_, err := builder.
+		Order("created_at", nil).
+		Range(offset, offset+limit-1, "").
+		ExecuteTo(&logs)
+	if err != nil {
+		log.Printf("[ListDataRoomAccessLogs] Failed to query access logs of %s: %v", roomID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query access logs")
+		return
+	}
+	if logs == nil {
+		logs = []models.DataRoomAccessLog{}
+	}
+
+	response.Success(w, http.StatusOK, logs)
+}
+
+// resolveDataRoomAccess checks that the user is the author of the post, or a buyer with an active grant
+// and a signed NDA covering the post.
+// 🔒 SECURITY: データルームの各テーブルにはRLSポリシーがないため、すべての参照はここを通してから行う
+func (s *Server) resolveDataRoomAccess(roomID string, userID string) (*dataRoomAccess, error) {
+	serviceClient := s.supabase.GetServiceClient()
+
+	var rooms []models.DataRoom
+	_, err := serviceClient.From("data_rooms").
+		Select("*", "", false).
+		Eq("id", roomID).
+		ExecuteTo(&rooms)
+	if err != nil {
+		return nil, err
+	}
+	if len(rooms) == 0 {
+		return nil, errDataRoomNotFound
+	}
+
+	post, err := s.fetchPostForRevenueVerification(serviceClient, rooms[0].PostID)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, errDataRoomNotFound
+	}
+
+	access := &dataRoomAccess{room: rooms[0], post: *post, isOwner: post.AuthorUserID == userID}
+	if !access.isOwner {
+		var grants []models.DataRoomGrant
+		_, err = serviceClient.From("data_room_grants").
+			Select("*", "", false).
+			Eq("room_id", roomID).
+			Eq("buyer_user_id", userID).
+			ExecuteTo(&grants)
+		if err != nil {
+			return nil, err
+		}
+		if len(grants) == 0 || !grants[0].Active(time.Now()) {
+			return nil, errDataRoomNoGrant
+		}
+		access.grant = &grants[0]
+
+		// NDAの失効・期限切れは付与の有無にかかわらず即時に反映する
+		covered, err := s.checkNDAAgreement(serviceClient, userID, post.AuthorUserID, post.AuthorOrgID, post.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !covered {
+			return nil, errDataRoomNDARequired
+		}
+	}
+
+	_, err = serviceClient.From("data_room_folders").
+		Select("*", "", false).
+		Eq("room_id", roomID).
+		ExecuteTo(&access.folders)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(access.folders, func(i, j int) bool { return access.folders[i].Name < access.folders[j].Name })
+
+	if access.grant != nil && access.grant.FolderIDs != nil {
+		access.allowedFolders = dataRoomFolderClosure(access.folders, access.grant.FolderIDs)
+	}
+	return access, nil
+}
+
+// handleDataRoomAccessError writes the response for an error from resolveDataRoomAccess.
+// Returns true if an error was handled.
+func (s *Server) handleDataRoomAccessError(w http.ResponseWriter, handler string, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errDataRoomNotFound):
+		response.Error(w, http.StatusNotFound, "Data room not found")
+	case errors.Is(err, errDataRoomNoGrant):
+		response.Error(w, http.StatusForbidden, "You do not have access to this data room")
+	case errors.Is(err, errDataRoomNDARequired):
+		response.Error(w, http.StatusForbidden, "A signed NDA is required to access this data room")
+	default:
+		log.Printf("[%s] Failed to resolve data room access: %v", handler, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to verify data room access")
+	}
+	return true
+}
+
+// requireDataRoomOwner resolves the access and rejects users other than the author of the post
+func (s *Server) requireDataRoomOwner(w http.ResponseWriter, handler string, roomID string, userID string) (*dataRoomAccess, bool) {
+	access, err := s.resolveDataRoomAccess(roomID, userID)
+	if s.handleDataRoomAccessError(w, handler, err) {
+		return nil, false
+	}
+	if !access.isOwner {
+		log.Printf("[%s] ❌ User %s is not the owner of data room %s", handler, userID, roomID)
+		response.Error(w, http.StatusForbidden, "Only the author can manage this data room")
+		return nil, false
+	}
+	return access, true
+}
+
+// fetchDataRoomFiles returns the files of the room that have not been deleted
+func (s *Server) fetchDataRoomFiles(roomID string) ([]models.DataRoomFile, error) {
+	var files []models.DataRoomFile
+	_, err := s.supabase.GetServiceClient().From("data_room_files").
+		Select("*", "", false).
+		Eq("room_id", roomID).
+		Is("deleted_at", "null").
+		Order("created_at", nil).
+		ExecuteTo(&files)
+	return files, err
+}
+
+// fetchDataRoomFile returns nil when the file does not exist in the room or has been deleted
+func (s *Server) fetchDataRoomFile(roomID string, fileID string) (*models.DataRoomFile, error) {
+	var files []models.DataRoomFile
+	_, err := s.supabase.GetServiceClient().From("data_room_files").
+		Select("*", "", false).
+		Eq("id", fileID).
+		Eq("room_id", roomID).
+		Is("deleted_at", "null").
+		ExecuteTo(&files)
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+// fetchDataRoomGrants returns the grants of the room with the buyer display names
+func (s *Server) fetchDataRoomGrants(roomID string) ([]models.DataRoomGrant, error) {
+	serviceClient := s.supabase.GetServiceClient()
+	var grants []models.DataRoomGrant
+	_, err := serviceClient.From("data_room_grants").
+		Select("*", "", false).
+		Eq("room_id", roomID).
+		Order("created_at", nil).
+		ExecuteTo(&grants)
+	if err != nil {
+		return nil, err
+	}
+
+	buyerIDs := make([]string, 0, len(grants))
+	for _, g := range grants {
+		buyerIDs = append(buyerIDs, g.BuyerUserID)
+	}
+	names := s.fetchDisplayNames(serviceClient, buyerIDs...)
+	for i := range grants {
+		grants[i].BuyerDisplayName = names[grants[i].BuyerUserID]
+	}
+	if grants == nil {
+		grants = []models.DataRoomGrant{}
+	}
+	return grants, nil
+}
+
+// recordDataRoomAccess inserts an access log row and returns its ID
+func (s *Server) recordDataRoomAccess(r *http.Request, file models.DataRoomFile, userID string, action models.FileAccessAction) (int64, error) {
+	row := map[string]interface{}{
+		"room_id":    file.RoomID,
+		"file_id":    file.ID,
+		"user_id":    userID,
+		"action":     action,
+		"ip_address": utils.ClientIP(r),
+	}
+	if ua := r.UserAgent(); ua != "" {
+		row["user_agent"] = ua
+	}
+
+	var inserted []models.DataRoomAccessLog
+	_, err := s.supabase.GetServiceClient().From("data_room_access_logs").
+		Insert(row, false, "", "", "").
+		ExecuteTo(&inserted)
+	if err != nil {
+		return 0, err
+	}
+	if len(inserted) == 0 {
+		return 0, fmt.Errorf("access log was not returned")
+	}
+	return inserted[0].ID, nil
+}
+
+func dataRoomHasFolder(folders []models.DataRoomFolder, folderID string) bool {
+	for _, f := range folders {
+		if f.ID == folderID {
+			return true
+		}
+	}
+	return false
+}
+
+// dataRoomFolderClosure returns the granted folders and all of their subfolders
+func dataRoomFolderClosure(folders []models.DataRoomFolder, granted []string) map[string]bool {
+	children := make(map[string][]string)
+	for _, f := range folders {
+		if f.ParentID != nil {
+			children[*f.ParentID] = append(children[*f.ParentID], f.ID)
+		}
+	}
+
+	allowed := make(map[string]bool)
+	queue := append([]string(nil), granted...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if allowed[id] {
+			continue
+		}
+		allowed[id] = true
+		queue = append(queue, children[id]...)
+	}
+	return allowed
+}
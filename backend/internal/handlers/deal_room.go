@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const threadSelectColumns = "id, created_by, related_post_id, thread_type, merged_into, last_activity_at, created_at"
+
+// threadParticipantKey is the deduplication key of a thread: the sorted, unique participant IDs
+func threadParticipantKey(userIDs []string) string {
+	seen := make(map[string]bool, len(userIDs))
+	ids := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// threadFromRow converts a threads row to the API model
+func threadFromRow(row threadRow) models.Thread {
+	thread := models.Thread{
+		ID:             row.ID,
+		CreatedBy:      row.CreatedBy,
+		RelatedPostID:  row.RelatedPostID,
+		ThreadType:     models.ThreadType(row.ThreadType),
+		MergedInto:     row.MergedInto,
+		LastActivityAt: parseOptionalTime(row.LastActivityAt),
+		CreatedAt:      parseTime(row.CreatedAt),
+	}
+	if thread.ThreadType == "" {
+		thread.ThreadType = models.ThreadTypeInquiry
+		if row.RelatedPostID != nil {
+			thread.ThreadType = models.ThreadTypeDealRoom
+		}
+	}
+	return thread
+}
+
+// getOrCreateThread returns the thread between the participants about the related post, creating it if needed.
+// 案件を指定したスレッドはその案件の商談スレッド（deal room）、指定なしは一般の問い合わせになる。
+// Returns created=false when an existing thread was returned.
+func (s *Server) getOrCreateThread(client *supabase.Client, creatorID string, participantIDs []string, relatedPostID *string) (models.Thread, bool, error) {
+	members := append(append([]string{}, participantIDs...), creatorID)
+	key := threadParticipantKey(members)
+
+	if existing, err := s.findThreadByKey(client, key, relatedPostID); err != nil || existing != nil {
+		if err != nil {
+			return models.Thread{}, false, err
+		}
+		return *existing, false, nil
+	}
+
+	var created []threadRow
+	_, err := client.From("threads").
+		Insert(threadInsert{CreatedBy: creatorID, RelatedPostID: relatedPostID, ParticipantKey: key}, false, "", "", "").
+		ExecuteTo(&created)
+	if err != nil {
+		// 同時に作成された場合は一意制約で弾かれるため、作成済みのスレッドを返す
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "23505") {
+			existing, findErr := s.findThreadByKey(client, key, relatedPostID)
+			if findErr == nil && existing != nil {
+				return *existing, false, nil
+			}
+		}
+		return models.Thread{}, false, err
+	}
+	if len(created) == 0 {
+		return models.Thread{}, false, fmt.Errorf("thread was not created")
+	}
+
+	inserts := make([]participantInsert, 0, len(members))
+	for _, id := range strings.Split(key, ",") {
+		inserts = append(inserts, participantInsert{ThreadID: created[0].ID, UserID: id})
+	}
+	_, _, err = client.From("thread_participants").
+		Insert(inserts, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		return models.Thread{}, false, fmt.Errorf("failed to add participants: %w", err)
+	}
+
+	return threadFromRow(created[0]), true, nil
+}
+
+// findThreadByKey returns the open (not merged) thread with the participant key and related post
+func (s *Server) findThreadByKey(client *supabase.Client, key string, relatedPostID *string) (*models.Thread, error) {
+	query := client.From("threads").
+		Select(threadSelectColumns, "", false).
+		Eq("participant_key", key).
+		Is("merged_into", "null")
+	if relatedPostID != nil {
+		query = query.Eq("related_post_id", *relatedPostID)
+	} else {
+		query = query.Is("related_post_id", "null")
+	}
+
+	var rows []threadRow
+	if _, err := query.Limit(1, "").ExecuteTo(&rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	thread := threadFromRow(rows[0])
+	return &thread, nil
+}
+
+// MergeThread merges a duplicate thread into another thread (operators only).
+// Messages, contracts, sale requests, NDAs and participants move to the target; the source keeps
+// merged_into so that old links can be redirected.
+// POST /api/threads/:id/merge
+func (s *Server) MergeThread(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodPost) {
+		return
+	}
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	targetID := strings.TrimPrefix(r.URL.Path, "/api/threads/")
+	targetID = strings.Trim(strings.TrimSuffix(targetID, "/merge"), "/")
+
+	var req models.MergeThreadRequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+	if targetID == "" || req.SourceThreadID == targetID {
+		response.Error(w, http.StatusBadRequest, "A different source thread is required")
+		return
+	}
+
+	if !s.isOperator(s.supabase.GetAuthenticatedClient(accessToken), userID) {
+		log.Printf("[MergeThread] ❌ User %s is not an operator", userID)
+		response.Error(w, http.StatusForbidden, "Only operators can merge threads")
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	var rows []threadRow
+	_, err := serviceClient.From("threads").
+		Select(threadSelectColumns, "", false).
+		In("id", []string{targetID, req.SourceThreadID}).
+		ExecuteTo(&rows)
+	if err != nil {
+		log.Printf("[MergeThread] Failed to query threads: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query threads")
+		return
+	}
+	var target, source *threadRow
+	for i := range rows {
+		switch rows[i].ID {
+		case targetID:
+			target = &rows[i]
+		case req.SourceThreadID:
+			source = &rows[i]
+		}
+	}
+	if target == nil || source == nil {
+		response.Error(w, http.StatusNotFound, "Thread not found")
+		return
+	}
+	if target.MergedInto != nil || source.MergedInto != nil {
+		response.Error(w, http.StatusConflict, "The thread has already been merged")
+		return
+	}
+	// 別の案件の商談スレッド同士は統合しない（NDA・売却リクエストの対象が混ざるため）
+	if ndaStringValue(target.RelatedPostID) != ndaStringValue(source.RelatedPostID) {
+		response.Error(w, http.StatusBadRequest, "Only threads about the same listing can be merged")
+		return
+	}
+
+	if err := s.supabase.CallRPC("merge_threads", map[string]interface{}{
+		"p_source_id": source.ID,
+		"p_target_id": target.ID,
+	}, nil); err != nil {
+		log.Printf("[MergeThread] ❌ Failed to merge %s into %s: %v", source.ID, target.ID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to merge threads")
+		return
+	}
+
+	merged := threadFromRow(*target)
+	log.Printf("[MergeThread] ✓ Merged thread %s into %s (by %s)", source.ID, target.ID, userID)
+	response.Success(w, http.StatusOK, merged)
+}
+
+// GetDealRoomState returns the NDA, contract and sale request state of a deal room
+// GET /api/threads/:id/deal
+func (s *Server) GetDealRoomState(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodGet) {
+		return
+	}
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	threadID := strings.TrimPrefix(r.URL.Path, "/api/threads/")
+	threadID = strings.Trim(strings.TrimSuffix(threadID, "/deal"), "/")
+
+	serviceClient := s.supabase.GetServiceClient()
+	participantIDs, err := s.threadParticipantIDs(serviceClient, threadID)
+	if err != nil {
+		log.Printf("[GetDealRoomState] Failed to query participants of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query thread")
+		return
+	}
+	if !containsString(participantIDs, userID) {
+		response.Error(w, http.StatusForbidden, "You are not a participant of this thread")
+		return
+	}
+
+	var rows []threadRow
+	_, err = serviceClient.From("threads").
+		Select(threadSelectColumns, "", false).
+		Eq("id", threadID).
+		ExecuteTo(&rows)
+	if err != nil || len(rows) == 0 {
+		log.Printf("[GetDealRoomState] Failed to query thread %s: %v", threadID, err)
+		response.Error(w, http.StatusNotFound, "Thread not found")
+		return
+	}
+	thread := threadFromRow(rows[0])
+	if thread.ThreadType != models.ThreadTypeDealRoom || thread.RelatedPostID == nil {
+		response.Error(w, http.StatusBadRequest, "This thread is not a deal room")
+		return
+	}
+
+	state, err := s.fetchDealRoomState(serviceClient, thread)
+	if err != nil {
+		log.Printf("[GetDealRoomState] Failed to build state of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch deal state")
+		return
+	}
+	response.Success(w, http.StatusOK, state)
+}
+
+// fetchDealRoomState collects the latest NDA, contract documents and sale request of a deal room
+func (s *Server) fetchDealRoomState(client *supabase.Client, thread models.Thread) (*models.DealRoomState, error) {
+	state := &models.DealRoomState{
+		ThreadID:  thread.ID,
+		PostID:    *thread.RelatedPostID,
+		Documents: make(map[string]*models.DealRoomDocument),
+	}
+
+	var ndas []models.NDAAgreement
+	_, err := client.From("nda_agreements").
+		Select("*", "", false).
+		Eq("thread_id", thread.ID).
+		Order("created_at", nil).
+		Limit(1, "").
+		ExecuteTo(&ndas)
+	if err != nil {
+		return nil, err
+	}
+	if len(ndas) > 0 {
+		state.NDA = &ndas[0]
+	}
+
+	var docs []struct {
+		ID           string `json:"id"`
+		ContractType string `json:"contract_type"`
+		FileName     string `json:"file_name"`
+		UploadedBy   string `json:"uploaded_by"`
+		CreatedAt    string `json:"created_at"`
+	}
+	_, err = client.From("thread_contract_documents").
+		Select("id, contract_type, file_name, uploaded_by, created_at", "", false).
+		Eq("thread_id", thread.ID).
+		Order("created_at", nil).
+		ExecuteTo(&docs)
+	if err != nil {
+		return nil, err
+	}
+	docIDs := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		// 新しい順に並んでいるため、種別ごとに最初の1件が最新
+		if _, exists := state.Documents[doc.ContractType]; exists {
+			continue
+		}
+		state.Documents[doc.ContractType] = &models.DealRoomDocument{
+			ID:           doc.ID,
+			ContractType: doc.ContractType,
+			FileName:     doc.FileName,
+			UploadedBy:   doc.UploadedBy,
+			CreatedAt:    parseTime(doc.CreatedAt),
+		}
+		docIDs = append(docIDs, doc.ID)
+	}
+	if len(docIDs) > 0 {
+		var signatures []struct {
+			ContractID string `json:"contract_id"`
+		}
+		_, err = client.From("contract_signatures").
+			Select("contract_id", "", false).
+			In("contract_id", docIDs).
+			ExecuteTo(&signatures)
+		if err != nil {
+			return nil, err
+		}
+		for _, sig := range signatures {
+			for _, doc := range state.Documents {
+				if doc.ID == sig.ContractID {
+					doc.SignatureCount++
+				}
+			}
+		}
+	}
+
+	var saleRequests []models.SaleRequest
+	_, err = client.From("sale_requests").
+		Select("*", "", false).
+		Eq("thread_id", thread.ID).
+		Eq("post_id", *thread.RelatedPostID).
+		Order("created_at", nil).
+		Limit(1, "").
+		ExecuteTo(&saleRequests)
+	if err != nil {
+		return nil, err
+	}
+	if len(saleRequests) > 0 {
+		state.SaleRequest = &saleRequests[0]
+	}
+
+	state.Stage = dealStage(state)
+	return state, nil
+}
+
+// dealStage derives the stage from the furthest step reached
+func dealStage(state *models.DealRoomState) models.DealStage {
+	if sr := state.SaleRequest; sr != nil {
+		switch sr.Status {
+		case models.SaleRequestStatusCompleted:
+			return models.DealStageCompleted
+		case models.SaleRequestStatusCancelled:
+			return models.DealStageCancelled
+		case models.SaleRequestStatusActive:
+			if state.Documents[string(models.ContractTypeHandover)] != nil {
+				return models.DealStageHandover
+			}
+			return models.DealStageClosing
+		default:
+			return models.DealStageSaleRequested
+		}
+	}
+	if state.Documents[string(models.ContractTypeLOI)] != nil {
+		return models.DealStageLOI
+	}
+	if state.NDA != nil {
+		switch state.NDA.Status {
+		case models.NDAStatusSigned:
+			return models.DealStageDueDiligence
+		case models.NDAStatusRequested, models.NDAStatusApproved:
+			return models.DealStageNDA
+		}
+	}
+	return models.DealStageInquiry
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	emailOutboxBatchSize = 50
+	maxEmailAttempts     = 8
+	// 送信中に再起動した場合など、sending のまま残ったメールを送信待ちに戻すまでの時間
+	emailSendingTimeout = 10 * time.Minute
+	// 最後のメッセージからこの時間が経っても未読ならダイジェストを送る
+	messageDigestDelay            = 30 * time.Minute
+	maxMessageDigestNotifications = 500
+)
+
+// emailRetryDelays is the wait before each retry (the last one is repeated)
+var emailRetryDelays = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 3 * time.Hour, 6 * time.Hour}
+
+// enqueueEmail renders an email for a user and adds it to the outbox.
+// Skipped when email is not configured, the user turned off email for the notification type,
+// or the address bounced. 失敗しても本処理は失敗させない（ログのみ）
+// 🔒 SECURITY: 宛先はクライアントから受け取らず、Supabase Auth の登録アドレスを使う
+func (s *Server) enqueueEmail(userID string, notificationType models.NotificationType, template models.EmailTemplate, link string, fields map[string]interface{}) {
+	if !s.config.EmailEnabled() || userID == "" {
+		return
+	}
+	serviceClient := s.supabase.GetServiceClient()
+
+	var disabled []struct {
+		Type string `json:"type"`
+	}
+	_, err := serviceClient.From("notification_preferences").
+		Select("type", "", false).
+		Eq("user_id", userID).
+		Eq("type", string(notificationType)).
+		Eq("email", "false").
+		ExecuteTo(&disabled)
+	if err != nil {
+		log.Printf("[enqueueEmail] ⚠️ Failed to query email preference of %s: %v", userID, err)
+	}
+	if len(disabled) > 0 {
+		return
+	}
+
+	address, err := s.supabase.GetUserEmail(userID)
+	if err != nil {
+		log.Printf("[enqueueEmail] ⚠️ Failed to get email address of %s: %v", userID, err)
+		return
+	}
+	address = strings.ToLower(strings.TrimSpace(address))
+	if address == "" {
+		return
+	}
+	if s.emailSuppressed(serviceClient, address) {
+		log.Printf("[enqueueEmail] Skipping %s email to %s: address is suppressed", template, userID)
+		return
+	}
+
+	var profiles []struct {
+		DisplayName       string `json:"display_name"`
+		PreferredLanguage string `json:"preferred_language"`
+	}
+	_, err = serviceClient.From("profiles").
+		Select("display_name, preferred_language", "", false).
+		Eq("id", userID).
+		ExecuteTo(&profiles)
+	if err != nil {
+		log.Printf("[enqueueEmail] ⚠️ Failed to query profile of %s: %v", userID, err)
+	}
+	appURL := strings.TrimRight(s.config.FrontendURL, "/")
+	data := services.EmailTemplateData{
+		AppURL: appURL,
+		Link:   appURL + link, // リンクがない場合はサイトのトップ
+		Fields: fields,
+	}
+	language := ""
+	if len(profiles) > 0 {
+		data.RecipientName = profiles[0].DisplayName
+		language = profiles[0].PreferredLanguage
+	}
+
+	language, subject, body, err := services.RenderEmail(template, language, data)
+	if err != nil {
+		log.Printf("[enqueueEmail] ❌ Failed to render %s email for %s: %v", template, userID, err)
+		return
+	}
+
+	_, _, err = serviceClient.From("email_outbox").
+		Insert(map[string]interface{}{
+			"user_id":    userID,
+			"to_address": address,
+			"template":   template,
+			"language":   language,
+			"subject":    subject,
+			"body":       body,
+		}, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		log.Printf("[enqueueEmail] ❌ Failed to queue %s email for %s: %v", template, userID, err)
+		return
+	}
+	log.Printf("[enqueueEmail] ✓ Queued %s email (%s) for %s", template, language, userID)
+}
+
+// emailSuppressed reports whether an address is on the suppression list
+func (s *Server) emailSuppressed(client *supabase.Client, address string) bool {
+	var rows []struct {
+		Address string `json:"address"`
+	}
+	_, err := client.From("email_suppressions").
+		Select("address", "", false).
+		Eq("address", address).
+		ExecuteTo(&rows)
+	if err != nil {
+		// 確認できない場合は送信する（SMTPで拒否されれば改めて登録される）
+		log.Printf("[emailSuppressed] ⚠️ Failed to query suppression of %s: %v", address, err)
+		return false
+	}
+	return len(rows) > 0
+}
+
+// suppressEmailAddress stops all email to an address and skips the messages still waiting for it
+func (s *Server) suppressEmailAddress(client *supabase.Client, address, reason string) {
+	_, _, err := client.From("email_suppressions").
+		Upsert(map[string]interface{}{"address": address, "reason": reason}, "address", "", "").
+		Execute()
+	if err != nil {
+		log.Printf("[suppressEmailAddress] ❌ Failed to suppress %s: %v", address, err)
+		return
+	}
+	_, _, err = client.From("email_outbox").
+		Update(map[string]interface{}{
+			"status":     models.EmailStatusSkipped,
+			"last_error": "address suppressed: " + reason,
+			"updated_at": time.Now().UTC().Format(time.RFC3339),
+		}, "", "").
+		Eq("to_address", address).
+		Eq("status", string(models.EmailStatusPending)).
+		Execute()
+	if err != nil {
+		log.Printf("[suppressEmailAddress] ⚠️ Failed to skip pending emails to %s: %v", address, err)
+	}
+	log.Printf("[suppressEmailAddress] ✓ %s suppressed (%s)", address, reason)
+}
+
+// deliverEmailOutbox sends the due messages of the outbox.
+// 複数インスタンスで動いても、pending → sending の条件付き更新で1通ずつ担当を決める
+func (s *Server) deliverEmailOutbox() {
+	serviceClient := s.supabase.GetServiceClient()
+	now := time.Now().UTC()
+
+	_, _, err := serviceClient.From("email_outbox").
+		Update(map[string]interface{}{
+			"status":     models.EmailStatusPending,
+			"updated_at": now.Format(time.RFC3339),
+		}, "", "").
+		Eq("status", string(models.EmailStatusSending)).
+		Lt("updated_at", now.Add(-emailSendingTimeout).Format(time.RFC3339)).
+		Execute()
+	if err != nil {
+		log.Printf("[deliverEmailOutbox] ⚠️ Failed to release stale messages: %v", err)
+	}
+
+	var due []models.EmailOutboxMessage
+	_, err = serviceClient.From("email_outbox").
+		Select("*", "", false).
+		Eq("status", string(models.EmailStatusPending)).
+		Lte("next_attempt_at", now.Format(time.RFC3339)).
+		Order("next_attempt_at", &postgrest.OrderOpts{Ascending: true}).
+		Limit(emailOutboxBatchSize, "").
+		ExecuteTo(&due)
+	if err != nil {
+		log.Printf("[deliverEmailOutbox] ⚠️ Failed to query due messages: %v", err)
+		return
+	}
+	for _, msg := range due {
+		s.deliverEmail(serviceClient, msg)
+	}
+}
+
+// deliverEmail sends one message and records the result
+func (s *Server) deliverEmail(client *supabase.Client, msg models.EmailOutboxMessage) {
+	var claimed []models.EmailOutboxMessage
+	_, err := client.From("email_outbox").
+		Update(map[string]interface{}{
+			"status":     models.EmailStatusSending,
+			"attempts":   msg.Attempts + 1,
+			"updated_at": time.Now().UTC().Format(time.RFC3339),
+		}, "", "").
+		Eq("id", msg.ID).
+		Eq("status", string(models.EmailStatusPending)).
+		ExecuteTo(&claimed)
+	if err != nil || len(claimed) == 0 {
+		if err != nil {
+			log.Printf("[deliverEmail] ⚠️ Failed to claim message %s: %v", msg.ID, err)
+		}
+		return
+	}
+	attempts := msg.Attempts + 1
+
+	update := map[string]interface{}{"updated_at": time.Now().UTC().Format(time.RFC3339)}
+	if s.emailSuppressed(client, msg.ToAddress) {
+		update["status"] = models.EmailStatusSkipped
+		update["last_error"] = "address suppressed"
+	} else {
+		err = s.mailer.Send(services.EmailMessage{
+			ID:      msg.ID,
+			From:    s.config.EmailFrom,
+			To:      msg.ToAddress,
+			Subject: msg.Subject,
+			Body:    msg.Body,
+		})
+		switch {
+		case err == nil:
+			update["status"] = models.EmailStatusSent
+			update["sent_at"] = time.Now().UTC().Format(time.RFC3339)
+			update["last_error"] = nil
+			log.Printf("[deliverEmail] ✓ Sent %s email %s", msg.Template, msg.ID)
+		case errors.Is(err, services.ErrEmailBounced):
+			update["status"] = models.EmailStatusBounced
+			update["last_error"] = err.Error()
+			log.Printf("[deliverEmail] ❌ %s email %s bounced: %v", msg.Template, msg.ID, err)
+			s.suppressEmailAddress(client, msg.ToAddress, err.Error())
+		case errors.Is(err, services.ErrEmailRejected) || attempts >= maxEmailAttempts:
+			update["status"] = models.EmailStatusFailed
+			update["last_error"] = err.Error()
+			log.Printf("[deliverEmail] ❌ Giving up %s email %s after %d attempts: %v", msg.Template, msg.ID, attempts, err)
+		default:
+			delay := emailRetryDelays[len(emailRetryDelays)-1]
+			if attempts <= len(emailRetryDelays) {
+				delay = emailRetryDelays[attempts-1]
+			}
+			update["status"] = models.EmailStatusPending
+			update["next_attempt_at"] = time.Now().UTC().Add(delay).Format(time.RFC3339)
+			update["last_error"] = err.Error()
+			log.Printf("[deliverEmail] ⚠️ Failed to send %s email %s (attempt %d, retry in %s): %v", msg.Template, msg.ID, attempts, delay, err)
+		}
+	}
+
+	_, _, err = client.From("email_outbox").
+		Update(update, "", "").
+		Eq("id", msg.ID).
+		Execute()
+	if err != nil {
+		log.Printf("[deliverEmail] ⚠️ Failed to record result of message %s: %v", msg.ID, err)
+	}
+}
+
+// runEmailOutboxWorker periodically sends the due messages of the outbox
+func (s *Server) runEmailOutboxWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.deliverEmailOutbox()
+		<-ticker.C
+	}
+}
+
+// messageDigestThread is one thread in the unread message digest
+type messageDigestThread struct {
+	SenderName string
+	Count      int
+	Link       string
+}
+
+// sendMessageDigests emails each user a digest of the message notifications left unread for a while.
+// 通知ごとに1通ずつ送らないよう、ユーザーごとにまとめて送る
+func (s *Server) sendMessageDigests() {
+	serviceClient := s.supabase.GetServiceClient()
+	var notifications []models.Notification
+	_, err := serviceClient.From("notifications").
+		Select("*", "", false).
+		Eq("type", string(models.NotificationTypeMessageReceived)).
+		Is("read_at", "null").
+		Is("emailed_at", "null").
+		Lte("created_at", time.Now().UTC().Add(-messageDigestDelay).Format(time.RFC3339)).
+		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+		Limit(maxMessageDigestNotifications, "").
+		ExecuteTo(&notifications)
+	if err != nil {
+		log.Printf("[sendMessageDigests] ⚠️ Failed to query unread message notifications: %v", err)
+		return
+	}
+	if len(notifications) == 0 {
+		return
+	}
+
+	byUser := make(map[string][]models.Notification)
+	var actorIDs []string
+	for _, n := range notifications {
+		byUser[n.UserID] = append(byUser[n.UserID], n)
+		if n.ActorUserID != nil && !containsString(actorIDs, *n.ActorUserID) {
+			actorIDs = append(actorIDs, *n.ActorUserID)
+		}
+	}
+	names := s.fetchDisplayNames(serviceClient, actorIDs...)
+	appURL := strings.TrimRight(s.config.FrontendURL, "/")
+
+	ids := make([]string, 0, len(notifications))
+	for userID, unread := range byUser {
+		threads := make([]messageDigestThread, 0, len(unread))
+		total := 0
+		for _, n := range unread {
+			ids = append(ids, n.ID)
+			count := 1
+			if v, ok := n.Data["count"].(float64); ok && v > 0 {
+				count = int(v)
+			}
+			thread := messageDigestThread{Count: count, Link: appURL + "/messages"}
+			if n.ActorUserID != nil {
+				thread.SenderName = names[*n.ActorUserID]
+			}
+			if n.ResourceID != nil {
+				thread.Link = appURL + "/messages/" + *n.ResourceID
+			}
+			threads = append(threads, thread)
+			total += count
+		}
+		s.enqueueEmail(userID, models.NotificationTypeMessageReceived, models.EmailTemplateMessageDigest, "/messages", map[string]interface{}{
+			"Threads": threads,
+			"Total":   total,
+		})
+	}
+
+	// メールを送らなかった通知（設定で無効など）も含めて記録し、繰り返し対象にしない
+	_, _, err = serviceClient.From("notifications").
+		Update(map[string]interface{}{"emailed_at": time.Now().UTC().Format(time.RFC3339)}, "", "").
+		In("id", ids).
+		Execute()
+	if err != nil {
+		log.Printf("[sendMessageDigests] ⚠️ Failed to mark %d notifications as emailed: %v", len(ids), err)
+		return
+	}
+	log.Printf("[sendMessageDigests] ✓ Processed %d unread message notifications of %d users", len(ids), len(byUser))
+}
+
+// runMessageDigestWorker periodically sends unread message digests
+func (s *Server) runMessageDigestWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.sendMessageDigests()
+		<-ticker.C
+	}
+}
+
+// HandleEmailBounce records a bounce reported by the mail provider
+// POST /api/email/bounces (header X-Bounce-Secret: EMAIL_BOUNCE_WEBHOOK_SECRET)
+func (s *Server) HandleEmailBounce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	// 🔒 SECURITY: シークレット未設定の場合は受け付けない（誰でも配信停止できてしまうため）
+	secret := s.config.EmailBounceSecret
+	if secret == "" {
+		response.Error(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Bounce-Secret")), []byte(secret)) != 1 {
+		log.Printf("[HandleEmailBounce] ❌ Invalid secret from %s", utils.ClientIP(r))
+		response.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.EmailBounceRequest
+	if !utils.DecodeJSONBody(r, w, &req) {
+		return
+	}
+	address := strings.ToLower(strings.TrimSpace(req.Email))
+	if address == "" {
+		response.Error(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	// 一時的なバウンス（メールボックス容量超過など）は再送に任せる
+	if req.Permanent != nil && !*req.Permanent {
+		log.Printf("[HandleEmailBounce] Soft bounce for %s: %s", address, req.Reason)
+		response.Success(w, http.StatusOK, map[string]interface{}{"suppressed": false})
+		return
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "bounce reported by provider"
+	}
+	s.suppressEmailAddress(s.supabase.GetServiceClient(), address, reason)
+	response.Success(w, http.StatusOK, map[string]interface{}{"suppressed": true})
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	defaultFeedLimit  = 50
+	maxFeedLimit      = 100
+	feedSummaryLength = 300
+	feedCacheMaxAge   = 300 // seconds
+)
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// HandlePostsFeed serves new listings as Atom, RSS 2.0 or JSON Feed
+// GET /feeds/posts?format=atom|rss|json (or /feeds/posts.atom, .rss, .json)
+// Accepts the same filters as ListPosts (categories, tech_stacks, price_min, revenue_min, ...)
+func (s *Server) HandlePostsFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	format := detectFeedFormat(r)
+	if format == "" {
+		response.Error(w, http.StatusBadRequest, "Unsupported format (use atom, rss or json)")
+		return
+	}
+
+	urlQuery := r.URL.Query()
+	params := parsePostQueryParams(urlQuery)
+	// フィードは常に公開中の投稿のみ
+	isActive := true
+	params.IsActive = &isActive
+	// 種別指定がなければ売却案件（通常・秘匿）のみ
+	if params.Type == nil && len(params.PostTypes) == 0 {
+		params.PostTypes = []string{string(models.PostTypeTransaction), string(models.PostTypeSecret)}
+	}
+	if urlQuery.Get("limit") == "" {
+		params.Limit = defaultFeedLimit
+	}
+	if params.Limit > maxFeedLimit {
+		params.Limit = maxFeedLimit
+	}
+
+	// 🔒 SECURITY: フィードリーダーは認証しないため、常にAnon Clientで取得（RLSで公開投稿のみ）
+	client := s.supabase.GetAnonClient()
+	query := client.From("posts").
+		Select("*", "", false).
+		Order("created_at", nil)
+	query = applyPostFilters(query, params)
+	query = query.Range(0, params.Limit-1, "")
+
+	var posts []models.Post
+	if _, err := query.ExecuteTo(&posts); err != nil {
+		log.Printf("[HandlePostsFeed] Failed to query posts: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query posts")
+		return
+	}
+
+	// 🔒 SECURITY: フィードの閲覧者は常に未ログイン扱い。非公開（hidden）の秘匿投稿は出さず、
+	// 内容に関する条件で絞り込んだ場合は秘匿投稿自体を除外する
+	// （ティーザーが表示されること自体から非開示の項目が推測できてしまうため）
+	detailFiltered := hasPostDetailFilters(params)
+	filtered := posts[:0]
+	for _, post := range posts {
+		if !services.PostListable(post, services.ViewerAnonymous) {
+			continue
+		}
+		if detailFiltered && post.Type == models.PostTypeSecret {
+			continue
+		}
+		filtered = append(filtered, post)
+	}
+	posts = filtered
+
+	// 更新日時とETag（投稿ID・更新日時・フィード条件から算出）
+	lastModified := time.Time{}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%s|", format, canonicalFeedQuery(urlQuery))
+	for _, post := range posts {
+		if post.UpdatedAt.After(lastModified) {
+			lastModified = post.UpdatedAt
+		}
+		fmt.Fprintf(hash, "%s:%d;", post.ID, post.UpdatedAt.UnixNano())
+	}
+	if lastModified.IsZero() {
+		lastModified = time.Unix(0, 0)
+	}
+	lastModified = lastModified.UTC().Truncate(time.Second)
+	etag := `"` + hex.EncodeToString(hash.Sum(nil))[:32] + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", feedCacheMaxAge))
+	w.Header().Set("Vary", "Accept")
+
+	if feedNotModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// 秘匿投稿以外の投稿者名を取得
+	authorNames := s.fetchFeedAuthorNames(posts)
+
+	frontendURL := strings.TrimRight(s.config.FrontendURL, "/")
+	selfURL := strings.TrimRight(s.config.BackendURL, "/") + r.URL.RequestURI()
+	feed := services.Feed{
+		ID:          selfURL,
+		Title:       "APPEXIT 新着案件",
+		Description: "APPEXITに掲載された新着のアプリ・サービス売却案件",
+		Link:        frontendURL + "/projects",
+		SelfLink:    selfURL,
+		Language:    "ja",
+		Updated:     lastModified,
+		Items:       make([]services.FeedItem, 0, len(posts)),
+	}
+	for _, post := range posts {
+		feed.Items = append(feed.Items, buildPostFeedItem(post, frontendURL, authorNames[post.AuthorUserID]))
+	}
+
+	var buf bytes.Buffer
+	if err := services.RenderFeed(format, feed, &buf); err != nil {
+		log.Printf("[HandlePostsFeed] Failed to render %s feed: %v", format, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to render feed")
+		return
+	}
+
+	w.Header().Set("Content-Type", services.FeedContentType(format))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+	log.Printf("[HandlePostsFeed] ✓ Served %s feed with %d items", format, len(feed.Items))
+}
+
+// buildPostFeedItem converts a post to a feed item.
+// 🔒 SECURITY: 秘匿投稿は未ログイン閲覧者の公開範囲でマスクした上で、匿名のティーザーにする
+func buildPostFeedItem(post models.Post, frontendURL string, authorName string) services.FeedItem {
+	item := services.FeedItem{
+		ID:        "urn:appexit:post:" + post.ID,
+		Link:      frontendURL + "/projects/" + url.PathEscape(post.ID),
+		Published: post.CreatedAt,
+		Updated:   post.UpdatedAt,
+	}
+
+	if post.Type == models.PostTypeSecret {
+		services.ApplyPostVisibility(&post, services.ViewerAnonymous)
+		item.Title = "【秘匿案件】新しい非公開案件が掲載されました"
+		summary := "NDA締結後に詳細を閲覧できます。"
+		if post.Price != nil {
+			summary = fmt.Sprintf("希望価格: %s円 / %s", services.FormatYen(*post.Price), summary)
+		}
+		item.Summary = summary
+		return item
+	}
+
+	item.Title = post.Title
+	item.Author = authorName
+	item.Categories = post.AppCategories
+	if post.EyecatchURL != nil {
+		item.ImageURL = *post.EyecatchURL
+	}
+
+	lines := make([]string, 0, 3)
+	if post.Price != nil {
+		lines = append(lines, fmt.Sprintf("希望価格: %s円", services.FormatYen(*post.Price)))
+	}
+	if post.MonthlyRevenue != nil {
+		lines = append(lines, fmt.Sprintf("月間売上: %s円", services.FormatYen(*post.MonthlyRevenue)))
+	}
+	text := ""
+	if post.AppealText != nil && *post.AppealText != "" {
+		text = *post.AppealText
+	} else if post.Body != nil {
+		text = htmlToPlainText(*post.Body)
+	}
+	if text != "" {
+		lines = append(lines, truncateRunes(text, feedSummaryLength))
+	}
+	item.Summary = strings.Join(lines, "\n")
+	return item
+}
+
+// hasPostDetailFilters reports whether the query filters on listing contents
+func hasPostDetailFilters(params models.PostQueryParams) bool {
+	return (params.SearchKeyword != nil && *params.SearchKeyword != "") ||
+		len(params.Categories) > 0 || len(params.TechStacks) > 0 ||
+		params.PriceMin != nil || params.PriceMax != nil ||
+		params.RevenueMin != nil || params.RevenueMax != nil
+}
+
+// fetchFeedAuthorNames returns display names of the authors of non-secret posts
+func (s *Server) fetchFeedAuthorNames(posts []models.Post) map[string]string {
+	names := make(map[string]string)
+	seen := make(map[string]bool)
+	ids := make([]string, 0)
+	for _, post := range posts {
+		if post.Type == models.PostTypeSecret || seen[post.AuthorUserID] {
+			continue
+		}
+		seen[post.AuthorUserID] = true
+		ids = append(ids, post.AuthorUserID)
+	}
+	if len(ids) == 0 {
+		return names
+	}
+
+	var profiles []models.AuthorProfile
+	_, err := s.supabase.GetAnonClient().From("profiles").
+		Select("id, display_name", "", false).
+		In("id", ids).
+		ExecuteTo(&profiles)
+	if err != nil {
+		log.Printf("[HandlePostsFeed] ⚠️ Failed to query profiles: %v", err)
+		return names
+	}
+	for _, p := range profiles {
+		names[p.ID] = p.DisplayName
+	}
+	return names
+}
+
+// detectFeedFormat uses the path suffix, then ?format=, then the Accept header (default: Atom)
+func detectFeedFormat(r *http.Request) string {
+	switch {
+	case strings.HasSuffix(r.URL.Path, ".atom"):
+		return services.FeedFormatAtom
+	case strings.HasSuffix(r.URL.Path, ".rss"):
+		return services.FeedFormatRSS
+	case strings.HasSuffix(r.URL.Path, ".json"):
+		return services.FeedFormatJSON
+	}
+
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "atom":
+		return services.FeedFormatAtom
+	case "rss", "rss2":
+		return services.FeedFormatRSS
+	case "json", "jsonfeed":
+		return services.FeedFormatJSON
+	case "":
+	default:
+		return ""
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/feed+json"):
+		return services.FeedFormatJSON
+	case strings.Contains(accept, "application/rss+xml"):
+		return services.FeedFormatRSS
+	default:
+		return services.FeedFormatAtom
+	}
+}
+
+// feedNotModified evaluates If-None-Match (preferred) and If-Modified-Since
+func feedNotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalFeedQuery returns the query string with sorted keys so that equivalent URLs share an ETag
+func canonicalFeedQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+strings.Join(values[k], ","))
+	}
+	return strings.Join(parts, "&")
+}
+
+func htmlToPlainText(s string) string {
+	s = htmlTagPattern.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n]) + "…"
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+// マッチング条件として読み込むprofilesのカラム
+const matchCriteriaColumns = "id, role, investment_min, investment_max, target_categories, operation_type, desired_purchase_timing, expertise"
+
+// matchCriteriaRow maps a profiles row to MatchCriteria (profiles.id is the user ID)
+type matchCriteriaRow struct {
+	ID                       string   `json:"id"`
+	Role                     string   `json:"role"`
+	InvestmentMin            *int     `json:"investment_min"`
+	InvestmentMax            *int     `json:"investment_max"`
+	TargetCategories         []string `json:"target_categories"`
+	OperationType            *string  `json:"operation_type"`
+	DesiredAcquisitionTiming *string  `json:"desired_purchase_timing"`
+	Expertise                []string `json:"expertise"`
+}
+
+func (row matchCriteriaRow) toCriteria() models.MatchCriteria {
+	return models.MatchCriteria{
+		UserID:                   row.ID,
+		Role:                     row.Role,
+		InvestmentMin:            row.InvestmentMin,
+		InvestmentMax:            row.InvestmentMax,
+		TargetCategories:         row.TargetCategories,
+		OperationType:            row.OperationType,
+		DesiredAcquisitionTiming: row.DesiredAcquisitionTiming,
+		Expertise:                row.Expertise,
+	}
+}
+
+// loadMatchCriteria loads the buyer/advisor criteria of a user
+func (s *Server) loadMatchCriteria(client *supabase.Client, userID string) ([]models.MatchCriteria, error) {
+	var rows []matchCriteriaRow
+	_, err := client.From("profiles").
+		Select(matchCriteriaColumns, "", false).
+		Eq("id", userID).
+		In("role", []string{"buyer", "advisor"}).
+		ExecuteTo(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	criteria := make([]models.MatchCriteria, 0, len(rows))
+	for _, row := range rows {
+		criteria = append(criteria, row.toCriteria())
+	}
+	return criteria, nil
+}
+
+// GetRecommendedPosts returns listings ranked by the authenticated buyer's criteria
+// GET /api/posts/recommended
+// ListPostsと同じフィルター・NDAマスキングを使い、sort=recommended で並べ替える
+func (s *Server) GetRecommendedPosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if _, ok := utils.RequireUserID(r, w); !ok {
+		return
+	}
+
+	urlQuery := r.URL.Query()
+	urlQuery.Set("sort", "recommended")
+	// 掲示板投稿は売買対象ではないため除外
+	if urlQuery.Get("type") == "" && urlQuery.Get("post_types") == "" {
+		urlQuery.Set("post_types", `["transaction","secret"]`)
+	}
+	urlQuery.Set("exclude_own", "true")
+	r.URL.RawQuery = urlQuery.Encode()
+
+	s.ListPosts(w, r)
+}
+
+// GetMatchingBuyers returns how many buyers' criteria match a listing (counts only, for the seller)
+// GET /api/posts/:id/matching-buyers
+func (s *Server) GetMatchingBuyers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 {
+		response.Error(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+	postID := parts[2]
+
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+
+	var posts []models.Post
+	_, err := client.From("posts").
+		Select("*", "", false).
+		Eq("id", postID).
+		Limit(1, "").
+		ExecuteTo(&posts)
+	if err != nil {
+		log.Printf("[GetMatchingBuyers] Failed to query post %s: %v", postID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query post")
+		return
+	}
+	if len(posts) == 0 {
+		response.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	post := posts[0]
+	if post.AuthorUserID != userID {
+		response.Error(w, http.StatusForbidden, "Only the author can view matching buyers")
+		return
+	}
+
+	// 🔒 SECURITY: 他ユーザーの購入条件を横断集計するためService Clientを使用する。
+	// レスポンスは件数のみで、個々の買い手情報は返さない
+	serviceClient := s.supabase.GetServiceClient()
+
+	// ブロックしている・されている買い手は件数に含めない
+	blocks, err := s.fetchUserBlocks(userID)
+	if err != nil {
+		log.Printf("[GetMatchingBuyers] Failed to query blocks of %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query buyers")
+		return
+	}
+
+	scoresByUser := make(map[string]int)
+	const pageSize = 1000
+	for offset := 0; ; offset += pageSize {
+		var rows []matchCriteriaRow
+		_, err := serviceClient.From("profiles").
+			Select(matchCriteriaColumns, "", false).
+			In("role", []string{"buyer", "advisor"}).
+			Neq("id", userID).
+			Range(offset, offset+pageSize-1, "").
+			ExecuteTo(&rows)
+		if err != nil {
+			log.Printf("[GetMatchingBuyers] Failed to query buyer profiles: %v", err)
+			response.Error(w, http.StatusInternalServerError, "Failed to query buyers")
+			return
+		}
+
+		for _, row := range rows {
+			criteria := row.toCriteria()
+			if !criteria.HasCriteria() || blocks.between(row.ID) {
+				continue
+			}
+			score := services.ScoreListing(criteria, post).Score
+			// 買い手と提案者の両方のプロフィールを持つユーザーは高い方を採用
+			if existing, ok := scoresByUser[row.ID]; !ok || score > existing {
+				scoresByUser[row.ID] = score
+			}
+		}
+
+		if len(rows) < pageSize {
+			break
+		}
+	}
+
+	summary := models.MatchingBuyersSummary{
+		PostID:          postID,
+		EvaluatedBuyers: len(scoresByUser),
+		Threshold:       services.MatchThreshold,
+	}
+	for _, score := range scoresByUser {
+		if score >= services.MatchThreshold {
+			summary.MatchingBuyers++
+		}
+		if score >= services.StrongMatchThreshold {
+			summary.StrongMatches++
+		}
+	}
+
+	log.Printf("[GetMatchingBuyers] ✓ Post %s: %d/%d buyers match (strong: %d)",
+		postID, summary.MatchingBuyers, summary.EvaluatedBuyers, summary.StrongMatches)
+	response.Success(w, http.StatusOK, summary)
+}
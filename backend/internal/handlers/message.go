@@ -24,13 +24,25 @@ func parseTime(timeStr string) time.Time {
 	return t
 }
 
+// parseOptionalTime converts a nullable ISO8601 string to *time.Time
+func parseOptionalTime(timeStr *string) *time.Time {
+	if timeStr == nil || *timeStr == "" {
+		return nil
+	}
+	t := parseTime(*timeStr)
+	return &t
+}
+
 // Common struct types used across message handlers
 type (
 	threadRow struct {
-		ID            string  `json:"id"`
-		CreatedBy     string  `json:"created_by"`
-		RelatedPostID *string `json:"related_post_id"`
-		CreatedAt     string  `json:"created_at"`
+		ID             string  `json:"id"`
+		CreatedBy      string  `json:"created_by"`
+		RelatedPostID  *string `json:"related_post_id"`
+		ThreadType     string  `json:"thread_type"`
+		MergedInto     *string `json:"merged_into"`
+		LastActivityAt *string `json:"last_activity_at"`
+		CreatedAt      string  `json:"created_at"`
 	}
 
 	participantRow struct {
@@ -76,6 +88,8 @@ type (
 		SenderUserID string  `json:"sender_user_id"`
 		Type         string  `json:"type"`
 		Text         *string `json:"text"`
+		EditedAt     *string `json:"edited_at"`
+		DeletedAt    *string `json:"deleted_at"`
 		CreatedAt    string  `json:"created_at"`
 	}
 
@@ -101,8 +115,9 @@ type (
 	}
 
 	threadInsert struct {
-		CreatedBy     string  `json:"created_by"`
-		RelatedPostID *string `json:"related_post_id"`
+		CreatedBy      string  `json:"created_by"`
+		RelatedPostID  *string `json:"related_post_id"`
+		ParticipantKey string  `json:"participant_key,omitempty"`
 	}
 
 	threadResponse struct {
@@ -180,6 +195,42 @@ func (s *Server) HandleThreadByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 入力中の通知（リアルタイム配信のみ、保存しない）
+	if strings.HasSuffix(r.URL.Path, "/typing") {
+		s.SetTypingStatus(w, r)
+		return
+	}
+
+	// 参加者と役割（アドバイザー・運営の招待と削除）
+	if strings.Contains(r.URL.Path, "/participants") {
+		s.HandleThreadParticipants(w, r)
+		return
+	}
+
+	// 自分だけのスレッドの状態（アーカイブ・ミュート・ピン留め・ラベル）
+	if strings.HasSuffix(r.URL.Path, "/state") {
+		s.UpdateThreadState(w, r)
+		return
+	}
+
+	// スレッドの記録の出力（トランスクリプトPDF・ZIPアーカイブ）
+	if strings.HasSuffix(r.URL.Path, "/export") {
+		s.ExportThread(w, r)
+		return
+	}
+
+	// 商談スレッドの進捗（NDA・LOI・売却リクエスト・引き継ぎ）
+	if strings.HasSuffix(r.URL.Path, "/deal") {
+		s.GetDealRoomState(w, r)
+		return
+	}
+
+	// 重複スレッドの統合（運営のみ）
+	if strings.HasSuffix(r.URL.Path, "/merge") {
+		s.MergeThread(w, r)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		s.GetThreadByID(w, r)
@@ -220,86 +271,40 @@ func (s *Server) CreateThread(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	client := s.supabase.GetAuthenticatedClient(accessToken)
-
-	insertData := threadInsert{
-		CreatedBy:     userID,
-		RelatedPostID: req.RelatedPostID,
-	}
-
-	var threadResponse []threadResponse
-	_, err := client.From("threads").
-		Insert(insertData, false, "", "", "").
-		ExecuteTo(&threadResponse)
-
+	// ブロックしている・されている相手とは新しいスレッドを作れない（どちらがブロックしたかは伝えない）
+	blocked, err := s.blockedAmong(userID, req.ParticipantIDs)
 	if err != nil {
-		log.Printf("[CreateThread] Failed to insert thread: %v", err)
+		log.Printf("[CreateThread] Failed to query blocks of %s: %v", userID, err)
 		response.Error(w, http.StatusInternalServerError, "Failed to create thread")
 		return
 	}
-
-	if len(threadResponse) == 0 {
-		response.Error(w, http.StatusInternalServerError, "Failed to create thread")
+	if blocked {
+		log.Printf("[CreateThread] ❌ Blocked between %s and %v", userID, req.ParticipantIDs)
+		response.Error(w, http.StatusForbidden, "You cannot start a conversation with this user")
 		return
 	}
 
-	thread := models.Thread{
-		ID:            threadResponse[0].ID,
-		CreatedBy:     threadResponse[0].CreatedBy,
-		RelatedPostID: threadResponse[0].RelatedPostID,
-		CreatedAt:     parseTime(threadResponse[0].CreatedAt),
-	}
-
-	// Add participants (including creator)
-	participantIDs := append(req.ParticipantIDs, userID)
-	uniqueParticipants := make(map[string]bool)
-	for _, pid := range participantIDs {
-		uniqueParticipants[pid] = true
-	}
+	client := s.supabase.GetAuthenticatedClient(accessToken)
 
-	// 🔒 SECURITY: Use access token instead of Service Role Key to enforce RLS
-	// Check existing participants
-	var existingParticipants []participantCheck
-	_, checkErr := client.From("thread_participants").
-		Select("user_id", "", false).
-		Eq("thread_id", thread.ID).
-		ExecuteTo(&existingParticipants)
-	
-	existingParticipantMap := make(map[string]bool)
-	if checkErr == nil {
-		for _, ep := range existingParticipants {
-			existingParticipantMap[ep.UserID] = true
-		}
-	}
-	
-	// Create batch insert slice
-	var participantInserts []participantInsert
-	for pid := range uniqueParticipants {
-		if !existingParticipantMap[pid] {
-			participantInserts = append(participantInserts, participantInsert{
-				ThreadID: thread.ID,
-				UserID:   pid,
-			})
-		}
+	// 同じ参加者・同じ案件のスレッドが既にあればそれを返す（並行したスレッドで契約・売却リクエストが分散しないように）
+	thread, created, err := s.getOrCreateThread(client, userID, req.ParticipantIDs, req.RelatedPostID)
+	if err != nil {
+		log.Printf("[CreateThread] Failed to get or create thread: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to create thread")
+		return
 	}
 
-	// Insert participants if any
-	if len(participantInserts) > 0 {
-		_, _, err := client.From("thread_participants").
-			Insert(participantInserts, false, "", "", "").
-			Execute()
-
-		if err != nil {
-			log.Printf("[CreateThread] Failed to add participants: %v", err)
-			response.Error(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add participants: %v", err))
-			return
-		}
+	if !created {
+		log.Printf("[CreateThread] ✓ Returning existing thread %s", thread.ID)
+		response.Success(w, http.StatusOK, thread)
+		return
 	}
-
+	log.Printf("[CreateThread] ✓ Created %s thread %s", thread.ThreadType, thread.ID)
 	response.Success(w, http.StatusCreated, thread)
 }
 
-// GetThreads retrieves all threads for the authenticated user
+// GetThreads retrieves the threads of an inbox view for the authenticated user, pinned threads first and
+// then by last activity. Query: view (active, archived, unread), label, type (inquiry, deal_room), limit, offset
 func (s *Server) GetThreads(w http.ResponseWriter, r *http.Request) {
 	userID, accessToken, ok := utils.RequireAuth(r, w)
 	if !ok {
@@ -322,43 +327,57 @@ func (s *Server) GetThreads(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	client := s.supabase.GetAuthenticatedClient(accessToken)
-
-	var threadParticipantRows []participantRow
-	_, err := client.From("thread_participants").
-		Select("thread_id, user_id", "", false).
-		Eq("user_id", userID).
-		ExecuteTo(&threadParticipantRows)
+	// 受信箱のビュー（active / archived / unread）とラベル・種別で絞り込み、ピン留め→最終更新の順に並べる
+	view := models.ThreadView(r.URL.Query().Get("view"))
+	switch view {
+	case "":
+		view = models.ThreadViewActive
+	case models.ThreadViewActive, models.ThreadViewArchived, models.ThreadViewUnread:
+	default:
+		response.Error(w, http.StatusBadRequest, "view must be one of: active, archived, unread")
+		return
+	}
+	inboxPayload := map[string]interface{}{
+		"p_user_id": userID,
+		"p_view":    string(view),
+		"p_limit":   limit,
+		"p_offset":  offset,
+	}
+	if label := strings.TrimSpace(r.URL.Query().Get("label")); label != "" {
+		inboxPayload["p_label"] = label
+	}
+	switch threadType := models.ThreadType(r.URL.Query().Get("type")); threadType {
+	case models.ThreadTypeInquiry, models.ThreadTypeDealRoom:
+		inboxPayload["p_thread_type"] = string(threadType)
+	}
 
-	if err != nil {
-		log.Printf("[GetThreads] Failed to query thread_participants: %v", err)
+	var inboxRows []inboxThreadRow
+	if err := s.supabase.CallRPC("inbox_threads", inboxPayload, &inboxRows); err != nil {
+		log.Printf("[GetThreads] Failed to query inbox: %v", err)
 		response.Error(w, http.StatusInternalServerError, "Failed to fetch threads")
 		return
 	}
 
-	if len(threadParticipantRows) == 0 {
+	if len(inboxRows) == 0 {
 		response.Success(w, http.StatusOK, []models.ThreadWithLastMessage{})
 		return
 	}
 
-	threadIDMap := make(map[string]bool)
-	for _, p := range threadParticipantRows {
-		threadIDMap[p.ThreadID] = true
+	threadIDList := make([]string, len(inboxRows))
+	inboxMap := make(map[string]inboxThreadRow, len(inboxRows))
+	for i, row := range inboxRows {
+		threadIDList[i] = row.ThreadID
+		inboxMap[row.ThreadID] = row
 	}
 
-	threadIDList := make([]string, 0, len(threadIDMap))
-	for threadID := range threadIDMap {
-		threadIDList = append(threadIDList, threadID)
-	}
+	client := s.supabase.GetAuthenticatedClient(accessToken)
 
 	// 🔒 SECURITY: Use access token instead of Service Role Key to enforce RLS
-	var threadRows []threadRow
-	_, err = client.From("threads").
-		Select("id, created_by, related_post_id, created_at", "", false).
+	var unorderedThreadRows []threadRow
+	_, err := client.From("threads").
+		Select(threadSelectColumns, "", false).
 		In("id", threadIDList).
-		Order("created_at", nil). // 新しいスレッドから取得
-		Range(offset, offset+limit-1, "").
-		ExecuteTo(&threadRows)
+		ExecuteTo(&unorderedThreadRows)
 
 	if err != nil {
 		log.Printf("[GetThreads] Failed to query threads: %v", err)
@@ -366,6 +385,18 @@ func (s *Server) GetThreads(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 受信箱の並び順に揃える
+	threadRowMap := make(map[string]threadRow, len(unorderedThreadRows))
+	for _, row := range unorderedThreadRows {
+		threadRowMap[row.ID] = row
+	}
+	threadRows := make([]threadRow, 0, len(threadIDList))
+	for _, threadID := range threadIDList {
+		if row, ok := threadRowMap[threadID]; ok {
+			threadRows = append(threadRows, row)
+		}
+	}
+
 	log.Printf("[GetThreads] Found %d threads", len(threadRows))
 
 	if len(threadRows) == 0 {
@@ -381,7 +412,7 @@ func (s *Server) GetThreads(w http.ResponseWriter, r *http.Request) {
 
 	var allMessageRows []messageRow
 	_, err = client.From("messages").
-		Select("id, thread_id, sender_user_id, type, text, created_at", "", false).
+		Select(messageSelectColumns, "", false).
 		In("thread_id", threadIDs).
 		ExecuteTo(&allMessageRows)
 
@@ -487,23 +518,12 @@ func (s *Server) GetThreads(w http.ResponseWriter, r *http.Request) {
 	threads := make([]models.ThreadWithLastMessage, 0, len(threadRows))
 	for _, row := range threadRows {
 		thread := models.ThreadWithLastMessage{
-			Thread: models.Thread{
-				ID:            row.ID,
-				CreatedBy:     row.CreatedBy,
-				RelatedPostID: row.RelatedPostID,
-				CreatedAt:     parseTime(row.CreatedAt),
-			},
+			Thread: threadFromRow(row),
 		}
 
 		if msg, hasMessage := lastMessageMap[row.ID]; hasMessage {
-			thread.LastMessage = &models.Message{
-				ID:           msg.ID,
-				ThreadID:     row.ID,
-				SenderUserID: msg.SenderUserID,
-				Type:         models.MessageType(msg.Type),
-				Text:         msg.Text,
-				CreatedAt:    parseTime(msg.CreatedAt),
-			}
+			lastMessage := messageFromRow(msg)
+			thread.LastMessage = &lastMessage
 		}
 
 		thread.ParticipantIDs = participantsByThread[row.ID]
@@ -532,71 +552,11 @@ func (s *Server) GetThreads(w http.ResponseWriter, r *http.Request) {
 		threads = append(threads, thread)
 	}
 
-	// 未読数を計算
-	// 各スレッドのメッセージIDを取得
-	threadMessageIDs := make(map[string][]string)
-	for _, msg := range allMessageRows {
-		threadMessageIDs[msg.ThreadID] = append(threadMessageIDs[msg.ThreadID], msg.ID)
-	}
-
-	// 既読レコードを取得
-	type messageReadRow struct {
-		MessageID string `json:"message_id"`
-		UserID    string `json:"user_id"`
-	}
-	var readRows []messageReadRow
-	if len(threadIDs) > 0 {
-		// すべてのスレッドのメッセージIDを収集
-		allMessageIDs := make([]string, 0)
-		for _, msgIDs := range threadMessageIDs {
-			allMessageIDs = append(allMessageIDs, msgIDs...)
-		}
-
-		if len(allMessageIDs) > 0 {
-			_, err = client.From("message_reads").
-				Select("message_id, user_id", "", false).
-				In("message_id", allMessageIDs).
-				Eq("user_id", userID).
-				ExecuteTo(&readRows)
-
-			if err != nil {
-				log.Printf("[GetThreads] Failed to query message_reads: %v", err)
-			}
-		}
-	}
-
-	// 既読メッセージIDのセットを作成
-	readMessageIDs := make(map[string]bool)
-	for _, readRow := range readRows {
-		readMessageIDs[readRow.MessageID] = true
-	}
-
-	// 各スレッドの未読数を計算
+	// 未読数・スレッドの状態（アーカイブ・ミュート・ピン留め・ラベル）は受信箱のRPCの結果を使う
 	for i := range threads {
-		threadID := threads[i].ID
-		unreadCount := 0
-
-		// このスレッドのメッセージを取得
-		if msgIDs, exists := threadMessageIDs[threadID]; exists {
-			for _, msgID := range msgIDs {
-				// メッセージの送信者を確認
-				var msgSenderID string
-				for _, msg := range allMessageRows {
-					if msg.ID == msgID {
-						msgSenderID = msg.SenderUserID
-						break
-					}
-				}
-
-				// 自分が送信者でないメッセージで、かつ既読レコードが存在しない場合、未読としてカウント
-				if msgSenderID != userID && !readMessageIDs[msgID] {
-					unreadCount++
-				}
-			}
-		}
-
-		threads[i].UnreadCount = unreadCount
-		log.Printf("[GetThreads] Thread %s: unread_count = %d", threadID, unreadCount)
+		inbox := inboxMap[threads[i].ID]
+		threads[i].UnreadCount = inbox.UnreadCount
+		threads[i].State = inbox.state()
 	}
 
 	log.Printf("[GetThreads] Returning %d threads with full details", len(threads))
@@ -630,7 +590,7 @@ func (s *Server) GetThreadByID(w http.ResponseWriter, r *http.Request) {
 	// 🔒 SECURITY: Use access token instead of Service Role Key to enforce RLS
 	var threadRows []threadRow
 	_, err = client.From("threads").
-		Select("id, created_by, related_post_id, created_at", "", false).
+		Select(threadSelectColumns, "", false).
 		Eq("id", threadID).
 		ExecuteTo(&threadRows)
 
@@ -696,19 +656,14 @@ func (s *Server) GetThreadByID(w http.ResponseWriter, r *http.Request) {
 						// But we need to avoid infinite recursion, so we'll fetch it directly
 						var existingThreadRows []threadRow
 						_, err = client.From("threads").
-							Select("id, created_by, related_post_id, created_at", "", false).
+							Select(threadSelectColumns, "", false).
 							Eq("id", existingThreadID).
 							ExecuteTo(&existingThreadRows)
 						
 						if err == nil && len(existingThreadRows) > 0 {
 							// Build thread detail response
 							thread := models.ThreadDetail{
-								Thread: models.Thread{
-									ID:            existingThreadRows[0].ID,
-									CreatedBy:     existingThreadRows[0].CreatedBy,
-									RelatedPostID: existingThreadRows[0].RelatedPostID,
-									CreatedAt:     parseTime(existingThreadRows[0].CreatedAt),
-								},
+								Thread: threadFromRow(existingThreadRows[0]),
 							}
 							
 							// Get participants
@@ -786,63 +741,16 @@ func (s *Server) GetThreadByID(w http.ResponseWriter, r *http.Request) {
 			}
 			
 			// No existing thread found - create a new one
+			// (案件を指定しない問い合わせスレッド。同時に作成された場合は既存のスレッドが返る)
 			log.Printf("[GetThreadByID] Creating new thread with user: %s", threadID)
-			
-			insertData := threadInsert{
-				CreatedBy:     userID,
-				RelatedPostID: nil,
-			}
-			
-			var threadResponse []threadResponse
-			_, err = client.From("threads").
-				Insert(insertData, false, "", "", "").
-				ExecuteTo(&threadResponse)
-			
+
+			newThread, _, err := s.getOrCreateThread(client, userID, []string{threadID}, nil)
 			if err != nil {
 				log.Printf("[GetThreadByID] Failed to create thread: %v", err)
 				response.Error(w, http.StatusInternalServerError, "Failed to create thread")
 				return
 			}
 			
-			if len(threadResponse) == 0 {
-				response.Error(w, http.StatusInternalServerError, "Failed to create thread")
-				return
-			}
-			
-			newThread := models.Thread{
-				ID:            threadResponse[0].ID,
-				CreatedBy:     threadResponse[0].CreatedBy,
-				RelatedPostID: threadResponse[0].RelatedPostID,
-				CreatedAt:     parseTime(threadResponse[0].CreatedAt),
-			}
-			
-			// Add participants
-			participantIDs := []string{threadID, userID}
-			uniqueParticipants := make(map[string]bool)
-			for _, pid := range participantIDs {
-				uniqueParticipants[pid] = true
-			}
-			
-			var participantInserts []participantInsert
-			for pid := range uniqueParticipants {
-				participantInserts = append(participantInserts, participantInsert{
-					ThreadID: newThread.ID,
-					UserID:   pid,
-				})
-			}
-			
-			if len(participantInserts) > 0 {
-				_, _, err = client.From("thread_participants").
-					Insert(participantInserts, false, "", "", "").
-					Execute()
-				
-				if err != nil {
-					log.Printf("[GetThreadByID] Failed to add participants: %v", err)
-					response.Error(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add participants: %v", err))
-					return
-				}
-			}
-			
 			// Build thread detail response
 			threadDetail := models.ThreadDetail{
 				Thread: newThread,
@@ -931,12 +839,7 @@ func (s *Server) GetThreadByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	thread := models.ThreadDetail{
-		Thread: models.Thread{
-			ID:            threadRows[0].ID,
-			CreatedBy:     threadRows[0].CreatedBy,
-			RelatedPostID: threadRows[0].RelatedPostID,
-			CreatedAt:     parseTime(threadRows[0].CreatedAt),
-		},
+		Thread: threadFromRow(threadRows[0]),
 	}
 
 	var participantRows []participantRowSimple
@@ -1078,7 +981,7 @@ func (s *Server) GetMessages(w http.ResponseWriter, r *http.Request) {
 
 	var messageRows []messageRow
 	_, err := client.From("messages").
-		Select("id, thread_id, sender_user_id, type, text, created_at", "", false).
+		Select(messageSelectColumns, "", false).
 		Eq("thread_id", threadID).
 		Order("created_at", nil). // 新しいメッセージから取得
 		Range(offset, offset+limit-1, "").
@@ -1144,14 +1047,7 @@ func (s *Server) GetMessages(w http.ResponseWriter, r *http.Request) {
 	for _, row := range messageRows {
 		profile, hasProfile := profilesMap[row.SenderUserID]
 		msg := models.MessageWithSender{
-			Message: models.Message{
-				ID:           row.ID,
-				ThreadID:     row.ThreadID,
-				SenderUserID: row.SenderUserID,
-				Type:         models.MessageType(row.Type),
-				Text:         row.Text,
-				CreatedAt:    parseTime(row.CreatedAt),
-			},
+			Message:       messageFromRow(row),
 			SenderName:    "不明なユーザー",
 			SenderIconURL: nil,
 			ImageURL:      nil,
@@ -1161,20 +1057,12 @@ func (s *Server) GetMessages(w http.ResponseWriter, r *http.Request) {
 			msg.SenderIconURL = profile.IconURL
 		}
 
-		if filePath, hasAttachment := attachmentsMap[row.ID]; hasAttachment {
-			// 契約書の場合はcontract-documentsバケットから、画像の場合はmessage-imagesバケットからURLを取得
-			bucketName := "message-images"
-			if row.Type == string(models.MessageTypeContract) || row.Type == string(models.MessageTypeNDA) {
-				bucketName = "contract-documents"
-			}
-			
-			log.Printf("[GetMessages] Getting file URL for message %s, bucket=%s, path=%s", row.ID, bucketName, filePath)
-			imageURL, err := s.supabase.GetImageURL(bucketName, filePath, 3600)
-			if err != nil {
-				log.Printf("[GetMessages] ERROR: Failed to get file URL for message %s: %v", row.ID, err)
-				// エラーでもメッセージは返す（ファイルなしで）
-			} else {
-				log.Printf("[GetMessages] Successfully got file URL for message %s: %s", row.ID, imageURL)
+		// 削除済みメッセージの添付は返さない（トゥームストーン）
+		if filePath, hasAttachment := attachmentsMap[row.ID]; hasAttachment && row.DeletedAt == nil {
+			// 🔒 SECURITY: ストレージの署名付きURLではなく、閲覧者の透かしを入れるダウンロードプロキシのURLを返す
+			// （バケットはプロキシ側でメッセージ種別から判定）
+			// エラーでもメッセージは返す（ファイルなしで）
+			if imageURL := s.messageAttachmentURL("GetMessages", userID, row.ID, filePath); imageURL != "" {
 				msg.ImageURL = &imageURL
 			}
 		}
@@ -1237,6 +1125,17 @@ func (s *Server) GetMessages(w http.ResponseWriter, r *http.Request) {
 					log.Printf("[GetMessages] Failed to mark messages as read: %v", err)
 				} else {
 					log.Printf("[GetMessages] Marked %d messages as read", len(readsToInsert))
+
+					// 既読を送信者側にリアルタイムで通知
+					readIDs := make([]string, 0, len(readsToInsert))
+					for _, read := range readsToInsert {
+						readIDs = append(readIDs, read.MessageID)
+					}
+					s.publishThreadEvent("GetMessages", threadID, userID, models.RealtimeEventMessagesRead, models.RealtimeMessagesRead{
+						UserID:     userID,
+						MessageIDs: readIDs,
+						ReadAt:     time.Now().UTC(),
+					})
 				}
 			}
 		}
@@ -1257,18 +1156,48 @@ func (s *Server) SendMessage(w http.ResponseWriter, r *http.Request) {
 	if !utils.DecodeAndValidate(r, w, &req) {
 		return
 	}
+	// 🔒 SECURITY: 添付は service role で配信するため、送信者がアップロードしたファイル（自分のフォルダ）のみ添付できる
+	if req.FileURL != nil && *req.FileURL != "" && !isExternalURL(*req.FileURL) && !isOwnStoragePath(userID, *req.FileURL) {
+		log.Printf("[SendMessage] ❌ User %s attached a file outside their folder in %s: %s", userID, messageAttachmentBucket(req.Type), *req.FileURL)
+		response.Error(w, http.StatusBadRequest, "Invalid file_url")
+		return
+	}
 
 	client := s.supabase.GetAuthenticatedClient(accessToken)
 
 	type threadRowSimple struct {
-		CreatedBy string `json:"created_by"`
+		CreatedBy  string  `json:"created_by"`
+		MergedInto *string `json:"merged_into"`
 	}
 	var threadRows []threadRowSimple
 	_, err := client.From("threads").
-		Select("created_by", "", false).
+		Select("created_by, merged_into", "", false).
 		Eq("id", req.ThreadID).
 		ExecuteTo(&threadRows)
 
+	// 統合済みのスレッドには送信できない（統合先のスレッドIDを返す）
+	if err == nil && len(threadRows) > 0 && threadRows[0].MergedInto != nil {
+		response.Error(w, http.StatusConflict, fmt.Sprintf("This thread has been merged into %s", *threadRows[0].MergedInto))
+		return
+	}
+
+	// ブロックしている・されている参加者がいるスレッドには送信できない
+	participantIDs, err := s.threadParticipantIDs(s.supabase.GetServiceClient(), req.ThreadID)
+	blocked := false
+	if err == nil {
+		blocked, err = s.blockedAmong(userID, participantIDs)
+	}
+	if err != nil {
+		log.Printf("[SendMessage] Failed to query blocks of %s in thread %s: %v", userID, req.ThreadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to send message")
+		return
+	}
+	if blocked {
+		log.Printf("[SendMessage] ❌ Blocked between %s and a participant of thread %s", userID, req.ThreadID)
+		response.Error(w, http.StatusForbidden, "You cannot send messages to this user")
+		return
+	}
+
 	if err == nil && len(threadRows) > 0 && threadRows[0].CreatedBy == userID {
 		var participantCheck []participantCheck
 		_, checkErr := client.From("thread_participants").
@@ -1305,6 +1234,23 @@ func (s *Server) SendMessage(w http.ResponseWriter, r *http.Request) {
 		sanitizedTextPtr = &sanitizedText.Sanitized
 	}
 
+	// 連絡先（電話番号・メール・LINE IDなど）の直接交換は商談ステージごとのポリシーに従う
+	var contacts contactCheck
+	if sanitizedTextPtr != nil {
+		contacts = s.screenContacts("SendMessage", userID, *sanitizedTextPtr, func() string {
+			return s.threadContactContext(req.ThreadID)
+		})
+		if contacts.blocked() {
+			// 参加していないスレッドへの送信は記録しない（送信自体もRLSで拒否される）
+			if containsString(participantIDs, userID) {
+				s.recordContactFlag("SendMessage", userID, contacts, models.ContactSourceMessage, "", req.ThreadID, "")
+			}
+			response.Error(w, http.StatusUnprocessableEntity, contacts.blockedMessage())
+			return
+		}
+		sanitizedTextPtr = &contacts.Text
+	}
+
 	insertData := messageInsert{
 		ThreadID:     req.ThreadID,
 		SenderUserID: userID,
@@ -1385,6 +1331,14 @@ func (s *Server) SendMessage(w http.ResponseWriter, r *http.Request) {
 							}
 						}
 
+						// 添付は保存されていないため、他の参加者にはURLなしで配信
+						pushed := messageWithSender
+						pushed.ImageURL = nil
+						s.publishMessageCreated("SendMessage", pushed, "")
+						s.notifyNewMessage(messageWithSender)
+
+						s.recordContactFlag("SendMessage", userID, contacts, models.ContactSourceMessage, message.ID, req.ThreadID, "")
+						messageWithSender.ContactWarning = contacts.warning()
 						response.Success(w, http.StatusCreated, messageWithSender)
 						return
 					}
@@ -1436,6 +1390,7 @@ func (s *Server) SendMessage(w http.ResponseWriter, r *http.Request) {
 		messageWithSender.SenderIconURL = profile.IconURL
 	}
 
+	attachmentPath := ""
 	if req.FileURL != nil && *req.FileURL != "" {
 		type attachmentInsert struct {
 			MessageID string `json:"message_id"`
@@ -1452,24 +1407,23 @@ func (s *Server) SendMessage(w http.ResponseWriter, r *http.Request) {
 			Execute()
 
 		if err == nil {
-			// 契約書の場合はcontract-documentsバケットから、画像の場合はmessage-imagesバケットからURLを取得
-			bucketName := "message-images"
-			if req.Type == models.MessageTypeContract || req.Type == models.MessageTypeNDA {
-				bucketName = "contract-documents"
-			}
-			
-			// 画像URLを取得（publicバケットの場合は直接URL、privateバケットの場合はsigned URL）
-			imageURL, err := s.supabase.GetImageURL(bucketName, *req.FileURL, 3600)
-			if err == nil {
+			attachmentPath = *req.FileURL
+			// 透かし入りで配信するダウンロードプロキシのURL（バケットはメッセージ種別から判定）
+			if imageURL := s.messageAttachmentURL("SendMessage", userID, message.ID, *req.FileURL); imageURL != "" {
 				messageWithSender.ImageURL = &imageURL
 			} else {
-				log.Printf("[SendMessage] Failed to generate image URL: %v", err)
 				// エラーが発生してもファイルパスをそのまま設定
 				messageWithSender.ImageURL = req.FileURL
 			}
 		}
 	}
 
+	// スレッド参加者にリアルタイム配信
+	s.publishMessageCreated("SendMessage", messageWithSender, attachmentPath)
+	s.notifyNewMessage(messageWithSender)
+
+	s.recordContactFlag("SendMessage", userID, contacts, models.ContactSourceMessage, message.ID, req.ThreadID, "")
+	messageWithSender.ContactWarning = contacts.warning()
 	response.Success(w, http.StatusCreated, messageWithSender)
 }
 
@@ -1502,37 +1456,24 @@ func (s *Server) UploadMessageImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 🔒 SECURITY: 種類は中身から判定する（クライアントのContent-Typeや拡張子は信用しない）。
+	// 拡張子も判定した種類から付け、HTMLなどが画像として保存されないようにする
 	contentType := http.DetectContentType(fileData)
-	if contentType == "application/octet-stream" || contentType == "application/json" {
-		headerContentType := header.Header.Get("Content-Type")
-		if headerContentType != "" {
-			contentType = headerContentType
-		} else {
-			ext := filepath.Ext(header.Filename)
-			mimeType := mime.TypeByExtension(ext)
-			if mimeType != "" {
-				contentType = mimeType
-			}
-		}
-	}
 
-	if contentType == "image/jpg" {
-		contentType = "image/jpeg"
+	allowedTypes := map[string]string{
+		"image/jpeg": ".jpg",
+		"image/png":  ".png",
+		"image/webp": ".webp",
+		"image/gif":  ".gif",
 	}
 
-	allowedTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/png":  true,
-		"image/webp": true,
-		"image/gif":  true,
-	}
-
-	if !allowedTypes[contentType] {
+	ext, allowed := allowedTypes[contentType]
+	if !allowed {
+		log.Printf("[UploadMessageImage] ❌ Rejected %s (detected %s)", header.Filename, contentType)
 		response.Error(w, http.StatusBadRequest, "Invalid file type. Only JPEG, PNG, WEBP, and GIF are allowed")
 		return
 	}
 
-	ext := filepath.Ext(header.Filename)
 	fileName := fmt.Sprintf("%s/%s%s", userID, uuid.New().String(), ext)
 
 	filePath, err := s.supabase.UploadFile(userID, "message-images", fileName, fileData, contentType)
@@ -1597,18 +1538,12 @@ func (s *Server) UploadContractDocument(w http.ResponseWriter, r *http.Request)
 	}
 	client := s.supabase.GetAuthenticatedClient(accessToken)
 
-	var participantCheck []struct {
-		UserID string `json:"user_id"`
+	// アドバイザーはDD資料・その他の資料のみ提出できる（当事者間の契約書は売り手・買い手のみ）
+	permission := models.ThreadPermissionUploadContract
+	if contractType == "dd" || contractType == "custom" {
+		permission = models.ThreadPermissionUploadDocument
 	}
-	_, err = client.From("thread_participants").
-		Select("user_id", "", false).
-		Eq("thread_id", threadID).
-		Eq("user_id", userID).
-		ExecuteTo(&participantCheck)
-
-	if err != nil || len(participantCheck) == 0 {
-		log.Printf("[UploadContractDocument] User is not a participant of the thread: %v", err)
-		response.Error(w, http.StatusForbidden, "You are not a participant of this thread")
+	if _, ok := s.requireThreadPermission(w, "UploadContractDocument", threadID, userID, permission); !ok {
 		return
 	}
 
@@ -1690,9 +1625,12 @@ func (s *Server) UploadContractDocument(w http.ResponseWriter, r *http.Request)
 		ContentType:  contentType,
 	}
 
-	_, _, err = client.From("thread_contract_documents").
+	var insertedDocs []struct {
+		ID string `json:"id"`
+	}
+	_, err = client.From("thread_contract_documents").
 		Insert(contractDoc, false, "", "", "").
-		Execute()
+		ExecuteTo(&insertedDocs)
 
 	if err != nil {
 		log.Printf("[UploadContractDocument] Failed to save contract document to database: %v", err)
@@ -1701,11 +1639,16 @@ func (s *Server) UploadContractDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 署名付きURLを生成してレスポンスに含める
-	signedURL, err := s.supabase.GetImageURL("contract-documents", filePath, 3600)
-	if err != nil {
-		log.Printf("[UploadContractDocument] Failed to generate signed URL: %v", err)
-		signedURL = "" // エラーでも続行
+	// 透かし入りで配信するダウンロードプロキシのURLをレスポンスに含める（エラーでも続行）
+	signedURL := ""
+	if len(insertedDocs) > 0 {
+		signedURL = s.protectedFileURLString("UploadContractDocument", userID, models.ProtectedFileContractDocument, insertedDocs[0].ID)
+		s.publishThreadEvent("UploadContractDocument", threadID, "", models.RealtimeEventContractUploaded, models.RealtimeContractUploaded{
+			ID:           insertedDocs[0].ID,
+			ContractType: contractType,
+			FileName:     header.Filename,
+			UploadedBy:   userID,
+		})
 	}
 
 	response.Success(w, http.StatusCreated, map[string]string{
@@ -1841,12 +1784,8 @@ func (s *Server) GetThreadContractDocuments(w http.ResponseWriter, r *http.Reque
 
 	contracts := make([]contractDocumentResponse, 0, len(contractRows))
 	for _, row := range contractRows {
-		signedURL, err := s.supabase.GetImageURL("contract-documents", row.FilePath, 3600)
-		if err != nil {
-			log.Printf("[GetThreadContractDocuments] Failed to generate signed URL for %s: %v", row.FilePath, err)
-			// エラーでも続行（signedURLは空文字列）
-			signedURL = ""
-		}
+		// 閲覧者の透かしを入れて配信するダウンロードプロキシのURL（エラーでも続行、signedURLは空文字列）
+		signedURL := s.protectedFileURLString("GetThreadContractDocuments", userID, models.ProtectedFileContractDocument, row.ID)
 
 		// 署名情報を追加
 		signatures := make([]signatureResponse, 0)
@@ -2076,19 +2015,8 @@ func (s *Server) AddContractSignature(w http.ResponseWriter, r *http.Request) {
 
 	contract := existingContract[0]
 
-	// スレッドの参加者であることを確認
-	var participantCheck []struct {
-		UserID string `json:"user_id"`
-	}
-	_, err = client.From("thread_participants").
-		Select("user_id", "", false).
-		Eq("thread_id", contract.ThreadID).
-		Eq("user_id", userID).
-		ExecuteTo(&participantCheck)
-
-	if err != nil || len(participantCheck) == 0 {
-		log.Printf("[AddContractSignature] User is not a participant: %v", err)
-		response.Error(w, http.StatusForbidden, "You are not a participant of this thread")
+	// スレッドの参加者で、署名できる役割（売り手・買い手）であることを確認
+	if _, ok := s.requireThreadPermission(w, "AddContractSignature", contract.ThreadID, userID, models.ThreadPermissionSignContract); !ok {
 		return
 	}
 
@@ -2142,34 +2070,11 @@ func (s *Server) CreateSaleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 	client := s.supabase.GetAuthenticatedClient(accessToken)
 
-	// スレッドの参加者であることを確認
-	var participantCheck []struct {
-		UserID string `json:"user_id"`
+	// スレッドの参加者で、売却リクエストを作成できる役割（売り手）であることを確認
+	if _, ok := s.requireThreadPermission(w, "CreateSaleRequest", req.ThreadID, userID, models.ThreadPermissionCreateSaleRequest); !ok {
+		return
 	}
 	var err error
-	_, err = client.From("thread_participants").
-		Select("user_id", "", false).
-		Eq("thread_id", req.ThreadID).
-		Eq("user_id", userID).
-		ExecuteTo(&participantCheck)
-
-	if err != nil || len(participantCheck) == 0 {
-		// スレッド作成者も参加者として扱う
-		var threadCheck []struct {
-			CreatedBy string `json:"created_by"`
-		}
-		_, err = client.From("threads").
-			Select("created_by", "", false).
-			Eq("id", req.ThreadID).
-			Eq("created_by", userID).
-			ExecuteTo(&threadCheck)
-
-		if err != nil || len(threadCheck) == 0 {
-			log.Printf("[CreateSaleRequest] User is not a participant: %v", err)
-			response.Error(w, http.StatusForbidden, "You are not a participant of this thread")
-			return
-		}
-	}
 
 	// 投稿がユーザーのものであることを確認
 	var postCheck []struct {
@@ -2260,36 +2165,37 @@ func (s *Server) CreateSaleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 🔒 METADATA: スレッド参加者から買い手を特定（売り手以外の参加者）
-	var threadParticipants []struct {
-		UserID string `json:"user_id"`
+	// 🔒 METADATA: 買い手の役割の参加者から買い手を特定（複数いる場合は指定が必要）
+	participants, err := s.threadParticipantRoles(s.supabase.GetServiceClient(), req.ThreadID)
+	if err != nil {
+		log.Printf("[CreateSaleRequest] Failed to query participants: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to verify thread participants")
+		return
 	}
-	_, err = client.From("thread_participants").
-		Select("user_id", "", false).
-		Eq("thread_id", req.ThreadID).
-		Neq("user_id", userID). // 売り手以外
-		ExecuteTo(&threadParticipants)
-
-	// 買い手情報を取得（スレッド参加者または作成者）
-	var buyerID string
-	if len(threadParticipants) > 0 {
-		buyerID = threadParticipants[0].UserID
-	} else {
-		// 参加者がいない場合はスレッド作成者を買い手とする
-		var threadInfo []struct {
-			CreatedBy string `json:"created_by"`
+	buyerIDs := make([]string, 0, 1)
+	for _, p := range participants {
+		if models.ThreadRole(p.Role) == models.ThreadRoleBuyer && p.UserID != userID {
+			buyerIDs = append(buyerIDs, p.UserID)
 		}
-		_, err = client.From("threads").
-			Select("created_by", "", false).
-			Eq("id", req.ThreadID).
-			ExecuteTo(&threadInfo)
+	}
 
-		if err != nil || len(threadInfo) == 0 || threadInfo[0].CreatedBy == userID {
-			log.Printf("[CreateSaleRequest] Could not find buyer in thread")
-			response.Error(w, http.StatusBadRequest, "No buyer found in thread")
+	var buyerID string
+	switch {
+	case req.BuyerUserID != nil && *req.BuyerUserID != "":
+		if !containsString(buyerIDs, *req.BuyerUserID) {
+			response.Error(w, http.StatusBadRequest, "buyer_user_id must be a buyer of this thread")
 			return
 		}
-		buyerID = threadInfo[0].CreatedBy
+		buyerID = *req.BuyerUserID
+	case len(buyerIDs) == 1:
+		buyerID = buyerIDs[0]
+	case len(buyerIDs) == 0:
+		log.Printf("[CreateSaleRequest] Could not find buyer in thread")
+		response.Error(w, http.StatusBadRequest, "No buyer found in thread")
+		return
+	default:
+		response.Error(w, http.StatusBadRequest, "buyer_user_id is required for threads with more than one buyer")
+		return
 	}
 
 	// 買い手のプロフィールを取得
@@ -2315,6 +2221,7 @@ func (s *Server) CreateSaleRequest(w http.ResponseWriter, r *http.Request) {
 	type saleRequestInsert struct {
 		ThreadID    string `json:"thread_id"`
 		UserID      string `json:"user_id"`
+		BuyerUserID string `json:"buyer_user_id"`
 		PostID      string `json:"post_id"`
 		Price       int64  `json:"price"`
 		PhoneNumber string `json:"phone_number,omitempty"`
@@ -2324,6 +2231,7 @@ func (s *Server) CreateSaleRequest(w http.ResponseWriter, r *http.Request) {
 	insertData := saleRequestInsert{
 		ThreadID:    req.ThreadID,
 		UserID:      userID,
+		BuyerUserID: buyerID,
 		PostID:      req.PostID,
 		Price:       actualPrice, // 🔒 DB価格を使用
 		PhoneNumber: req.PhoneNumber,
@@ -2347,6 +2255,13 @@ func (s *Server) CreateSaleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.publishThreadEvent("CreateSaleRequest", req.ThreadID, "", models.RealtimeEventSaleRequestUpdated, models.RealtimeSaleRequestStatus{
+		ID:     createdRequests[0].ID,
+		PostID: createdRequests[0].PostID,
+		Status: createdRequests[0].Status,
+	})
+	s.notifySaleRequest(userID, createdRequests[0], models.SaleRequestStatusPending)
+
 	response.Success(w, http.StatusCreated, createdRequests[0])
 }
 
@@ -2453,12 +2368,14 @@ func (s *Server) RefundSaleRequest(w http.ResponseWriter, r *http.Request) {
 
 	// 売却リクエストを取得
 	var saleRequests []struct {
-		ID              string `json:"id"`
-		UserID          string `json:"user_id"`
-		ThreadID        string `json:"thread_id"`
-		PaymentIntentID string `json:"payment_intent_id"`
-		Price           int64  `json:"price"`
-		Status          string `json:"status"`
+		ID              string  `json:"id"`
+		UserID          string  `json:"user_id"`
+		BuyerUserID     *string `json:"buyer_user_id"`
+		ThreadID        string  `json:"thread_id"`
+		PostID          string  `json:"post_id"`
+		PaymentIntentID string  `json:"payment_intent_id"`
+		Price           int64   `json:"price"`
+		Status          string  `json:"status"`
 	}
 
 	var err error
@@ -2515,6 +2432,20 @@ func (s *Server) RefundSaleRequest(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Printf("[RefundSaleRequest] Failed to update sale_request status: %v", err)
 		// Stripe返金は既に完了しているので、エラーにはしない
+	} else {
+		s.publishThreadEvent("RefundSaleRequest", saleRequest.ThreadID, "", models.RealtimeEventSaleRequestUpdated, models.RealtimeSaleRequestStatus{
+			ID:     saleRequest.ID,
+			PostID: saleRequest.PostID,
+			Status: models.SaleRequestStatusCancelled,
+		})
+		s.notifySaleRequest(userID, models.SaleRequest{
+			ID:          saleRequest.ID,
+			ThreadID:    saleRequest.ThreadID,
+			UserID:      saleRequest.UserID,
+			BuyerUserID: saleRequest.BuyerUserID,
+			PostID:      saleRequest.PostID,
+			Price:       saleRequest.Price,
+		}, models.SaleRequestStatusCancelled)
 	}
 
 	response.Success(w, http.StatusOK, map[string]interface{}{
@@ -2660,6 +2591,17 @@ func (s *Server) ConfirmSaleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 指定された買い手本人のみ確定できる（アドバイザーは確定できない）
+	if saleRequest.BuyerUserID != nil {
+		if *saleRequest.BuyerUserID != userID {
+			log.Printf("[ConfirmSaleRequest] ❌ User %s is not the buyer of sale request %s", userID, saleRequest.ID)
+			response.Error(w, http.StatusForbidden, "Only the buyer can confirm this sale request")
+			return
+		}
+	} else if _, ok := s.requireThreadPermission(w, "ConfirmSaleRequest", saleRequest.ThreadID, userID, models.ThreadPermissionConfirmPurchase); !ok {
+		return
+	}
+
 	// ステータスがpendingであることを確認
 	if saleRequest.Status != models.SaleRequestStatusPending {
 		log.Printf("[ConfirmSaleRequest] Sale request is not in pending status: %s", saleRequest.Status)
@@ -2685,10 +2627,20 @@ func (s *Server) ConfirmSaleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[ConfirmSaleRequest] Sale request confirmed: %s", req.SaleRequestID)
+	s.publishThreadEvent("ConfirmSaleRequest", saleRequest.ThreadID, "", models.RealtimeEventSaleRequestUpdated, models.RealtimeSaleRequestStatus{
+		ID:     saleRequest.ID,
+		PostID: saleRequest.PostID,
+		Status: models.SaleRequestStatusActive,
+	})
+	s.notifySaleRequest(userID, saleRequest, models.SaleRequestStatusActive)
 
-	// 購入確定レスポンス（買い手には運営口座情報をメールで送信）
+	// 購入確定レスポンス（買い手には振込先をメールで送信。メール未設定の環境では運営から案内する）
+	message := "Purchase confirmed. Our team will contact you with payment instructions; please check your notifications."
+	if s.config.EmailEnabled() {
+		message = "Purchase confirmed. Please check your email for payment instructions."
+	}
 	response.Success(w, http.StatusOK, map[string]interface{}{
-		"message":         "Purchase confirmed. Please check your email for payment instructions.",
+		"message":         message,
 		"sale_request_id": saleRequest.ID,
 		"amount":          saleRequest.Price,
 		"status":          "active",
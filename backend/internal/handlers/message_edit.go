@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const messageSelectColumns = "id, thread_id, sender_user_id, type, text, edited_at, deleted_at, created_at"
+
+// HandleMessageByID routes /api/messages/:id requests
+func (s *Server) HandleMessageByID(w http.ResponseWriter, r *http.Request) {
+	// 編集・削除前の版（運営のみ）
+	if strings.HasSuffix(r.URL.Path, "/history") {
+		s.GetMessageHistory(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.UpdateMessage(w, r)
+	case http.MethodDelete:
+		s.DeleteMessage(w, r)
+	default:
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// UpdateMessage edits the text of the user's own message within the edit window.
+// The previous text is kept in message_revisions.
+// PUT /api/messages/:id
+func (s *Server) UpdateMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	messageID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/messages/"), "/")
+
+	var req models.UpdateMessageRequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	row, ok := s.requireRevisableMessage(w, "UpdateMessage", messageID, userID)
+	if !ok {
+		return
+	}
+
+	// 🔒 SECURITY: 送信時と同じサニタイズを行う
+	sanitizedText := utils.SanitizeText(utils.SanitizeInput{
+		Value:      req.Text,
+		MaxLength:  utils.MaxTextareaLength,
+		AllowHTML:  false,
+		StrictMode: false,
+	})
+	if !sanitizedText.IsValid {
+		log.Printf("[UpdateMessage] Message contains potentially malicious content: %v", sanitizedText.Errors)
+	}
+
+	// 編集で連絡先を書き足すこともできるため、送信時と同じポリシーを適用する
+	contacts := s.screenContacts("UpdateMessage", userID, sanitizedText.Sanitized, func() string {
+		return s.threadContactContext(row.ThreadID)
+	})
+	if contacts.blocked() {
+		s.recordContactFlag("UpdateMessage", userID, contacts, models.ContactSourceMessage, messageID, row.ThreadID, "")
+		response.Error(w, http.StatusUnprocessableEntity, contacts.blockedMessage())
+		return
+	}
+
+	updated, ok := s.reviseMessage(w, "UpdateMessage", messageID, userID, models.MessageRevisionEdit, &contacts.Text)
+	if !ok {
+		return
+	}
+	s.recordContactFlag("UpdateMessage", userID, contacts, models.ContactSourceMessage, messageID, row.ThreadID, "")
+
+	filePath := s.messageAttachmentPath("UpdateMessage", messageID)
+	message := s.messageWithSender("UpdateMessage", userID, updated, filePath)
+	s.publishMessageEvent("UpdateMessage", models.RealtimeEventMessageUpdated, message, filePath)
+
+	log.Printf("[UpdateMessage] ✓ Message %s edited by %s", messageID, userID)
+	message.ContactWarning = contacts.warning()
+	response.Success(w, http.StatusOK, message)
+}
+
+// DeleteMessage deletes the user's own message within the edit window.
+// The row is kept as a tombstone (deleted_at) without text or attachment; the original is kept for operators.
+// DELETE /api/messages/:id
+func (s *Server) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	messageID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/messages/"), "/")
+
+	if _, ok := s.requireRevisableMessage(w, "DeleteMessage", messageID, userID); !ok {
+		return
+	}
+
+	deleted, ok := s.reviseMessage(w, "DeleteMessage", messageID, userID, models.MessageRevisionDelete, nil)
+	if !ok {
+		return
+	}
+
+	message := s.messageWithSender("DeleteMessage", userID, deleted, "")
+	deletedAt := time.Now().UTC()
+	if message.DeletedAt != nil {
+		deletedAt = *message.DeletedAt
+	}
+	s.publishThreadEvent("DeleteMessage", message.ThreadID, "", models.RealtimeEventMessageDeleted, models.RealtimeMessageDeleted{
+		ID:        message.ID,
+		DeletedAt: deletedAt,
+	})
+
+	log.Printf("[DeleteMessage] ✓ Message %s deleted by %s", messageID, userID)
+	response.Success(w, http.StatusOK, message)
+}
+
+// GetMessageHistory returns a message with its previous versions, for dispute handling (operators only)
+// GET /api/messages/:id/history
+func (s *Server) GetMessageHistory(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodGet) {
+		return
+	}
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	messageID := strings.TrimPrefix(r.URL.Path, "/api/messages/")
+	messageID = strings.Trim(strings.TrimSuffix(messageID, "/history"), "/")
+
+	if !s.isOperator(s.supabase.GetAuthenticatedClient(accessToken), userID) {
+		log.Printf("[GetMessageHistory] ❌ User %s is not an operator", userID)
+		response.Error(w, http.StatusForbidden, "Only operators can view message history")
+		return
+	}
+
+	// 🔒 SECURITY: 削除済みの本文を含むため service role で取得する（RLSでは参照できない）
+	serviceClient := s.supabase.GetServiceClient()
+	var rows []messageRow
+	_, err := serviceClient.From("messages").
+		Select(messageSelectColumns, "", false).
+		Eq("id", messageID).
+		ExecuteTo(&rows)
+	if err != nil {
+		log.Printf("[GetMessageHistory] Failed to query message %s: %v", messageID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query message")
+		return
+	}
+	if len(rows) == 0 {
+		response.Error(w, http.StatusNotFound, "Message not found")
+		return
+	}
+
+	revisions := make([]models.MessageRevision, 0)
+	_, err = serviceClient.From("message_revisions").
+		Select("id, message_id, thread_id, editor_user_id, action, previous_text, created_at", "", false).
+		Eq("message_id", messageID).
+		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&revisions)
+	if err != nil {
+		log.Printf("[GetMessageHistory] Failed to query revisions of %s: %v", messageID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query message history")
+		return
+	}
+
+	log.Printf("[GetMessageHistory] ✓ Operator %s viewed history of message %s (%d revisions)", userID, messageID, len(revisions))
+	response.Success(w, http.StatusOK, models.MessageHistory{
+		Message:   messageFromRow(rows[0]),
+		Revisions: revisions,
+	})
+}
+
+// requireRevisableMessage checks that the user sent the message, that it is not deleted and that the
+// edit window has not passed. Writes the error response and returns false otherwise.
+func (s *Server) requireRevisableMessage(w http.ResponseWriter, handler string, messageID string, userID string) (*messageRow, bool) {
+	if messageID == "" {
+		response.Error(w, http.StatusBadRequest, "Message ID required")
+		return nil, false
+	}
+
+	var rows []messageRow
+	_, err := s.supabase.GetServiceClient().From("messages").
+		Select(messageSelectColumns, "", false).
+		Eq("id", messageID).
+		ExecuteTo(&rows)
+	if err != nil {
+		log.Printf("[%s] Failed to query message %s: %v", handler, messageID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query message")
+		return nil, false
+	}
+	// 🔒 SECURITY: 他人のメッセージは存在も明かさない
+	if len(rows) == 0 || rows[0].SenderUserID != userID {
+		response.Error(w, http.StatusNotFound, "Message not found")
+		return nil, false
+	}
+	row := &rows[0]
+
+	if row.DeletedAt != nil {
+		response.Error(w, http.StatusConflict, "The message has already been deleted")
+		return nil, false
+	}
+	// 契約書・NDAのメッセージは書類と紐づくため編集・削除できない
+	switch models.MessageType(row.Type) {
+	case models.MessageTypeContract, models.MessageTypeNDA:
+		response.Error(w, http.StatusBadRequest, "Contract and NDA messages cannot be edited or deleted")
+		return nil, false
+	}
+	if time.Since(parseTime(row.CreatedAt)) > s.config.MessageEditWindow {
+		response.Error(w, http.StatusForbidden, "The message can no longer be edited or deleted")
+		return nil, false
+	}
+	return row, true
+}
+
+// reviseMessage stores the current version and applies the edit or deletion in one transaction
+func (s *Server) reviseMessage(w http.ResponseWriter, handler string, messageID string, userID string, action models.MessageRevisionAction, text *string) (messageRow, bool) {
+	var rows []messageRow
+	err := s.supabase.CallRPC("revise_message", map[string]interface{}{
+		"p_message_id": messageID,
+		"p_editor_id":  userID,
+		"p_action":     string(action),
+		"p_text":       text,
+	}, &rows)
+	if err != nil {
+		// 同時に削除された場合
+		if strings.Contains(err.Error(), "message already deleted") {
+			response.Error(w, http.StatusConflict, "The message has already been deleted")
+			return messageRow{}, false
+		}
+		log.Printf("[%s] ❌ Failed to %s message %s: %v", handler, action, messageID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to update message")
+		return messageRow{}, false
+	}
+	if len(rows) == 0 {
+		response.Error(w, http.StatusNotFound, "Message not found")
+		return messageRow{}, false
+	}
+	return rows[0], true
+}
+
+// messageAttachmentPath returns the stored attachment path of a message ("" if none)
+func (s *Server) messageAttachmentPath(handler string, messageID string) string {
+	var attachments []attachmentRow
+	_, err := s.supabase.GetServiceClient().From("message_attachments").
+		Select("message_id, file_url", "", false).
+		Eq("message_id", messageID).
+		Limit(1, "").
+		ExecuteTo(&attachments)
+	if err != nil {
+		log.Printf("[%s] ⚠️ Failed to query attachment of message %s: %v", handler, messageID, err)
+		return ""
+	}
+	if len(attachments) == 0 {
+		return ""
+	}
+	return attachments[0].FileURL
+}
+
+// messageWithSender builds the response of one message for the viewer
+func (s *Server) messageWithSender(handler string, viewerID string, row messageRow, filePath string) models.MessageWithSender {
+	message := models.MessageWithSender{
+		Message:    messageFromRow(row),
+		SenderName: "不明なユーザー",
+	}
+
+	var profiles []profileRowSimple
+	_, err := s.supabase.GetServiceClient().From("profiles").
+		Select("id, display_name, icon_url", "", false).
+		Eq("id", row.SenderUserID).
+		ExecuteTo(&profiles)
+	if err == nil && len(profiles) > 0 {
+		message.SenderName = profiles[0].DisplayName
+		message.SenderIconURL = profiles[0].IconURL
+	}
+
+	if filePath != "" && row.DeletedAt == nil {
+		if imageURL := s.messageAttachmentURL(handler, viewerID, row.ID, filePath); imageURL != "" {
+			message.ImageURL = &imageURL
+		}
+	}
+	return message
+}
+
+func messageFromRow(row messageRow) models.Message {
+	return models.Message{
+		ID:           row.ID,
+		ThreadID:     row.ThreadID,
+		SenderUserID: row.SenderUserID,
+		Type:         models.MessageType(row.Type),
+		Text:         row.Text,
+		EditedAt:     parseOptionalTime(row.EditedAt),
+		DeletedAt:    parseOptionalTime(row.DeletedAt),
+		CreatedAt:    parseTime(row.CreatedAt),
+	}
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	defaultMessageSearchLimit = 20
+	maxMessageSearchLimit     = 50
+	maxMessageSearchQuery     = 200 // 文字数
+	maxMessageSearchTerms     = 5
+	// スニペットは最初のヒットの前に少し文脈を残して切り出す
+	messageSnippetLength  = 120
+	messageSnippetContext = 40
+)
+
+// SearchMessages searches the messages of the threads the user participates in.
+// All whitespace-separated keywords must match (substring match, so Japanese works without word breaks;
+// case, full-width and half-width forms are ignored). Filters: thread_id, sender_id,
+// type (comma-separated: text,image,file,contract,nda), from / to (YYYY-MM-DD, JST, inclusive).
+// Results are newest first; pass next_cursor as ?cursor= for the next page.
+// GET /api/messages/search?q=...
+func (s *Server) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodGet) {
+		return
+	}
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	payload := map[string]interface{}{"p_user_id": userID}
+
+	q := strings.TrimSpace(query.Get("q"))
+	if utf8.RuneCountInString(q) > maxMessageSearchQuery {
+		response.Error(w, http.StatusBadRequest, "Search query is too long")
+		return
+	}
+	terms := strings.Fields(q) // 全角スペースも区切りとして扱う
+	if len(terms) > maxMessageSearchTerms {
+		response.Error(w, http.StatusBadRequest, "Too many search keywords (max 5)")
+		return
+	}
+	payload["p_terms"] = terms
+
+	hasFilter := false
+	for _, name := range []string{"thread_id", "sender_id"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		if _, err := uuid.Parse(value); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		payload["p_"+name] = value
+		hasFilter = true
+	}
+
+	if typeStr := query.Get("type"); typeStr != "" {
+		var types []string
+		for _, t := range strings.Split(typeStr, ",") {
+			switch models.MessageType(strings.TrimSpace(t)) {
+			case models.MessageTypeText, models.MessageTypeImage, models.MessageTypeFile, models.MessageTypeContract, models.MessageTypeNDA:
+				types = append(types, strings.TrimSpace(t))
+			default:
+				response.Error(w, http.StatusBadRequest, "Invalid message type: "+t)
+				return
+			}
+		}
+		payload["p_types"] = types
+		hasFilter = true
+	}
+
+	var from, to time.Time
+	if fromStr := query.Get("from"); fromStr != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", fromStr, analyticsLocation)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid from date (expected YYYY-MM-DD)")
+			return
+		}
+		from = parsed
+		payload["p_from"] = from.UTC().Format(time.RFC3339)
+		hasFilter = true
+	}
+	if toStr := query.Get("to"); toStr != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", toStr, analyticsLocation)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid to date (expected YYYY-MM-DD)")
+			return
+		}
+		to = parsed.AddDate(0, 0, 1) // 終了日を含める
+		payload["p_to"] = to.UTC().Format(time.RFC3339)
+		hasFilter = true
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		response.Error(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	if len(terms) == 0 && !hasFilter {
+		response.Error(w, http.StatusBadRequest, "Search query or filter required")
+		return
+	}
+
+	limit := defaultMessageSearchLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= maxMessageSearchLimit {
+			limit = l
+		}
+	}
+	payload["p_limit"] = limit
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		createdAt, messageID, err := decodeMessageSearchCursor(cursor)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		payload["p_before_created_at"] = createdAt.Format(time.RFC3339Nano)
+		payload["p_before_id"] = messageID
+	}
+
+	// 🔒 SECURITY: 参加しているスレッドへの絞り込みは RPC 内で認証済みのユーザーIDにより行う
+	var rows []struct {
+		ID            string    `json:"id"`
+		ThreadID      string    `json:"thread_id"`
+		ThreadType    string    `json:"thread_type"`
+		RelatedPostID *string   `json:"related_post_id"`
+		SenderUserID  string    `json:"sender_user_id"`
+		Type          string    `json:"type"`
+		Text          *string   `json:"text"`
+		CreatedAt     time.Time `json:"created_at"`
+		ThreadOffset  int       `json:"thread_offset"`
+	}
+	if err := s.supabase.CallRPC("search_messages", payload, &rows); err != nil {
+		log.Printf("[SearchMessages] Failed to search messages for user %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to search messages")
+		return
+	}
+
+	senderIDs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if !containsString(senderIDs, row.SenderUserID) {
+			senderIDs = append(senderIDs, row.SenderUserID)
+		}
+	}
+	names := s.fetchDisplayNames(s.supabase.GetServiceClient(), senderIDs...)
+
+	result := models.MessageSearchResponse{Hits: make([]models.MessageSearchHit, 0, len(rows))}
+	for _, row := range rows {
+		text := ""
+		if row.Text != nil {
+			text = *row.Text
+		}
+		snippet, highlights := buildMessageSnippet(text, terms)
+		result.Hits = append(result.Hits, models.MessageSearchHit{
+			ID:            row.ID,
+			ThreadID:      row.ThreadID,
+			ThreadType:    models.ThreadType(row.ThreadType),
+			RelatedPostID: row.RelatedPostID,
+			SenderUserID:  row.SenderUserID,
+			SenderName:    names[row.SenderUserID],
+			Type:          models.MessageType(row.Type),
+			Snippet:       snippet,
+			Highlights:    highlights,
+			CreatedAt:     row.CreatedAt,
+			Jump: models.MessageSearchJump{
+				ThreadID:  row.ThreadID,
+				MessageID: row.ID,
+				Offset:    row.ThreadOffset,
+			},
+		})
+	}
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		result.NextCursor = encodeMessageSearchCursor(last.CreatedAt, last.ID)
+	}
+
+	log.Printf("[SearchMessages] ✓ %d hits for user %s (terms: %d)", len(result.Hits), userID, len(terms))
+	response.Success(w, http.StatusOK, result)
+}
+
+// encodeMessageSearchCursor encodes the position after the last hit of a page
+func encodeMessageSearchCursor(createdAt time.Time, messageID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + messageID))
+}
+
+func decodeMessageSearchCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	createdAtStr, messageID, _ := strings.Cut(string(raw), "|")
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if _, err := uuid.Parse(messageID); err != nil {
+		return time.Time{}, "", err
+	}
+	return createdAt, messageID, nil
+}
+
+// buildMessageSnippet cuts the part of text around the first keyword and returns the keyword positions in it.
+// Positions are in code points, so multi-byte (Japanese) text is never cut in the middle of a character.
+func buildMessageSnippet(text string, terms []string) (string, []models.TextRange) {
+	runes := []rune(text)
+	folded := make([]rune, len(runes))
+	for i, r := range runes {
+		if r == '\n' || r == '\r' || r == '\t' {
+			runes[i] = ' '
+		}
+		folded[i] = foldSearchRune(runes[i])
+	}
+
+	var ranges []models.TextRange
+	for _, term := range terms {
+		needle := []rune(term)
+		for i := range needle {
+			needle[i] = foldSearchRune(needle[i])
+		}
+		for i := 0; len(needle) > 0 && i+len(needle) <= len(folded); {
+			if slices.Equal(folded[i:i+len(needle)], needle) {
+				ranges = append(ranges, models.TextRange{Start: i, End: i + len(needle)})
+				i += len(needle)
+				continue
+			}
+			i++
+		}
+	}
+	ranges = mergeTextRanges(ranges)
+
+	start, end := 0, len(runes)
+	if len(runes) > messageSnippetLength {
+		if len(ranges) > 0 && ranges[0].Start > messageSnippetContext {
+			start = ranges[0].Start - messageSnippetContext
+		}
+		end = start + messageSnippetLength
+		if end > len(runes) {
+			end = len(runes)
+			start = end - messageSnippetLength
+		}
+	}
+
+	prefix := ""
+	if start > 0 {
+		prefix = "…"
+	}
+	suffix := ""
+	if end < len(runes) {
+		suffix = "…"
+	}
+	shift := utf8.RuneCountInString(prefix) - start
+
+	highlights := make([]models.TextRange, 0, len(ranges))
+	for _, rg := range ranges {
+		if rg.End <= start || rg.Start >= end {
+			continue
+		}
+		highlights = append(highlights, models.TextRange{
+			Start: max(rg.Start, start) + shift,
+			End:   min(rg.End, end) + shift,
+		})
+	}
+	return prefix + string(runes[start:end]) + suffix, highlights
+}
+
+// foldSearchRune folds case and full-width ASCII one rune at a time, so positions in the folded text
+// are positions in the original text (the database side additionally applies NFKC)
+func foldSearchRune(r rune) rune {
+	switch {
+	case r >= '！' && r <= '～':
+		r -= '！' - '!'
+	case r == '　':
+		r = ' '
+	}
+	return unicode.ToLower(r)
+}
+
+// mergeTextRanges sorts ranges and merges the overlapping ones
+func mergeTextRanges(ranges []models.TextRange) []models.TextRange {
+	if len(ranges) == 0 {
+		return ranges
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	merged := []models.TextRange{ranges[0]}
+	for _, rg := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if rg.Start <= last.End {
+			if rg.End > last.End {
+				last.End = rg.End
+			}
+			continue
+		}
+		merged = append(merged, rg)
+	}
+	return merged
+}
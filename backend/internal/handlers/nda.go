@@ -0,0 +1,1241 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	defaultNDAListLimit = 50
+	maxNDAListLimit     = 100
+)
+
+// errNDAStatusChanged is returned when a conditional status update matched no row
+// (the agreement was changed concurrently by the other party)
+var errNDAStatusChanged = errors.New("nda agreement status changed")
+
+// HandleNDAAgreements handles /api/nda-agreements
+// GET: list my agreements (?role=buyer|seller&status=...), POST: request an NDA
+func (s *Server) HandleNDAAgreements(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.ListNDAAgreements(w, r)
+	case http.MethodPost:
+		s.CreateNDAAgreement(w, r)
+	default:
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleNDAAgreementByID routes /api/nda-agreements/:id[/document|approve|decline|sign|cancel|scope|revoke]
+func (s *Server) HandleNDAAgreementByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 || parts[2] == "" {
+		response.Error(w, http.StatusBadRequest, "NDA agreement ID required")
+		return
+	}
+	agreementID := parts[2]
+	action := ""
+	if len(parts) > 3 {
+		action = parts[3]
+	}
+
+	method := http.MethodPost
+	if action == "" || action == "document" {
+		method = http.MethodGet
+	}
+	if r.Method != method {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	switch action {
+	case "":
+		s.GetNDAAgreement(w, r, agreementID)
+	case "document":
+		s.GetNDADocument(w, r, agreementID)
+	case "approve":
+		s.ApproveNDAAgreement(w, r, agreementID)
+	case "decline":
+		s.DeclineNDAAgreement(w, r, agreementID)
+	case "sign":
+		s.SignNDAAgreement(w, r, agreementID)
+	case "cancel":
+		s.CancelNDAAgreement(w, r, agreementID)
+	case "scope":
+		s.UpdateNDAScope(w, r, agreementID)
+	case "revoke":
+		s.RevokeNDAAgreement(w, r, agreementID)
+	default:
+		response.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// CreateNDAAgreement lets a buyer request an NDA for a listing (post_id) or directly with a seller (seller_user_id)
+// POST /api/nda-agreements
+func (s *Server) CreateNDAAgreement(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.CreateNDARequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+	serviceClient := s.supabase.GetServiceClient()
+
+	// 売り手を特定（投稿指定の場合は投稿者、組織の投稿なら組織が契約相手）
+	var seller ndaSeller
+	var contactUserID string
+	var postID *string
+	if req.PostID != nil && *req.PostID != "" {
+		// 🔒 SECURITY: 投稿は閲覧者のClientで取得し、RLSで見えない投稿には申請させない
+		var posts []models.Post
+		_, err := client.From("posts").
+			Select("*", "", false).
+			Eq("id", *req.PostID).
+			ExecuteTo(&posts)
+		if err != nil {
+			log.Printf("[CreateNDAAgreement] Failed to query post %s: %v", *req.PostID, err)
+			response.Error(w, http.StatusInternalServerError, "Failed to query post")
+			return
+		}
+		if len(posts) == 0 || !services.PostListable(posts[0], services.ViewerMember) {
+			response.Error(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		post := posts[0]
+		seller = sellerOf(post.AuthorUserID, post.AuthorOrgID)
+		contactUserID = post.AuthorUserID
+		postID = &post.ID
+	} else {
+		var profiles []struct {
+			ID string `json:"id"`
+		}
+		_, err := client.From("profiles").
+			Select("id", "", false).
+			Eq("id", *req.SellerUserID).
+			ExecuteTo(&profiles)
+		if err != nil || len(profiles) == 0 {
+			response.Error(w, http.StatusNotFound, "Seller not found")
+			return
+		}
+		// 投稿作成時と同じく、組織に所属する売り手とは組織として契約する
+		seller = sellerOf(*req.SellerUserID, s.getAuthorOrgID(serviceClient, *req.SellerUserID))
+		contactUserID = *req.SellerUserID
+	}
+
+	orgIDs, err := s.userOrgIDs(serviceClient, userID)
+	if err != nil {
+		log.Printf("[CreateNDAAgreement] Failed to query org memberships: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to verify organization")
+		return
+	}
+
+	if contactUserID == userID || (seller.OrgID != "" && containsString(orgIDs, seller.OrgID)) {
+		response.Error(w, http.StatusBadRequest, "Cannot request an NDA with yourself")
+		return
+	}
+
+	// 組織として申請する場合は所属を確認
+	if req.BuyerOrgID != nil && *req.BuyerOrgID != "" && !containsString(orgIDs, *req.BuyerOrgID) {
+		response.Error(w, http.StatusForbidden, "You are not a member of this organization")
+		return
+	}
+
+	// スコープ: 省略時は案件指定なら案件単位、売り手指定なら売り手単位
+	scope := models.NDAScopeSeller
+	if postID != nil {
+		scope = models.NDAScopeListing
+	}
+	if req.Scope != nil {
+		scope = *req.Scope
+	}
+	if scope == models.NDAScopeListing && postID == nil {
+		response.Error(w, http.StatusBadRequest, "post_id is required for a listing-scoped NDA")
+		return
+	}
+	if scope == models.NDAScopeOrg && seller.OrgID == "" {
+		response.Error(w, http.StatusBadRequest, "Seller does not belong to an organization")
+		return
+	}
+
+	// 希望する範囲を既に有効なNDAが含んでいれば申請不要
+	grants, err := newNDAResolver(client, userID).Grants(seller)
+	if err != nil {
+		log.Printf("[CreateNDAAgreement] Failed to check NDA: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to check NDA status")
+		return
+	}
+	for _, grant := range grants {
+		if services.NDAScopeIncludes(grant.Scope, scope) && grant.Covers(contactUserID, ndaStringValue(postID)) {
+			response.Error(w, http.StatusConflict, "An active NDA already covers this request")
+			return
+		}
+	}
+
+	insertData := map[string]interface{}{
+		"seller_user_id":         nil,
+		"seller_org_id":          nil,
+		"seller_contact_user_id": contactUserID,
+		"requested_by":           userID,
+		"post_id":                postID,
+		"scope":                  scope,
+		"status":                 models.NDAStatusRequested,
+	}
+	if seller.OrgID != "" {
+		insertData["seller_org_id"] = seller.OrgID
+	} else {
+		insertData["seller_user_id"] = seller.UserID
+	}
+	if req.BuyerOrgID != nil && *req.BuyerOrgID != "" {
+		insertData["buyer_org_id"] = *req.BuyerOrgID
+	} else {
+		insertData["buyer_user_id"] = userID
+	}
+	if req.Message != nil && strings.TrimSpace(*req.Message) != "" {
+		sanitized := utils.SanitizeText(utils.SanitizeInput{
+			Value:     *req.Message,
+			MaxLength: utils.MaxTextareaLength,
+			AllowHTML: false,
+		})
+		insertData["request_message"] = sanitized.Sanitized
+	}
+
+	// 🔒 SECURITY: 当事者の確認は上で済ませ、書き込みはService Clientで行う
+	var created []models.NDAAgreement
+	_, err = serviceClient.From("nda_agreements").
+		Insert(insertData, false, "", "", "").
+		ExecuteTo(&created)
+	if err != nil {
+		// 進行中の申請は部分ユニークインデックスで1件に制限している
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "23505") {
+			response.Error(w, http.StatusConflict, "An NDA request with this seller is already in progress")
+			return
+		}
+		log.Printf("[CreateNDAAgreement] Failed to insert agreement: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to create NDA request")
+		return
+	}
+	if len(created) == 0 {
+		response.Error(w, http.StatusInternalServerError, "Failed to create NDA request")
+		return
+	}
+	agreement := created[0]
+
+	// 買い手と売り手の窓口のスレッドにNDAのやり取りを記録する
+	threadID, err := s.ensureNDAThread(serviceClient, userID, contactUserID, postID)
+	if err != nil {
+		log.Printf("[CreateNDAAgreement] ⚠️ Failed to prepare thread for agreement %s: %v", agreement.ID, err)
+	} else {
+		_, _, err = serviceClient.From("nda_agreements").
+			Update(map[string]interface{}{"thread_id": threadID}, "minimal", "").
+			Eq("id", agreement.ID).
+			Execute()
+		if err != nil {
+			log.Printf("[CreateNDAAgreement] ⚠️ Failed to link thread %s: %v", threadID, err)
+		} else {
+			agreement.ThreadID = &threadID
+		}
+	}
+
+	note := ""
+	if agreement.RequestMessage != nil {
+		note = *agreement.RequestMessage
+	}
+	s.recordNDATransition(r, agreement, userID, models.NDAEventRequested, nil, nil, note, nil)
+
+	log.Printf("[CreateNDAAgreement] ✓ NDA %s requested by %s (seller: %s)", agreement.ID, userID, seller.key())
+	response.Success(w, http.StatusCreated, prepareNDAAgreementResponse(agreement, models.NDAPartyBuyer))
+}
+
+// ListNDAAgreements lists agreements where the user (or one of their organizations) is a party
+// GET /api/nda-agreements?role=buyer|seller&status=requested,approved&limit=&offset=
+func (s *Server) ListNDAAgreements(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	role := models.NDAParty(query.Get("role"))
+	if role != "" && role != models.NDAPartyBuyer && role != models.NDAPartySeller {
+		response.Error(w, http.StatusBadRequest, "role must be buyer or seller")
+		return
+	}
+
+	limit := defaultNDAListLimit
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	if limit > maxNDAListLimit {
+		limit = maxNDAListLimit
+	}
+	offset := 0
+	if v, err := strconv.Atoi(query.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	orgIDs, err := s.userOrgIDs(serviceClient, userID)
+	if err != nil {
+		log.Printf("[ListNDAAgreements] Failed to query org memberships: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query NDA agreements")
+		return
+	}
+
+	// 🔒 SECURITY: Service Clientで取得するため、当事者条件を必ず付ける
+	filter := ndaPartyFilter(userID, orgIDs, role)
+	q := serviceClient.From("nda_agreements").
+		Select("*", "", false).
+		Or(filter, "")
+	if status := query.Get("status"); status != "" {
+		q = q.In("status", strings.Split(status, ","))
+	}
+
+	var agreements []models.NDAAgreement
+	_, err = q.Order("created_at", nil).
+		Range(offset, offset+limit-1, "").
+		ExecuteTo(&agreements)
+	if err != nil {
+		log.Printf("[ListNDAAgreements] Failed to query agreements: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query NDA agreements")
+		return
+	}
+
+	result := make([]models.NDAAgreement, 0, len(agreements))
+	for _, a := range agreements {
+		a = s.expireNDAAgreement(serviceClient, a)
+		result = append(result, prepareNDAAgreementResponse(a, ndaPartyOf(a, userID, orgIDs)))
+	}
+	response.Success(w, http.StatusOK, result)
+}
+
+// GetNDAAgreement returns an agreement with its event history (parties only)
+// GET /api/nda-agreements/:id
+func (s *Server) GetNDAAgreement(w http.ResponseWriter, r *http.Request, agreementID string) {
+	userID, _, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	agreement, party, ok := s.loadNDAAgreementForParty(w, serviceClient, agreementID, userID)
+	if !ok {
+		return
+	}
+
+	var events []models.NDAAgreementEvent
+	_, err := serviceClient.From("nda_agreement_events").
+		Select("*", "", false).
+		Eq("agreement_id", agreement.ID).
+		Order("created_at", nil).
+		ExecuteTo(&events)
+	if err != nil {
+		log.Printf("[GetNDAAgreement] ⚠️ Failed to query events for %s: %v", agreement.ID, err)
+		events = []models.NDAAgreementEvent{}
+	}
+	// 🔒 SECURITY: IPアドレスは本人の操作分のみ返す
+	for i := range events {
+		if events[i].ActorUserID == nil || *events[i].ActorUserID != userID {
+			events[i].IPAddress = nil
+		}
+	}
+
+	response.Success(w, http.StatusOK, models.NDAAgreementDetail{
+		NDAAgreement: prepareNDAAgreementResponse(*agreement, party),
+		MyParty:      party,
+		Events:       events,
+	})
+}
+
+// GetNDADocument returns the document fixed at approval and its hash, which both parties sign
+// GET /api/nda-agreements/:id/document
+func (s *Server) GetNDADocument(w http.ResponseWriter, r *http.Request, agreementID string) {
+	userID, _, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	agreement, _, ok := s.loadNDAAgreementForParty(w, s.supabase.GetServiceClient(), agreementID, userID)
+	if !ok {
+		return
+	}
+	if agreement.DocumentContent == nil || agreement.DocumentHash == nil {
+		response.Error(w, http.StatusConflict, "NDA document is available after the seller approves the request")
+		return
+	}
+
+	// 保存された文面とハッシュの整合性を確認する
+	if services.HashNDADocument(*agreement.DocumentContent) != *agreement.DocumentHash {
+		log.Printf("[SECURITY ALERT] NDA document hash mismatch: agreement=%s", agreement.ID)
+		response.Error(w, http.StatusInternalServerError, "NDA document integrity check failed")
+		return
+	}
+
+	version := ""
+	if agreement.DocumentVersion != nil {
+		version = *agreement.DocumentVersion
+	}
+	response.Success(w, http.StatusOK, models.NDADocument{
+		AgreementID: agreement.ID,
+		Version:     version,
+		Content:     *agreement.DocumentContent,
+		Hash:        *agreement.DocumentHash,
+	})
+}
+
+// ApproveNDAAgreement approves a request and fixes the document to be signed (seller only).
+// The seller may change the requested scope and set an expiry (body is optional).
+// POST /api/nda-agreements/:id/approve
+func (s *Server) ApproveNDAAgreement(w http.ResponseWriter, r *http.Request, agreementID string) {
+	userID, _, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.ApproveNDARequest
+	if r.ContentLength != 0 && !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	agreement, party, ok := s.loadNDAAgreementForParty(w, serviceClient, agreementID, userID)
+	if !ok {
+		return
+	}
+	if party != models.NDAPartySeller {
+		response.Error(w, http.StatusForbidden, "Only the seller can approve an NDA request")
+		return
+	}
+	if !services.CanTransitionNDA(agreement.Status, models.NDAStatusApproved) {
+		response.Error(w, http.StatusConflict, fmt.Sprintf("Cannot approve an NDA in status %s", agreement.Status))
+		return
+	}
+
+	scope := agreement.Scope
+	if req.Scope != nil {
+		scope = *req.Scope
+	}
+	if !s.validateNDAScope(w, *agreement, scope) {
+		return
+	}
+
+	// 承認時点で署名対象の文面を確定する（以降の表示名変更などで文面が変わらないよう保存）
+	approvedAt := time.Now().UTC()
+	names := s.fetchDisplayNames(serviceClient, ndaStringValue(agreement.RequestedBy), ndaStringValue(agreement.SellerContactUserID))
+	content := services.BuildNDADocument(services.NDADocumentParams{
+		AgreementID: agreement.ID,
+		BuyerName:   ndaPartyName(names[ndaStringValue(agreement.RequestedBy)], agreement.BuyerOrgID),
+		SellerName:  ndaPartyName(names[ndaStringValue(agreement.SellerContactUserID)], agreement.SellerOrgID),
+		PostID:      ndaStringValue(agreement.PostID),
+		Scope:       scope,
+		ExpiresAt:   req.ExpiresAt,
+		ApprovedAt:  approvedAt,
+	})
+	hash := services.HashNDADocument(content)
+
+	update := map[string]interface{}{
+		"status":           models.NDAStatusApproved,
+		"scope":            scope,
+		"expires_at":       nil,
+		"approved_at":      approvedAt.Format(time.RFC3339),
+		"document_version": services.NDADocumentVersion,
+		"document_content": content,
+		"document_hash":    hash,
+		"updated_at":       approvedAt.Format(time.RFC3339),
+	}
+	if req.ExpiresAt != nil {
+		update["expires_at"] = req.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	updated, err := s.updateNDAAgreement(serviceClient, agreement.ID, agreement.Status, update)
+	if !s.handleNDAUpdateError(w, "ApproveNDAAgreement", err) {
+		return
+	}
+
+	// 申請時から範囲を変更して承認した場合は履歴に残す
+	var details *models.NDAScopeChange
+	if scope != agreement.Scope || req.ExpiresAt != nil {
+		details = &models.NDAScopeChange{FromScope: agreement.Scope, ToScope: scope, ToExpiresAt: updated.ExpiresAt}
+	}
+	from := agreement.Status
+	s.recordNDATransition(r, *updated, userID, models.NDAEventApproved, &from, &hash, "", details)
+
+	log.Printf("[ApproveNDAAgreement] ✓ NDA %s approved by %s", agreement.ID, userID)
+	response.Success(w, http.StatusOK, prepareNDAAgreementResponse(*updated, party))
+}
+
+// DeclineNDAAgreement declines a request (seller only)
+// POST /api/nda-agreements/:id/decline
+func (s *Server) DeclineNDAAgreement(w http.ResponseWriter, r *http.Request, agreementID string) {
+	userID, _, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.DeclineNDARequest
+	if r.ContentLength != 0 && !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	agreement, party, ok := s.loadNDAAgreementForParty(w, serviceClient, agreementID, userID)
+	if !ok {
+		return
+	}
+	if party != models.NDAPartySeller {
+		response.Error(w, http.StatusForbidden, "Only the seller can decline an NDA request")
+		return
+	}
+	if !services.CanTransitionNDA(agreement.Status, models.NDAStatusDeclined) {
+		response.Error(w, http.StatusConflict, fmt.Sprintf("Cannot decline an NDA in status %s", agreement.Status))
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	update := map[string]interface{}{
+		"status":      models.NDAStatusDeclined,
+		"declined_at": now,
+		"updated_at":  now,
+	}
+	reason := ""
+	if req.Reason != nil && strings.TrimSpace(*req.Reason) != "" {
+		reason = utils.SanitizeText(utils.SanitizeInput{
+			Value:     *req.Reason,
+			MaxLength: utils.MaxTextareaLength,
+			AllowHTML: false,
+		}).Sanitized
+		update["decline_reason"] = reason
+	}
+
+	updated, err := s.updateNDAAgreement(serviceClient, agreement.ID, agreement.Status, update)
+	if !s.handleNDAUpdateError(w, "DeclineNDAAgreement", err) {
+		return
+	}
+
+	from := agreement.Status
+	s.recordNDATransition(r, *updated, userID, models.NDAEventDeclined, &from, nil, reason, nil)
+
+	log.Printf("[DeclineNDAAgreement] ✓ NDA %s declined by %s", agreement.ID, userID)
+	response.Success(w, http.StatusOK, prepareNDAAgreementResponse(*updated, party))
+}
+
+// CancelNDAAgreement withdraws a request that has not been signed yet (buyer only)
+// POST /api/nda-agreements/:id/cancel
+func (s *Server) CancelNDAAgreement(w http.ResponseWriter, r *http.Request, agreementID string) {
+	userID, _, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	agreement, party, ok := s.loadNDAAgreementForParty(w, serviceClient, agreementID, userID)
+	if !ok {
+		return
+	}
+	if party != models.NDAPartyBuyer {
+		response.Error(w, http.StatusForbidden, "Only the buyer can cancel an NDA request")
+		return
+	}
+	if !services.CanTransitionNDA(agreement.Status, models.NDAStatusCancelled) {
+		response.Error(w, http.StatusConflict, fmt.Sprintf("Cannot cancel an NDA in status %s", agreement.Status))
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	updated, err := s.updateNDAAgreement(serviceClient, agreement.ID, agreement.Status, map[string]interface{}{
+		"status":       models.NDAStatusCancelled,
+		"cancelled_at": now,
+		"updated_at":   now,
+	})
+	if !s.handleNDAUpdateError(w, "CancelNDAAgreement", err) {
+		return
+	}
+
+	from := agreement.Status
+	s.recordNDATransition(r, *updated, userID, models.NDAEventCancelled, &from, nil, "", nil)
+
+	log.Printf("[CancelNDAAgreement] ✓ NDA %s cancelled by %s", agreement.ID, userID)
+	response.Success(w, http.StatusOK, prepareNDAAgreementResponse(*updated, party))
+}
+
+// SignNDAAgreement records the caller's signature (timestamp, IP and document hash) on an approved agreement.
+// When both parties have signed, the agreement becomes signed and unlocks the seller's secret posts.
+// POST /api/nda-agreements/:id/sign
+func (s *Server) SignNDAAgreement(w http.ResponseWriter, r *http.Request, agreementID string) {
+	userID, _, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.SignNDARequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	agreement, party, ok := s.loadNDAAgreementForParty(w, serviceClient, agreementID, userID)
+	if !ok {
+		return
+	}
+	if agreement.Status != models.NDAStatusApproved || agreement.DocumentHash == nil {
+		response.Error(w, http.StatusConflict, fmt.Sprintf("Cannot sign an NDA in status %s", agreement.Status))
+		return
+	}
+
+	if agreement.ExpiresAt != nil && !agreement.ExpiresAt.After(time.Now()) {
+		response.Error(w, http.StatusConflict, "The disclosure period of this NDA has already ended")
+		return
+	}
+
+	// 🔒 SECURITY: 署名者が確認した文面と、承認時に確定した文面が一致することを確認
+	if !strings.EqualFold(req.DocumentHash, *agreement.DocumentHash) {
+		response.Error(w, http.StatusConflict, "Document hash does not match the approved NDA document")
+		return
+	}
+
+	prefix := "buyer"
+	event := models.NDAEventSignedByBuyer
+	alreadySigned := agreement.BuyerSignedAt != nil
+	if party == models.NDAPartySeller {
+		prefix = "seller"
+		event = models.NDAEventSignedBySeller
+		alreadySigned = agreement.SellerSignedAt != nil
+	}
+	if alreadySigned {
+		response.Error(w, http.StatusConflict, "You have already signed this NDA")
+		return
+	}
+
+	now := time.Now().UTC()
+	ip := utils.ClientIP(r)
+	var rows []models.NDAAgreement
+	_, err := serviceClient.From("nda_agreements").
+		Update(map[string]interface{}{
+			prefix + "_signed_by":     userID,
+			prefix + "_signed_at":     now.Format(time.RFC3339),
+			prefix + "_signed_ip":     ip,
+			prefix + "_document_hash": *agreement.DocumentHash,
+			"updated_at":              now.Format(time.RFC3339),
+		}, "", "").
+		Eq("id", agreement.ID).
+		Eq("status", string(models.NDAStatusApproved)).
+		Is(prefix+"_signed_at", "null").
+		ExecuteTo(&rows)
+	if err == nil && len(rows) == 0 {
+		err = errNDAStatusChanged
+	}
+	if !s.handleNDAUpdateError(w, "SignNDAAgreement", err) {
+		return
+	}
+	updated := rows[0]
+
+	from := models.NDAStatusApproved
+	s.recordNDATransition(r, updated, userID, event, &from, agreement.DocumentHash, "", nil)
+
+	// 両当事者の署名が揃ったら締結（同時に署名された場合も後から更新した側の結果に両方の署名が含まれる）
+	if updated.BuyerSignedAt != nil && updated.SellerSignedAt != nil {
+		signed, err := s.updateNDAAgreement(serviceClient, agreement.ID, models.NDAStatusApproved, map[string]interface{}{
+			"status":     models.NDAStatusSigned,
+			"signed_at":  now.Format(time.RFC3339),
+			"updated_at": now.Format(time.RFC3339),
+		})
+		if err != nil && !errors.Is(err, errNDAStatusChanged) {
+			log.Printf("[SignNDAAgreement] Failed to mark agreement %s as signed: %v", agreement.ID, err)
+			response.Error(w, http.StatusInternalServerError, "Failed to complete NDA")
+			return
+		}
+		if signed != nil {
+			updated = *signed
+			s.recordNDATransition(r, updated, userID, models.NDAEventSigned, &from, agreement.DocumentHash, "", nil)
+			log.Printf("[SignNDAAgreement] ✓ NDA %s signed by both parties", agreement.ID)
+		}
+	}
+
+	log.Printf("[SignNDAAgreement] ✓ NDA %s signed by %s (%s)", agreement.ID, userID, party)
+	response.Success(w, http.StatusOK, prepareNDAAgreementResponse(updated, party))
+}
+
+// UpdateNDAScope narrows the scope or changes the expiry of a signed agreement (seller only).
+// 範囲の拡大は新しいNDAの締結が必要。変更は履歴に残り、相手方に通知される
+// POST /api/nda-agreements/:id/scope
+func (s *Server) UpdateNDAScope(w http.ResponseWriter, r *http.Request, agreementID string) {
+	userID, _, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateNDAScopeRequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	agreement, party, ok := s.loadNDAAgreementForParty(w, serviceClient, agreementID, userID)
+	if !ok {
+		return
+	}
+	if party != models.NDAPartySeller {
+		response.Error(w, http.StatusForbidden, "Only the seller can change the scope of an NDA")
+		return
+	}
+	if agreement.Status != models.NDAStatusSigned {
+		response.Error(w, http.StatusConflict, fmt.Sprintf("Cannot change the scope of an NDA in status %s", agreement.Status))
+		return
+	}
+
+	scope := agreement.Scope
+	if req.Scope != nil {
+		scope = *req.Scope
+	}
+	if !services.NDAScopeIncludes(agreement.Scope, scope) {
+		response.Error(w, http.StatusBadRequest, "The scope of a signed NDA can only be narrowed. Request a new NDA to broaden it")
+		return
+	}
+	if !s.validateNDAScope(w, *agreement, scope) {
+		return
+	}
+
+	expiresAt := agreement.ExpiresAt
+	if req.RemoveExpiry {
+		expiresAt = nil
+	} else if req.ExpiresAt != nil {
+		expiresAt = req.ExpiresAt
+	}
+	if scope == agreement.Scope && sameNDAExpiry(expiresAt, agreement.ExpiresAt) {
+		response.Error(w, http.StatusBadRequest, "No changes to the scope or expiry")
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	update := map[string]interface{}{
+		"scope":      scope,
+		"expires_at": nil,
+		"updated_at": now,
+	}
+	if expiresAt != nil {
+		update["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	updated, err := s.updateNDAAgreement(serviceClient, agreement.ID, agreement.Status, update)
+	if !s.handleNDAUpdateError(w, "UpdateNDAScope", err) {
+		return
+	}
+
+	note := ""
+	if req.Note != nil && strings.TrimSpace(*req.Note) != "" {
+		note = utils.SanitizeText(utils.SanitizeInput{
+			Value:     *req.Note,
+			MaxLength: utils.MaxTextareaLength,
+			AllowHTML: false,
+		}).Sanitized
+	}
+	from := agreement.Status
+	s.recordNDATransition(r, *updated, userID, models.NDAEventScopeChanged, &from, nil, note, &models.NDAScopeChange{
+		FromScope:     agreement.Scope,
+		ToScope:       updated.Scope,
+		FromExpiresAt: agreement.ExpiresAt,
+		ToExpiresAt:   updated.ExpiresAt,
+	})
+
+	log.Printf("[UpdateNDAScope] ✓ NDA %s scope %s -> %s by %s", agreement.ID, agreement.Scope, updated.Scope, userID)
+	response.Success(w, http.StatusOK, prepareNDAAgreementResponse(*updated, party))
+}
+
+// RevokeNDAAgreement revokes a signed agreement (seller only).
+// The buyer's access to the covered secret listings ends with the next request.
+// POST /api/nda-agreements/:id/revoke
+func (s *Server) RevokeNDAAgreement(w http.ResponseWriter, r *http.Request, agreementID string) {
+	userID, _, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.RevokeNDARequest
+	if r.ContentLength != 0 && !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	agreement, party, ok := s.loadNDAAgreementForParty(w, serviceClient, agreementID, userID)
+	if !ok {
+		return
+	}
+	if party != models.NDAPartySeller {
+		response.Error(w, http.StatusForbidden, "Only the seller can revoke an NDA")
+		return
+	}
+	if !services.CanTransitionNDA(agreement.Status, models.NDAStatusRevoked) {
+		response.Error(w, http.StatusConflict, fmt.Sprintf("Cannot revoke an NDA in status %s", agreement.Status))
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	update := map[string]interface{}{
+		"status":     models.NDAStatusRevoked,
+		"revoked_at": now,
+		"revoked_by": userID,
+		"updated_at": now,
+	}
+	reason := ""
+	if req.Reason != nil && strings.TrimSpace(*req.Reason) != "" {
+		reason = utils.SanitizeText(utils.SanitizeInput{
+			Value:     *req.Reason,
+			MaxLength: utils.MaxTextareaLength,
+			AllowHTML: false,
+		}).Sanitized
+		update["revoke_reason"] = reason
+	}
+
+	updated, err := s.updateNDAAgreement(serviceClient, agreement.ID, agreement.Status, update)
+	if !s.handleNDAUpdateError(w, "RevokeNDAAgreement", err) {
+		return
+	}
+
+	from := agreement.Status
+	s.recordNDATransition(r, *updated, userID, models.NDAEventRevoked, &from, nil, reason, nil)
+
+	log.Printf("[RevokeNDAAgreement] ✓ NDA %s revoked by %s", agreement.ID, userID)
+	response.Success(w, http.StatusOK, prepareNDAAgreementResponse(*updated, party))
+}
+
+// validateNDAScope checks that the scope can apply to the agreement, writing 400 otherwise
+func (s *Server) validateNDAScope(w http.ResponseWriter, agreement models.NDAAgreement, scope models.NDAScope) bool {
+	switch {
+	case !services.ValidNDAScope(scope):
+		response.Error(w, http.StatusBadRequest, "scope must be listing, seller or org")
+	case scope == models.NDAScopeListing && ndaStringValue(agreement.PostID) == "":
+		response.Error(w, http.StatusBadRequest, "A listing-scoped NDA requires a listing")
+	case scope == models.NDAScopeOrg && ndaStringValue(agreement.SellerOrgID) == "":
+		response.Error(w, http.StatusBadRequest, "An org-scoped NDA requires a seller organization")
+	default:
+		return true
+	}
+	return false
+}
+
+// expireNDAAgreement marks a signed agreement whose expiry has passed as expired.
+// Returns the updated agreement, or the original one when it is not due or was changed concurrently.
+func (s *Server) expireNDAAgreement(client *supabase.Client, agreement models.NDAAgreement) models.NDAAgreement {
+	if agreement.Status != models.NDAStatusSigned || agreement.ExpiresAt == nil || agreement.ExpiresAt.After(time.Now()) {
+		return agreement
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	updated, err := s.updateNDAAgreement(client, agreement.ID, models.NDAStatusSigned, map[string]interface{}{
+		"status":     models.NDAStatusExpired,
+		"expired_at": now,
+		"updated_at": now,
+	})
+	if err != nil {
+		if !errors.Is(err, errNDAStatusChanged) {
+			log.Printf("[expireNDAAgreement] ⚠️ Failed to expire agreement %s: %v", agreement.ID, err)
+		}
+		return agreement
+	}
+	from := models.NDAStatusSigned
+	s.recordNDATransition(nil, *updated, "", models.NDAEventExpired, &from, nil, "", nil)
+	log.Printf("[expireNDAAgreement] ✓ NDA %s expired", agreement.ID)
+	return *updated
+}
+
+// expireDueNDAAgreements lapses all signed agreements past their expiry.
+// 閲覧可否は ndaResolver が expires_at で判定するため、この処理は状態・履歴・通知を揃えるためのもの
+func (s *Server) expireDueNDAAgreements() {
+	serviceClient := s.supabase.GetServiceClient()
+	var agreements []models.NDAAgreement
+	_, err := serviceClient.From("nda_agreements").
+		Select("*", "", false).
+		Eq("status", string(models.NDAStatusSigned)).
+		Lte("expires_at", time.Now().UTC().Format(time.RFC3339)).
+		Limit(maxNDAListLimit, "").
+		ExecuteTo(&agreements)
+	if err != nil {
+		log.Printf("[expireDueNDAAgreements] ⚠️ Failed to query due agreements: %v", err)
+		return
+	}
+	for _, a := range agreements {
+		s.expireNDAAgreement(serviceClient, a)
+	}
+}
+
+// runNDAExpiryWorker periodically lapses expired agreements
+func (s *Server) runNDAExpiryWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.expireDueNDAAgreements()
+		<-ticker.C
+	}
+}
+
+func sameNDAExpiry(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+// loadNDAAgreementForParty loads an agreement and the caller's side of it.
+// Writes 404 when the agreement does not exist or the caller is not a party.
+func (s *Server) loadNDAAgreementForParty(w http.ResponseWriter, client *supabase.Client, agreementID string, userID string) (*models.NDAAgreement, models.NDAParty, bool) {
+	var agreements []models.NDAAgreement
+	_, err := client.From("nda_agreements").
+		Select("*", "", false).
+		Eq("id", agreementID).
+		ExecuteTo(&agreements)
+	if err != nil {
+		log.Printf("[loadNDAAgreementForParty] Failed to query agreement %s: %v", agreementID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query NDA agreement")
+		return nil, "", false
+	}
+	if len(agreements) == 0 {
+		response.Error(w, http.StatusNotFound, "NDA agreement not found")
+		return nil, "", false
+	}
+
+	orgIDs, err := s.userOrgIDs(client, userID)
+	if err != nil {
+		log.Printf("[loadNDAAgreementForParty] Failed to query org memberships: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query NDA agreement")
+		return nil, "", false
+	}
+
+	// 🔒 SECURITY: 当事者以外には存在自体を返さない
+	party := ndaPartyOf(agreements[0], userID, orgIDs)
+	if party == "" {
+		response.Error(w, http.StatusNotFound, "NDA agreement not found")
+		return nil, "", false
+	}
+	// 定期処理より先に参照された期限切れのNDAはここで失効させる
+	agreement := s.expireNDAAgreement(client, agreements[0])
+	return &agreement, party, true
+}
+
+// updateNDAAgreement updates an agreement only if it is still in the expected status
+func (s *Server) updateNDAAgreement(client *supabase.Client, agreementID string, from models.NDAStatus, update map[string]interface{}) (*models.NDAAgreement, error) {
+	var rows []models.NDAAgreement
+	_, err := client.From("nda_agreements").
+		Update(update, "", "").
+		Eq("id", agreementID).
+		Eq("status", string(from)).
+		ExecuteTo(&rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errNDAStatusChanged
+	}
+	return &rows[0], nil
+}
+
+// handleNDAUpdateError writes the error response for a failed transition and returns false, or returns true on success
+func (s *Server) handleNDAUpdateError(w http.ResponseWriter, handler string, err error) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, errNDAStatusChanged) {
+		response.Error(w, http.StatusConflict, "NDA agreement was updated by the other party. Please reload.")
+		return false
+	}
+	log.Printf("[%s] Failed to update agreement: %v", handler, err)
+	response.Error(w, http.StatusInternalServerError, "Failed to update NDA agreement")
+	return false
+}
+
+// recordNDATransition writes the audit event, posts an NDA message to the deal thread and notifies the other party.
+// actorID が空の場合はシステムによる遷移（期限切れ）として両当事者に通知する
+// 副作用の失敗で状態遷移自体は失敗させない（ログのみ）
+func (s *Server) recordNDATransition(r *http.Request, agreement models.NDAAgreement, actorID string, event models.NDAEventType, from *models.NDAStatus, documentHash *string, note string, details *models.NDAScopeChange) {
+	serviceClient := s.supabase.GetServiceClient()
+
+	eventData := map[string]interface{}{
+		"agreement_id":  agreement.ID,
+		"event":         event,
+		"from_status":   from,
+		"to_status":     agreement.Status,
+		"document_hash": documentHash,
+	}
+	var actor *string
+	if actorID != "" {
+		actor = &actorID
+		eventData["actor_user_id"] = actorID
+	}
+	if r != nil {
+		eventData["ip_address"] = utils.ClientIP(r)
+	}
+	if note != "" {
+		eventData["note"] = note
+	}
+	if details != nil {
+		eventData["details"] = details
+	}
+	_, _, err := serviceClient.From("nda_agreement_events").
+		Insert(eventData, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		log.Printf("[recordNDATransition] ⚠️ Failed to record %s event for %s: %v", event, agreement.ID, err)
+	}
+
+	// システムによる遷移のメッセージは売り手の窓口ユーザー名義で投稿する
+	sender := actorID
+	if sender == "" {
+		sender = ndaStringValue(agreement.SellerContactUserID)
+	}
+	if agreement.ThreadID != nil && *agreement.ThreadID != "" && sender != "" {
+		text := services.NDAStatusMessage(event, ndaTransitionNote(note, details))
+		_, _, err = serviceClient.From("messages").
+			Insert(messageInsert{
+				ThreadID:     *agreement.ThreadID,
+				SenderUserID: sender,
+				Type:         string(models.MessageTypeNDA),
+				Text:         &text,
+			}, false, "", "minimal", "").
+			Execute()
+		if err != nil {
+			log.Printf("[recordNDATransition] ⚠️ Failed to post NDA message to thread %s: %v", *agreement.ThreadID, err)
+		}
+	}
+
+	notificationType, title := ndaNotificationContent(event)
+	body := services.NDAStatusMessage(event, "")
+	resourceType := "nda_agreement"
+	var link *string
+	if agreement.ThreadID != nil && *agreement.ThreadID != "" {
+		l := "/messages/" + *agreement.ThreadID
+		link = &l
+	}
+	notifications := make([]notificationInsert, 0, 2)
+	for _, recipient := range ndaNotificationRecipients(agreement) {
+		notifications = append(notifications, notificationInsert{
+			UserID:       recipient,
+			Type:         notificationType,
+			Title:        title,
+			Body:         &body,
+			Link:         link,
+			ActorUserID:  actor,
+			ResourceType: &resourceType,
+			ResourceID:   &agreement.ID,
+			Data: map[string]interface{}{
+				"status":     agreement.Status,
+				"event":      event,
+				"post_id":    agreement.PostID,
+				"scope":      agreement.Scope,
+				"expires_at": agreement.ExpiresAt,
+			},
+		})
+	}
+	s.createNotifications(notifications)
+
+	// 🔒 SECURITY: メールには案件名を入れない（締結前の買い手には秘匿されている場合があるため）
+	emailLink := ""
+	if link != nil {
+		emailLink = *link
+	}
+	for _, recipient := range ndaNotificationRecipients(agreement) {
+		if recipient == actorID {
+			continue
+		}
+		s.enqueueEmail(recipient, notificationType, models.EmailTemplateNDAEvent, emailLink, map[string]interface{}{
+			"Event": string(event),
+			"Note":  ndaTransitionNote(note, details),
+		})
+	}
+}
+
+func ndaNotificationContent(event models.NDAEventType) (models.NotificationType, string) {
+	switch event {
+	case models.NDAEventRequested:
+		return models.NotificationTypeNDARequested, "NDAの締結申請が届きました"
+	case models.NDAEventApproved:
+		return models.NotificationTypeNDAApproved, "NDAの申請が承認されました"
+	case models.NDAEventDeclined:
+		return models.NotificationTypeNDADeclined, "NDAの申請が見送られました"
+	case models.NDAEventCancelled:
+		return models.NotificationTypeNDACancelled, "NDAの申請が取り下げられました"
+	case models.NDAEventSigned:
+		return models.NotificationTypeNDASigned, "NDAが締結されました"
+	case models.NDAEventScopeChanged:
+		return models.NotificationTypeNDAScope, "NDAの対象範囲が変更されました"
+	case models.NDAEventRevoked:
+		return models.NotificationTypeNDARevoked, "NDAが失効されました"
+	case models.NDAEventExpired:
+		return models.NotificationTypeNDAExpired, "NDAの開示期限が到来しました"
+	default:
+		return models.NotificationTypeNDASignature, "NDAに署名されました"
+	}
+}
+
+// ndaNotificationRecipients returns the contact users of both sides (the actor is skipped by createNotifications)
+func ndaNotificationRecipients(agreement models.NDAAgreement) []string {
+	recipients := make([]string, 0, 2)
+	if agreement.RequestedBy != nil {
+		recipients = append(recipients, *agreement.RequestedBy)
+	} else if agreement.BuyerUserID != nil {
+		recipients = append(recipients, *agreement.BuyerUserID)
+	}
+	if agreement.SellerContactUserID != nil {
+		recipients = append(recipients, *agreement.SellerContactUserID)
+	} else if agreement.SellerUserID != nil {
+		recipients = append(recipients, *agreement.SellerUserID)
+	}
+	return recipients
+}
+
+// ensureNDAThread returns the thread between the buyer and the seller contact for the listing, creating it if needed.
+// 案件指定ありの申請はその案件の商談スレッド（deal room）を起点にする
+func (s *Server) ensureNDAThread(client *supabase.Client, buyerID, sellerID string, postID *string) (string, error) {
+	thread, _, err := s.getOrCreateThread(client, buyerID, []string{sellerID}, postID)
+	if err != nil {
+		return "", err
+	}
+	return thread.ID, nil
+}
+
+// userOrgIDs returns the organizations the user belongs to
+func (s *Server) userOrgIDs(client *supabase.Client, userID string) ([]string, error) {
+	var memberships []struct {
+		OrgID string `json:"org_id"`
+	}
+	_, err := client.From("org_memberships").
+		Select("org_id", "", false).
+		Eq("user_id", userID).
+		ExecuteTo(&memberships)
+	if err != nil {
+		return nil, err
+	}
+	orgIDs := make([]string, 0, len(memberships))
+	for _, m := range memberships {
+		orgIDs = append(orgIDs, m.OrgID)
+	}
+	return orgIDs, nil
+}
+
+// fetchDisplayNames returns display names by user ID
+func (s *Server) fetchDisplayNames(client *supabase.Client, userIDs ...string) map[string]string {
+	names := make(map[string]string)
+	ids := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return names
+	}
+	var profiles []profileRowSimple
+	_, err := client.From("profiles").
+		Select("id, display_name, icon_url", "", false).
+		In("id", ids).
+		ExecuteTo(&profiles)
+	if err != nil {
+		log.Printf("[fetchDisplayNames] ⚠️ Failed to query profiles: %v", err)
+		return names
+	}
+	for _, p := range profiles {
+		names[p.ID] = p.DisplayName
+	}
+	return names
+}
+
+// ndaPartyOf returns the side of the agreement the user is on, or "" if the user is not a party
+func ndaPartyOf(a models.NDAAgreement, userID string, orgIDs []string) models.NDAParty {
+	is := func(v *string) bool { return v != nil && *v == userID }
+	inOrg := func(v *string) bool { return v != nil && containsString(orgIDs, *v) }
+
+	switch {
+	case is(a.BuyerUserID) || is(a.RequestedBy) || inOrg(a.BuyerOrgID):
+		return models.NDAPartyBuyer
+	case is(a.SellerUserID) || is(a.SellerContactUserID) || inOrg(a.SellerOrgID):
+		return models.NDAPartySeller
+	default:
+		return ""
+	}
+}
+
+// ndaPartyFilter builds the PostgREST or-filter matching agreements where the user is a party
+func ndaPartyFilter(userID string, orgIDs []string, role models.NDAParty) string {
+	var conditions []string
+	orgList := strings.Join(orgIDs, ",")
+	if role == "" || role == models.NDAPartyBuyer {
+		conditions = append(conditions, "buyer_user_id.eq."+userID, "requested_by.eq."+userID)
+		if len(orgIDs) > 0 {
+			conditions = append(conditions, "buyer_org_id.in.("+orgList+")")
+		}
+	}
+	if role == "" || role == models.NDAPartySeller {
+		conditions = append(conditions, "seller_user_id.eq."+userID, "seller_contact_user_id.eq."+userID)
+		if len(orgIDs) > 0 {
+			conditions = append(conditions, "seller_org_id.in.("+orgList+")")
+		}
+	}
+	return strings.Join(conditions, ",")
+}
+
+// prepareNDAAgreementResponse strips the document body and the other party's signing IP
+func prepareNDAAgreementResponse(a models.NDAAgreement, party models.NDAParty) models.NDAAgreement {
+	a.DocumentContent = nil
+	if party != models.NDAPartyBuyer {
+		a.BuyerSignedIP = nil
+	}
+	if party != models.NDAPartySeller {
+		a.SellerSignedIP = nil
+	}
+	return a
+}
+
+func ndaPartyName(displayName string, orgID *string) string {
+	if displayName == "" {
+		displayName = "（未設定）"
+	}
+	if orgID != nil && *orgID != "" {
+		return fmt.Sprintf("%s（組織ID: %s）", displayName, *orgID)
+	}
+	return displayName
+}
+
+// ndaTransitionNote appends the scope / expiry change to the note posted to the thread
+func ndaTransitionNote(note string, details *models.NDAScopeChange) string {
+	if details == nil {
+		return note
+	}
+	lines := make([]string, 0, 3)
+	if details.ToScope != "" && details.ToScope != details.FromScope {
+		lines = append(lines, "対象: "+services.NDAScopeLabel(details.ToScope, "")+"（変更前: "+services.NDAScopeLabel(details.FromScope, "")+"）")
+	}
+	if !sameNDAExpiry(details.FromExpiresAt, details.ToExpiresAt) {
+		lines = append(lines, "開示期限: "+services.NDAExpiryLabel(details.ToExpiresAt))
+	}
+	if note != "" {
+		lines = append(lines, note)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func ndaStringValue(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
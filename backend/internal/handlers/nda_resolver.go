@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+)
+
+// ndaSeller identifies the selling side of an NDA.
+// When the seller belongs to an organization the agreement is made with the organization.
+type ndaSeller struct {
+	UserID string
+	OrgID  string
+}
+
+func sellerOf(authorUserID string, authorOrgID *string) ndaSeller {
+	if authorOrgID != nil && *authorOrgID != "" {
+		return ndaSeller{OrgID: *authorOrgID}
+	}
+	return ndaSeller{UserID: authorUserID}
+}
+
+func (s ndaSeller) key() string {
+	if s.OrgID != "" {
+		return "org:" + s.OrgID
+	}
+	return "user:" + s.UserID
+}
+
+// ndaResolver resolves signed NDAs for one buyer in a constant number of queries
+// (1 query for the buyer's organizations + 1 query per Resolve call) and caches the results
+// for the lifetime of the request.
+// 失効・期限切れはリクエストごとに再取得されるため、売り手が失効させた時点で次のリクエストからマスクされる
+type ndaResolver struct {
+	client      *supabase.Client
+	buyerUserID string
+	buyerOrgIDs []string
+	orgsLoaded  bool
+	grants      map[string][]services.NDAGrant // seller key -> active grants
+	now         time.Time
+}
+
+func newNDAResolver(client *supabase.Client, buyerUserID string) *ndaResolver {
+	return &ndaResolver{
+		client:      client,
+		buyerUserID: buyerUserID,
+		grants:      make(map[string][]services.NDAGrant),
+		now:         time.Now(),
+	}
+}
+
+// Resolve fetches the NDAs for all sellers not resolved yet
+func (n *ndaResolver) Resolve(sellers []ndaSeller) error {
+	if n.buyerUserID == "" {
+		return nil
+	}
+
+	pending := make(map[string][]services.NDAGrant)
+	for _, seller := range sellers {
+		if seller.OrgID == "" && seller.UserID == "" {
+			continue
+		}
+		if _, ok := n.grants[seller.key()]; !ok {
+			pending[seller.key()] = nil
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := n.loadBuyerOrgs(); err != nil {
+		return err
+	}
+
+	// 買い手（本人または所属組織）の締結済みNDAを1クエリで取得し、売り手側とスコープはメモリ上で照合する
+	buyerFilter := []string{fmt.Sprintf("buyer_user_id.eq.%s", n.buyerUserID)}
+	if len(n.buyerOrgIDs) > 0 {
+		buyerFilter = append(buyerFilter, fmt.Sprintf("buyer_org_id.in.(%s)", strings.Join(n.buyerOrgIDs, ",")))
+	}
+
+	var agreements []struct {
+		SellerUserID        *string         `json:"seller_user_id"`
+		SellerOrgID         *string         `json:"seller_org_id"`
+		SellerContactUserID *string         `json:"seller_contact_user_id"`
+		PostID              *string         `json:"post_id"`
+		Scope               models.NDAScope `json:"scope"`
+		ExpiresAt           *time.Time      `json:"expires_at"`
+	}
+	_, err := n.client.From("nda_agreements").
+		Select("seller_user_id, seller_org_id, seller_contact_user_id, post_id, scope, expires_at", "", false).
+		Eq("status", string(models.NDAStatusSigned)).
+		Or(strings.Join(buyerFilter, ","), "").
+		ExecuteTo(&agreements)
+	if err != nil {
+		// 失敗した結果はキャッシュしない
+		return err
+	}
+
+	for _, a := range agreements {
+		grant := services.NDAGrant{
+			Scope:         a.Scope,
+			PostID:        ndaStringValue(a.PostID),
+			ContactUserID: ndaStringValue(a.SellerContactUserID),
+			ExpiresAt:     a.ExpiresAt,
+		}
+		// 🔒 SECURITY: 期限切れは定期処理で expired になる前でも無効として扱う
+		if !grant.Active(n.now) {
+			continue
+		}
+		var key string
+		switch {
+		case a.SellerOrgID != nil && *a.SellerOrgID != "":
+			key = "org:" + *a.SellerOrgID
+		case a.SellerUserID != nil && *a.SellerUserID != "":
+			key = "user:" + *a.SellerUserID
+		default:
+			continue
+		}
+		if _, ok := pending[key]; ok {
+			pending[key] = append(pending[key], grant)
+		}
+	}
+	for key, grants := range pending {
+		n.grants[key] = grants
+	}
+	return nil
+}
+
+// Grants returns the buyer's active NDAs with the seller, resolving them if needed
+func (n *ndaResolver) Grants(seller ndaSeller) ([]services.NDAGrant, error) {
+	if n.buyerUserID == "" {
+		return nil, nil
+	}
+	if grants, ok := n.grants[seller.key()]; ok {
+		return grants, nil
+	}
+	if err := n.Resolve([]ndaSeller{seller}); err != nil {
+		return nil, err
+	}
+	return n.grants[seller.key()], nil
+}
+
+// Covers reports whether the buyer holds an active NDA whose scope covers the post
+func (n *ndaResolver) Covers(authorUserID string, authorOrgID *string, postID string) (bool, error) {
+	grants, err := n.Grants(sellerOf(authorUserID, authorOrgID))
+	if err != nil {
+		return false, err
+	}
+	for _, grant := range grants {
+		if grant.Covers(authorUserID, postID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// loadBuyerOrgs loads the buyer's organizations once per resolver
+func (n *ndaResolver) loadBuyerOrgs() error {
+	if n.orgsLoaded {
+		return nil
+	}
+	var memberships []struct {
+		OrgID string `json:"org_id"`
+	}
+	_, err := n.client.From("org_memberships").
+		Select("org_id", "", false).
+		Eq("user_id", n.buyerUserID).
+		ExecuteTo(&memberships)
+	if err != nil {
+		// 組織の取得に失敗しても本人名義のNDAは判定できる
+		log.Printf("[ndaResolver] ⚠️ Failed to query org memberships for %s: %v", n.buyerUserID, err)
+	}
+	for _, m := range memberships {
+		n.buyerOrgIDs = append(n.buyerOrgIDs, m.OrgID)
+	}
+	n.orgsLoaded = true
+	return nil
+}
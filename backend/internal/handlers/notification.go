@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	defaultNotificationLimit = 30
+	maxNotificationLimit     = 100
+)
+
+// groupedNotificationTypes are merged into the unread notification of the same resource
+// (メッセージ・いいねが続いても未読の通知は1件にまとめ、data.count に件数を入れる)
+var groupedNotificationTypes = map[models.NotificationType]bool{
+	models.NotificationTypeMessageReceived: true,
+	models.NotificationTypePostLiked:       true,
+	models.NotificationTypeCommentLiked:    true,
+	models.NotificationTypeReplyLiked:      true,
+}
+
+// notificationInsert is one row to insert into the notifications table
+type notificationInsert struct {
+	UserID       string                  `json:"user_id"`
+	Type         models.NotificationType `json:"type"`
+	Title        string                  `json:"title"`
+	Body         *string                 `json:"body,omitempty"`
+	Link         *string                 `json:"link,omitempty"`
+	ActorUserID  *string                 `json:"actor_user_id,omitempty"`
+	ResourceType *string                 `json:"resource_type,omitempty"`
+	ResourceID   *string                 `json:"resource_id,omitempty"`
+	Data         map[string]interface{}  `json:"data,omitempty"`
+}
+
+// createNotifications inserts notifications for other users and pushes them on the realtime stream.
+// Types turned off in the recipient's preferences are skipped.
+// 🔒 SECURITY: 他ユーザー宛ての行を作成するためService Clientを使用する（notificationsにINSERTポリシーはない）
+// 通知の失敗で本処理を失敗させないよう、エラーはログのみ
+func (s *Server) createNotifications(notifications []notificationInsert) {
+	rows := make([]notificationInsert, 0, len(notifications))
+	seen := make(map[string]bool)
+	for _, n := range notifications {
+		if n.UserID == "" {
+			continue
+		}
+		// 操作した本人には通知しない
+		if n.ActorUserID != nil && *n.ActorUserID == n.UserID {
+			continue
+		}
+		// 同じ宛先・種別・対象の重複のみ除く（種別が同じでも対象が異なる通知は残す）
+		key := n.UserID + "|" + string(n.Type) + "|" + ndaStringValue(n.ResourceID)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		rows = append(rows, n)
+	}
+	serviceClient := s.supabase.GetServiceClient()
+	rows = s.filterNotificationPreferences(serviceClient, rows)
+	if len(rows) == 0 {
+		return
+	}
+
+	delivered := make([]models.Notification, 0, len(rows))
+	inserts := make([]notificationInsert, 0, len(rows))
+	for _, n := range rows {
+		if groupedNotificationTypes[n.Type] && n.ResourceID != nil {
+			if merged, ok := s.mergeUnreadNotification(serviceClient, n); ok {
+				delivered = append(delivered, merged)
+				continue
+			}
+		}
+		inserts = append(inserts, n)
+	}
+
+	if len(inserts) > 0 {
+		var created []models.Notification
+		_, err := serviceClient.From("notifications").
+			Insert(inserts, false, "", "", "").
+			ExecuteTo(&created)
+		if err != nil {
+			log.Printf("[createNotifications] ⚠️ Failed to create %d notifications: %v", len(inserts), err)
+		}
+		delivered = append(delivered, created...)
+	}
+	if len(delivered) == 0 {
+		return
+	}
+
+	for _, n := range delivered {
+		s.publishRealtimeEvent("createNotifications", []string{n.UserID}, models.RealtimeEventNotificationCreated, "", n)
+	}
+	log.Printf("[createNotifications] ✓ Delivered %d notifications (%d merged)", len(delivered), len(delivered)-len(inserts))
+}
+
+// filterNotificationPreferences drops the notifications whose type the recipient turned off
+func (s *Server) filterNotificationPreferences(client *supabase.Client, rows []notificationInsert) []notificationInsert {
+	if len(rows) == 0 {
+		return rows
+	}
+	userIDs := make([]string, 0, len(rows))
+	for _, n := range rows {
+		if !containsString(userIDs, n.UserID) {
+			userIDs = append(userIDs, n.UserID)
+		}
+	}
+	var disabled []struct {
+		UserID string                  `json:"user_id"`
+		Type   models.NotificationType `json:"type"`
+	}
+	_, err := client.From("notification_preferences").
+		Select("user_id, type", "", false).
+		In("user_id", userIDs).
+		Eq("in_app", "false").
+		ExecuteTo(&disabled)
+	if err != nil {
+		// 設定を確認できない場合は通知する（通知の取りこぼしを避ける）
+		log.Printf("[createNotifications] ⚠️ Failed to query notification preferences: %v", err)
+		return rows
+	}
+	if len(disabled) == 0 {
+		return rows
+	}
+	off := make(map[string]bool, len(disabled))
+	for _, d := range disabled {
+		off[d.UserID+"|"+string(d.Type)] = true
+	}
+	result := rows[:0]
+	for _, n := range rows {
+		if !off[n.UserID+"|"+string(n.Type)] {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// mergeUnreadNotification updates the unread notification of the same recipient, type and resource
+// with the new content and moves it to the top. Returns false if there is none.
+func (s *Server) mergeUnreadNotification(client *supabase.Client, n notificationInsert) (models.Notification, bool) {
+	var existing []models.Notification
+	_, err := client.From("notifications").
+		Select("*", "", false).
+		Eq("user_id", n.UserID).
+		Eq("type", string(n.Type)).
+		Eq("resource_id", *n.ResourceID).
+		Is("read_at", "null").
+		Order("created_at", nil).
+		Limit(1, "").
+		ExecuteTo(&existing)
+	if err != nil || len(existing) == 0 {
+		if err != nil {
+			log.Printf("[createNotifications] ⚠️ Failed to query unread %s notification of %s: %v", n.Type, n.UserID, err)
+		}
+		return models.Notification{}, false
+	}
+
+	count := 1
+	if v, ok := existing[0].Data["count"].(float64); ok && v > 0 {
+		count = int(v)
+	}
+	data := make(map[string]interface{}, len(n.Data)+1)
+	for k, v := range n.Data {
+		data[k] = v
+	}
+	data["count"] = count + 1
+
+	var updated []models.Notification
+	_, err = client.From("notifications").
+		Update(map[string]interface{}{
+			"title":         n.Title,
+			"body":          n.Body,
+			"link":          n.Link,
+			"actor_user_id": n.ActorUserID,
+			"data":          data,
+			"created_at":    time.Now().UTC().Format(time.RFC3339Nano),
+			"emailed_at":    nil, // 新しいメッセージは改めてダイジェストの対象にする
+		}, "", "").
+		Eq("id", existing[0].ID).
+		Is("read_at", "null").
+		ExecuteTo(&updated)
+	if err != nil || len(updated) == 0 {
+		if err != nil {
+			log.Printf("[createNotifications] ⚠️ Failed to merge %s notification %s: %v", n.Type, existing[0].ID, err)
+		}
+		return models.Notification{}, false
+	}
+	return updated[0], true
+}
+
+// HandleNotifications routes /api/notifications requests
+func (s *Server) HandleNotifications(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/notifications"), "/")
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		s.ListNotifications(w, r)
+	case path == "unread-count" && r.Method == http.MethodGet:
+		s.GetUnreadNotificationCount(w, r)
+	case path == "read-all" && r.Method == http.MethodPut:
+		s.MarkAllNotificationsRead(w, r)
+	case path == "preferences" && r.Method == http.MethodGet:
+		s.GetNotificationPreferences(w, r)
+	case path == "preferences" && r.Method == http.MethodPut:
+		s.UpdateNotificationPreferences(w, r)
+	case strings.HasSuffix(path, "/read") && r.Method == http.MethodPut:
+		s.MarkNotificationRead(w, r, strings.TrimSuffix(path, "/read"))
+	default:
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// ListNotifications returns the notifications of the authenticated user, newest first
+// GET /api/notifications?status=all|unread&type=&limit=&offset=
+func (s *Server) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultNotificationLimit
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 {
+		limit = min(v, maxNotificationLimit)
+	}
+	offset := 0
+	if v, err := strconv.Atoi(query.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+
+	// 🔒 SECURITY: RLSで自分宛ての通知のみ参照する
+	builder := s.supabase.GetAuthenticatedClient(accessToken).From("notifications").
+		Select("*", "", false).
+		Eq("user_id", userID)
+	switch query.Get("status") {
+	case "", "all":
+	case "unread":
+		builder = builder.Is("read_at", "null")
+	default:
+		response.Error(w, http.StatusBadRequest, "status must be all or unread")
+		return
+	}
+	if v := query.Get("type"); v != "" {
+		builder = builder.Eq("type", v)
+	}
+
+	var notifications []models.Notification
+	_, err := builder.
+		Order("created_at", nil).
+		Range(offset, offset+limit-1, "").
+		ExecuteTo(&notifications)
+	if err != nil {
+		log.Printf("[ListNotifications] Failed to query notifications of %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query notifications")
+		return
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+
+	response.Success(w, http.StatusOK, notifications)
+}
+
+// GetUnreadNotificationCount returns the number of unread notifications, in total and per type
+// GET /api/notifications/unread-count
+func (s *Server) GetUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var rows []struct {
+		Type models.NotificationType `json:"type"`
+	}
+	_, err := s.supabase.GetAuthenticatedClient(accessToken).From("notifications").
+		Select("type", "", false).
+		Eq("user_id", userID).
+		Is("read_at", "null").
+		ExecuteTo(&rows)
+	if err != nil {
+		log.Printf("[GetUnreadNotificationCount] Failed to count notifications of %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to count notifications")
+		return
+	}
+
+	counts := models.NotificationUnreadCount{Total: len(rows), ByType: map[models.NotificationType]int{}}
+	for _, row := range rows {
+		counts.ByType[row.Type]++
+	}
+	response.Success(w, http.StatusOK, counts)
+}
+
+// MarkNotificationRead marks a notification as read (already read notifications keep their read time)
+// PUT /api/notifications/:id/read
+func (s *Server) MarkNotificationRead(w http.ResponseWriter, r *http.Request, notificationID string) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+	if notificationID == "" || strings.Contains(notificationID, "/") {
+		response.Error(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+	var updated []models.Notification
+	_, err := client.From("notifications").
+		Update(map[string]interface{}{"read_at": time.Now().UTC().Format(time.RFC3339)}, "", "").
+		Eq("id", notificationID).
+		Eq("user_id", userID).
+		Is("read_at", "null").
+		ExecuteTo(&updated)
+	if err != nil {
+		log.Printf("[MarkNotificationRead] ❌ Failed to mark notification %s as read: %v", notificationID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to update notification")
+		return
+	}
+	if len(updated) > 0 {
+		response.Success(w, http.StatusOK, updated[0])
+		return
+	}
+
+	var existing []models.Notification
+	_, err = client.From("notifications").
+		Select("*", "", false).
+		Eq("id", notificationID).
+		Eq("user_id", userID).
+		ExecuteTo(&existing)
+	if err != nil || len(existing) == 0 {
+		response.Error(w, http.StatusNotFound, "Notification not found")
+		return
+	}
+	response.Success(w, http.StatusOK, existing[0])
+}
+
+// MarkAllNotificationsRead marks all unread notifications (optionally of one type) as read
+// PUT /api/notifications/read-all?type=
+func (s *Server) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	builder := s.supabase.GetAuthenticatedClient(accessToken).From("notifications").
+		Update(map[string]interface{}{"read_at": time.Now().UTC().Format(time.RFC3339)}, "", "").
+		Eq("user_id", userID).
+		Is("read_at", "null")
+	if v := r.URL.Query().Get("type"); v != "" {
+		builder = builder.Eq("type", v)
+	}
+
+	var updated []struct {
+		ID string `json:"id"`
+	}
+	_, err := builder.ExecuteTo(&updated)
+	if err != nil {
+		log.Printf("[MarkAllNotificationsRead] ❌ Failed to mark notifications of %s as read: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to update notifications")
+		return
+	}
+
+	log.Printf("[MarkAllNotificationsRead] ✓ %d notifications of %s marked as read", len(updated), userID)
+	response.Success(w, http.StatusOK, map[string]int{"updated": len(updated)})
+}
+
+// GetNotificationPreferences returns whether each type of notification is delivered to the user in the app and by email
+// GET /api/notifications/preferences
+func (s *Server) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	preferences, err := s.notificationPreferences(s.supabase.GetAuthenticatedClient(accessToken), userID)
+	if err != nil {
+		log.Printf("[GetNotificationPreferences] Failed to query preferences of %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query notification preferences")
+		return
+	}
+	response.Success(w, http.StatusOK, preferences)
+}
+
+// UpdateNotificationPreferences turns types of notifications on or off for each channel
+// PUT /api/notifications/preferences
+func (s *Server) UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateNotificationPreferencesRequest
+	if !utils.DecodeJSONBody(r, w, &req) {
+		return
+	}
+	if len(req.Preferences) == 0 {
+		response.Error(w, http.StatusBadRequest, "preferences is required")
+		return
+	}
+
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+	current, err := s.notificationPreferences(client, userID)
+	if err != nil {
+		log.Printf("[UpdateNotificationPreferences] Failed to query preferences of %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query notification preferences")
+		return
+	}
+	saved := make(map[models.NotificationType]models.NotificationPreference, len(current))
+	for _, p := range current {
+		saved[p.Type] = p
+	}
+
+	// 一括upsertは全行のキーを揃える必要があるため、指定されなかったチャネルは現在の値で埋める
+	now := time.Now().UTC().Format(time.RFC3339)
+	rows := make([]map[string]interface{}, 0, len(req.Preferences))
+	for _, p := range req.Preferences {
+		if !p.Type.Valid() {
+			response.Error(w, http.StatusBadRequest, "Unknown notification type: "+string(p.Type))
+			return
+		}
+		preference := saved[p.Type]
+		if p.InApp != nil {
+			preference.InApp = *p.InApp
+		}
+		if p.Email != nil {
+			preference.Email = *p.Email
+		}
+		rows = append(rows, map[string]interface{}{
+			"user_id":    userID,
+			"type":       p.Type,
+			"in_app":     preference.InApp,
+			"email":      preference.Email,
+			"updated_at": now,
+		})
+	}
+
+	_, _, err = client.From("notification_preferences").
+		Upsert(rows, "user_id,type", "", "").
+		Execute()
+	if err != nil {
+		log.Printf("[UpdateNotificationPreferences] ❌ Failed to save preferences of %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to update notification preferences")
+		return
+	}
+
+	preferences, err := s.notificationPreferences(client, userID)
+	if err != nil {
+		log.Printf("[UpdateNotificationPreferences] Failed to query preferences of %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query notification preferences")
+		return
+	}
+	log.Printf("[UpdateNotificationPreferences] ✓ %d preferences of %s updated", len(rows), userID)
+	response.Success(w, http.StatusOK, preferences)
+}
+
+// notificationPreferences returns the setting of every notification type (on unless turned off)
+func (s *Server) notificationPreferences(client *supabase.Client, userID string) ([]models.NotificationPreference, error) {
+	var rows []models.NotificationPreference
+	_, err := client.From("notification_preferences").
+		Select("type, in_app, email", "", false).
+		Eq("user_id", userID).
+		ExecuteTo(&rows)
+	if err != nil {
+		return nil, err
+	}
+	saved := make(map[models.NotificationType]models.NotificationPreference, len(rows))
+	for _, row := range rows {
+		saved[row.Type] = row
+	}
+
+	preferences := make([]models.NotificationPreference, 0, len(models.NotificationTypes))
+	for _, t := range models.NotificationTypes {
+		preference, ok := saved[t]
+		if !ok {
+			preference = models.NotificationPreference{Type: t, InApp: true, Email: true}
+		}
+		preferences = append(preferences, preference)
+	}
+	return preferences, nil
+}
@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+)
+
+// 通知の本文に入れる本文の抜粋の最大文字数
+const notificationExcerptLength = 80
+
+// notificationExcerpt shortens a text for the body of a notification
+func notificationExcerpt(text string) string {
+	runes := []rune(text)
+	if len(runes) <= notificationExcerptLength {
+		return text
+	}
+	return string(runes[:notificationExcerptLength]) + "…"
+}
+
+// recipientBlockedActor reports whether the recipient blocked the actor
+// (ブロックした相手のコメントは表示されないため、その相手の操作は通知しない)
+func (s *Server) recipientBlockedActor(recipientID, actorID string) bool {
+	return s.usersBlockedBy(s.supabase.GetServiceClient(), recipientID)[actorID]
+}
+
+// notifyNewMessage notifies the other participants of a thread of a new message.
+// スレッドをミュートしている参加者には通知しない
+func (s *Server) notifyNewMessage(message models.MessageWithSender) {
+	serviceClient := s.supabase.GetServiceClient()
+	participantIDs, err := s.threadParticipantIDs(serviceClient, message.ThreadID)
+	if err != nil {
+		log.Printf("[notifyNewMessage] ⚠️ Failed to query participants of thread %s: %v", message.ThreadID, err)
+		return
+	}
+
+	var muted []struct {
+		UserID string `json:"user_id"`
+	}
+	_, err = serviceClient.From("thread_user_states").
+		Select("user_id", "", false).
+		Eq("thread_id", message.ThreadID).
+		Eq("muted", "true").
+		ExecuteTo(&muted)
+	if err != nil {
+		log.Printf("[notifyNewMessage] ⚠️ Failed to query muted participants of thread %s: %v", message.ThreadID, err)
+	}
+	for _, m := range muted {
+		participantIDs = excludeString(participantIDs, m.UserID)
+	}
+
+	var body string
+	switch message.Type {
+	case models.MessageTypeImage:
+		body = "画像が送信されました"
+	case models.MessageTypeFile:
+		body = "ファイルが送信されました"
+	case models.MessageTypeContract:
+		body = "契約書が送信されました"
+	default:
+		body = notificationExcerpt(ndaStringValue(message.Text))
+	}
+	link := "/messages/" + message.ThreadID
+	resourceType := "thread"
+	threadID := message.ThreadID
+	sender := message.SenderUserID
+
+	notifications := make([]notificationInsert, 0, len(participantIDs))
+	for _, participantID := range participantIDs {
+		notifications = append(notifications, notificationInsert{
+			UserID:       participantID,
+			Type:         models.NotificationTypeMessageReceived,
+			Title:        fmt.Sprintf("%sさんからメッセージが届きました", message.SenderName),
+			Body:         &body,
+			Link:         &link,
+			ActorUserID:  &sender,
+			ResourceType: &resourceType,
+			ResourceID:   &threadID,
+			Data:         map[string]interface{}{"message_id": message.ID, "message_type": message.Type},
+		})
+	}
+	s.createNotifications(notifications)
+}
+
+// notifyPostComment notifies the author of a post of a new comment
+func (s *Server) notifyPostComment(actorID string, comment models.PostComment) {
+	var posts []struct {
+		AuthorUserID string `json:"author_user_id"`
+		Title        string `json:"title"`
+	}
+	_, err := s.supabase.GetServiceClient().From("posts").
+		Select("author_user_id, title", "", false).
+		Eq("id", comment.PostID).
+		ExecuteTo(&posts)
+	if err != nil || len(posts) == 0 {
+		log.Printf("[notifyPostComment] ⚠️ Failed to query post %s: %v", comment.PostID, err)
+		return
+	}
+	if s.recipientBlockedActor(posts[0].AuthorUserID, actorID) {
+		return
+	}
+
+	body := notificationExcerpt(comment.Content)
+	link := "/posts/" + comment.PostID
+	resourceType := "post_comment"
+	s.createNotifications([]notificationInsert{{
+		UserID:       posts[0].AuthorUserID,
+		Type:         models.NotificationTypePostCommented,
+		Title:        fmt.Sprintf("「%s」にコメントがつきました", posts[0].Title),
+		Body:         &body,
+		Link:         &link,
+		ActorUserID:  &actorID,
+		ResourceType: &resourceType,
+		ResourceID:   &comment.ID,
+		Data:         map[string]interface{}{"post_id": comment.PostID},
+	}})
+}
+
+// notifyCommentReply notifies the author of a comment of a new reply
+func (s *Server) notifyCommentReply(actorID string, reply models.CommentReply) {
+	var comments []models.PostComment
+	_, err := s.supabase.GetServiceClient().From("post_comments").
+		Select("*", "", false).
+		Eq("id", reply.CommentID).
+		ExecuteTo(&comments)
+	if err != nil || len(comments) == 0 {
+		log.Printf("[notifyCommentReply] ⚠️ Failed to query comment %s: %v", reply.CommentID, err)
+		return
+	}
+	if s.recipientBlockedActor(comments[0].UserID, actorID) {
+		return
+	}
+
+	body := notificationExcerpt(reply.Content)
+	link := "/posts/" + comments[0].PostID
+	resourceType := "comment_reply"
+	s.createNotifications([]notificationInsert{{
+		UserID:       comments[0].UserID,
+		Type:         models.NotificationTypeCommentReplied,
+		Title:        "コメントに返信がありました",
+		Body:         &body,
+		Link:         &link,
+		ActorUserID:  &actorID,
+		ResourceType: &resourceType,
+		ResourceID:   &reply.ID,
+		Data:         map[string]interface{}{"post_id": comments[0].PostID, "comment_id": reply.CommentID},
+	}})
+}
+
+// notifyPostLike notifies the author of a post of a new like
+func (s *Server) notifyPostLike(actorID string, postID string) {
+	var posts []struct {
+		AuthorUserID string `json:"author_user_id"`
+		Title        string `json:"title"`
+	}
+	_, err := s.supabase.GetServiceClient().From("posts").
+		Select("author_user_id, title", "", false).
+		Eq("id", postID).
+		ExecuteTo(&posts)
+	if err != nil || len(posts) == 0 {
+		log.Printf("[notifyPostLike] ⚠️ Failed to query post %s: %v", postID, err)
+		return
+	}
+	if s.recipientBlockedActor(posts[0].AuthorUserID, actorID) {
+		return
+	}
+
+	link := "/posts/" + postID
+	resourceType := "post"
+	s.createNotifications([]notificationInsert{{
+		UserID:       posts[0].AuthorUserID,
+		Type:         models.NotificationTypePostLiked,
+		Title:        fmt.Sprintf("「%s」に「いいね」がつきました", posts[0].Title),
+		Link:         &link,
+		ActorUserID:  &actorID,
+		ResourceType: &resourceType,
+		ResourceID:   &postID,
+	}})
+}
+
+// notifyCommentLike notifies the author of a comment of a new like
+func (s *Server) notifyCommentLike(actorID string, commentID string) {
+	var comments []models.PostComment
+	_, err := s.supabase.GetServiceClient().From("post_comments").
+		Select("*", "", false).
+		Eq("id", commentID).
+		ExecuteTo(&comments)
+	if err != nil || len(comments) == 0 {
+		log.Printf("[notifyCommentLike] ⚠️ Failed to query comment %s: %v", commentID, err)
+		return
+	}
+	if s.recipientBlockedActor(comments[0].UserID, actorID) {
+		return
+	}
+
+	body := notificationExcerpt(comments[0].Content)
+	link := "/posts/" + comments[0].PostID
+	resourceType := "post_comment"
+	s.createNotifications([]notificationInsert{{
+		UserID:       comments[0].UserID,
+		Type:         models.NotificationTypeCommentLiked,
+		Title:        "コメントに「いいね」がつきました",
+		Body:         &body,
+		Link:         &link,
+		ActorUserID:  &actorID,
+		ResourceType: &resourceType,
+		ResourceID:   &commentID,
+		Data:         map[string]interface{}{"post_id": comments[0].PostID},
+	}})
+}
+
+// notifyReplyLike notifies the author of a reply of a new like
+func (s *Server) notifyReplyLike(actorID string, replyID string) {
+	serviceClient := s.supabase.GetServiceClient()
+	var replies []models.CommentReply
+	_, err := serviceClient.From("comment_replies").
+		Select("*", "", false).
+		Eq("id", replyID).
+		ExecuteTo(&replies)
+	if err != nil || len(replies) == 0 {
+		log.Printf("[notifyReplyLike] ⚠️ Failed to query reply %s: %v", replyID, err)
+		return
+	}
+	if s.recipientBlockedActor(replies[0].UserID, actorID) {
+		return
+	}
+	data := map[string]interface{}{"comment_id": replies[0].CommentID}
+	var link *string
+	var comments []models.PostComment
+	_, err = serviceClient.From("post_comments").
+		Select("*", "", false).
+		Eq("id", replies[0].CommentID).
+		ExecuteTo(&comments)
+	if err == nil && len(comments) > 0 {
+		l := "/posts/" + comments[0].PostID
+		link = &l
+		data["post_id"] = comments[0].PostID
+	}
+
+	body := notificationExcerpt(replies[0].Content)
+	resourceType := "comment_reply"
+	s.createNotifications([]notificationInsert{{
+		UserID:       replies[0].UserID,
+		Type:         models.NotificationTypeReplyLiked,
+		Title:        "返信に「いいね」がつきました",
+		Body:         &body,
+		Link:         link,
+		ActorUserID:  &actorID,
+		ResourceType: &resourceType,
+		ResourceID:   &replyID,
+		Data:         data,
+	}})
+}
+
+// notifySaleRequest notifies the seller and the buyer of a new sale request or a status change
+// (the actor is skipped by createNotifications)
+func (s *Server) notifySaleRequest(actorID string, saleRequest models.SaleRequest, status models.SaleRequestStatus) {
+	price := services.FormatYen(saleRequest.Price)
+	var notificationType models.NotificationType
+	var title, sellerBody, buyerBody string
+	switch status {
+	case models.SaleRequestStatusPending:
+		notificationType = models.NotificationTypeSaleRequestCreated
+		title = "売却リクエストが届きました"
+		buyerBody = fmt.Sprintf("売却価格: %s円。内容をご確認のうえ、購入を確定してください", price)
+	case models.SaleRequestStatusActive:
+		notificationType = models.NotificationTypeSaleRequestConfirmed
+		title = "購入が確定しました"
+		sellerBody = fmt.Sprintf("買い手が購入を確定しました（%s円）。運営が入金を確認後にご連絡します", price)
+		// 確定した買い手本人にも、次の手順として届ける
+		buyerBody = fmt.Sprintf("購入を確定しました（%s円）。お支払い方法は運営からご案内します", price)
+		if s.config.EmailEnabled() {
+			buyerBody = fmt.Sprintf("購入を確定しました（%s円）。お支払い方法をメールでお送りしました", price)
+		}
+	case models.SaleRequestStatusCancelled:
+		notificationType = models.NotificationTypeSaleRequestCancelled
+		title = "売却リクエストがキャンセルされました"
+		sellerBody = "返金が必要な場合は運営が対応します"
+		buyerBody = sellerBody
+	default:
+		return
+	}
+
+	link := "/messages/" + saleRequest.ThreadID
+	resourceType := "sale_request"
+	data := map[string]interface{}{
+		"post_id": saleRequest.PostID,
+		"price":   saleRequest.Price,
+		"status":  status,
+	}
+	notification := func(recipient, body string, actor *string) notificationInsert {
+		return notificationInsert{
+			UserID:       recipient,
+			Type:         notificationType,
+			Title:        title,
+			Body:         &body,
+			Link:         &link,
+			ActorUserID:  actor,
+			ResourceType: &resourceType,
+			ResourceID:   &saleRequest.ID,
+			Data:         data,
+		}
+	}
+
+	var notifications []notificationInsert
+	if sellerBody != "" {
+		notifications = append(notifications, notification(saleRequest.UserID, sellerBody, &actorID))
+	}
+	if buyerBody != "" && saleRequest.BuyerUserID != nil {
+		actor := &actorID
+		if status == models.SaleRequestStatusActive {
+			actor = nil
+		}
+		notifications = append(notifications, notification(*saleRequest.BuyerUserID, buyerBody, actor))
+	}
+	s.createNotifications(notifications)
+	s.emailSaleRequest(actorID, saleRequest, status)
+}
+
+// notifyListingModerated tells the author of a listing that operators acted on a report about it.
+// 通報者や運営の対応メモ（resolution_note）は伝えない
+func (s *Server) notifyListingModerated(actorID string, report models.Report) {
+	if report.TargetType != models.ReportTargetPost {
+		return
+	}
+	var posts []struct {
+		AuthorUserID string `json:"author_user_id"`
+		Title        string `json:"title"`
+	}
+	_, err := s.supabase.GetServiceClient().From("posts").
+		Select("author_user_id, title", "", false).
+		Eq("id", report.TargetID).
+		ExecuteTo(&posts)
+	if err != nil || len(posts) == 0 {
+		log.Printf("[notifyListingModerated] ⚠️ Failed to query post %s: %v", report.TargetID, err)
+		return
+	}
+
+	body := "寄せられた通報を運営が確認し、対応を行いました。掲載内容をご確認ください"
+	link := "/posts/" + report.TargetID
+	resourceType := "post"
+	s.createNotifications([]notificationInsert{{
+		UserID:       posts[0].AuthorUserID,
+		Type:         models.NotificationTypeListingModerated,
+		Title:        fmt.Sprintf("「%s」について運営が対応しました", posts[0].Title),
+		Body:         &body,
+		Link:         &link,
+		ActorUserID:  &actorID,
+		ResourceType: &resourceType,
+		ResourceID:   &report.TargetID,
+	}})
+	s.enqueueEmail(posts[0].AuthorUserID, models.NotificationTypeListingModerated, models.EmailTemplateListingModerated, link, map[string]interface{}{
+		"PostTitle": posts[0].Title,
+	})
+}
+
+// emailSaleRequest emails the seller and the buyer about a sale request (the actor is skipped,
+// except for the payment instructions sent to the buyer who confirmed)
+// 🔒 SECURITY: 買い手宛てのメールには案件名を入れない（公開範囲によっては秘匿されているため）
+func (s *Server) emailSaleRequest(actorID string, saleRequest models.SaleRequest, status models.SaleRequestStatus) {
+	if !s.config.EmailEnabled() {
+		return
+	}
+	serviceClient := s.supabase.GetServiceClient()
+	sellerID := saleRequest.UserID
+	buyerID := ndaStringValue(saleRequest.BuyerUserID)
+	names := s.fetchDisplayNames(serviceClient, sellerID, buyerID, actorID)
+	link := "/messages/" + saleRequest.ThreadID
+
+	switch status {
+	case models.SaleRequestStatusPending:
+		s.enqueueEmail(buyerID, models.NotificationTypeSaleRequestCreated, models.EmailTemplateSaleRequestCreated, link, map[string]interface{}{
+			"SellerName": names[sellerID],
+			"Price":      saleRequest.Price,
+		})
+	case models.SaleRequestStatusActive:
+		s.enqueueEmail(buyerID, models.NotificationTypeSaleRequestConfirmed, models.EmailTemplateSaleRequestPayment, link, map[string]interface{}{
+			"Price":       saleRequest.Price,
+			"Reference":   saleRequestReference(saleRequest.ID),
+			"BankAccount": s.config.EscrowBankAccount,
+		})
+		var posts []struct {
+			Title string `json:"title"`
+		}
+		_, err := serviceClient.From("posts").
+			Select("title", "", false).
+			Eq("id", saleRequest.PostID).
+			ExecuteTo(&posts)
+		if err != nil || len(posts) == 0 {
+			log.Printf("[emailSaleRequest] ⚠️ Failed to query post %s: %v", saleRequest.PostID, err)
+			return
+		}
+		s.enqueueEmail(sellerID, models.NotificationTypeSaleRequestConfirmed, models.EmailTemplateSaleRequestConfirmed, link, map[string]interface{}{
+			"BuyerName": names[buyerID],
+			"PostTitle": posts[0].Title,
+			"Price":     saleRequest.Price,
+		})
+	case models.SaleRequestStatusCancelled:
+		for _, recipient := range []string{sellerID, buyerID} {
+			if recipient == actorID {
+				continue
+			}
+			s.enqueueEmail(recipient, models.NotificationTypeSaleRequestCancelled, models.EmailTemplateSaleRequestCancelled, link, map[string]interface{}{
+				"ActorName": names[actorID],
+				"Price":     saleRequest.Price,
+			})
+		}
+	}
+}
+
+// saleRequestReference is the short transaction ID buyers add to their bank transfer
+func saleRequestReference(saleRequestID string) string {
+	reference := strings.ReplaceAll(saleRequestID, "-", "")
+	if len(reference) > 8 {
+		reference = reference[:8]
+	}
+	return strings.ToUpper(reference)
+}
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/supabase-community/postgrest-go"
 	supabase "github.com/supabase-community/supabase-go"
 	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
 	"github.com/yourusername/appexit-backend/internal/utils"
 	"github.com/yourusername/appexit-backend/pkg/response"
 )
@@ -92,89 +95,15 @@ func (s *Server) ListPostsWithAuth(w http.ResponseWriter, r *http.Request) {
 	s.ListPosts(w, r)
 }
 
-// checkNDAAgreement checks if the user/organization has signed NDA with the seller
+// checkNDAAgreement checks if the user/organization holds an active NDA covering the seller's post
 // 🔒 SECURITY: Now accepts client as parameter to enforce RLS
-func (s *Server) checkNDAAgreement(client *supabase.Client, buyerUserID string, sellerUserID string, sellerOrgID *string) (bool, error) {
-	if buyerUserID == "" {
-		return false, nil
-	}
-
-	// Check if buyer user has signed NDA with seller (user-level)
-	var ndaAgreements []struct {
-		ID          string  `json:"id"`
-		BuyerUserID *string `json:"buyer_user_id"`
-		Status      string  `json:"status"`
-	}
-
-	query := client.From("nda_agreements").
-		Select("id, buyer_user_id, status", "", false).
-		Eq("status", "signed").
-		Eq("buyer_user_id", buyerUserID)
-
-	if sellerOrgID != nil && *sellerOrgID != "" {
-		query = query.Eq("seller_org_id", *sellerOrgID)
-	} else {
-		query = query.Eq("seller_user_id", sellerUserID)
-	}
-
-	_, err := query.ExecuteTo(&ndaAgreements)
-	if err == nil && len(ndaAgreements) > 0 {
-		return true, nil
-	}
-
-	// Check organization-level NDA
-	var orgMemberships []struct {
-		OrgID string `json:"org_id"`
-	}
-	_, err = client.From("org_memberships").
-		Select("org_id", "", false).
-		Eq("user_id", buyerUserID).
-		ExecuteTo(&orgMemberships)
-
-	if err == nil && len(orgMemberships) > 0 {
-		for _, membership := range orgMemberships {
-			var orgNDAAgreements []struct {
-				ID         string `json:"id"`
-				BuyerOrgID string `json:"buyer_org_id"`
-				Status     string `json:"status"`
-			}
-			orgQuery := client.From("nda_agreements").
-				Select("id, buyer_org_id, status", "", false).
-				Eq("status", "signed").
-				Eq("buyer_org_id", membership.OrgID)
-
-			if sellerOrgID != nil && *sellerOrgID != "" {
-				orgQuery = orgQuery.Eq("seller_org_id", *sellerOrgID)
-			} else {
-				orgQuery = orgQuery.Eq("seller_user_id", sellerUserID)
-			}
-
-			_, err = orgQuery.ExecuteTo(&orgNDAAgreements)
-			if err == nil && len(orgNDAAgreements) > 0 {
-				return true, nil
-			}
-		}
-	}
-
-	return false, nil
+// 複数の投稿をまとめて判定する場合は ndaResolver（postViewer.prefetch）を使う
+func (s *Server) checkNDAAgreement(client *supabase.Client, buyerUserID string, sellerUserID string, sellerOrgID *string, postID string) (bool, error) {
+	return newNDAResolver(client, buyerUserID).Covers(sellerUserID, sellerOrgID, postID)
 }
 
-// ListPosts retrieves a list of posts with optional filters using Supabase
-func (s *Server) ListPosts(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("\n========== LIST POSTS START ==========\n")
-	fmt.Printf("[GET /api/posts] Request received from %s\n", r.RemoteAddr)
-	fmt.Printf("[GET /api/posts] Query params: %v\n", r.URL.Query())
-	
-	urlQuery := r.URL.Query()
-
-	// Get user ID from context if available (for NDA check)
-	var currentUserID string
-	if userID, ok := r.Context().Value("user_id").(string); ok {
-		currentUserID = userID
-		fmt.Printf("[ListPosts] Current user ID: %s\n", currentUserID)
-	}
-
-	// Build query parameters
+// parsePostQueryParams parses the list filters shared by ListPosts and the feeds
+func parsePostQueryParams(urlQuery url.Values) models.PostQueryParams {
 	params := models.PostQueryParams{
 		Limit:  20, // Default limit
 		Offset: 0,
@@ -253,25 +182,11 @@ func (s *Server) ListPosts(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Check for sort parameter
-	sortBy := urlQuery.Get("sort")
-	fmt.Printf("[ListPosts] Search params: keyword=%v, categories=%v, postTypes=%v, price=%v-%v, revenue=%v-%v, techStacks=%v\n",
-		params.SearchKeyword, params.Categories, params.PostTypes, params.PriceMin, params.PriceMax, params.RevenueMin, params.RevenueMax, params.TechStacks)
-
-	// 🔒 SECURITY: Use access token if authenticated, otherwise use Anon Client to enforce RLS
-	var client *supabase.Client
-	if accessToken, ok := r.Context().Value("access_token").(string); ok && accessToken != "" {
-		// Authenticated user - can see more posts based on RLS policies
-		client = s.supabase.GetAuthenticatedClient(accessToken)
-	} else {
-		// Unauthenticated user - can only see public posts
-		client = s.supabase.GetAnonClient()
-	}
-	query := client.From("posts").
-		Select("*", "", false).
-		Order("created_at", nil)
+	return params
+}
 
-	// Apply filters
+// applyPostFilters applies PostQueryParams to a posts query (pagination and sort are left to the caller)
+func applyPostFilters(query *postgrest.FilterBuilder, params models.PostQueryParams) *postgrest.FilterBuilder {
 	if params.Type != nil {
 		query = query.Eq("type", string(*params.Type))
 	}
@@ -331,62 +246,105 @@ func (s *Server) ListPosts(w http.ResponseWriter, r *http.Request) {
 		query = query.Filter("tech_stack", "ov", string(techStacksJSON))
 	}
 
-	// For recommended sort, fetch more data to allow proper sorting by watch count
-	// ウォッチ数でソートするため、より多くのデータを取得してからソート
-	fetchLimit := params.Limit
-	if sortBy == "recommended" {
-		// ウォッチ数でソートするため、十分なデータを取得（最大100件）
-		fetchLimit = 100
-		if fetchLimit < params.Limit {
-			fetchLimit = params.Limit
+	return query
+}
+
+// recommendedPageSize matches the PostgREST max_rows limit
+const recommendedPageSize = 1000
+
+// fetchAllPosts reads every post matching the query, page by page
+func fetchAllPosts(query *postgrest.FilterBuilder) ([]models.Post, error) {
+	var posts []models.Post
+	seen := make(map[string]bool)
+	for from := 0; ; from += recommendedPageSize {
+		var page []models.Post
+		if _, err := query.Range(from, from+recommendedPageSize-1, "").ExecuteTo(&page); err != nil {
+			return nil, err
 		}
-		// ページネーションを一時的に無効化（ソート後に適用）
-		query = query.Range(0, fetchLimit-1, "")
+		for _, post := range page {
+			// ページ取得の間に投稿が追加されると同じ投稿が次のページにも含まれる
+			if !seen[post.ID] {
+				seen[post.ID] = true
+				posts = append(posts, post)
+			}
+		}
+		if len(page) < recommendedPageSize {
+			return posts, nil
+		}
+	}
+}
+
+// ListPosts retrieves a list of posts with optional filters using Supabase
+func (s *Server) ListPosts(w http.ResponseWriter, r *http.Request) {
+	fmt.Printf("\n========== LIST POSTS START ==========\n")
+	fmt.Printf("[GET /api/posts] Request received from %s\n", r.RemoteAddr)
+	fmt.Printf("[GET /api/posts] Query params: %v\n", r.URL.Query())
+	
+	urlQuery := r.URL.Query()
+
+	// Get user ID from context if available (for NDA check)
+	var currentUserID string
+	if userID, ok := r.Context().Value("user_id").(string); ok {
+		currentUserID = userID
+		fmt.Printf("[ListPosts] Current user ID: %s\n", currentUserID)
+	}
+
+	// Build query parameters
+	params := parsePostQueryParams(urlQuery)
+
+	// Check for sort parameter
+	sortBy := urlQuery.Get("sort")
+	fmt.Printf("[ListPosts] Search params: keyword=%v, categories=%v, postTypes=%v, price=%v-%v, revenue=%v-%v, techStacks=%v\n",
+		params.SearchKeyword, params.Categories, params.PostTypes, params.PriceMin, params.PriceMax, params.RevenueMin, params.RevenueMax, params.TechStacks)
+
+	// 🔒 SECURITY: Use access token if authenticated, otherwise use Anon Client to enforce RLS
+	var client *supabase.Client
+	if accessToken, ok := r.Context().Value("access_token").(string); ok && accessToken != "" {
+		// Authenticated user - can see more posts based on RLS policies
+		client = s.supabase.GetAuthenticatedClient(accessToken)
 	} else {
-		// Apply pagination
-		query = query.Range(params.Offset, params.Offset+params.Limit-1, "")
+		// Unauthenticated user - can only see public posts
+		client = s.supabase.GetAnonClient()
+	}
+	query := client.From("posts").
+		Select("*", "", false).
+		Order("created_at", nil)
+
+	// Apply filters
+	query = applyPostFilters(query, params)
+
+	// Exclude the viewer's own posts (used by /api/posts/recommended)
+	if urlQuery.Get("exclude_own") == "true" && currentUserID != "" {
+		query = query.Neq("author_user_id", currentUserID)
+		// ブロックしている・されている売り手の案件はおすすめに出さない
+		if blocks, err := s.fetchUserBlocks(currentUserID); err != nil {
+			fmt.Printf("[ListPosts] ⚠ Failed to query blocks: %v\n", err)
+		} else if ids := blocks.userIDs(); len(ids) > 0 {
+			query = query.Not("author_user_id", "in", "("+strings.Join(ids, ",")+")")
+		}
 	}
 
-	// Execute query
+	// おすすめ順はマッチングスコア・ウォッチ数で並べ替えるため、条件に合う投稿をすべて取得し、
+	// ソート後に offset / limit を適用する（新しい順の一部だけを並べ替えると古い案件が出ず、ページもずれる）
 	var postsData []models.Post
-	_, err := query.ExecuteTo(&postsData)
+	var err error
+	if sortBy == "recommended" {
+		postsData, err = fetchAllPosts(query)
+	} else {
+		// Apply pagination
+		_, err = query.Range(params.Offset, params.Offset+params.Limit-1, "").ExecuteTo(&postsData)
+	}
 	if err != nil {
 		fmt.Printf("[ListPosts] ERROR: Failed to query posts: %v\n", err)
 		response.Success(w, http.StatusOK, []models.PostWithDetails{})
 		return
 	}
 
-	// Get all unique author user IDs and post IDs
-	authorIDs := make(map[string]bool)
 	postIDs := make([]string, 0, len(postsData))
 	for _, post := range postsData {
-		authorIDs[post.AuthorUserID] = true
 		postIDs = append(postIDs, post.ID)
 	}
 
-	// Fetch profiles for all authors
-	profilesMap := make(map[string]*models.AuthorProfile)
-	if len(authorIDs) > 0 {
-		ids := make([]string, 0, len(authorIDs))
-		for id := range authorIDs {
-			ids = append(ids, id)
-		}
-
-		var profiles []models.AuthorProfile
-		_, err := client.From("profiles").
-			Select("id, display_name, icon_url, role, party", "", false).
-			In("id", ids).
-			ExecuteTo(&profiles)
-
-		if err != nil {
-			fmt.Printf("[ListPosts] WARNING: Failed to query profiles: %v\n", err)
-		} else {
-			for i := range profiles {
-				profilesMap[profiles[i].ID] = &profiles[i]
-			}
-		}
-	}
-
 	// Fetch active view counts for all posts using RPC function (N+1問題を解決)
 	// PostgreSQLのGROUP BY集計を使用して効率的にカウント
 	activeViewCountMap := make(map[string]int)
@@ -418,114 +376,71 @@ func (s *Server) ListPosts(w http.ResponseWriter, r *http.Request) {
 			fmt.Printf("[ListPosts] ✓ Retrieved active view counts via RPC (total: %d views)\n", totalViews)
 		}
 
-		// Fetch watch counts for recommended sort
-		if sortBy == "recommended" {
-			var watchViews []models.ProductActiveView
-			_, err := client.From("product_active_views").
-				Select("post_id", "", false).
-				In("post_id", postIDs).
-				ExecuteTo(&watchViews)
-
-			if err == nil {
-				for _, view := range watchViews {
-					watchCountMap[view.PostID]++
-				}
-				fmt.Printf("[ListPosts] ✓ Retrieved watch counts (total: %d watches)\n", len(watchViews))
-			} else {
-				fmt.Printf("[ListPosts] ⚠ Failed to get watch counts: %v\n", err)
-			}
-		}
+		// ウォッチ数（おすすめ順で使用）は product_active_views の件数
+		watchCountMap = activeViewCountMap
 	}
 
-	// Transform to PostWithDetails and apply NDA filtering for secret posts
+	// Transform to PostWithDetails and apply the visibility policy for secret posts
+	viewer := s.newPostViewer(r, client)
+	viewer.prefetch(postsData)
+	// 🔒 SECURITY: 内容に関する条件で絞り込んだ場合、項目がマスクされる秘匿投稿は除外する
+	// （結果に含まれること自体から非開示の価格・売上などが推測できてしまうため）
+	detailFiltered := hasPostDetailFilters(params)
 	result := make([]models.PostWithDetails, 0, len(postsData))
 	for _, post := range postsData {
 		activeCount := activeViewCountMap[post.ID]
-		
-		// For secret posts, check NDA agreement and filter/hide details if not signed
-		if post.Type == models.PostTypeSecret {
-			// If user is not authenticated, hide all details
-			if currentUserID == "" {
-				// Hide title, body, and other sensitive information
-				post.Title = ""
-				post.Body = nil
-				post.AppCategories = nil
-				post.ServiceURLs = nil
-				post.RevenueModels = nil
-				post.MonthlyRevenue = nil
-				post.MonthlyCost = nil
-				post.AppealText = nil
-				post.TechStack = nil
-				post.UserCount = nil
-				post.ReleaseDate = nil
-				post.OperationForm = nil
-				post.OperationEffort = nil
-				post.TransferItems = nil
-				post.DesiredTransferTiming = nil
-				post.GrowthPotential = nil
-				post.TargetCustomers = nil
-				post.MarketingChannels = nil
-				post.MediaMentions = nil
-				post.ExtraImageURLs = nil
-				post.DashboardURL = nil
-				post.UserUIURL = nil
-				post.PerformanceURL = nil
-			} else {
-				// Check NDA agreement
-				hasNDA, err := s.checkNDAAgreement(client, currentUserID, post.AuthorUserID, post.AuthorOrgID)
-				if err != nil {
-					fmt.Printf("[ListPosts] ⚠️ Warning: Failed to check NDA for post %s: %v\n", post.ID, err)
-				}
-				if !hasNDA {
-					// Hide details if NDA not signed
-					post.Title = ""
-					post.Body = nil
-					post.AppCategories = nil
-					post.ServiceURLs = nil
-					post.RevenueModels = nil
-					post.MonthlyRevenue = nil
-					post.MonthlyCost = nil
-					post.AppealText = nil
-					post.TechStack = nil
-					post.UserCount = nil
-					post.ReleaseDate = nil
-					post.OperationForm = nil
-					post.OperationEffort = nil
-					post.TransferItems = nil
-					post.DesiredTransferTiming = nil
-					post.GrowthPotential = nil
-					post.TargetCustomers = nil
-					post.MarketingChannels = nil
-					post.MediaMentions = nil
-					post.ExtraImageURLs = nil
-					post.DashboardURL = nil
-					post.UserUIURL = nil
-					post.PerformanceURL = nil
-					// Hide author profile name for secret posts without NDA
-					if profilesMap[post.AuthorUserID] != nil {
-						profileCopy := *profilesMap[post.AuthorUserID]
-						profileCopy.DisplayName = ""
-						profilesMap[post.AuthorUserID] = &profileCopy
-					}
-				}
-			}
+
+		// 🔒 SECURITY: 閲覧者との関係（未ログイン/ログイン/NDA締結/投稿者/運営）に応じて項目をマスク
+		relation := viewer.relation(post)
+		if !services.PostListable(post, relation) {
+			continue
 		}
-		
-		result = append(result, models.PostWithDetails{
+		details := models.PostWithDetails{
 			Post:            post,
-			AuthorProfile:   profilesMap[post.AuthorUserID],
 			ActiveViewCount: activeCount,
-		})
+		}
+		services.ApplyPostDetailsVisibility(&details, relation)
+		if detailFiltered && len(details.MaskedFields) > 0 {
+			continue
+		}
+
+		result = append(result, details)
 		if activeCount > 0 {
-			fmt.Printf("[ListPosts] Post %s (%s) has %d active views\n", post.ID, post.Title, activeCount)
+			fmt.Printf("[ListPosts] Post %s (%s) has %d active views\n", post.ID, details.Title, activeCount)
 		}
 	}
 
-	// Sort by watch count if sort=recommended
+	// Sort by match score (falls back to watch count) if sort=recommended
 	if sortBy == "recommended" {
-		fmt.Printf("[ListPosts] Sorting by watch count (recommended)\n")
-		// ウォッチ数でソート（降順）
+		// ログインユーザーに購入条件があればマッチングスコアで並べ替える
+		// スコアはNDAマスキング後の項目で計算する（非開示項目が順位から推測されないように）
+		var criteria []models.MatchCriteria
+		if currentUserID != "" {
+			criteria, err = s.loadMatchCriteria(client, currentUserID)
+			if err != nil {
+				fmt.Printf("[ListPosts] ⚠ Failed to load match criteria: %v\n", err)
+			}
+		}
+		scoreMap := make(map[string]int)
+		for i := range result {
+			if score, ok := services.BestScore(criteria, result[i].Post); ok {
+				scoreCopy := score
+				result[i].Match = &scoreCopy
+				scoreMap[result[i].ID] = score.Score
+			}
+		}
+		if len(scoreMap) > 0 {
+			fmt.Printf("[ListPosts] Sorting by match score (recommended)\n")
+		} else {
+			fmt.Printf("[ListPosts] Sorting by watch count (recommended)\n")
+		}
+		// マッチングスコア → ウォッチ数の順でソート（降順）
 		sort.Slice(result, func(i, j int) bool {
+			scoreI := scoreMap[result[i].ID]
+			scoreJ := scoreMap[result[j].ID]
+			if scoreI != scoreJ {
+				return scoreI > scoreJ
+			}
 			watchCountI := watchCountMap[result[i].ID]
 			watchCountJ := watchCountMap[result[j].ID]
 			if watchCountI != watchCountJ {
@@ -534,9 +449,37 @@ func (s *Server) ListPosts(w http.ResponseWriter, r *http.Request) {
 			// ウォッチ数が同じ場合は作成日時で比較（新しい順）
 			return result[i].CreatedAt.After(result[j].CreatedAt)
 		})
-		// ソート後に要求されたlimitを適用
-		if len(result) > params.Limit {
-			result = result[:params.Limit]
+		// ソート後に要求されたoffset / limitを適用
+		start := min(params.Offset, len(result))
+		end := min(start+params.Limit, len(result))
+		result = result[start:end]
+	}
+
+	// Fetch profiles for the authors of the returned posts
+	// （著者が非開示の秘匿投稿は author_user_id がマスク済みのためプロフィールを付けない）
+	authorIDs := make([]string, 0, len(result))
+	for _, details := range result {
+		if details.AuthorUserID != "" && !containsString(authorIDs, details.AuthorUserID) {
+			authorIDs = append(authorIDs, details.AuthorUserID)
+		}
+	}
+	if len(authorIDs) > 0 {
+		var profiles []models.AuthorProfile
+		_, err := client.From("profiles").
+			Select("id, display_name, icon_url, role, party", "", false).
+			In("id", authorIDs).
+			ExecuteTo(&profiles)
+
+		if err != nil {
+			fmt.Printf("[ListPosts] WARNING: Failed to query profiles: %v\n", err)
+		} else {
+			profilesMap := make(map[string]*models.AuthorProfile, len(profiles))
+			for i := range profiles {
+				profilesMap[profiles[i].ID] = &profiles[i]
+			}
+			for i := range result {
+				result[i].AuthorProfile = profilesMap[result[i].AuthorUserID]
+			}
 		}
 	}
 
@@ -593,28 +536,16 @@ func (s *Server) GetPost(w http.ResponseWriter, r *http.Request, postID string)
 	post := postsData[0]
 	fmt.Printf("[GET /api/posts/%s] ✓ Post found: %s\n", postID, post.Title)
 
-	// For secret posts, check NDA agreement and return 403 if not signed
+	// 🔒 SECURITY: 秘匿投稿は閲覧者との関係に応じてマスク（hidden はNDA締結者・投稿者・運営のみ）
+	viewer := s.newPostViewer(r, client)
+	relation := viewer.relation(post)
+	if !services.PostListable(post, relation) {
+		fmt.Printf("[GET /api/posts/%s] ❌ ERROR: Viewer (%s) cannot access hidden secret post\n", postID, relation)
+		http.Error(w, "NDA agreement required", http.StatusForbidden)
+		return
+	}
 	if post.Type == models.PostTypeSecret {
-		// If user is not authenticated, return 403
-		if currentUserID == "" {
-			fmt.Printf("[GET /api/posts/%s] ❌ ERROR: Unauthenticated user trying to access secret post\n", postID)
-			http.Error(w, "NDA agreement required", http.StatusForbidden)
-			return
-		}
-
-		// Check NDA agreement
-		hasNDA, err := s.checkNDAAgreement(client, currentUserID, post.AuthorUserID, post.AuthorOrgID)
-		if err != nil {
-			fmt.Printf("[GET /api/posts/%s] ❌ ERROR: Failed to check NDA: %v\n", postID, err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		if !hasNDA {
-			fmt.Printf("[GET /api/posts/%s] ❌ ERROR: User %s does not have NDA agreement for this post\n", postID, currentUserID)
-			http.Error(w, "NDA agreement required", http.StatusForbidden)
-			return
-		}
-		fmt.Printf("[GET /api/posts/%s] ✓ User %s has NDA agreement\n", postID, currentUserID)
+		fmt.Printf("[GET /api/posts/%s] ✓ Secret post viewed as %s\n", postID, relation)
 	}
 
 	// Fetch author profile
@@ -656,6 +587,12 @@ func (s *Server) GetPost(w http.ResponseWriter, r *http.Request, postID string)
 		AuthorProfile:   authorProfilePtr,
 		ActiveViewCount: activeViewCount,
 	}
+	services.ApplyPostDetailsVisibility(&response, relation)
+
+	// 詳細ページの閲覧を記録（UpdatePostからの呼び出しは除外）
+	if r.Method == http.MethodGet {
+		s.trackPostView(w, r, post, currentUserID)
+	}
 
 	fmt.Printf("[GET /api/posts/%s] ✅ Returning post with author profile\n", postID)
 	w.Header().Set("Content-Type", "application/json")
@@ -717,6 +654,76 @@ func (s *Server) CreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 🔒 SECURITY: 入力値をサニタイズ（XSS、インジェクション攻撃防止）
+	if err := sanitizeCreatePostRequest(&req); err != nil {
+		fmt.Printf("[POST /api/posts] ❌ ERROR: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Additional validation for transaction type
+	if err := checkTransactionPostRequirements(req); err != nil {
+		fmt.Printf("[POST /api/posts] ❌ ERROR: %v\n", err)
+		fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	fmt.Printf("[POST /api/posts] ✓ Validation passed\n")
+
+	// Create a new Supabase client with access token (for RLS)
+	fmt.Printf("[POST /api/posts] Creating Supabase client with access token...\n")
+	authClient := s.supabase.GetAuthenticatedClient(accessToken)
+	fmt.Printf("[POST /api/posts] ✓ Supabase client created\n")
+
+	// Get user's organization if they have one
+	fmt.Printf("[POST /api/posts] Querying user organization...\n")
+	authorOrgID := s.getAuthorOrgID(authClient, userID)
+
+	// Prepare post data
+	postData := buildPostInsertData(userID, authorOrgID, req)
+
+	// Insert post with access token (RLS will automatically check permissions)
+	fmt.Printf("[POST /api/posts] Inserting post into database...\n")
+	fmt.Printf("[POST /api/posts] Post data: %+v\n", postData)
+	var createdPosts []models.Post
+	_, err := authClient.From("posts").
+		Insert(postData, false, "", "", "").
+		ExecuteTo(&createdPosts)
+
+	if err != nil {
+		fmt.Printf("[POST /api/posts] ❌ ERROR: Failed to insert post: %v\n", err)
+		fmt.Printf("[POST /api/posts] Error type: %T\n", err)
+		fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
+		http.Error(w, fmt.Sprintf("Failed to create post: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("[POST /api/posts] ✓ Post insert query executed\n")
+
+	if len(createdPosts) == 0 {
+		fmt.Printf("[POST /api/posts] ❌ ERROR: No post was created (empty result)\n")
+		fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
+		http.Error(w, "Failed to create post", http.StatusInternalServerError)
+		return
+	}
+
+	postID := createdPosts[0].ID
+	fmt.Printf("[POST /api/posts] ✓ Post created successfully with ID: %s\n", postID)
+
+	response := models.PostWithDetails{
+		Post: createdPosts[0],
+	}
+
+	fmt.Printf("[POST /api/posts] ✅ CreatePost completed successfully\n")
+	fmt.Printf("========== CREATE POST END (SUCCESS) ==========\n\n")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// sanitizeCreatePostRequest sanitizes free-text and URL fields of a create request in place
+// 🔒 SECURITY: XSS、インジェクション攻撃防止（CreatePostと一括インポートで共通）
+func sanitizeCreatePostRequest(req *models.CreatePostRequest) error {
 	titleResult := utils.SanitizeText(utils.SanitizeInput{
 		Value:      req.Title,
 		MaxLength:  utils.MaxTitleLength,
@@ -724,14 +731,14 @@ func (s *Server) CreatePost(w http.ResponseWriter, r *http.Request) {
 		StrictMode: true,
 	})
 	if !titleResult.IsValid {
-		fmt.Printf("[POST /api/posts] ❌ WARNING: Title contains potentially malicious content: %v\n", titleResult.Errors)
+		fmt.Printf("[sanitizeCreatePostRequest] ❌ WARNING: Title contains potentially malicious content: %v\n", titleResult.Errors)
 	}
 	req.Title = titleResult.Sanitized
 
 	if req.Body != nil {
 		bodyResult := utils.SanitizeRichText(*req.Body, utils.MaxDescriptionLength)
 		if !bodyResult.IsValid {
-			fmt.Printf("[POST /api/posts] ❌ WARNING: Body contains potentially malicious content: %v\n", bodyResult.Errors)
+			fmt.Printf("[sanitizeCreatePostRequest] ❌ WARNING: Body contains potentially malicious content: %v\n", bodyResult.Errors)
 		}
 		sanitizedBody := bodyResult.Sanitized
 		req.Body = &sanitizedBody
@@ -745,7 +752,7 @@ func (s *Server) CreatePost(w http.ResponseWriter, r *http.Request) {
 			StrictMode: false,
 		})
 		if !appealResult.IsValid {
-			fmt.Printf("[POST /api/posts] ❌ WARNING: Appeal text contains potentially malicious content: %v\n", appealResult.Errors)
+			fmt.Printf("[sanitizeCreatePostRequest] ❌ WARNING: Appeal text contains potentially malicious content: %v\n", appealResult.Errors)
 		}
 		sanitizedAppeal := appealResult.Sanitized
 		req.AppealText = &sanitizedAppeal
@@ -755,9 +762,7 @@ func (s *Server) CreatePost(w http.ResponseWriter, r *http.Request) {
 	if req.EyecatchURL != nil {
 		eyecatchResult := utils.SanitizeURL(*req.EyecatchURL)
 		if !eyecatchResult.IsValid {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: Invalid eyecatch URL: %v\n", eyecatchResult.Errors)
-			http.Error(w, "Invalid eyecatch URL", http.StatusBadRequest)
-			return
+			return fmt.Errorf("Invalid eyecatch URL")
 		}
 		req.EyecatchURL = &eyecatchResult.Sanitized
 	}
@@ -765,190 +770,111 @@ func (s *Server) CreatePost(w http.ResponseWriter, r *http.Request) {
 	if req.DashboardURL != nil {
 		dashboardResult := utils.SanitizeURL(*req.DashboardURL)
 		if !dashboardResult.IsValid {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: Invalid dashboard URL: %v\n", dashboardResult.Errors)
-			http.Error(w, "Invalid dashboard URL", http.StatusBadRequest)
-			return
+			return fmt.Errorf("Invalid dashboard URL")
 		}
 		req.DashboardURL = &dashboardResult.Sanitized
 	}
-	
-	// Additional validation for transaction type
-	if req.Type == models.PostTypeTransaction {
-		fmt.Printf("[POST /api/posts] Validating transaction-specific fields...\n")
-		
-		if req.Price == nil || *req.Price <= 0 {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: Price is required for transaction posts\n")
-			fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-			http.Error(w, "Price is required for transaction posts", http.StatusBadRequest)
-			return
-		}
-		
-		if len(req.AppCategories) == 0 {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: At least one app category is required for transaction posts\n")
-			fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-			http.Error(w, "At least one app category is required for transaction posts", http.StatusBadRequest)
-			return
-		}
-		
-		if req.MonthlyRevenue == nil || *req.MonthlyRevenue < 0 {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: Monthly revenue is required for transaction posts\n")
-			fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-			http.Error(w, "Monthly revenue is required for transaction posts", http.StatusBadRequest)
-			return
-		}
-		
-		if req.MonthlyCost == nil || *req.MonthlyCost < 0 {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: Monthly cost is required for transaction posts\n")
-			fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-			http.Error(w, "Monthly cost is required for transaction posts", http.StatusBadRequest)
-			return
-		}
-		
-		if req.AppealText == nil || len(*req.AppealText) < 50 {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: Appeal text must be at least 50 characters for transaction posts\n")
-			fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-			http.Error(w, "Appeal text must be at least 50 characters for transaction posts", http.StatusBadRequest)
-			return
-		}
-		
-		if req.EyecatchURL == nil || *req.EyecatchURL == "" {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: Eyecatch URL is required for transaction posts\n")
-			fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-			http.Error(w, "Eyecatch URL is required for transaction posts", http.StatusBadRequest)
-			return
-		}
-		
-		if req.DashboardURL == nil || *req.DashboardURL == "" {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: Dashboard URL is required for transaction posts\n")
-			fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-			http.Error(w, "Dashboard URL is required for transaction posts", http.StatusBadRequest)
-			return
-		}
-		
-		if req.UserUIURL == nil || *req.UserUIURL == "" {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: User UI URL is required for transaction posts\n")
-			fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-			http.Error(w, "User UI URL is required for transaction posts", http.StatusBadRequest)
-			return
-		}
-		
-		if req.PerformanceURL == nil || *req.PerformanceURL == "" {
-			fmt.Printf("[POST /api/posts] ❌ ERROR: Performance URL is required for transaction posts\n")
-			fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-			http.Error(w, "Performance URL is required for transaction posts", http.StatusBadRequest)
-			return
-		}
-		
-		fmt.Printf("[POST /api/posts] ✓ Transaction validation passed\n")
-	}
-	
-	fmt.Printf("[POST /api/posts] ✓ Validation passed\n")
 
-	// Create a new Supabase client with access token (for RLS)
-	fmt.Printf("[POST /api/posts] Creating Supabase client with access token...\n")
-	authClient := s.supabase.GetAuthenticatedClient(accessToken)
-	fmt.Printf("[POST /api/posts] ✓ Supabase client created\n")
+	return nil
+}
 
-	// Get user's organization if they have one
-	fmt.Printf("[POST /api/posts] Querying user organization...\n")
-	type OrgMembership struct {
-		OrgID string `json:"org_id"`
+// checkTransactionPostRequirements checks the fields required for transaction posts
+// (stricter than validateCreatePostRequest: empty strings and zero price are rejected)
+func checkTransactionPostRequirements(req models.CreatePostRequest) error {
+	if req.Type != models.PostTypeTransaction {
+		return nil
+	}
+	if req.Price == nil || *req.Price <= 0 {
+		return fmt.Errorf("Price is required for transaction posts")
+	}
+	if len(req.AppCategories) == 0 {
+		return fmt.Errorf("At least one app category is required for transaction posts")
+	}
+	if req.MonthlyRevenue == nil || *req.MonthlyRevenue < 0 {
+		return fmt.Errorf("Monthly revenue is required for transaction posts")
+	}
+	if req.MonthlyCost == nil || *req.MonthlyCost < 0 {
+		return fmt.Errorf("Monthly cost is required for transaction posts")
 	}
-	var orgMemberships []OrgMembership
-	var authorOrgID *string
+	if req.AppealText == nil || len(*req.AppealText) < 50 {
+		return fmt.Errorf("Appeal text must be at least 50 characters for transaction posts")
+	}
+	if req.EyecatchURL == nil || *req.EyecatchURL == "" {
+		return fmt.Errorf("Eyecatch URL is required for transaction posts")
+	}
+	if req.DashboardURL == nil || *req.DashboardURL == "" {
+		return fmt.Errorf("Dashboard URL is required for transaction posts")
+	}
+	if req.UserUIURL == nil || *req.UserUIURL == "" {
+		return fmt.Errorf("User UI URL is required for transaction posts")
+	}
+	if req.PerformanceURL == nil || *req.PerformanceURL == "" {
+		return fmt.Errorf("Performance URL is required for transaction posts")
+	}
+	return nil
+}
 
-	_, err := authClient.From("org_memberships").
+// getAuthorOrgID returns the first organization of the user, or nil
+func (s *Server) getAuthorOrgID(client *supabase.Client, userID string) *string {
+	var orgMemberships []struct {
+		OrgID string `json:"org_id"`
+	}
+	_, err := client.From("org_memberships").
 		Select("org_id", "", false).
 		Eq("user_id", userID).
 		Limit(1, "").
 		ExecuteTo(&orgMemberships)
 
 	if err != nil {
-		fmt.Printf("[POST /api/posts] ⚠️ Warning: Failed to query user organization: %v\n", err)
-		fmt.Printf("[POST /api/posts] Continuing without organization...\n")
-	} else if len(orgMemberships) > 0 {
-		authorOrgID = &orgMemberships[0].OrgID
-		fmt.Printf("[POST /api/posts] ✓ User organization ID: %s\n", *authorOrgID)
-	} else {
-		fmt.Printf("[POST /api/posts] ℹ️ User has no organization\n")
+		fmt.Printf("[getAuthorOrgID] ⚠️ Warning: Failed to query user organization: %v\n", err)
+		return nil
 	}
+	if len(orgMemberships) == 0 {
+		return nil
+	}
+	return &orgMemberships[0].OrgID
+}
 
-	// Prepare post data
+// buildPostInsertData maps a create request to a posts row
+func buildPostInsertData(userID string, authorOrgID *string, req models.CreatePostRequest) map[string]interface{} {
 	postData := map[string]interface{}{
-		"author_user_id":           userID,
-		"author_org_id":            authorOrgID,
-		"type":                     req.Type,
-		"title":                    req.Title,
-		"body":                     req.Body,
-		"price":                    req.Price,
-		"secret_visibility":        req.SecretVisibility,
-		"is_active":                true,
-		"eyecatch_url":             req.EyecatchURL,
-		"dashboard_url":            req.DashboardURL,
-		"user_ui_url":              req.UserUIURL,
-		"performance_url":          req.PerformanceURL,
-		"app_categories":           req.AppCategories,
-		"service_urls":             req.ServiceURLs,
-		"revenue_models":           req.RevenueModels,
-		"monthly_revenue":          req.MonthlyRevenue,
-		"monthly_cost":             req.MonthlyCost,
-		"appeal_text":              req.AppealText,
-		"tech_stack":               req.TechStack,
-		"user_count":               req.UserCount,
-		"release_date":             req.ReleaseDate,
-		"operation_form":           req.OperationForm,
-		"operation_effort":         req.OperationEffort,
-		"transfer_items":           req.TransferItems,
-		"desired_transfer_timing":  req.DesiredTransferTiming,
-		"growth_potential":         req.GrowthPotential,
-		"target_customers":         req.TargetCustomers,
-		"marketing_channels":       req.MarketingChannels,
-		"media_mentions":           req.MediaMentions,
-		"extra_image_urls":         req.ExtraImageURLs,
+		"author_user_id":          userID,
+		"author_org_id":           authorOrgID,
+		"type":                    req.Type,
+		"title":                   req.Title,
+		"body":                    req.Body,
+		"price":                   req.Price,
+		"secret_visibility":       req.SecretVisibility,
+		"is_active":               true,
+		"eyecatch_url":            req.EyecatchURL,
+		"dashboard_url":           req.DashboardURL,
+		"user_ui_url":             req.UserUIURL,
+		"performance_url":         req.PerformanceURL,
+		"app_categories":          req.AppCategories,
+		"service_urls":            req.ServiceURLs,
+		"revenue_models":          req.RevenueModels,
+		"monthly_revenue":         req.MonthlyRevenue,
+		"monthly_cost":            req.MonthlyCost,
+		"appeal_text":             req.AppealText,
+		"tech_stack":              req.TechStack,
+		"user_count":              req.UserCount,
+		"release_date":            req.ReleaseDate,
+		"operation_form":          req.OperationForm,
+		"operation_effort":        req.OperationEffort,
+		"transfer_items":          req.TransferItems,
+		"desired_transfer_timing": req.DesiredTransferTiming,
+		"growth_potential":        req.GrowthPotential,
+		"target_customers":        req.TargetCustomers,
+		"marketing_channels":      req.MarketingChannels,
+		"media_mentions":          req.MediaMentions,
+		"extra_image_urls":        req.ExtraImageURLs,
 	}
 
 	// Add subscribe field only if it's not nil
 	if req.Subscribe != nil {
 		postData["subscribe"] = req.Subscribe
 	}
-
-	// Insert post with access token (RLS will automatically check permissions)
-	fmt.Printf("[POST /api/posts] Inserting post into database...\n")
-	fmt.Printf("[POST /api/posts] Post data: %+v\n", postData)
-	var createdPosts []models.Post
-	_, err = authClient.From("posts").
-		Insert(postData, false, "", "", "").
-		ExecuteTo(&createdPosts)
-
-	if err != nil {
-		fmt.Printf("[POST /api/posts] ❌ ERROR: Failed to insert post: %v\n", err)
-		fmt.Printf("[POST /api/posts] Error type: %T\n", err)
-		fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-		http.Error(w, fmt.Sprintf("Failed to create post: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	fmt.Printf("[POST /api/posts] ✓ Post insert query executed\n")
-
-	if len(createdPosts) == 0 {
-		fmt.Printf("[POST /api/posts] ❌ ERROR: No post was created (empty result)\n")
-		fmt.Printf("========== CREATE POST END (FAILED) ==========\n\n")
-		http.Error(w, "Failed to create post", http.StatusInternalServerError)
-		return
-	}
-
-	postID := createdPosts[0].ID
-	fmt.Printf("[POST /api/posts] ✓ Post created successfully with ID: %s\n", postID)
-
-	response := models.PostWithDetails{
-		Post: createdPosts[0],
-	}
-
-	fmt.Printf("[POST /api/posts] ✅ CreatePost completed successfully\n")
-	fmt.Printf("========== CREATE POST END (SUCCESS) ==========\n\n")
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	return postData
 }
 
 // UpdatePost updates an existing post using Supabase
@@ -1046,6 +972,11 @@ func (s *Server) UpdatePost(w http.ResponseWriter, r *http.Request, postID strin
 	}
 	if req.MonthlyRevenue != nil {
 		postUpdateData["monthly_revenue"] = *req.MonthlyRevenue
+		// 申告売上が変わった場合は売上検証バッジを外す（再検証が必要）
+		postUpdateData["revenue_verified"] = false
+		postUpdateData["revenue_verified_from"] = nil
+		postUpdateData["revenue_verified_to"] = nil
+		postUpdateData["revenue_verified_at"] = nil
 	}
 	if req.MonthlyCost != nil {
 		postUpdateData["monthly_cost"] = *req.MonthlyCost
@@ -1303,6 +1234,7 @@ func (s *Server) TogglePostLike(w http.ResponseWriter, r *http.Request, postID s
 			http.Error(w, "Failed to like post", http.StatusInternalServerError)
 			return
 		}
+		s.notifyPostLike(userID, postID)
 	}
 	s.GetPostLikes(w, r, postID)
 }
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	// 未ログインの閲覧者を識別するためのCookie（閲覧数の重複排除専用）
+	viewerSessionCookie = "viewer_session"
+	// 同じ閲覧者による再表示をこの分数以内なら1回とみなす
+	postViewDedupMinutes = 30
+	maxAnalyticsDays     = 365
+	defaultAnalyticsDays = 30
+)
+
+// analyticsLocation is used to bucket events into days (matches get_post_analytics)
+var analyticsLocation = func() *time.Location {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		return time.FixedZone("JST", 9*60*60)
+	}
+	return loc
+}()
+
+// trackPostView records a detail-page view of a post.
+// Logged-in viewers are identified by user ID, anonymous viewers by a session cookie.
+// Must be called before the response body is written because it may set a cookie.
+func (s *Server) trackPostView(w http.ResponseWriter, r *http.Request, post models.Post, currentUserID string) {
+	// 投稿者自身の閲覧はカウントしない
+	if currentUserID != "" && currentUserID == post.AuthorUserID {
+		return
+	}
+
+	var viewerKey string
+	var viewerUserID interface{}
+	if currentUserID != "" {
+		viewerKey = "user:" + currentUserID
+		viewerUserID = currentUserID
+	} else {
+		sessionID := ""
+		if cookie, err := r.Cookie(viewerSessionCookie); err == nil && cookie.Value != "" {
+			sessionID = cookie.Value
+		} else {
+			sessionID = uuid.New().String()
+			http.SetCookie(w, &http.Cookie{
+				Name:     viewerSessionCookie,
+				Value:    sessionID,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   s.config.IsSecureCookie(),
+				SameSite: http.SameSiteLaxMode,
+				MaxAge:   60 * 60 * 24 * 365,
+			})
+		}
+		// セッションIDはそのまま保存せずハッシュ化する
+		sum := sha256.Sum256([]byte(sessionID))
+		viewerKey = "session:" + hex.EncodeToString(sum[:])
+	}
+
+	payload := map[string]interface{}{
+		"p_post_id":        post.ID,
+		"p_viewer_key":     viewerKey,
+		"p_viewer_user_id": viewerUserID,
+		"p_dedup_minutes":  postViewDedupMinutes,
+	}
+
+	// 閲覧記録はレスポンスを遅らせないよう非同期で行う
+	go func() {
+		var recorded bool
+		if err := s.supabase.CallRPC("record_post_view", payload, &recorded); err != nil {
+			log.Printf("[trackPostView] ⚠️ Failed to record view for post %s: %v", post.ID, err)
+		}
+	}()
+}
+
+// GetPostAnalytics returns daily analytics for a post (author only)
+// GET /api/posts/:id/analytics?from=YYYY-MM-DD&to=YYYY-MM-DD
+func (s *Server) GetPostAnalytics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 {
+		response.Error(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+	postID := parts[2]
+
+	// 期間を解析（デフォルト: 直近30日）
+	today := time.Now().In(analyticsLocation)
+	to := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -(defaultAnalyticsDays - 1))
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		parsed, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid to date (expected YYYY-MM-DD)")
+			return
+		}
+		to = parsed
+		from = to.AddDate(0, 0, -(defaultAnalyticsDays - 1))
+	}
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		parsed, err := time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid from date (expected YYYY-MM-DD)")
+			return
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		response.Error(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+	if to.Sub(from) > time.Duration(maxAnalyticsDays)*24*time.Hour {
+		response.Error(w, http.StatusBadRequest, "Period must be 365 days or less")
+		return
+	}
+
+	// 投稿者本人であることを確認（RLSの効くクライアントで取得）
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+	var posts []struct {
+		ID           string `json:"id"`
+		AuthorUserID string `json:"author_user_id"`
+	}
+	_, err := client.From("posts").
+		Select("id, author_user_id", "", false).
+		Eq("id", postID).
+		Limit(1, "").
+		ExecuteTo(&posts)
+	if err != nil {
+		log.Printf("[GetPostAnalytics] Failed to query post %s: %v", postID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query post")
+		return
+	}
+	if len(posts) == 0 {
+		response.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if posts[0].AuthorUserID != userID {
+		response.Error(w, http.StatusForbidden, "Only the author can view analytics")
+		return
+	}
+
+	rangePayload := map[string]interface{}{
+		"p_post_id": postID,
+		"p_from":    from.Format("2006-01-02"),
+		"p_to":      to.Format("2006-01-02"),
+	}
+
+	var series []models.PostAnalyticsDay
+	if err := s.supabase.CallRPC("get_post_analytics", rangePayload, &series); err != nil {
+		log.Printf("[GetPostAnalytics] Failed to get analytics for post %s: %v", postID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to get analytics")
+		return
+	}
+
+	analytics := models.PostAnalytics{
+		PostID: postID,
+		From:   from.Format("2006-01-02"),
+		To:     to.Format("2006-01-02"),
+		Series: series,
+	}
+	if analytics.Series == nil {
+		analytics.Series = []models.PostAnalyticsDay{}
+	}
+
+	for _, day := range series {
+		analytics.Totals.Views += day.Views
+		analytics.Totals.WatchAdds += day.WatchAdds
+		analytics.Totals.WatchRemoves += day.WatchRemoves
+		analytics.Totals.NewThreads += day.NewThreads
+		analytics.Totals.NDARequests += day.NDARequests
+		analytics.Totals.SaleRequests += day.SaleRequests
+	}
+	analytics.Totals.NetWatchers = analytics.Totals.WatchAdds - analytics.Totals.WatchRemoves
+
+	// 期間全体のユニーク閲覧者数（日別ユニーク数の合計ではない）
+	var uniqueViewers int64
+	if err := s.supabase.CallRPC("get_post_unique_viewers", rangePayload, &uniqueViewers); err != nil {
+		log.Printf("[GetPostAnalytics] ⚠️ Failed to get unique viewers: %v", err)
+	}
+	analytics.Totals.UniqueViewers = uniqueViewers
+
+	// ファネルの母数はユニーク閲覧者
+	t := analytics.Totals
+	analytics.Conversion = models.PostAnalyticsConversion{
+		ViewToWatch:   conversionRatio(t.WatchAdds, t.UniqueViewers),
+		ViewToInquiry: conversionRatio(t.NewThreads, t.UniqueViewers),
+		InquiryToNDA:  conversionRatio(t.NDARequests, t.NewThreads),
+		NDAToSale:     conversionRatio(t.SaleRequests, t.NDARequests),
+		ViewToSale:    conversionRatio(t.SaleRequests, t.UniqueViewers),
+	}
+
+	if counts, err := s.supabase.GetActiveViewCounts([]string{postID}); err == nil {
+		analytics.ActiveViewCount = counts[postID]
+	}
+
+	response.Success(w, http.StatusOK, analytics)
+}
+
+func conversionRatio(numerator, denominator int64) *float64 {
+	if denominator == 0 {
+		return nil
+	}
+	v := float64(numerator) / float64(denominator)
+	return &v
+}
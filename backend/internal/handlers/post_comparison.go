@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+// 一度に比較できる投稿数の上限
+const maxComparePosts = 5
+
+// comparisonMetric defines one row of the comparison matrix.
+// better: 1 = higher is better, -1 = lower is better, 0 = not ranked
+// fields lists the post fields (JSON names) the metric is derived from; the cell is masked if any is masked
+type comparisonMetric struct {
+	key    string
+	unit   string
+	better int
+	fields []string
+	value  func(post models.Post, now time.Time) (interface{}, bool)
+}
+
+var comparisonMetrics = []comparisonMetric{
+	{key: "price", unit: "JPY", fields: []string{"price"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		if p.Price == nil {
+			return nil, false
+		}
+		return *p.Price, true
+	}},
+	{key: "monthly_revenue", unit: "JPY", better: 1, fields: []string{"monthly_revenue"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		if p.MonthlyRevenue == nil {
+			return nil, false
+		}
+		return *p.MonthlyRevenue, true
+	}},
+	{key: "monthly_profit", unit: "JPY", better: 1, fields: []string{"monthly_profit", "monthly_revenue", "monthly_cost"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		profit, ok := comparisonMonthlyProfit(p)
+		return profit, ok
+	}},
+	{key: "profit_margin", unit: "ratio", better: 1, fields: []string{"monthly_profit", "monthly_revenue", "monthly_cost"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		profit, ok := comparisonMonthlyProfit(p)
+		if !ok || p.MonthlyRevenue == nil || *p.MonthlyRevenue <= 0 {
+			return nil, false
+		}
+		return roundTo(float64(profit)/float64(*p.MonthlyRevenue), 3), true
+	}},
+	{key: "revenue_multiple", unit: "x", better: -1, fields: []string{"price", "monthly_revenue"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		// 価格 ÷ 年間売上
+		if p.Price == nil || p.MonthlyRevenue == nil || *p.MonthlyRevenue <= 0 {
+			return nil, false
+		}
+		return roundTo(float64(*p.Price)/float64(*p.MonthlyRevenue*12), 2), true
+	}},
+	{key: "profit_multiple", unit: "x", better: -1, fields: []string{"price", "monthly_profit", "monthly_revenue", "monthly_cost"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		// 価格 ÷ 年間利益
+		profit, ok := comparisonMonthlyProfit(p)
+		if p.Price == nil || !ok || profit <= 0 {
+			return nil, false
+		}
+		return roundTo(float64(*p.Price)/float64(profit*12), 2), true
+	}},
+	{key: "user_count", better: 1, fields: []string{"user_count"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		if p.UserCount == nil {
+			return nil, false
+		}
+		return *p.UserCount, true
+	}},
+	{key: "release_age_months", unit: "months", fields: []string{"release_date"}, value: func(p models.Post, now time.Time) (interface{}, bool) {
+		if p.ReleaseDate == nil || p.ReleaseDate.IsZero() {
+			return nil, false
+		}
+		release := p.ReleaseDate.Time
+		months := (now.Year()-release.Year())*12 + int(now.Month()) - int(release.Month())
+		if now.Day() < release.Day() {
+			months--
+		}
+		if months < 0 {
+			months = 0
+		}
+		return months, true
+	}},
+	{key: "tech_stack", fields: []string{"tech_stack"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		if len(p.TechStack) == 0 {
+			return nil, false
+		}
+		return p.TechStack, true
+	}},
+	{key: "operation_effort", fields: []string{"operation_effort"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		if p.OperationEffort == nil || *p.OperationEffort == "" {
+			return nil, false
+		}
+		return *p.OperationEffort, true
+	}},
+	{key: "operation_hours_per_week", unit: "hours", better: -1, fields: []string{"operation_effort"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		if p.OperationEffort == nil {
+			return nil, false
+		}
+		hours, ok := services.ParseWeeklyHours(*p.OperationEffort)
+		if !ok {
+			return nil, false
+		}
+		return roundTo(hours, 1), true
+	}},
+	{key: "transfer_items", fields: []string{"transfer_items"}, value: func(p models.Post, _ time.Time) (interface{}, bool) {
+		if len(p.TransferItems) == 0 {
+			return nil, false
+		}
+		return p.TransferItems, true
+	}},
+}
+
+// ComparePosts returns a normalized side-by-side comparison of up to maxComparePosts posts
+// GET /api/posts/compare?ids=id1,id2,id3
+func (s *Server) ComparePosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ids := parseCompareIDs(r.URL.Query()["ids"])
+	if len(ids) < 2 {
+		response.Error(w, http.StatusBadRequest, "At least 2 post IDs are required")
+		return
+	}
+	if len(ids) > maxComparePosts {
+		response.Error(w, http.StatusBadRequest, "Too many post IDs (max 5)")
+		return
+	}
+
+	// 🔒 SECURITY: Use access token if authenticated, otherwise use Anon Client to enforce RLS
+	var client *supabase.Client
+	if accessToken, ok := r.Context().Value("access_token").(string); ok && accessToken != "" {
+		client = s.supabase.GetAuthenticatedClient(accessToken)
+	} else {
+		client = s.supabase.GetAnonClient()
+	}
+
+	var postsData []models.Post
+	_, err := client.From("posts").
+		Select("*", "", false).
+		In("id", ids).
+		Eq("is_active", "true").
+		ExecuteTo(&postsData)
+	if err != nil {
+		log.Printf("[ComparePosts] Failed to query posts: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query posts")
+		return
+	}
+
+	postsByID := make(map[string]models.Post, len(postsData))
+	for _, p := range postsData {
+		postsByID[p.ID] = p
+	}
+
+	// 🔒 SECURITY: 秘匿投稿は閲覧者との関係に応じてマスク（GetPostと同じポリシー）
+	viewer := s.newPostViewer(r, client)
+	viewer.prefetch(postsData)
+	result := models.PostComparison{}
+	ordered := make([]models.Post, 0, len(ids))
+	maskedFields := make(map[string]map[string]bool)
+	for _, id := range ids {
+		post, ok := postsByID[id]
+		var relation services.ViewerRelation
+		if ok {
+			relation = viewer.relation(post)
+			ok = services.PostListable(post, relation)
+		}
+		if !ok {
+			result.NotFound = append(result.NotFound, id)
+			continue
+		}
+
+		masked := services.ApplyPostVisibility(&post, relation)
+		maskedFields[post.ID] = make(map[string]bool, len(masked))
+		for _, name := range masked {
+			maskedFields[post.ID][name] = true
+		}
+
+		result.Posts = append(result.Posts, models.ComparisonPost{
+			ID:          post.ID,
+			Type:        post.Type,
+			Title:       post.Title,
+			EyecatchURL: post.EyecatchURL,
+			Masked:      len(masked) > 0,
+		})
+		ordered = append(ordered, post)
+	}
+
+	now := time.Now()
+	for _, metric := range comparisonMetrics {
+		row := models.ComparisonRow{Key: metric.key, Unit: metric.unit}
+		for _, post := range ordered {
+			cell := models.ComparisonValue{PostID: post.ID}
+			if metricMasked(metric, maskedFields[post.ID]) {
+				cell.Masked = true
+			} else if v, ok := metric.value(post, now); ok {
+				cell.Value = v
+			}
+			row.Values = append(row.Values, cell)
+		}
+		markBestValues(&row, metric.better)
+		result.Rows = append(result.Rows, row)
+	}
+
+	log.Printf("[ComparePosts] ✓ Compared %d posts (%d not found)", len(ordered), len(result.NotFound))
+	response.Success(w, http.StatusOK, result)
+}
+
+// metricMasked reports whether any source field of the metric is masked for the post
+func metricMasked(metric comparisonMetric, masked map[string]bool) bool {
+	for _, field := range metric.fields {
+		if masked[field] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCompareIDs accepts both ?ids=a,b and ?ids=a&ids=b, removing duplicates while keeping order
+func parseCompareIDs(values []string) []string {
+	seen := make(map[string]bool)
+	ids := make([]string, 0)
+	for _, v := range values {
+		for _, id := range strings.Split(v, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// markBestValues flags the best numeric value in a row (only when at least two posts have a value)
+func markBestValues(row *models.ComparisonRow, better int) {
+	if better == 0 {
+		return
+	}
+
+	bestIdx := -1
+	var best float64
+	count := 0
+	for i, cell := range row.Values {
+		v, ok := toFloat(cell.Value)
+		if !ok || cell.Masked {
+			continue
+		}
+		count++
+		if bestIdx == -1 || (better > 0 && v > best) || (better < 0 && v < best) {
+			bestIdx, best = i, v
+		}
+	}
+	if count < 2 {
+		return
+	}
+	for i, cell := range row.Values {
+		if v, ok := toFloat(cell.Value); ok && !cell.Masked && v == best {
+			row.Values[i].Best = true
+		}
+	}
+}
+
+func comparisonMonthlyProfit(p models.Post) (int64, bool) {
+	if p.MonthlyProfit != nil {
+		return *p.MonthlyProfit, true
+	}
+	if p.MonthlyRevenue != nil && p.MonthlyCost != nil {
+		return *p.MonthlyRevenue - *p.MonthlyCost, true
+	}
+	return 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func roundTo(v float64, digits int) float64 {
+	p := math.Pow(10, float64(digits))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	// 一度にインポートできる行数の上限
+	maxPostImportRows = 200
+	maxPostImportSize = 5 << 20 // 5MB
+)
+
+// ImportPosts creates listings in bulk from CSV or JSON lines
+// POST /api/posts/import?format=csv|jsonl&dry_run=true
+// Body: multipart "file" or raw CSV / JSON lines
+func (s *Server) ImportPosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	data, filename, err := readPostImportBody(w, r)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := detectPostImportFormat(r, filename)
+	if format == "" {
+		response.Error(w, http.StatusBadRequest, "Unsupported format (use csv or jsonl)")
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	rows, err := services.ParsePostImport(format, data)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse import file: %v", err))
+		return
+	}
+	if len(rows) == 0 {
+		response.Error(w, http.StatusBadRequest, "Import file has no rows")
+		return
+	}
+	if len(rows) > maxPostImportRows {
+		response.Error(w, http.StatusBadRequest, fmt.Sprintf("Too many rows (max %d)", maxPostImportRows))
+		return
+	}
+
+	log.Printf("[ImportPosts] User %s importing %d rows (format=%s, dry_run=%v)", userID, len(rows), format, dryRun)
+
+	authClient := s.supabase.GetAuthenticatedClient(accessToken)
+	var authorOrgID *string
+	if !dryRun {
+		authorOrgID = s.getAuthorOrgID(authClient, userID)
+	}
+
+	report := models.PostImportReport{
+		DryRun: dryRun,
+		Format: format,
+		Total:  len(rows),
+		Rows:   make([]models.PostImportRowResult, 0, len(rows)),
+	}
+
+	for _, row := range rows {
+		result := models.PostImportRowResult{Row: row.Line}
+		if row.Err != nil {
+			result.Status = models.PostImportRowInvalid
+			result.Errors = []string{row.Err.Error()}
+			report.Invalid++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+
+		req := *row.Request
+		result.Title = req.Title
+
+		// CreatePost と同じ検証・サニタイズを行う
+		if errs := validatePostImportRow(&req); len(errs) > 0 {
+			result.Status = models.PostImportRowInvalid
+			result.Errors = errs
+			report.Invalid++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+		result.Title = req.Title
+
+		if dryRun {
+			result.Status = models.PostImportRowValid
+			report.Valid++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+
+		var createdPosts []models.Post
+		_, err := authClient.From("posts").
+			Insert(buildPostInsertData(userID, authorOrgID, req), false, "", "", "").
+			ExecuteTo(&createdPosts)
+		if err != nil || len(createdPosts) == 0 {
+			log.Printf("[ImportPosts] ❌ Failed to insert row %d: %v", row.Line, err)
+			result.Status = models.PostImportRowFailed
+			result.Errors = []string{"Failed to create post"}
+			report.Failed++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+
+		result.Status = models.PostImportRowCreated
+		result.PostID = createdPosts[0].ID
+		report.Valid++
+		report.Created++
+		report.Rows = append(report.Rows, result)
+	}
+
+	log.Printf("[ImportPosts] ✓ Done: valid=%d created=%d invalid=%d failed=%d", report.Valid, report.Created, report.Invalid, report.Failed)
+	response.Success(w, http.StatusOK, report)
+}
+
+// validatePostImportRow applies validateCreatePostRequest, sanitization and the transaction checks used by CreatePost
+func validatePostImportRow(req *models.CreatePostRequest) []string {
+	if err := utils.ValidateStruct(*req); err != nil {
+		return []string{err.Error()}
+	}
+	if err := sanitizeCreatePostRequest(req); err != nil {
+		return []string{err.Error()}
+	}
+	if err := checkTransactionPostRequirements(*req); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// readPostImportBody reads either a multipart "file" field or the raw request body
+func readPostImportBody(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPostImportSize+(1<<20))
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxPostImportSize); err != nil {
+			return nil, "", fmt.Errorf("Failed to parse form data")
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", fmt.Errorf("file is required")
+		}
+		defer file.Close()
+		if header.Size > maxPostImportSize {
+			return nil, "", fmt.Errorf("File too large (max 5MB)")
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, "", fmt.Errorf("Failed to read file")
+		}
+		return data, header.Filename, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to read request body")
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, "", fmt.Errorf("Request body is empty")
+	}
+	return data, "", nil
+}
+
+// detectPostImportFormat uses ?format=, then the file extension, then the Content-Type
+func detectPostImportFormat(r *http.Request, filename string) string {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "csv":
+		return services.PostImportFormatCSV
+	case "jsonl", "ndjson", "json":
+		return services.PostImportFormatJSONL
+	case "":
+	default:
+		return ""
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return services.PostImportFormatCSV
+	case ".jsonl", ".ndjson", ".json":
+		return services.PostImportFormatJSONL
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return services.PostImportFormatCSV
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		return services.PostImportFormatJSONL
+	}
+	return ""
+}
+
+// ExportPosts exports the current user's own listings in the import format
+// GET /api/posts/export?format=csv|jsonl
+func (s *Server) ExportPosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	format := services.PostImportFormatCSV
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "", "csv":
+	case "jsonl", "ndjson", "json":
+		format = services.PostImportFormatJSONL
+	default:
+		response.Error(w, http.StatusBadRequest, "Unsupported format (use csv or jsonl)")
+		return
+	}
+
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+	var posts []models.Post
+	_, err := client.From("posts").
+		Select("*", "", false).
+		Eq("author_user_id", userID).
+		Order("created_at", nil).
+		ExecuteTo(&posts)
+	if err != nil {
+		log.Printf("[ExportPosts] Failed to query posts for user %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query posts")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.EncodePostExport(format, posts, &buf); err != nil {
+		log.Printf("[ExportPosts] Failed to encode export: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to export posts")
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == services.PostImportFormatJSONL {
+		contentType = "application/x-ndjson; charset=utf-8"
+	}
+	filename := fmt.Sprintf("posts-%s.%s", time.Now().Format("20060102"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+
+	log.Printf("[ExportPosts] ✓ Exported %d posts for user %s (%s)", len(posts), userID, format)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+)
+
+// postViewer resolves the relationship between the current viewer and posts for one request.
+// NDA results are resolved in batches and cached by the ndaResolver.
+type postViewer struct {
+	client   *supabase.Client
+	userID   string
+	operator bool
+	nda      *ndaResolver
+}
+
+// newPostViewer creates a viewer from the request context (user_id is optional)
+func (s *Server) newPostViewer(r *http.Request, client *supabase.Client) *postViewer {
+	v := &postViewer{client: client}
+	if userID, ok := r.Context().Value("user_id").(string); ok {
+		v.userID = userID
+	}
+	v.nda = newNDAResolver(client, v.userID)
+	if v.userID != "" {
+		v.operator = s.isOperator(client, v.userID)
+	}
+	return v
+}
+
+// prefetch resolves the NDA status of all secret posts of a list in one batch
+func (v *postViewer) prefetch(posts []models.Post) {
+	if v.userID == "" || v.operator {
+		return
+	}
+	sellers := make([]ndaSeller, 0)
+	for _, post := range posts {
+		if post.Type == models.PostTypeSecret && post.AuthorUserID != v.userID {
+			sellers = append(sellers, sellerOf(post.AuthorUserID, post.AuthorOrgID))
+		}
+	}
+	if len(sellers) == 0 {
+		return
+	}
+	if err := v.nda.Resolve(sellers); err != nil {
+		log.Printf("[postViewer] ⚠️ Failed to resolve NDAs for %d sellers: %v", len(sellers), err)
+	}
+}
+
+// relation returns the viewer's relationship to a post.
+// Non-secret posts never need an NDA lookup.
+func (v *postViewer) relation(post models.Post) services.ViewerRelation {
+	switch {
+	case v.userID == "":
+		return services.ViewerAnonymous
+	case v.operator:
+		return services.ViewerOperator
+	case post.AuthorUserID == v.userID:
+		return services.ViewerOwner
+	case post.Type != models.PostTypeSecret:
+		return services.ViewerMember
+	}
+
+	hasNDA, err := v.nda.Covers(post.AuthorUserID, post.AuthorOrgID, post.ID)
+	if err != nil {
+		log.Printf("[postViewer] ⚠️ Failed to check NDA for post %s: %v", post.ID, err)
+	}
+	if hasNDA {
+		return services.ViewerNDA
+	}
+	return services.ViewerMember
+}
+
+// isOperator reports whether the user is a platform operator (operators table)
+func (s *Server) isOperator(client *supabase.Client, userID string) bool {
+	var rows []struct {
+		UserID string `json:"user_id"`
+	}
+	_, err := client.From("operators").
+		Select("user_id", "", false).
+		Eq("user_id", userID).
+		Limit(1, "").
+		ExecuteTo(&rows)
+	if err != nil {
+		log.Printf("[isOperator] ⚠️ Failed to query operators for %s: %v", userID, err)
+		return false
+	}
+	return len(rows) > 0
+}
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	messageImagesBucket = "message-images"
+	// スレッドの一覧で返すURLの有効期限（従来の署名付きURLと同じ1時間）。URLは閲覧者に紐づき、開いた人の透かしが入る
+	protectedFileListTTL = time.Hour
+	// アクセスログのIDに付ける接頭辞（透かしのトレースIDから参照先のテーブルを判別する）
+	dataRoomTracePrefix   = "dr-"
+	fileAccessTracePrefix = "fa-"
+)
+
+// inlineProtectedFileTypes are the content types that may be displayed in the browser.
+// 🔒 SECURITY: それ以外（HTML・SVG など）はAPIのオリジンで実行されないよう、常にダウンロードとして返す
+var inlineProtectedFileTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+}
+
+var (
+	errProtectedFileNotFound  = errors.New("protected file not found")
+	errProtectedFileForbidden = errors.New("not allowed to open the protected file")
+	errDownloadNotAllowed     = errors.New("download not allowed")
+)
+
+// protectedFile is a file resolved from a download token after the viewer's access was checked
+type protectedFile struct {
+	bucket      string
+	path        string
+	fileName    string
+	contentType string // 空の場合は中身から判定する
+	footerOnly  bool   // メッセージ画像は下端の帯のみ（全面の透かしは入れない）
+	// record writes the access log and returns the trace ID embedded in the watermark
+	record func(r *http.Request, userID string, action models.FileAccessAction) (string, error)
+}
+
+// protectedFileURL issues a proxy URL bound to the viewer
+func (s *Server) protectedFileURL(userID string, resource models.ProtectedFileResource, resourceID string, action models.FileAccessAction, ttl time.Duration) (models.ProtectedFileURL, error) {
+	token, expiresAt, err := services.SignDownloadToken(s.config.SupabaseJWTSecret, userID, string(resource), resourceID, string(action), ttl)
+	if err != nil {
+		return models.ProtectedFileURL{}, err
+	}
+	return models.ProtectedFileURL{
+		Resource:   resource,
+		ResourceID: resourceID,
+		Action:     action,
+		URL:        fmt.Sprintf("%s/api/files/content?token=%s", strings.TrimRight(s.config.BackendURL, "/"), url.QueryEscape(token)),
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// protectedFileURLString returns the proxy URL for embedding in list responses ("" on failure)
+func (s *Server) protectedFileURLString(handler string, userID string, resource models.ProtectedFileResource, resourceID string) string {
+	fileURL, err := s.protectedFileURL(userID, resource, resourceID, models.FileAccessView, protectedFileListTTL)
+	if err != nil {
+		log.Printf("[%s] Failed to create file URL for %s %s: %v", handler, resource, resourceID, err)
+		return ""
+	}
+	return fileURL.URL
+}
+
+// ServeProtectedFile streams a contract document, message attachment or data room file stamped with a visible
+// and an invisible watermark of the viewer. Authentication is the token issued by protectedFileURL
+// (usable from <iframe>/<img>); access is checked again because it may have been revoked since.
+// GET /api/files/content?token=
+func (s *Server) ServeProtectedFile(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodGet) {
+		return
+	}
+
+	claims, err := services.VerifyDownloadToken(s.config.SupabaseJWTSecret, r.URL.Query().Get("token"))
+	if err != nil {
+		response.Error(w, http.StatusUnauthorized, "Invalid or expired link")
+		return
+	}
+	userID := claims.Subject
+	action := models.FileAccessAction(claims.Action)
+
+	var file *protectedFile
+	switch models.ProtectedFileResource(claims.Resource) {
+	case models.ProtectedFileDataRoom:
+		file, err = s.resolveDataRoomFile(userID, claims.ResourceID, action)
+	case models.ProtectedFileContractDocument:
+		file, err = s.resolveContractDocumentFile(userID, claims.ResourceID)
+	case models.ProtectedFileMessageAttachment:
+		file, err = s.resolveMessageAttachmentFile(userID, claims.ResourceID)
+	default:
+		err = errProtectedFileNotFound
+	}
+	if s.handleProtectedFileError(w, "ServeProtectedFile", err) {
+		return
+	}
+
+	data, err := s.supabase.DownloadFile(file.bucket, file.path)
+	if err != nil {
+		log.Printf("[ServeProtectedFile] Failed to download %s/%s: %v", file.bucket, file.path, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to load file")
+		return
+	}
+	contentType := file.contentType
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+		if contentType == "application/octet-stream" {
+			if byExt := mime.TypeByExtension(filepath.Ext(file.fileName)); byExt != "" {
+				contentType = byExt
+			}
+		}
+	}
+	contentType = strings.Split(contentType, ";")[0]
+
+	// 🔒 SECURITY: 記録できない閲覧は配信しない。ログのIDを透かしに入れて流出元を特定できるようにする
+	traceID, err := file.record(r, userID, action)
+	if err != nil {
+		log.Printf("[ServeProtectedFile] ❌ Failed to record access to %s %s: %v", claims.Resource, claims.ResourceID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to record access")
+		return
+	}
+
+	fileName := file.fileName
+	if services.WatermarkSupported(contentType) {
+		viewerName := s.fetchDisplayNames(s.supabase.GetServiceClient(), userID)[userID]
+		stamped, stampedType, err := services.ApplyWatermark(s.config.SupabaseJWTSecret, contentType, data, services.Watermark{
+			ViewerName: viewerName,
+			UserID:     userID,
+			Timestamp:  time.Now(),
+			TraceID:    traceID,
+			FooterOnly: file.footerOnly,
+		})
+		if err != nil {
+			// 🔒 SECURITY: 透かしを入れられない場合は原本を返さない
+			log.Printf("[ServeProtectedFile] ❌ Failed to watermark %s %s: %v", claims.Resource, claims.ResourceID, err)
+			response.Error(w, http.StatusInternalServerError, "Failed to prepare file")
+			return
+		}
+		if stampedType != contentType {
+			fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".png"
+		}
+		data, contentType = stamped, stampedType
+	}
+
+	disposition := "inline"
+	if action == models.FileAccessDownload {
+		disposition = "attachment"
+	}
+	if !inlineProtectedFileTypes[contentType] {
+		contentType = "application/octet-stream"
+		disposition = "attachment"
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", disposition+"; filename*=UTF-8''"+url.PathEscape(fileName))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+
+	log.Printf("[ServeProtectedFile] ✓ Served %s %s (%s) to %s (trace %s)", claims.Resource, claims.ResourceID, action, userID, traceID)
+}
+
+// handleProtectedFileError writes the response for an error from a protected file resolver.
+// Returns true if an error was handled.
+func (s *Server) handleProtectedFileError(w http.ResponseWriter, handler string, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errProtectedFileNotFound):
+		response.Error(w, http.StatusNotFound, "File not found")
+	case errors.Is(err, errProtectedFileForbidden):
+		response.Error(w, http.StatusForbidden, "You do not have access to this file")
+	case errors.Is(err, errDownloadNotAllowed):
+		response.Error(w, http.StatusForbidden, "Downloading is not allowed for this file")
+	default:
+		return s.handleDataRoomAccessError(w, handler, err)
+	}
+	return true
+}
+
+// resolveContractDocumentFile checks that the user participates in the thread of the contract document
+func (s *Server) resolveContractDocumentFile(userID string, documentID string) (*protectedFile, error) {
+	serviceClient := s.supabase.GetServiceClient()
+	var docs []struct {
+		ID          string  `json:"id"`
+		ThreadID    string  `json:"thread_id"`
+		FilePath    string  `json:"file_path"`
+		FileName    string  `json:"file_name"`
+		ContentType *string `json:"content_type"`
+	}
+	_, err := serviceClient.From("thread_contract_documents").
+		Select("id, thread_id, file_path, file_name, content_type", "", false).
+		Eq("id", documentID).
+		ExecuteTo(&docs)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, errProtectedFileNotFound
+	}
+	doc := docs[0]
+
+	participantIDs, err := s.threadParticipantIDs(serviceClient, doc.ThreadID)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(participantIDs, userID) {
+		return nil, errProtectedFileForbidden
+	}
+
+	return &protectedFile{
+		bucket:      contractDocumentsBucket,
+		path:        doc.FilePath,
+		fileName:    doc.FileName,
+		contentType: ndaStringValue(doc.ContentType),
+		record: func(r *http.Request, userID string, action models.FileAccessAction) (string, error) {
+			return s.recordFileAccess(r, models.ProtectedFileContractDocument, doc.ID, doc.ThreadID, userID, action)
+		},
+	}, nil
+}
+
+// resolveMessageAttachmentFile checks that the user participates in the thread of the message
+func (s *Server) resolveMessageAttachmentFile(userID string, messageID string) (*protectedFile, error) {
+	serviceClient := s.supabase.GetServiceClient()
+	var messages []struct {
+		ID           string  `json:"id"`
+		ThreadID     string  `json:"thread_id"`
+		SenderUserID string  `json:"sender_user_id"`
+		Type         string  `json:"type"`
+		DeletedAt    *string `json:"deleted_at"`
+	}
+	_, err := serviceClient.From("messages").
+		Select("id, thread_id, sender_user_id, type, deleted_at", "", false).
+		Eq("id", messageID).
+		ExecuteTo(&messages)
+	if err != nil {
+		return nil, err
+	}
+	// 削除済みメッセージの添付は配信しない（原本は運営の履歴確認用に残る）
+	if len(messages) == 0 || messages[0].DeletedAt != nil {
+		return nil, errProtectedFileNotFound
+	}
+	message := messages[0]
+
+	var attachments []struct {
+		FileURL string `json:"file_url"`
+	}
+	_, err = serviceClient.From("message_attachments").
+		Select("file_url", "", false).
+		Eq("message_id", messageID).
+		Limit(1, "").
+		ExecuteTo(&attachments)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 || isExternalURL(attachments[0].FileURL) {
+		return nil, errProtectedFileNotFound
+	}
+	// 🔒 SECURITY: 送信者のフォルダ外のパス（直接登録された行など）は配信しない
+	if !isOwnStoragePath(message.SenderUserID, attachments[0].FileURL) {
+		log.Printf("[resolveMessageAttachmentFile] ❌ Attachment of message %s is outside the sender's folder: %s", message.ID, attachments[0].FileURL)
+		return nil, errProtectedFileNotFound
+	}
+
+	participantIDs, err := s.threadParticipantIDs(serviceClient, message.ThreadID)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(participantIDs, userID) {
+		return nil, errProtectedFileForbidden
+	}
+
+	bucket := messageAttachmentBucket(models.MessageType(message.Type))
+	return &protectedFile{
+		bucket:     bucket,
+		path:       attachments[0].FileURL,
+		fileName:   path.Base(attachments[0].FileURL),
+		footerOnly: bucket == messageImagesBucket,
+		record: func(r *http.Request, userID string, action models.FileAccessAction) (string, error) {
+			return s.recordFileAccess(r, models.ProtectedFileMessageAttachment, message.ID, message.ThreadID, userID, action)
+		},
+	}, nil
+}
+
+// messageAttachmentURL returns the proxy URL of a message attachment.
+// 外部URLはこれまで通りそのまま返す
+func (s *Server) messageAttachmentURL(handler string, userID string, messageID string, filePath string) string {
+	if isExternalURL(filePath) {
+		return filePath
+	}
+	return s.protectedFileURLString(handler, userID, models.ProtectedFileMessageAttachment, messageID)
+}
+
+// messageAttachmentBucket returns the bucket of the attachment:
+// 契約書・NDAはcontract-documents、それ以外（画像）はmessage-images
+func messageAttachmentBucket(messageType models.MessageType) string {
+	if messageType == models.MessageTypeContract || messageType == models.MessageTypeNDA {
+		return contractDocumentsBucket
+	}
+	return messageImagesBucket
+}
+
+// isOwnStoragePath reports whether a storage path is inside the user's folder ({userID}/...)
+// アップロード時のパスは userID/uuid.ext のため、".." などで他のフォルダを指すパスは受け付けない
+func isOwnStoragePath(userID string, filePath string) bool {
+	return userID != "" && strings.HasPrefix(filePath, userID+"/") && path.Clean(filePath) == filePath &&
+		!strings.Contains(filePath, "..")
+}
+
+func isExternalURL(filePath string) bool {
+	return strings.HasPrefix(filePath, "http://") || strings.HasPrefix(filePath, "https://")
+}
+
+// recordFileAccess inserts a file_access_logs row and returns the trace ID
+func (s *Server) recordFileAccess(r *http.Request, resource models.ProtectedFileResource, resourceID string, threadID string, userID string, action models.FileAccessAction) (string, error) {
+	row := map[string]interface{}{
+		"resource_type": resource,
+		"resource_id":   resourceID,
+		"user_id":       userID,
+		"action":        action,
+		"ip_address":    utils.ClientIP(r),
+	}
+	if threadID != "" {
+		row["thread_id"] = threadID
+	}
+	if ua := r.UserAgent(); ua != "" {
+		row["user_agent"] = ua
+	}
+
+	var inserted []models.FileAccessLog
+	_, err := s.supabase.GetServiceClient().From("file_access_logs").
+		Insert(row, false, "", "", "").
+		ExecuteTo(&inserted)
+	if err != nil {
+		return "", err
+	}
+	if len(inserted) == 0 {
+		return "", fmt.Errorf("access log was not returned")
+	}
+	return fileAccessTracePrefix + strconv.FormatInt(inserted[0].ID, 10), nil
+}
+
+// InspectWatermark reads the invisible watermarks of a leaked file and resolves them to the access log (operators only)
+// POST /api/watermarks/inspect (multipart/form-data: file)
+func (s *Server) InspectWatermark(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+	if !s.isOperator(s.supabase.GetAuthenticatedClient(accessToken), userID) {
+		log.Printf("[InspectWatermark] ❌ User %s is not an operator", userID)
+		response.Error(w, http.StatusForbidden, "Only operators can inspect watermarks")
+		return
+	}
+
+	if err := r.ParseMultipartForm(50 << 20); err != nil { // 50MB max
+		log.Printf("[InspectWatermark] Failed to parse form: %v", err)
+		response.Error(w, http.StatusBadRequest, "Failed to parse form data")
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "No file provided")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		log.Printf("[InspectWatermark] Failed to read file: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to read file")
+		return
+	}
+
+	contentType := strings.Split(http.DetectContentType(data), ";")[0]
+	marks, err := services.ExtractWatermarks(s.config.SupabaseJWTSecret, contentType, data)
+	if errors.Is(err, services.ErrWatermarkUnsupported) {
+		response.Error(w, http.StatusBadRequest, "Only PDF, PNG, JPEG and GIF files can be inspected")
+		return
+	}
+	if err != nil {
+		log.Printf("[InspectWatermark] Failed to extract watermarks: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to inspect file")
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	result := models.WatermarkInspection{
+		ContentType: contentType,
+		SHA256:      hex.EncodeToString(sum[:]),
+		Marks:       make([]models.WatermarkTrace, 0, len(marks)),
+	}
+	userIDs := make([]string, 0, len(marks))
+	for _, mark := range marks {
+		trace := models.WatermarkTrace{
+			UserID:    mark.UserID,
+			Timestamp: mark.Timestamp,
+			TraceID:   mark.TraceID,
+			Verified:  mark.Verified,
+		}
+		// 改ざんされた透かしのトレースIDは信用しない
+		if mark.Verified {
+			s.resolveWatermarkTrace(&trace)
+		}
+		result.Marks = append(result.Marks, trace)
+		userIDs = append(userIDs, mark.UserID)
+	}
+	names := s.fetchDisplayNames(s.supabase.GetServiceClient(), userIDs...)
+	for i := range result.Marks {
+		result.Marks[i].UserDisplayName = names[result.Marks[i].UserID]
+	}
+
+	log.Printf("[InspectWatermark] ✓ Found %d watermark(s) in %s (%s)", len(marks), result.SHA256, contentType)
+	response.Success(w, http.StatusOK, result)
+}
+
+// resolveWatermarkTrace fills the access the trace ID of a watermark points to
+func (s *Server) resolveWatermarkTrace(trace *models.WatermarkTrace) {
+	serviceClient := s.supabase.GetServiceClient()
+	switch {
+	case strings.HasPrefix(trace.TraceID, dataRoomTracePrefix):
+		var logs []models.DataRoomAccessLog
+		_, err := serviceClient.From("data_room_access_logs").
+			Select("*", "", false).
+			Eq("id", strings.TrimPrefix(trace.TraceID, dataRoomTracePrefix)).
+			ExecuteTo(&logs)
+		if err != nil || len(logs) == 0 {
+			log.Printf("[resolveWatermarkTrace] ⚠️ Access log %s not found: %v", trace.TraceID, err)
+			return
+		}
+		trace.Resource = models.ProtectedFileDataRoom
+		trace.ResourceID = logs[0].FileID
+		trace.Action = logs[0].Action
+		trace.IPAddress = logs[0].IPAddress
+		trace.AccessedAt = &logs[0].CreatedAt
+
+		var files []models.DataRoomFile
+		_, err = serviceClient.From("data_room_files").
+			Select("id, file_name", "", false).
+			Eq("id", logs[0].FileID).
+			ExecuteTo(&files)
+		if err == nil && len(files) > 0 {
+			trace.FileName = files[0].FileName
+		}
+	case strings.HasPrefix(trace.TraceID, fileAccessTracePrefix):
+		var logs []models.FileAccessLog
+		_, err := serviceClient.From("file_access_logs").
+			Select("*", "", false).
+			Eq("id", strings.TrimPrefix(trace.TraceID, fileAccessTracePrefix)).
+			ExecuteTo(&logs)
+		if err != nil || len(logs) == 0 {
+			log.Printf("[resolveWatermarkTrace] ⚠️ Access log %s not found: %v", trace.TraceID, err)
+			return
+		}
+		trace.Resource = logs[0].ResourceType
+		trace.ResourceID = logs[0].ResourceID
+		trace.Action = logs[0].Action
+		trace.IPAddress = logs[0].IPAddress
+		trace.AccessedAt = &logs[0].CreatedAt
+
+		if logs[0].ResourceType == models.ProtectedFileContractDocument {
+			var docs []struct {
+				FileName string `json:"file_name"`
+			}
+			_, err = serviceClient.From("thread_contract_documents").
+				Select("file_name", "", false).
+				Eq("id", logs[0].ResourceID).
+				ExecuteTo(&docs)
+			if err == nil && len(docs) > 0 {
+				trace.FileName = docs[0].FileName
+			}
+		}
+	}
+}
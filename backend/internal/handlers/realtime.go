@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	maxRealtimeStreamsPerUser = 5
+	// プロキシ・ロードバランサのアイドルタイムアウトで切断されないよう定期的にコメント行を送る
+	realtimeHeartbeatInterval = 25 * time.Second
+	realtimeRetryMillis       = 3000
+	// 入力中表示の有効期間（クライアントは入力中にこれより短い間隔で送り直す）
+	realtimeTypingTTL = 6 * time.Second
+)
+
+// StreamRealtimeEvents pushes the events of the threads the user participates in as Server-Sent Events
+// (new messages, typing, read receipts, contract uploads and sale request status changes).
+// Authentication is the same cookie / Bearer token as the rest of the API; the stream is closed when
+// the token expires and the client reconnects with the refreshed cookie. Events missed while
+// disconnected are not replayed; clients refetch the thread after reconnecting.
+// GET /api/realtime/stream
+func (s *Server) StreamRealtimeEvents(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodGet) {
+		return
+	}
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	sub, err := s.realtime.Subscribe(userID)
+	if errors.Is(err, services.ErrRealtimeTooManyStreams) {
+		log.Printf("[StreamRealtimeEvents] ⚠️ Too many streams for user %s", userID)
+		response.Error(w, http.StatusTooManyRequests, "Too many open realtime connections")
+		return
+	}
+	if err != nil {
+		log.Printf("[StreamRealtimeEvents] Failed to subscribe user %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to open realtime stream")
+		return
+	}
+	defer s.realtime.Unsubscribe(sub)
+
+	// 認証済みトークンの有効期限（署名はミドルウェアで検証済み）
+	expiresAt := time.Now().Add(time.Hour)
+	if claims, _, err := jwt.NewParser().ParseUnverified(accessToken, &jwt.RegisteredClaims{}); err == nil {
+		if exp, err := claims.Claims.GetExpirationTime(); err == nil && exp != nil {
+			expiresAt = exp.Time
+		}
+	}
+	expiry := time.NewTimer(time.Until(expiresAt))
+	defer expiry.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Nginxのバッファリングを無効化
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", realtimeRetryMillis)
+	ready, err := services.NewRealtimeEvent(models.RealtimeEventReady, "", models.RealtimeReady{UserID: userID, ExpiresAt: expiresAt})
+	if err != nil || writeRealtimeEvent(w, ready) != nil || rc.Flush() != nil {
+		log.Printf("[StreamRealtimeEvents] ❌ Streaming is not supported for user %s: %v", userID, err)
+		return
+	}
+	log.Printf("[StreamRealtimeEvents] ✓ Stream opened for user %s", userID)
+
+	heartbeat := time.NewTicker(realtimeHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("[StreamRealtimeEvents] Stream closed by client (user %s)", userID)
+			return
+		case <-sub.Done():
+			log.Printf("[StreamRealtimeEvents] ⚠️ Stream dropped by hub (user %s)", userID)
+			return
+		case <-expiry.C:
+			log.Printf("[StreamRealtimeEvents] Token expired, closing stream (user %s)", userID)
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		case event := <-sub.Events():
+			if writeRealtimeEvent(w, event) != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeRealtimeEvent writes one event in the text/event-stream format
+func writeRealtimeEvent(w http.ResponseWriter, event services.RealtimeEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, payload)
+	return err
+}
+
+// SetTypingStatus broadcasts that the user is (or stopped) typing in a thread. Nothing is stored.
+// POST /api/threads/:id/typing
+func (s *Server) SetTypingStatus(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodPost) {
+		return
+	}
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	threadID := strings.TrimPrefix(r.URL.Path, "/api/threads/")
+	threadID = strings.Trim(strings.TrimSuffix(threadID, "/typing"), "/")
+	if threadID == "" {
+		response.Error(w, http.StatusBadRequest, "Thread ID required")
+		return
+	}
+
+	var req models.TypingRequest
+	if !utils.DecodeJSONBody(r, w, &req) {
+		return
+	}
+
+	participantIDs, err := s.threadParticipantIDs(s.supabase.GetServiceClient(), threadID)
+	if err != nil {
+		log.Printf("[SetTypingStatus] Failed to query participants of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query thread")
+		return
+	}
+	if !containsString(participantIDs, userID) {
+		response.Error(w, http.StatusForbidden, "You are not a participant of this thread")
+		return
+	}
+
+	s.publishRealtimeEvent("SetTypingStatus", excludeString(participantIDs, userID), models.RealtimeEventTyping, threadID, models.RealtimeTyping{
+		UserID:    userID,
+		Typing:    req.Typing,
+		ExpiresAt: time.Now().Add(realtimeTypingTTL).UTC(),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishThreadEvent pushes an event to the participants of a thread (excludeUserID = "" for everyone,
+// so that the actor's other tabs and devices stay in sync).
+// Delivery is best-effort: failures are logged and never fail the request that caused the event.
+func (s *Server) publishThreadEvent(handler string, threadID string, excludeUserID string, eventType string, data interface{}) {
+	participantIDs, err := s.threadParticipantIDs(s.supabase.GetServiceClient(), threadID)
+	if err != nil {
+		log.Printf("[%s] ⚠️ Failed to query participants for realtime event %s: %v", handler, eventType, err)
+		return
+	}
+	s.publishRealtimeEvent(handler, excludeString(participantIDs, excludeUserID), eventType, threadID, data)
+}
+
+// publishMessageCreated pushes a new message to the participants of its thread.
+func (s *Server) publishMessageCreated(handler string, message models.MessageWithSender, filePath string) {
+	s.publishMessageEvent(handler, models.RealtimeEventMessageCreated, message, filePath)
+}
+
+// publishMessageEvent pushes a new or edited message to the participants of its thread.
+// 添付ファイルのURLは閲覧者ごとに発行する（透かしに閲覧者が入るため）
+func (s *Server) publishMessageEvent(handler string, eventType string, message models.MessageWithSender, filePath string) {
+	participantIDs, err := s.threadParticipantIDs(s.supabase.GetServiceClient(), message.ThreadID)
+	if err != nil {
+		log.Printf("[%s] ⚠️ Failed to query participants for realtime event %s: %v", handler, eventType, err)
+		return
+	}
+	if filePath == "" {
+		s.publishRealtimeEvent(handler, participantIDs, eventType, message.ThreadID, message)
+		return
+	}
+	for _, participantID := range participantIDs {
+		personal := message
+		personal.ImageURL = nil
+		if imageURL := s.messageAttachmentURL(handler, participantID, message.ID, filePath); imageURL != "" {
+			personal.ImageURL = &imageURL
+		}
+		s.publishRealtimeEvent(handler, []string{participantID}, eventType, message.ThreadID, personal)
+	}
+}
+
+// publishRealtimeEvent pushes an event to the given users (best-effort)
+func (s *Server) publishRealtimeEvent(handler string, userIDs []string, eventType string, threadID string, data interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+	event, err := services.NewRealtimeEvent(eventType, threadID, data)
+	if err == nil {
+		err = s.realtime.Publish(userIDs, event)
+	}
+	if err != nil {
+		log.Printf("[%s] ⚠️ Failed to publish realtime event %s: %v", handler, eventType, err)
+	}
+}
+
+func excludeString(values []string, exclude string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != exclude {
+			result = append(result, v)
+		}
+	}
+	return result
+}
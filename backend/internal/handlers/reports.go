@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	defaultReportLimit = 50
+	maxReportLimit     = 200
+	// 通報時点の内容として保存する最大文字数
+	maxReportSnapshotLength = 2000
+)
+
+var (
+	errReportTargetNotFound = errors.New("report target not found")
+	errInvalidReportTarget  = errors.New("target_type must be one of: message, comment, comment_reply, post, profile")
+)
+
+// activeReportStatuses are the statuses in the triage queue by default
+var activeReportStatuses = []string{string(models.ReportStatusOpen), string(models.ReportStatusInReview)}
+
+// reportTarget is the reported content resolved from target_type and target_id
+type reportTarget struct {
+	UserID   string
+	ThreadID string
+	PostID   string
+	Snapshot string
+}
+
+// HandleReports routes /api/reports requests
+func (s *Server) HandleReports(w http.ResponseWriter, r *http.Request) {
+	reportID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/reports"), "/")
+	switch {
+	case reportID == "" && r.Method == http.MethodPost:
+		s.CreateReport(w, r)
+	case reportID == "" && r.Method == http.MethodGet:
+		s.ListReports(w, r)
+	case reportID != "" && r.Method == http.MethodPut:
+		s.UpdateReport(w, r, reportID)
+	default:
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// CreateReport reports a message, comment, reply, post or profile to the operators.
+// An open report of the same content by the same user is returned instead of a new one.
+// POST /api/reports
+func (s *Server) CreateReport(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.CreateReportRequest
+	if !utils.DecodeJSONBody(r, w, &req) {
+		return
+	}
+	req.TargetID = strings.TrimSpace(req.TargetID)
+	if req.TargetID == "" {
+		response.Error(w, http.StatusBadRequest, "target_id is required")
+		return
+	}
+	if !models.ValidReportReason(req.Reason) {
+		response.Error(w, http.StatusBadRequest, "reason must be one of: harassment, spam, fraud, off_platform_contact, inappropriate, other")
+		return
+	}
+	var details *string
+	if req.Details != nil {
+		// 🔒 SECURITY: 運営の管理画面に表示するためサニタイズする
+		sanitized := utils.SanitizeText(utils.SanitizeInput{
+			Value:     strings.TrimSpace(*req.Details),
+			MaxLength: utils.MaxTextareaLength,
+		})
+		if sanitized.Sanitized != "" {
+			details = &sanitized.Sanitized
+		}
+	}
+
+	// 🔒 SECURITY: 通報者が閲覧できる内容のみ通報できる（RLSで確認するため access token を使う）
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+	target, err := s.resolveReportTarget(client, req.TargetType, req.TargetID)
+	switch {
+	case errors.Is(err, errInvalidReportTarget):
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, errReportTargetNotFound):
+		response.Error(w, http.StatusNotFound, "Reported content not found")
+		return
+	case err != nil:
+		log.Printf("[CreateReport] Failed to resolve %s %s: %v", req.TargetType, req.TargetID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query reported content")
+		return
+	}
+	if target.UserID == userID {
+		response.Error(w, http.StatusBadRequest, "You cannot report your own content")
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	var existing []models.Report
+	_, err = serviceClient.From("reports").
+		Select("*", "", false).
+		Eq("reporter_id", userID).
+		Eq("target_type", string(req.TargetType)).
+		Eq("target_id", req.TargetID).
+		In("status", activeReportStatuses).
+		ExecuteTo(&existing)
+	if err != nil {
+		log.Printf("[CreateReport] Failed to query existing reports: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to create report")
+		return
+	}
+	if len(existing) > 0 {
+		response.Success(w, http.StatusOK, reporterView(existing[0]))
+		return
+	}
+
+	optional := func(v string) *string {
+		if v == "" {
+			return nil
+		}
+		return &v
+	}
+	row := map[string]interface{}{
+		"reporter_id":     userID,
+		"target_type":     req.TargetType,
+		"target_id":       req.TargetID,
+		"target_user_id":  optional(target.UserID),
+		"thread_id":       optional(target.ThreadID),
+		"post_id":         optional(target.PostID),
+		"reason":          req.Reason,
+		"details":         details,
+		"target_snapshot": optional(target.Snapshot),
+	}
+	var created []models.Report
+	_, err = serviceClient.From("reports").
+		Insert(row, false, "", "", "").
+		ExecuteTo(&created)
+	if err != nil || len(created) == 0 {
+		log.Printf("[CreateReport] ❌ Failed to create report of %s %s by %s: %v", req.TargetType, req.TargetID, userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to create report")
+		return
+	}
+
+	log.Printf("[CreateReport] ✓ Report %s: %s %s (%s) by %s", created[0].ID, req.TargetType, req.TargetID, req.Reason, userID)
+	response.Success(w, http.StatusCreated, reporterView(created[0]))
+}
+
+// resolveReportTarget returns the author and context of the reported content
+func (s *Server) resolveReportTarget(client *supabase.Client, targetType models.ReportTargetType, targetID string) (reportTarget, error) {
+	var target reportTarget
+	switch targetType {
+	case models.ReportTargetMessage:
+		var rows []messageRow
+		_, err := client.From("messages").
+			Select(messageSelectColumns, "", false).
+			Eq("id", targetID).
+			ExecuteTo(&rows)
+		if err != nil {
+			return target, err
+		}
+		if len(rows) == 0 {
+			return target, errReportTargetNotFound
+		}
+		message := messageFromRow(rows[0])
+		target.UserID = message.SenderUserID
+		target.ThreadID = message.ThreadID
+		target.Snapshot = ndaStringValue(message.Text)
+	case models.ReportTargetComment:
+		var comments []models.PostComment
+		_, err := client.From("post_comments").
+			Select("*", "", false).
+			Eq("id", targetID).
+			ExecuteTo(&comments)
+		if err != nil {
+			return target, err
+		}
+		if len(comments) == 0 {
+			return target, errReportTargetNotFound
+		}
+		target.UserID = comments[0].UserID
+		target.PostID = comments[0].PostID
+		target.Snapshot = comments[0].Content
+	case models.ReportTargetCommentReply:
+		var replies []models.CommentReply
+		_, err := client.From("comment_replies").
+			Select("*", "", false).
+			Eq("id", targetID).
+			ExecuteTo(&replies)
+		if err != nil {
+			return target, err
+		}
+		if len(replies) == 0 {
+			return target, errReportTargetNotFound
+		}
+		target.UserID = replies[0].UserID
+		target.Snapshot = replies[0].Content
+		var comments []models.PostComment
+		_, err = client.From("post_comments").
+			Select("*", "", false).
+			Eq("id", replies[0].CommentID).
+			ExecuteTo(&comments)
+		if err == nil && len(comments) > 0 {
+			target.PostID = comments[0].PostID
+		}
+	case models.ReportTargetPost:
+		var posts []struct {
+			ID           string `json:"id"`
+			AuthorUserID string `json:"author_user_id"`
+			Title        string `json:"title"`
+		}
+		_, err := client.From("posts").
+			Select("id, author_user_id, title", "", false).
+			Eq("id", targetID).
+			ExecuteTo(&posts)
+		if err != nil {
+			return target, err
+		}
+		if len(posts) == 0 {
+			return target, errReportTargetNotFound
+		}
+		target.UserID = posts[0].AuthorUserID
+		target.PostID = posts[0].ID
+		target.Snapshot = posts[0].Title
+	case models.ReportTargetProfile:
+		var profiles []profileRowSimple
+		_, err := client.From("profiles").
+			Select("id, display_name, icon_url", "", false).
+			Eq("id", targetID).
+			ExecuteTo(&profiles)
+		if err != nil {
+			return target, err
+		}
+		if len(profiles) == 0 {
+			return target, errReportTargetNotFound
+		}
+		target.UserID = profiles[0].ID
+		target.Snapshot = profiles[0].DisplayName
+	default:
+		return target, errInvalidReportTarget
+	}
+	if runes := []rune(target.Snapshot); len(runes) > maxReportSnapshotLength {
+		target.Snapshot = string(runes[:maxReportSnapshotLength])
+	}
+	return target, nil
+}
+
+// reporterView hides the operator-only fields of a report from the reporter
+func reporterView(report models.Report) models.Report {
+	report.AssignedTo = nil
+	report.ResolutionNote = nil
+	report.ResolvedBy = nil
+	return report
+}
+
+// ListReports returns the triage queue to operators (oldest first) and the user's own reports to everyone else
+// (newest first, with the status only).
+// GET /api/reports?status=active|open|in_review|resolved|dismissed|all&target_type=&reason=&target_user_id=&assigned=me&limit=&offset=
+func (s *Server) ListReports(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultReportLimit
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 {
+		limit = min(v, maxReportLimit)
+	}
+	offset := 0
+	if v, err := strconv.Atoi(query.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+
+	// 🔒 SECURITY: reports にはRLSポリシーがないため、通報者本人か運営かを確認してから service role で参照する
+	serviceClient := s.supabase.GetServiceClient()
+	if !s.isOperator(s.supabase.GetAuthenticatedClient(accessToken), userID) {
+		var reports []models.Report
+		_, err := serviceClient.From("reports").
+			Select("*", "", false).
+			Eq("reporter_id", userID).
+			Order("created_at", nil).
+			Range(offset, offset+limit-1, "").
+			ExecuteTo(&reports)
+		if err != nil {
+			log.Printf("[ListReports] Failed to query reports of %s: %v", userID, err)
+			response.Error(w, http.StatusInternalServerError, "Failed to query reports")
+			return
+		}
+		result := make([]models.Report, 0, len(reports))
+		for _, report := range reports {
+			result = append(result, reporterView(report))
+		}
+		response.Success(w, http.StatusOK, result)
+		return
+	}
+
+	builder := serviceClient.From("reports").
+		Select("*", "", false)
+	switch status := query.Get("status"); status {
+	case "", "active":
+		builder = builder.In("status", activeReportStatuses)
+	case string(models.ReportStatusOpen), string(models.ReportStatusInReview),
+		string(models.ReportStatusResolved), string(models.ReportStatusDismissed):
+		builder = builder.Eq("status", status)
+	case "all":
+	default:
+		response.Error(w, http.StatusBadRequest, "status must be one of: active, open, in_review, resolved, dismissed, all")
+		return
+	}
+	if v := query.Get("target_type"); v != "" {
+		builder = builder.Eq("target_type", v)
+	}
+	if v := query.Get("reason"); v != "" {
+		builder = builder.Eq("reason", v)
+	}
+	if v := query.Get("target_user_id"); v != "" {
+		builder = builder.Eq("target_user_id", v)
+	}
+	if query.Get("assigned") == "me" {
+		builder = builder.Eq("assigned_to", userID)
+	}
+
+	var reports []models.Report
+	_, err := builder.
+		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+		Range(offset, offset+limit-1, "").
+		ExecuteTo(&reports)
+	if err != nil {
+		log.Printf("[ListReports] Failed to query report queue: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query reports")
+		return
+	}
+
+	response.Success(w, http.StatusOK, s.reportQueueItems(serviceClient, reports))
+}
+
+// reportQueueItems adds the names of the users and the open reports / contact flags of each reported user
+func (s *Server) reportQueueItems(client *supabase.Client, reports []models.Report) []models.ReportQueueItem {
+	items := make([]models.ReportQueueItem, 0, len(reports))
+	if len(reports) == 0 {
+		return items
+	}
+
+	userIDs := make([]string, 0, len(reports)*2)
+	targetUserIDs := make([]string, 0, len(reports))
+	for _, report := range reports {
+		userIDs = append(userIDs, report.ReporterID)
+		if report.TargetUserID != nil && !containsString(targetUserIDs, *report.TargetUserID) {
+			targetUserIDs = append(targetUserIDs, *report.TargetUserID)
+		}
+	}
+	names := s.fetchDisplayNames(client, append(userIDs, targetUserIDs...)...)
+
+	openReports := make(map[string]int)
+	openFlags := make(map[string]int)
+	if len(targetUserIDs) > 0 {
+		var reportRows []struct {
+			TargetUserID string `json:"target_user_id"`
+		}
+		_, err := client.From("reports").
+			Select("target_user_id", "", false).
+			In("target_user_id", targetUserIDs).
+			In("status", activeReportStatuses).
+			ExecuteTo(&reportRows)
+		if err != nil {
+			log.Printf("[ListReports] ⚠️ Failed to count open reports: %v", err)
+		}
+		for _, row := range reportRows {
+			openReports[row.TargetUserID]++
+		}
+
+		var flagRows []struct {
+			UserID string `json:"user_id"`
+		}
+		_, err = client.From("contact_flags").
+			Select("user_id", "", false).
+			In("user_id", targetUserIDs).
+			Is("reviewed_at", "null").
+			ExecuteTo(&flagRows)
+		if err != nil {
+			log.Printf("[ListReports] ⚠️ Failed to count open contact flags: %v", err)
+		}
+		for _, row := range flagRows {
+			openFlags[row.UserID]++
+		}
+	}
+
+	for _, report := range reports {
+		item := models.ReportQueueItem{
+			Report:       report,
+			ReporterName: names[report.ReporterID],
+		}
+		if report.TargetUserID != nil {
+			item.TargetUserName = names[*report.TargetUserID]
+			item.TargetOpenReports = openReports[*report.TargetUserID]
+			item.TargetOpenContactFlags = openFlags[*report.TargetUserID]
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// UpdateReport changes the status, assignee or resolution note of a report (operators only).
+// Taking a report in review assigns it to the operator unless someone else has it.
+// PUT /api/reports/:id
+func (s *Server) UpdateReport(w http.ResponseWriter, r *http.Request, reportID string) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+	if !s.isOperator(s.supabase.GetAuthenticatedClient(accessToken), userID) {
+		log.Printf("[UpdateReport] ❌ User %s is not an operator", userID)
+		response.Error(w, http.StatusForbidden, "Only operators can update reports")
+		return
+	}
+
+	var req models.UpdateReportRequest
+	if !utils.DecodeJSONBody(r, w, &req) {
+		return
+	}
+	if req.Status == nil && req.ResolutionNote == nil && req.AssignedTo == nil {
+		response.Error(w, http.StatusBadRequest, "Nothing to update")
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	var reports []models.Report
+	_, err := serviceClient.From("reports").
+		Select("*", "", false).
+		Eq("id", reportID).
+		ExecuteTo(&reports)
+	if err != nil {
+		log.Printf("[UpdateReport] Failed to query report %s: %v", reportID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query report")
+		return
+	}
+	if len(reports) == 0 {
+		response.Error(w, http.StatusNotFound, "Report not found")
+		return
+	}
+	report := reports[0]
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	update := map[string]interface{}{"updated_at": now}
+	if req.AssignedTo != nil {
+		assignee := strings.TrimSpace(*req.AssignedTo)
+		if assignee == "" {
+			update["assigned_to"] = nil
+		} else if !s.isOperator(serviceClient, assignee) {
+			response.Error(w, http.StatusBadRequest, "Reports can only be assigned to operators")
+			return
+		} else {
+			update["assigned_to"] = assignee
+		}
+	}
+	if req.ResolutionNote != nil {
+		note := utils.SanitizeText(utils.SanitizeInput{
+			Value:     strings.TrimSpace(*req.ResolutionNote),
+			MaxLength: utils.MaxTextareaLength,
+		}).Sanitized
+		update["resolution_note"] = note
+	}
+	if req.Status != nil {
+		status := *req.Status
+		switch status {
+		case models.ReportStatusOpen, models.ReportStatusInReview:
+			// 対応済みの通報を戻す場合は対応者の記録を消す
+			update["resolved_by"] = nil
+			update["resolved_at"] = nil
+			if status == models.ReportStatusInReview && req.AssignedTo == nil && report.AssignedTo == nil {
+				update["assigned_to"] = userID
+			}
+		case models.ReportStatusResolved, models.ReportStatusDismissed:
+			update["resolved_by"] = userID
+			update["resolved_at"] = now
+		default:
+			response.Error(w, http.StatusBadRequest, "status must be one of: open, in_review, resolved, dismissed")
+			return
+		}
+		update["status"] = status
+	}
+
+	var updated []models.Report
+	_, err = serviceClient.From("reports").
+		Update(update, "", "").
+		Eq("id", reportID).
+		ExecuteTo(&updated)
+	if err != nil || len(updated) == 0 {
+		log.Printf("[UpdateReport] ❌ Failed to update report %s: %v", reportID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to update report")
+		return
+	}
+
+	log.Printf("[UpdateReport] ✓ Report %s updated by %s (status %s -> %s)", reportID, userID, report.Status, updated[0].Status)
+	if report.Status != models.ReportStatusResolved && updated[0].Status == models.ReportStatusResolved {
+		s.notifyListingModerated(userID, updated[0])
+	}
+	response.Success(w, http.StatusOK, s.reportQueueItems(serviceClient, updated)[0])
+}
@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	revenueReportsBucket = "revenue-reports"
+	// 申告値との差がこの割合以内なら「売上検証済み」とする
+	revenueVerificationTolerance = 0.10
+	maxRevenueReportFiles        = 12
+)
+
+var validRevenueProviders = map[models.RevenueProvider]bool{
+	models.RevenueProviderStripe:     true,
+	models.RevenueProviderAppStore:   true,
+	models.RevenueProviderGooglePlay: true,
+}
+
+// HandleRevenueVerifications handles GET (latest verification) and POST (upload exports) for a post
+func (s *Server) HandleRevenueVerifications(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 {
+		response.Error(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+	postID := parts[2]
+
+	switch r.Method {
+	case http.MethodGet:
+		s.GetRevenueVerification(w, r, postID)
+	case http.MethodPost:
+		s.CreateRevenueVerification(w, r, postID)
+	default:
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// CreateRevenueVerification parses uploaded payment-provider exports, compares them with the claimed
+// monthly revenue and stores the raw files in the private revenue-reports bucket
+//
+// multipart/form-data:
+//   - files:    one or more exports (CSV / TSV)
+//   - provider: stripe | app_store | google_play (one value for all files, or one per file in order)
+func (s *Server) CreateRevenueVerification(w http.ResponseWriter, r *http.Request, postID string) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+
+	post, err := s.fetchPostForRevenueVerification(client, postID)
+	if err != nil {
+		log.Printf("[CreateRevenueVerification] Failed to query post %s: %v", postID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query post")
+		return
+	}
+	if post == nil {
+		response.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if post.AuthorUserID != userID {
+		log.Printf("[CreateRevenueVerification] ❌ User %s is not the author of post %s", userID, postID)
+		response.Error(w, http.StatusForbidden, "Only the author can verify revenue")
+		return
+	}
+
+	if err := r.ParseMultipartForm(20 << 20); err != nil { // 20MB max for exports
+		log.Printf("[CreateRevenueVerification] Failed to parse form: %v", err)
+		response.Error(w, http.StatusBadRequest, "Failed to parse form data")
+		return
+	}
+
+	fileHeaders := r.MultipartForm.File["files"]
+	if len(fileHeaders) == 0 {
+		response.Error(w, http.StatusBadRequest, "At least one export file is required")
+		return
+	}
+	if len(fileHeaders) > maxRevenueReportFiles {
+		response.Error(w, http.StatusBadRequest, fmt.Sprintf("Too many files (max %d)", maxRevenueReportFiles))
+		return
+	}
+
+	providers := r.MultipartForm.Value["provider"]
+	if len(providers) != 1 && len(providers) != len(fileHeaders) {
+		response.Error(w, http.StatusBadRequest, "provider must be specified once or once per file")
+		return
+	}
+
+	type uploadedExport struct {
+		provider    models.RevenueProvider
+		fileName    string
+		data        []byte
+		contentType string
+	}
+
+	exports := make([]uploadedExport, 0, len(fileHeaders))
+	reports := make([]*models.RevenueReport, 0, len(fileHeaders))
+	for i, header := range fileHeaders {
+		provider := models.RevenueProvider(providers[0])
+		if len(providers) > 1 {
+			provider = models.RevenueProvider(providers[i])
+		}
+		if !validRevenueProviders[provider] {
+			response.Error(w, http.StatusBadRequest, fmt.Sprintf("Invalid provider: %s", provider))
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			log.Printf("[CreateRevenueVerification] Failed to open file %s: %v", header.Filename, err)
+			response.Error(w, http.StatusBadRequest, "Failed to read uploaded file")
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			log.Printf("[CreateRevenueVerification] Failed to read file %s: %v", header.Filename, err)
+			response.Error(w, http.StatusBadRequest, "Failed to read uploaded file")
+			return
+		}
+
+		report, err := services.ParseRevenueReport(provider, data)
+		if err != nil {
+			log.Printf("[CreateRevenueVerification] Failed to parse %s (%s): %v", header.Filename, provider, err)
+			response.Error(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", header.Filename, err))
+			return
+		}
+		log.Printf("[CreateRevenueVerification] ✓ Parsed %s (%s): %d rows, %d skipped, %d months",
+			header.Filename, provider, report.ParsedRows, report.SkippedRows, len(report.Months))
+
+		contentType := header.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "text/csv"
+		}
+		exports = append(exports, uploadedExport{
+			provider:    provider,
+			fileName:    header.Filename,
+			data:        data,
+			contentType: contentType,
+		})
+		reports = append(reports, report)
+	}
+
+	currency, months, err := services.MergeRevenueReports(reports)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var claimed int64
+	if post.MonthlyRevenue != nil {
+		claimed = *post.MonthlyRevenue
+	}
+	verifiedRevenue, ratio, matched := services.CompareRevenue(months, claimed, revenueVerificationTolerance)
+	periodStart, periodEnd, err := services.RevenuePeriod(months)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Failed to determine verification period")
+		return
+	}
+
+	status := models.RevenueVerificationStatusMismatch
+	if matched && currency == "JPY" {
+		status = models.RevenueVerificationStatusVerified
+	}
+
+	verificationInsert := map[string]interface{}{
+		"post_id":                  postID,
+		"seller_user_id":           userID,
+		"status":                   status,
+		"currency":                 currency,
+		"period_start":             periodStart.Format("2006-01-02"),
+		"period_end":               periodEnd.Format("2006-01-02"),
+		"verified_monthly_revenue": verifiedRevenue,
+		"difference_ratio":         ratio,
+		"monthly_breakdown":        months,
+	}
+	if post.MonthlyRevenue != nil {
+		verificationInsert["claimed_monthly_revenue"] = *post.MonthlyRevenue
+	}
+
+	// 🔒 SECURITY: 検証結果とバッジは service role で書き込む（投稿者が自分で検証済みにできないようRLSでは許可していない）
+	serviceClient := s.supabase.GetServiceClient()
+
+	var inserted []models.RevenueVerification
+	_, err = serviceClient.From("revenue_verifications").
+		Insert(verificationInsert, false, "", "", "").
+		ExecuteTo(&inserted)
+	if err != nil || len(inserted) == 0 {
+		log.Printf("[CreateRevenueVerification] Failed to save verification: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to save revenue verification")
+		return
+	}
+	verification := inserted[0]
+
+	// 元ファイルはprivateバケットに保存（NDA締結者と投稿者のみ署名付きURLで参照可能）
+	fileInserts := make([]map[string]interface{}, 0, len(exports))
+	for _, export := range exports {
+		ext := filepath.Ext(export.fileName)
+		if ext == "" {
+			ext = ".csv"
+		}
+		storagePath := fmt.Sprintf("%s/%s/%s%s", postID, verification.ID, uuid.New().String(), ext)
+		filePath, err := s.supabase.UploadFile(userID, revenueReportsBucket, storagePath, export.data, export.contentType)
+		if err != nil {
+			log.Printf("[CreateRevenueVerification] Failed to upload %s: %v", export.fileName, err)
+			response.Error(w, http.StatusInternalServerError, "Failed to store export file")
+			return
+		}
+		fileInserts = append(fileInserts, map[string]interface{}{
+			"verification_id": verification.ID,
+			"post_id":         postID,
+			"provider":        export.provider,
+			"file_path":       filePath,
+			"file_name":       export.fileName,
+			"file_size":       len(export.data),
+			"content_type":    export.contentType,
+		})
+	}
+
+	_, _, err = serviceClient.From("revenue_verification_files").
+		Insert(fileInserts, false, "", "", "").
+		Execute()
+	if err != nil {
+		log.Printf("[CreateRevenueVerification] Failed to save file records: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to save export file information")
+		return
+	}
+
+	// 投稿のバッジを更新（不一致の場合は既存のバッジも外す）
+	postUpdate := map[string]interface{}{
+		"revenue_verified": status == models.RevenueVerificationStatusVerified,
+	}
+	if status == models.RevenueVerificationStatusVerified {
+		postUpdate["revenue_verified_from"] = periodStart.Format("2006-01-02")
+		postUpdate["revenue_verified_to"] = periodEnd.Format("2006-01-02")
+		postUpdate["revenue_verified_at"] = time.Now().UTC().Format(time.RFC3339)
+	} else {
+		postUpdate["revenue_verified_from"] = nil
+		postUpdate["revenue_verified_to"] = nil
+		postUpdate["revenue_verified_at"] = nil
+	}
+	_, _, err = serviceClient.From("posts").
+		Update(postUpdate, "", "").
+		Eq("id", postID).
+		Execute()
+	if err != nil {
+		log.Printf("[CreateRevenueVerification] Failed to update post badge: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+
+	log.Printf("[CreateRevenueVerification] ✅ Post %s: status=%s claimed=%d verified=%d ratio=%.3f period=%s..%s",
+		postID, status, claimed, verifiedRevenue, ratio, periodStart.Format("2006-01"), periodEnd.Format("2006-01"))
+
+	response.Success(w, http.StatusCreated, models.RevenueVerificationDetail{
+		PostID:          postID,
+		RevenueVerified: status == models.RevenueVerificationStatusVerified,
+		Verification:    &verification,
+		CanViewFiles:    true,
+	})
+}
+
+// GetRevenueVerification returns the latest verification of a post.
+// The badge and period are public; the monthly breakdown of secret posts and the raw files
+// are only returned to the author and NDA holders.
+func (s *Server) GetRevenueVerification(w http.ResponseWriter, r *http.Request, postID string) {
+	currentUserID, _ := r.Context().Value("user_id").(string)
+
+	// 🔒 SECURITY: Use access token if authenticated, otherwise use Anon Client to enforce RLS
+	var client *supabase.Client
+	if accessToken, ok := r.Context().Value("access_token").(string); ok && accessToken != "" {
+		client = s.supabase.GetAuthenticatedClient(accessToken)
+	} else {
+		client = s.supabase.GetAnonClient()
+	}
+
+	post, err := s.fetchPostForRevenueVerification(client, postID)
+	if err != nil {
+		log.Printf("[GetRevenueVerification] Failed to query post %s: %v", postID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query post")
+		return
+	}
+	if post == nil {
+		response.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+
+	// 🔒 SECURITY: 秘匿投稿は投稿と同じ公開範囲ポリシーで検証済みバッジの表示可否を決める
+	relation := s.newPostViewer(r, client).relation(*post)
+	if !services.PostListable(*post, relation) {
+		response.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	visible := *post
+	masked := services.ApplyPostVisibility(&visible, relation)
+
+	detail := models.RevenueVerificationDetail{
+		PostID:          postID,
+		RevenueVerified: visible.RevenueVerified != nil && *visible.RevenueVerified,
+	}
+	for _, field := range masked {
+		if field == "revenue_verified" {
+			response.Success(w, http.StatusOK, detail)
+			return
+		}
+	}
+
+	// 金額を含むためRLSでは投稿者とNDA締結者のみ参照可能。公開範囲は上で確認済みのため service role で取得し、
+	// 秘匿投稿の金額は下で伏せる
+	serviceClient := s.supabase.GetServiceClient()
+
+	var verifications []models.RevenueVerification
+	_, err = serviceClient.From("revenue_verifications").
+		Select("*", "", false).
+		Eq("post_id", postID).
+		Order("created_at", nil).
+		Limit(1, "").
+		ExecuteTo(&verifications)
+	if err != nil {
+		log.Printf("[GetRevenueVerification] Failed to query verifications: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query revenue verification")
+		return
+	}
+	if len(verifications) == 0 {
+		response.Success(w, http.StatusOK, detail)
+		return
+	}
+	verification := verifications[0]
+
+	if currentUserID != "" {
+		if post.AuthorUserID == currentUserID {
+			detail.CanViewFiles = true
+		} else {
+			hasNDA, err := s.checkNDAAgreement(client, currentUserID, post.AuthorUserID, post.AuthorOrgID, post.ID)
+			if err != nil {
+				log.Printf("[GetRevenueVerification] ⚠️ Failed to check NDA: %v", err)
+			}
+			detail.CanViewFiles = hasNDA
+		}
+	}
+
+	if !detail.CanViewFiles && post.Type == models.PostTypeSecret {
+		// 秘匿投稿では金額情報を伏せ、期間とステータスのみ返す
+		verification.ClaimedMonthlyRevenue = nil
+		verification.VerifiedMonthlyRevenue = nil
+		verification.DifferenceRatio = nil
+		verification.MonthlyBreakdown = nil
+	}
+	detail.Verification = &verification
+
+	if detail.CanViewFiles {
+		var files []models.RevenueVerificationFile
+		_, err = serviceClient.From("revenue_verification_files").
+			Select("*", "", false).
+			Eq("verification_id", verification.ID).
+			ExecuteTo(&files)
+		if err != nil {
+			log.Printf("[GetRevenueVerification] ⚠️ Failed to query files: %v", err)
+		} else {
+			paths := make([]string, 0, len(files))
+			for _, f := range files {
+				paths = append(paths, f.FilePath)
+			}
+			urlMap := s.supabase.GetBatchImageURLs(revenueReportsBucket, paths, 600)
+			for i := range files {
+				files[i].SignedURL = urlMap[files[i].FilePath]
+			}
+			detail.Files = files
+		}
+	}
+
+	response.Success(w, http.StatusOK, detail)
+}
+
+// fetchPostForRevenueVerification returns nil when the post does not exist or is not visible
+func (s *Server) fetchPostForRevenueVerification(client *supabase.Client, postID string) (*models.Post, error) {
+	var posts []models.Post
+	_, err := client.From("posts").
+		Select("*", "", false).
+		Eq("id", postID).
+		Limit(1, "").
+		ExecuteTo(&posts)
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return nil, nil
+	}
+	return &posts[0], nil
+}
@@ -2,23 +2,49 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/yourusername/appexit-backend/config"
 	"github.com/yourusername/appexit-backend/internal/middleware"
 	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
 )
 
 type Server struct {
 	config   *config.Config
 	supabase *services.SupabaseService
+	realtime *services.RealtimeHub
+	contacts *services.ContactFilter
+	mailer   services.Mailer // SMTP未設定の場合は nil（メールは作成しない）
 }
 
 func NewServer(cfg *config.Config) *Server {
+	// 単一インスタンス構成ではプロセス内で配信する（複数インスタンスではRealtimeBrokerを差し替える）
+	realtime, err := services.NewRealtimeHub(services.NewLocalRealtimeBroker(), maxRealtimeStreamsPerUser)
+	if err != nil {
+		log.Fatalf("[SERVER] ❌ Failed to start realtime hub: %v", err)
+	}
+	// 自サイトへのリンクは連絡先として扱わない
+	contacts, err := services.NewContactFilter(cfg.ContactPolicy, urlHost(cfg.FrontendURL), urlHost(cfg.BackendURL))
+	if err != nil {
+		log.Fatalf("[SERVER] ❌ Invalid CONTACT_POLICY: %v", err)
+	}
+	utils.SetTrustedProxyHops(cfg.TrustedProxyHops)
+	var mailer services.Mailer
+	if cfg.EmailEnabled() {
+		mailer = services.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword)
+	} else {
+		log.Printf("[SERVER] ⚠️ SMTP_HOST is not set: transactional emails are disabled")
+	}
 	return &Server{
 		config:   cfg,
 		supabase: services.NewSupabaseService(cfg),
+		realtime: realtime,
+		contacts: contacts,
+		mailer:   mailer,
 	}
 }
 
@@ -101,17 +127,37 @@ func SetupRoutes(cfg *config.Config) http.Handler {
 		fmt.Printf("========== ROUTER END ==========\n\n")
 	})
 	fmt.Println("[ROUTES] Registered: /api/threads (with auth)")
+	mux.HandleFunc("/api/threads/counts", auth(server.GetInboxCounts))
+	fmt.Println("[ROUTES] Registered: /api/threads/counts (with auth)")
 	mux.HandleFunc("/api/threads/", auth(server.HandleThreadByID))
-	fmt.Println("[ROUTES] Registered: /api/threads/ (with auth)")
+	fmt.Println("[ROUTES] Registered: /api/threads/ (contracts, typing, deal, merge, state, participants, export) (with auth)")
 	// より長いパスを先に登録（重要: http.ServeMuxの仕様）
 	mux.HandleFunc("/api/messages/upload-contract", auth(server.UploadContractDocument))
 	fmt.Println("[ROUTES] Registered: /api/messages/upload-contract (with auth)")
 	mux.HandleFunc("/api/messages/upload-image", auth(server.UploadMessageImage))
 	fmt.Println("[ROUTES] Registered: /api/messages/upload-image (with auth)")
+	mux.HandleFunc("/api/messages/search", auth(server.SearchMessages))
+	fmt.Println("[ROUTES] Registered: /api/messages/search (with auth)")
 	mux.HandleFunc("/api/messages", auth(server.HandleMessages))
 	fmt.Println("[ROUTES] Registered: /api/messages (with auth)")
+	mux.HandleFunc("/api/messages/", auth(server.HandleMessageByID))
+	fmt.Println("[ROUTES] Registered: /api/messages/:id (with auth)")
+
+	// Realtime routes (protected): Server-Sent Events stream of thread events
+	mux.HandleFunc("/api/realtime/stream", auth(server.StreamRealtimeEvents))
+	fmt.Println("[ROUTES] Registered: /api/realtime/stream (with auth)")
 
 	// Contract routes (protected)
+	mux.HandleFunc("/api/contract-templates", server.ListContractTemplates)
+	fmt.Println("[ROUTES] Registered: /api/contract-templates")
+	mux.HandleFunc("/api/contracts/generate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			auth(server.GenerateContract)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	fmt.Println("[ROUTES] Registered: /api/contracts/generate (with auth)")
 	mux.HandleFunc("/api/contracts/", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 		if strings.HasSuffix(path, "/update") && r.Method == http.MethodPut {
@@ -161,6 +207,26 @@ func SetupRoutes(cfg *config.Config) http.Handler {
 	fmt.Println("[ROUTES] Registered: /api/sale-requests/refund (with auth)")
 	fmt.Println("[ROUTES] Registered: /api/sale-requests/verify (with auth)")
 
+	// NDA routes (protected)
+	mux.HandleFunc("/api/nda-agreements", auth(server.HandleNDAAgreements))
+	mux.HandleFunc("/api/nda-agreements/", auth(server.HandleNDAAgreementByID))
+	fmt.Println("[ROUTES] Registered: /api/nda-agreements (with auth)")
+	fmt.Println("[ROUTES] Registered: /api/nda-agreements/ (document, approve, decline, sign, cancel, scope, revoke) (with auth)")
+	// 開示期限を過ぎたNDAの定期失効
+	go server.runNDAExpiryWorker(10 * time.Minute)
+
+	// Data room routes (protected)
+	mux.HandleFunc("/api/data-rooms", auth(server.HandleDataRooms))
+	mux.HandleFunc("/api/data-rooms/", auth(server.HandleDataRoomByID))
+	fmt.Println("[ROUTES] Registered: /api/data-rooms (with auth)")
+	fmt.Println("[ROUTES] Registered: /api/data-rooms/ (folders, files, grants, report, logs) (with auth)")
+
+	// 契約書・メッセージ添付・データルームのファイルを透かし入りで配信（認証はダウンロードトークンで行う）
+	mux.HandleFunc("/api/files/content", server.ServeProtectedFile)
+	fmt.Println("[ROUTES] Registered: /api/files/content (download token)")
+	mux.HandleFunc("/api/watermarks/inspect", auth(server.InspectWatermark))
+	fmt.Println("[ROUTES] Registered: /api/watermarks/inspect (with auth, operators only)")
+
 	// Post routes
 	// IMPORTANT: Register /api/posts/metadata BEFORE /api/posts/ to prevent it from being treated as an ID
 	mux.HandleFunc("/api/posts/metadata", func(w http.ResponseWriter, r *http.Request) {
@@ -173,17 +239,41 @@ func SetupRoutes(cfg *config.Config) http.Handler {
 	})
 	// Board sidebar endpoint (must be registered before /api/posts/)
 	mux.HandleFunc("/api/posts/board/sidebar", server.HandleBoardSidebar)
+	// Side-by-side comparison (must be registered before /api/posts/)
+	mux.HandleFunc("/api/posts/compare", middleware.OptionalAuthWithSupabase(cfg.SupabaseJWTSecret, server.supabase)(server.ComparePosts))
+	// Recommended posts for the authenticated buyer (must be registered before /api/posts/)
+	mux.HandleFunc("/api/posts/recommended", auth(server.GetRecommendedPosts))
+	// Bulk import/export of the seller's own listings (must be registered before /api/posts/)
+	mux.HandleFunc("/api/posts/import", auth(server.ImportPosts))
+	mux.HandleFunc("/api/posts/export", auth(server.ExportPosts))
 	mux.HandleFunc("/api/posts", server.HandlePostsRoute)
 	mux.HandleFunc("/api/posts/", server.HandlePostByIDRoute)
 	fmt.Println("[ROUTES] Registered: /api/posts/metadata (with optional auth)")
+	fmt.Println("[ROUTES] Registered: /api/posts/compare (with optional auth)")
+	fmt.Println("[ROUTES] Registered: /api/posts/recommended (with auth)")
+	fmt.Println("[ROUTES] Registered: /api/posts/import (with auth)")
+	fmt.Println("[ROUTES] Registered: /api/posts/export (with auth)")
 	fmt.Println("[ROUTES] Registered: /api/posts")
 	fmt.Println("[ROUTES] Registered: /api/posts/")
 
+	// Public feeds of new listings (Atom / RSS 2.0 / JSON Feed)
+	for _, path := range []string{"/feeds/posts", "/feeds/posts.atom", "/feeds/posts.rss", "/feeds/posts.json"} {
+		mux.HandleFunc(path, server.HandlePostsFeed)
+	}
+	fmt.Println("[ROUTES] Registered: /feeds/posts (.atom, .rss, .json)")
+
+	// Dynamic sitemaps for crawlers (index + paginated posts / board / profiles)
+	mux.HandleFunc("/sitemaps/", server.HandleSitemap)
+	fmt.Println("[ROUTES] Registered: /sitemaps/ (index.xml, {posts|board|profiles}-{page}.xml)")
+
 	// Active views routes (protected)
 	mux.HandleFunc("/api/posts/active-views", func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 	})
 	fmt.Println("[ROUTES] Registered: /api/posts/*/active-views (handled by /api/posts/)")
+	fmt.Println("[ROUTES] Registered: /api/posts/*/revenue-verifications (handled by /api/posts/)")
+	fmt.Println("[ROUTES] Registered: /api/posts/*/matching-buyers (handled by /api/posts/)")
+	fmt.Println("[ROUTES] Registered: /api/posts/*/analytics (handled by /api/posts/)")
 
 	// Comment routes
 	mux.HandleFunc("/api/comments/", server.HandleCommentRoute)
@@ -193,6 +283,33 @@ func SetupRoutes(cfg *config.Config) http.Handler {
 	fmt.Println("[ROUTES] Registered: /api/replies/*")
 	fmt.Println("[ROUTES] Registered: /api/comments/*/likes")
 
+	// Contact flag routes (operators only)
+	mux.HandleFunc("/api/contact-flags", auth(server.HandleContactFlags))
+	mux.HandleFunc("/api/contact-flags/", auth(server.HandleContactFlags))
+	fmt.Println("[ROUTES] Registered: /api/contact-flags (with auth, operators only)")
+
+	// Block and report routes (protected): reports are triaged by operators
+	mux.HandleFunc("/api/blocks", auth(server.HandleBlocks))
+	mux.HandleFunc("/api/blocks/", auth(server.HandleBlocks))
+	fmt.Println("[ROUTES] Registered: /api/blocks (with auth)")
+	mux.HandleFunc("/api/reports", auth(server.HandleReports))
+	mux.HandleFunc("/api/reports/", auth(server.HandleReports))
+	fmt.Println("[ROUTES] Registered: /api/reports (with auth, queue for operators)")
+
+	// Notification routes (protected): list, unread count, read state and per-type preferences
+	mux.HandleFunc("/api/notifications", auth(server.HandleNotifications))
+	mux.HandleFunc("/api/notifications/", auth(server.HandleNotifications))
+	fmt.Println("[ROUTES] Registered: /api/notifications (with auth)")
+
+	// Email bounce webhook (authenticated by EMAIL_BOUNCE_WEBHOOK_SECRET)
+	mux.HandleFunc("/api/email/bounces", server.HandleEmailBounce)
+	fmt.Println("[ROUTES] Registered: /api/email/bounces (shared secret)")
+	// 取引メールの送信と未読メッセージのダイジェスト
+	if server.mailer != nil {
+		go server.runEmailOutboxWorker(time.Minute)
+		go server.runMessageDigestWorker(5 * time.Minute)
+	}
+
 	// Storage routes (protected)
 	mux.HandleFunc("/api/storage/upload", auth(server.UploadFile))
 	mux.HandleFunc("/api/storage/signed-url", server.GetSignedURL)      // 公開（画像表示用）
@@ -283,6 +400,39 @@ func (s *Server) HandlePostByIDRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// /api/posts/:id/structured-data (public JSON-LD)
+	if len(parts) >= 4 && parts[3] == "structured-data" {
+		s.GetPostStructuredData(w, r)
+		return
+	}
+
+	// /api/posts/:id/analytics
+	if len(parts) >= 4 && parts[3] == "analytics" {
+		auth := middleware.AuthWithSupabase(s.config.SupabaseJWTSecret, s.supabase)
+		auth(s.GetPostAnalytics)(w, r)
+		return
+	}
+
+	// /api/posts/:id/matching-buyers
+	if len(parts) >= 4 && parts[3] == "matching-buyers" {
+		auth := middleware.AuthWithSupabase(s.config.SupabaseJWTSecret, s.supabase)
+		auth(s.GetMatchingBuyers)(w, r)
+		return
+	}
+
+	// /api/posts/:id/revenue-verifications
+	if len(parts) >= 4 && parts[3] == "revenue-verifications" {
+		if r.Method == http.MethodPost {
+			auth := middleware.AuthWithSupabase(s.config.SupabaseJWTSecret, s.supabase)
+			auth(s.HandleRevenueVerifications)(w, r)
+		} else {
+			// GET: optional auth so that NDA holders can see the raw exports
+			optionalAuth := middleware.OptionalAuthWithSupabase(s.config.SupabaseJWTSecret, s.supabase)
+			optionalAuth(s.HandleRevenueVerifications)(w, r)
+		}
+		return
+	}
+
 	if len(parts) >= 4 && parts[3] == "comments" {
 		// This is a comment route
 		auth := middleware.AuthWithSupabase(s.config.SupabaseJWTSecret, s.supabase)
@@ -298,8 +448,9 @@ func (s *Server) HandlePostByIDRoute(w http.ResponseWriter, r *http.Request) {
 
 	// Regular post route
 	if r.Method == http.MethodGet {
-		// GET is public
-		s.HandlePostByID(w, r)
+		// GET is public (optional auth for NDA check and view tracking)
+		optionalAuth := middleware.OptionalAuthWithSupabase(s.config.SupabaseJWTSecret, s.supabase)
+		optionalAuth(s.HandlePostByID)(w, r)
 	} else {
 		// PUT, DELETE require authentication
 		auth := middleware.AuthWithSupabase(s.config.SupabaseJWTSecret, s.supabase)
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	// PostgRESTの最大取得件数（max_rows）に合わせる
+	sitemapPageSize = 1000
+	sitemapMaxAge   = 3600 // seconds
+)
+
+// sitemapLocales are the frontend locales (the first one is the default)
+var sitemapLocales = []string{"ja", "en"}
+
+// sitemapKind describes one family of paginated sitemaps
+type sitemapKind struct {
+	name       string
+	pathPrefix string // frontend path before the ID
+	changeFreq string
+	priority   float64
+	// query returns a filter builder over rows with id and updated_at
+	query func(client *supabase.Client, columns string, count string) *postgrest.FilterBuilder
+}
+
+var sitemapKinds = []sitemapKind{
+	{
+		// 秘匿投稿は詳細がマスクされるためクロール対象外
+		name: "posts", pathPrefix: "/projects/", changeFreq: "daily", priority: 0.8,
+		query: func(client *supabase.Client, columns string, count string) *postgrest.FilterBuilder {
+			return client.From("posts").Select(columns, count, false).
+				Eq("type", string(models.PostTypeTransaction)).
+				Eq("is_active", "true")
+		},
+	},
+	{
+		name: "board", pathPrefix: "/projects/", changeFreq: "daily", priority: 0.6,
+		query: func(client *supabase.Client, columns string, count string) *postgrest.FilterBuilder {
+			return client.From("posts").Select(columns, count, false).
+				Eq("type", string(models.PostTypeBoard)).
+				Eq("is_active", "true")
+		},
+	},
+	{
+		// profiles はロールごとに1行のため、ユーザー単位に集約したビューを使う（公開プロフィールのみ）
+		name: "profiles", pathPrefix: "/profile/", changeFreq: "weekly", priority: 0.5,
+		query: func(client *supabase.Client, columns string, count string) *postgrest.FilterBuilder {
+			return client.From("sitemap_profiles").Select(columns, count, false)
+		},
+	},
+}
+
+type sitemapRow struct {
+	ID        string    `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HandleSitemap serves the sitemap index and the paginated sitemaps
+// GET /sitemaps/index.xml
+// GET /sitemaps/{posts|board|profiles}-{page}.xml
+func (s *Server) HandleSitemap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/sitemaps/")
+	if name == "" || name == "index.xml" {
+		s.serveSitemapIndex(w, r)
+		return
+	}
+
+	base := strings.TrimSuffix(name, ".xml")
+	sep := strings.LastIndex(base, "-")
+	if base == name || sep <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	page, err := strconv.Atoi(base[sep+1:])
+	if err != nil || page < 1 {
+		http.NotFound(w, r)
+		return
+	}
+	for _, kind := range sitemapKinds {
+		if kind.name == base[:sep] {
+			s.serveSitemapPage(w, r, kind, page)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) serveSitemapIndex(w http.ResponseWriter, r *http.Request) {
+	// 🔒 SECURITY: クローラー向けのため常にAnon Client（RLSで公開データのみ）
+	client := s.supabase.GetAnonClient()
+	backendURL := strings.TrimRight(s.config.BackendURL, "/")
+
+	refs := make([]services.SitemapRef, 0)
+	var lastModified time.Time
+	for _, kind := range sitemapKinds {
+		var latest []sitemapRow
+		count, err := kind.query(client, "id, updated_at", "exact").
+			Order("updated_at", nil).
+			Limit(1, "").
+			ExecuteTo(&latest)
+		if err != nil {
+			log.Printf("[HandleSitemap] Failed to count %s: %v", kind.name, err)
+			response.Error(w, http.StatusInternalServerError, "Failed to build sitemap index")
+			return
+		}
+
+		var kindLastMod time.Time
+		if len(latest) > 0 {
+			kindLastMod = latest[0].UpdatedAt
+		}
+		if kindLastMod.After(lastModified) {
+			lastModified = kindLastMod
+		}
+
+		pages := int((count + sitemapPageSize - 1) / sitemapPageSize)
+		for page := 1; page <= pages; page++ {
+			ref := services.SitemapRef{Loc: fmt.Sprintf("%s/sitemaps/%s-%d.xml", backendURL, kind.name, page)}
+			// 先頭ページ（最新の更新を含む）にのみ更新日時を付ける
+			if page == 1 {
+				ref.LastMod = kindLastMod
+			}
+			refs = append(refs, ref)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := services.RenderSitemapIndex(refs, &buf); err != nil {
+		log.Printf("[HandleSitemap] Failed to render sitemap index: %v", err)
+		response.Error(w, http.StatusInternalServerError, "Failed to build sitemap index")
+		return
+	}
+	writeSitemapResponse(w, r, buf.Bytes(), lastModified)
+}
+
+func (s *Server) serveSitemapPage(w http.ResponseWriter, r *http.Request, kind sitemapKind, page int) {
+	client := s.supabase.GetAnonClient()
+	from := (page - 1) * sitemapPageSize
+
+	// IDの順で安定したページ分割にする（更新日時順だと更新のたびにページ間で移動する）
+	var rows []sitemapRow
+	_, err := kind.query(client, "id, updated_at", "").
+		Order("id", &postgrest.OrderOpts{Ascending: true}).
+		Range(from, from+sitemapPageSize-1, "").
+		ExecuteTo(&rows)
+	if err != nil {
+		log.Printf("[HandleSitemap] Failed to query %s page %d: %v", kind.name, page, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to build sitemap")
+		return
+	}
+	if len(rows) == 0 && page > 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	frontendURL := strings.TrimRight(s.config.FrontendURL, "/")
+	urls := make([]services.SitemapURL, 0, len(rows))
+	var lastModified time.Time
+	for _, row := range rows {
+		path := kind.pathPrefix + url.PathEscape(row.ID)
+		entry := services.SitemapURL{
+			Loc:        localizedFrontendURL(frontendURL, sitemapLocales[0], path),
+			LastMod:    row.UpdatedAt,
+			ChangeFreq: kind.changeFreq,
+			Priority:   kind.priority,
+		}
+		for _, locale := range sitemapLocales {
+			entry.Alternates = append(entry.Alternates, services.SitemapAlternate{
+				Lang: locale,
+				Href: localizedFrontendURL(frontendURL, locale, path),
+			})
+		}
+		entry.Alternates = append(entry.Alternates, services.SitemapAlternate{
+			Lang: "x-default",
+			Href: localizedFrontendURL(frontendURL, sitemapLocales[0], path),
+		})
+		urls = append(urls, entry)
+		if row.UpdatedAt.After(lastModified) {
+			lastModified = row.UpdatedAt
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := services.RenderSitemap(urls, &buf); err != nil {
+		log.Printf("[HandleSitemap] Failed to render %s page %d: %v", kind.name, page, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to build sitemap")
+		return
+	}
+	log.Printf("[HandleSitemap] ✓ Served %s-%d.xml with %d URLs", kind.name, page, len(urls))
+	writeSitemapResponse(w, r, buf.Bytes(), lastModified)
+}
+
+func writeSitemapResponse(w http.ResponseWriter, r *http.Request, body []byte, lastModified time.Time) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", sitemapMaxAge))
+	if !lastModified.IsZero() {
+		lastModified = lastModified.UTC().Truncate(time.Second)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+			if t, err := http.ParseTime(ims); err == nil && !lastModified.After(t) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+func localizedFrontendURL(frontendURL, locale, path string) string {
+	return frontendURL + "/" + locale + path
+}
+
+// GetPostStructuredData returns JSON-LD for a post page
+// GET /api/posts/:id/structured-data
+// 🔒 SECURITY: 閲覧者に関係なく未ログイン（クローラー）と同じ公開範囲で生成する
+func (s *Server) GetPostStructuredData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 || parts[2] == "" {
+		response.Error(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+	postID := parts[2]
+
+	client := s.supabase.GetAnonClient()
+	var posts []models.Post
+	_, err := client.From("posts").
+		Select("*", "", false).
+		Eq("id", postID).
+		Limit(1, "").
+		ExecuteTo(&posts)
+	if err != nil {
+		log.Printf("[GetPostStructuredData] Failed to query post %s: %v", postID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query post")
+		return
+	}
+	if len(posts) == 0 {
+		response.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	post := posts[0]
+	if !services.PostListable(post, services.ViewerAnonymous) {
+		response.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+
+	// 秘匿投稿の投稿者名は出さない
+	authorName := ""
+	if post.Type != models.PostTypeSecret {
+		authorName = s.fetchFeedAuthorNames([]models.Post{post})[post.AuthorUserID]
+	}
+
+	locale := requestedSitemapLocale(r)
+	pageURL := localizedFrontendURL(strings.TrimRight(s.config.FrontendURL, "/"), locale, "/projects/"+url.PathEscape(post.ID))
+	response.Success(w, http.StatusOK, services.PostJSONLD(post, pageURL, authorName))
+}
+
+// GetUserStructuredData returns JSON-LD for a public profile page
+// GET /api/users/:id/structured-data
+func (s *Server) GetUserStructuredData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 || parts[2] == "" {
+		response.Error(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	userID := parts[2]
+
+	client := s.supabase.GetAnonClient()
+	var profiles []models.Profile
+	_, err := client.From("profiles").
+		Select("*", "", false).
+		Eq("id", userID).
+		Eq("public", "true").
+		Limit(1, "").
+		ExecuteTo(&profiles)
+	if err != nil {
+		log.Printf("[GetUserStructuredData] Failed to query profile %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query profile")
+		return
+	}
+	// 非公開プロフィールは存在自体を返さない
+	if len(profiles) == 0 {
+		response.Error(w, http.StatusNotFound, "Profile not found")
+		return
+	}
+
+	var links []models.UserLink
+	_, err = client.From("user_links").
+		Select("*", "", false).
+		Eq("user_id", userID).
+		Order("display_order", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&links)
+	if err != nil {
+		log.Printf("[GetUserStructuredData] ⚠️ Failed to query links for %s: %v", userID, err)
+	}
+
+	locale := requestedSitemapLocale(r)
+	pageURL := localizedFrontendURL(strings.TrimRight(s.config.FrontendURL, "/"), locale, "/profile/"+url.PathEscape(userID))
+	response.Success(w, http.StatusOK, services.ProfileJSONLD(profiles[0], links, pageURL))
+}
+
+// requestedSitemapLocale returns ?locale= if it is a known frontend locale, otherwise the default
+func requestedSitemapLocale(r *http.Request) string {
+	locale := r.URL.Query().Get("locale")
+	for _, l := range sitemapLocales {
+		if l == locale {
+			return l
+		}
+	}
+	return sitemapLocales[0]
+}
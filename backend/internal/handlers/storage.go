@@ -159,6 +159,11 @@ func (s *Server) GetSignedURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if restrictedStorageBuckets[req.Bucket] {
+		response.Error(w, http.StatusForbidden, "Files in this bucket cannot be accessed by signed URL")
+		return
+	}
+
 	// 外部URLの場合はそのまま返す
 	if strings.HasPrefix(req.Path, "http://") || strings.HasPrefix(req.Path, "https://") {
 		fmt.Printf("[STORAGE] Path is external URL, returning as-is: %s\n", req.Path)
@@ -188,6 +193,15 @@ func (s *Server) GetSignedURL(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// 🔒 SECURITY: 認証なしの署名付きURL発行では扱わないバケット。
+// 透かし入りダウンロードプロキシ、または権限を確認したAPIからのみ配信する
+var restrictedStorageBuckets = map[string]bool{
+	contractDocumentsBucket: true,
+	messageImagesBucket:     true,
+	dataRoomFilesBucket:     true,
+	revenueReportsBucket:    true,
+}
+
 // GetSignedURLs 複数の署名付きURLを取得
 func (s *Server) GetSignedURLs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -210,6 +224,11 @@ func (s *Server) GetSignedURLs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if restrictedStorageBuckets[req.Bucket] {
+		response.Error(w, http.StatusForbidden, "Files in this bucket cannot be accessed by signed URL")
+		return
+	}
+
 	if req.ExpiresIn == 0 {
 		req.ExpiresIn = 3600 // 1時間
 	}
@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/services"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+const (
+	// PostgRESTの1リクエストあたりの上限行数に合わせてページングする
+	threadExportPageSize = 1000
+	// ZIPに含めるファイルの合計サイズの上限（メモリ上で組み立てるため）
+	maxThreadExportBytes = 200 << 20
+)
+
+// threadExportContract is a row of thread_contract_documents for the export
+type threadExportContract struct {
+	ID           string  `json:"id"`
+	ContractType string  `json:"contract_type"`
+	FilePath     string  `json:"file_path"`
+	FileName     string  `json:"file_name"`
+	ContentType  *string `json:"content_type"`
+	UploadedBy   string  `json:"uploaded_by"`
+	DocumentHash *string `json:"document_hash"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+// threadExportSignature is a row of contract_signatures for the export
+type threadExportSignature struct {
+	ContractID    string `json:"contract_id"`
+	UserID        string `json:"user_id"`
+	SignatureData string `json:"signature_data"`
+	SignedAt      string `json:"signed_at"`
+}
+
+// ExportThread exports the full record of a thread for the participants: a PDF transcript, or a ZIP archive
+// with the transcript, message attachments, contract documents, signature records and SHA-256 checksums.
+// Files are watermarked like the download proxy; the export is recorded once in file_access_logs
+// and its trace ID is embedded in every watermark.
+// GET /api/threads/:id/export?format=pdf|zip&lang=ja|en
+func (s *Server) ExportThread(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodGet) {
+		return
+	}
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	threadID := strings.TrimPrefix(r.URL.Path, "/api/threads/")
+	threadID = strings.Trim(strings.TrimSuffix(threadID, "/export"), "/")
+	if threadID == "" {
+		response.Error(w, http.StatusBadRequest, "Thread ID required")
+		return
+	}
+
+	query := r.URL.Query()
+	format := models.ThreadExportFormat(query.Get("format"))
+	if format == "" {
+		format = models.ThreadExportPDF
+	}
+	if format != models.ThreadExportPDF && format != models.ThreadExportZIP {
+		response.Error(w, http.StatusBadRequest, "format must be pdf or zip")
+		return
+	}
+	language := query.Get("lang")
+	if language == "" {
+		language = "ja"
+	}
+	if language != "ja" && language != "en" {
+		response.Error(w, http.StatusBadRequest, "lang must be ja or en")
+		return
+	}
+
+	// 🔒 SECURITY: 参加者を確認してから service role で全件を取得する
+	serviceClient := s.supabase.GetServiceClient()
+	participants, err := s.threadParticipantRoles(serviceClient, threadID)
+	if err != nil {
+		log.Printf("[ExportThread] Failed to query participants of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query thread")
+		return
+	}
+	roles := make(map[string]models.ThreadRole, len(participants))
+	for _, p := range participants {
+		roles[p.UserID] = models.ThreadRole(p.Role)
+	}
+	if _, ok := roles[userID]; !ok {
+		response.Error(w, http.StatusForbidden, "You are not a participant of this thread")
+		return
+	}
+
+	var threads []threadRow
+	_, err = serviceClient.From("threads").
+		Select(threadSelectColumns, "", false).
+		Eq("id", threadID).
+		ExecuteTo(&threads)
+	if err != nil || len(threads) == 0 {
+		log.Printf("[ExportThread] Failed to query thread %s: %v", threadID, err)
+		response.Error(w, http.StatusNotFound, "Thread not found")
+		return
+	}
+	thread := threadFromRow(threads[0])
+
+	messages, err := s.fetchThreadExportMessages(serviceClient, threadID)
+	if err != nil {
+		log.Printf("[ExportThread] Failed to query messages of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query messages")
+		return
+	}
+	attachments, err := s.fetchThreadExportAttachments(serviceClient, messages)
+	if err != nil {
+		log.Printf("[ExportThread] Failed to query attachments of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query attachments")
+		return
+	}
+
+	var contracts []threadExportContract
+	_, err = serviceClient.From("thread_contract_documents").
+		Select("id, contract_type, file_path, file_name, content_type, uploaded_by, document_hash, created_at", "", false).
+		Eq("thread_id", threadID).
+		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&contracts)
+	if err != nil {
+		log.Printf("[ExportThread] Failed to query contract documents of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query contract documents")
+		return
+	}
+	var signatures []threadExportSignature
+	if len(contracts) > 0 {
+		contractIDs := make([]string, 0, len(contracts))
+		for _, c := range contracts {
+			contractIDs = append(contractIDs, c.ID)
+		}
+		_, err = serviceClient.From("contract_signatures").
+			Select("contract_id, user_id, signature_data, signed_at", "", false).
+			In("contract_id", contractIDs).
+			Order("signed_at", &postgrest.OrderOpts{Ascending: true}).
+			ExecuteTo(&signatures)
+		if err != nil {
+			log.Printf("[ExportThread] Failed to query signatures of thread %s: %v", threadID, err)
+			response.Error(w, http.StatusInternalServerError, "Failed to query signatures")
+			return
+		}
+	}
+
+	userIDs := []string{userID}
+	for _, p := range participants {
+		userIDs = append(userIDs, p.UserID)
+	}
+	for _, m := range messages {
+		userIDs = append(userIDs, m.SenderUserID)
+	}
+	for _, c := range contracts {
+		userIDs = append(userIDs, c.UploadedBy)
+	}
+	for _, sig := range signatures {
+		userIDs = append(userIDs, sig.UserID)
+	}
+	names := s.fetchDisplayNames(serviceClient, userIDs...)
+
+	// 🔒 SECURITY: 記録できない出力は行わない。ログのIDを透かしに入れて流出元を特定できるようにする
+	traceID, err := s.recordFileAccess(r, models.ProtectedFileThreadExport, threadID, threadID, userID, models.FileAccessDownload)
+	if err != nil {
+		log.Printf("[ExportThread] ❌ Failed to record export of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to record access")
+		return
+	}
+	now := time.Now().UTC()
+	watermark := services.Watermark{
+		ViewerName: names[userID],
+		UserID:     userID,
+		Timestamp:  now,
+		TraceID:    traceID,
+	}
+
+	transcript := services.ThreadTranscript{
+		ThreadID:   thread.ID,
+		ThreadType: thread.ThreadType,
+		Language:   language,
+		ExportedBy: names[userID],
+		ExportedAt: now,
+	}
+	if thread.RelatedPostID != nil {
+		transcript.RelatedPostID = *thread.RelatedPostID
+	}
+	for _, p := range participants {
+		transcript.Participants = append(transcript.Participants, services.TranscriptParticipant{
+			UserID:   p.UserID,
+			Name:     names[p.UserID],
+			Role:     models.ThreadRole(p.Role),
+			JoinedAt: parseOptionalTime(p.JoinedAt),
+		})
+	}
+
+	var entries []services.ThreadArchiveEntry
+	totalBytes := 0
+	// addFile watermarks a stored file and adds it to the archive. Returns the path in the archive.
+	addFile := func(kind, sourceID, bucket, filePath, archivePath, contentType string, footerOnly bool) (string, error) {
+		data, err := s.supabase.DownloadFile(bucket, filePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to download %s/%s: %w", bucket, filePath, err)
+		}
+		totalBytes += len(data)
+		if totalBytes > maxThreadExportBytes {
+			return "", errThreadExportTooLarge
+		}
+		originalSum := sha256Hex(data)
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+			if contentType == "application/octet-stream" {
+				if byExt := mime.TypeByExtension(filepath.Ext(archivePath)); byExt != "" {
+					contentType = byExt
+				}
+			}
+		}
+		contentType = strings.Split(contentType, ";")[0]
+
+		watermarked := false
+		if services.WatermarkSupported(contentType) {
+			mark := watermark
+			mark.FooterOnly = footerOnly
+			stamped, stampedType, err := services.ApplyWatermark(s.config.SupabaseJWTSecret, contentType, data, mark)
+			if err != nil {
+				// 🔒 SECURITY: 透かしを入れられない場合は原本を出力しない
+				return "", fmt.Errorf("failed to watermark %s: %w", archivePath, err)
+			}
+			if stampedType != contentType {
+				archivePath = strings.TrimSuffix(archivePath, filepath.Ext(archivePath)) + ".png"
+			}
+			data, watermarked = stamped, true
+		}
+		entries = append(entries, services.ThreadArchiveEntry{
+			File: models.ThreadExportFile{
+				Path:           archivePath,
+				Kind:           kind,
+				SourceID:       sourceID,
+				OriginalSHA256: originalSum,
+				Watermarked:    watermarked,
+			},
+			Data: data,
+		})
+		return archivePath, nil
+	}
+
+	for _, m := range messages {
+		item := services.TranscriptMessage{
+			ID:         m.ID,
+			SenderName: names[m.SenderUserID],
+			SenderRole: roles[m.SenderUserID],
+			Type:       m.Type,
+			Text:       ndaStringValue(m.Text),
+			CreatedAt:  m.CreatedAt,
+			EditedAt:   m.EditedAt,
+			DeletedAt:  m.DeletedAt,
+		}
+		// 削除済みメッセージの添付は出力しない（原本は運営の履歴確認用に残る）
+		if fileURL, ok := attachments[m.ID]; ok && m.DeletedAt == nil {
+			item.Attachment = path.Base(fileURL)
+			switch {
+			case isExternalURL(fileURL):
+				item.Attachment = fileURL
+			case format == models.ThreadExportZIP:
+				archivePath := fmt.Sprintf("messages/%s_%s%s", m.CreatedAt.In(analyticsLocation).Format("20060102-150405"), m.ID, path.Ext(fileURL))
+				bucket := messageAttachmentBucket(m.Type)
+				item.Attachment, err = addFile("message_attachment", m.ID, bucket, fileURL, archivePath, "", bucket == messageImagesBucket)
+				if s.handleThreadExportError(w, threadID, err) {
+					return
+				}
+			}
+		}
+		transcript.Messages = append(transcript.Messages, item)
+	}
+
+	contractPaths := make(map[string]string, len(contracts))
+	for _, c := range contracts {
+		item := services.TranscriptContract{
+			ID:           c.ID,
+			ContractType: c.ContractType,
+			FileName:     c.FileName,
+			UploadedBy:   names[c.UploadedBy],
+			CreatedAt:    parseTime(c.CreatedAt),
+			DocumentHash: ndaStringValue(c.DocumentHash),
+		}
+		for _, sig := range signatures {
+			if sig.ContractID == c.ID {
+				item.Signatures = append(item.Signatures, services.TranscriptSignature{Name: names[sig.UserID], SignedAt: parseTime(sig.SignedAt)})
+			}
+		}
+		if format == models.ThreadExportZIP {
+			fileName := strings.ReplaceAll(path.Base(c.FileName), "\\", "_")
+			archivePath, err := addFile("contract_document", c.ID, contractDocumentsBucket, c.FilePath, fmt.Sprintf("contracts/%s/%s", c.ID, fileName), ndaStringValue(c.ContentType), false)
+			if s.handleThreadExportError(w, threadID, err) {
+				return
+			}
+			contractPaths[c.ID] = archivePath
+			// 生成した契約書以外は保存時のハッシュがないため、原本から計算した値を記載する
+			if item.DocumentHash == "" {
+				item.DocumentHash = entries[len(entries)-1].File.OriginalSHA256
+			}
+		}
+		transcript.Contracts = append(transcript.Contracts, item)
+	}
+
+	transcriptPDF, _, err := services.ApplyWatermark(s.config.SupabaseJWTSecret, "application/pdf", services.RenderThreadTranscriptPDF(transcript), watermark)
+	if err != nil {
+		log.Printf("[ExportThread] ❌ Failed to watermark transcript of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to prepare export")
+		return
+	}
+	baseName := fmt.Sprintf("thread_%s_%s", thread.ID, now.In(analyticsLocation).Format("20060102"))
+
+	if format == models.ThreadExportPDF {
+		writeThreadExport(w, "application/pdf", baseName+".pdf", transcriptPDF)
+		log.Printf("[ExportThread] ✓ Exported transcript of thread %s for %s (trace %s)", threadID, userID, traceID)
+		return
+	}
+
+	records := make([]models.ThreadExportSignature, 0, len(signatures))
+	for _, sig := range signatures {
+		record := models.ThreadExportSignature{
+			ContractID:      sig.ContractID,
+			ContractFile:    contractPaths[sig.ContractID],
+			UserID:          sig.UserID,
+			DisplayName:     names[sig.UserID],
+			SignedAt:        parseTime(sig.SignedAt),
+			SignatureData:   sig.SignatureData,
+			SignatureSHA256: sha256Hex([]byte(sig.SignatureData)),
+		}
+		for _, c := range transcript.Contracts {
+			if c.ID == sig.ContractID {
+				record.DocumentHash = c.DocumentHash
+			}
+		}
+		records = append(records, record)
+	}
+	signaturesJSON, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		log.Printf("[ExportThread] Failed to encode signatures of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to prepare export")
+		return
+	}
+
+	entries = append([]services.ThreadArchiveEntry{
+		{File: models.ThreadExportFile{Path: "transcript.pdf", Kind: "transcript", Watermarked: true}, Data: transcriptPDF},
+		{File: models.ThreadExportFile{Path: "signatures.json", Kind: "signatures"}, Data: signaturesJSON},
+	}, entries...)
+	archive, err := services.BuildThreadArchive(models.ThreadExportManifest{
+		ThreadID:   thread.ID,
+		ThreadType: thread.ThreadType,
+		ExportedBy: userID,
+		ExportedAt: now,
+		TraceID:    traceID,
+	}, entries)
+	if err != nil {
+		log.Printf("[ExportThread] ❌ Failed to build archive of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to prepare export")
+		return
+	}
+
+	writeThreadExport(w, "application/zip", baseName+".zip", archive)
+	log.Printf("[ExportThread] ✓ Exported archive of thread %s for %s (%d files, trace %s)", threadID, userID, len(entries), traceID)
+}
+
+// errThreadExportTooLarge is returned when the files of a thread exceed maxThreadExportBytes
+var errThreadExportTooLarge = fmt.Errorf("thread export exceeds %d bytes", maxThreadExportBytes)
+
+// handleThreadExportError writes the response for an error while adding a file to the archive.
+// Returns true if an error was handled.
+func (s *Server) handleThreadExportError(w http.ResponseWriter, threadID string, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case err == errThreadExportTooLarge:
+		response.Error(w, http.StatusRequestEntityTooLarge, "The files of this thread are too large to export as an archive")
+	default:
+		log.Printf("[ExportThread] ❌ Failed to export a file of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to prepare export")
+	}
+	return true
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fetchThreadExportMessages returns all messages of a thread, oldest first
+func (s *Server) fetchThreadExportMessages(client *supabase.Client, threadID string) ([]models.Message, error) {
+	var messages []models.Message
+	for offset := 0; ; offset += threadExportPageSize {
+		var rows []messageRow
+		_, err := client.From("messages").
+			Select(messageSelectColumns, "", false).
+			Eq("thread_id", threadID).
+			Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+			Order("id", &postgrest.OrderOpts{Ascending: true}).
+			Range(offset, offset+threadExportPageSize-1, "").
+			ExecuteTo(&rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			messages = append(messages, messageFromRow(row))
+		}
+		if len(rows) < threadExportPageSize {
+			return messages, nil
+		}
+	}
+}
+
+// fetchThreadExportAttachments returns the attachment path of each message (message ID → file_url)
+func (s *Server) fetchThreadExportAttachments(client *supabase.Client, messages []models.Message) (map[string]string, error) {
+	attachments := make(map[string]string)
+	ids := make([]string, 0, len(messages))
+	for _, m := range messages {
+		if m.Type != models.MessageTypeText {
+			ids = append(ids, m.ID)
+		}
+	}
+	// URLの長さの上限を超えないように分けて取得する
+	for start := 0; start < len(ids); start += 100 {
+		var rows []struct {
+			MessageID string `json:"message_id"`
+			FileURL   string `json:"file_url"`
+		}
+		_, err := client.From("message_attachments").
+			Select("message_id, file_url", "", false).
+			In("message_id", ids[start:min(start+100, len(ids))]).
+			ExecuteTo(&rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			attachments[row.MessageID] = row.FileURL
+		}
+	}
+	return attachments, nil
+}
+
+// writeThreadExport sends an export file as a download
+func writeThreadExport(w http.ResponseWriter, contentType, fileName string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(fileName))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
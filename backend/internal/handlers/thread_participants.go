@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+// threadParticipantRoleRow is a row of thread_participants with the role
+type threadParticipantRoleRow struct {
+	ThreadID  string  `json:"thread_id"`
+	UserID    string  `json:"user_id"`
+	Role      string  `json:"role"`
+	InvitedBy *string `json:"invited_by"`
+	JoinedAt  *string `json:"joined_at"`
+}
+
+// threadParticipantRoles returns the participants of a thread with their roles
+func (s *Server) threadParticipantRoles(client *supabase.Client, threadID string) ([]threadParticipantRoleRow, error) {
+	var rows []threadParticipantRoleRow
+	_, err := client.From("thread_participants").
+		Select("thread_id, user_id, role, invited_by, joined_at", "", false).
+		Eq("thread_id", threadID).
+		ExecuteTo(&rows)
+	return rows, err
+}
+
+// threadRoleOf returns the role of the user in the thread ("" if not a participant)
+func (s *Server) threadRoleOf(threadID string, userID string) (models.ThreadRole, error) {
+	rows, err := s.threadParticipantRoles(s.supabase.GetServiceClient(), threadID)
+	if err != nil {
+		return "", err
+	}
+	for _, row := range rows {
+		if row.UserID == userID {
+			return models.ThreadRole(row.Role), nil
+		}
+	}
+	return "", nil
+}
+
+// requireThreadPermission checks that the user participates in the thread with a role allowed the action.
+// Writes the error response and returns false otherwise.
+func (s *Server) requireThreadPermission(w http.ResponseWriter, handler string, threadID string, userID string, permission models.ThreadPermission) (models.ThreadRole, bool) {
+	role, err := s.threadRoleOf(threadID, userID)
+	if err != nil {
+		log.Printf("[%s] Failed to query participant role in thread %s: %v", handler, threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to verify thread participants")
+		return "", false
+	}
+	if role == "" {
+		log.Printf("[%s] User %s is not a participant of thread %s", handler, userID, threadID)
+		response.Error(w, http.StatusForbidden, "You are not a participant of this thread")
+		return "", false
+	}
+	if !role.Can(permission) {
+		log.Printf("[%s] ❌ Role %s of user %s cannot %s in thread %s", handler, role, userID, permission, threadID)
+		response.Error(w, http.StatusForbidden, fmt.Sprintf("Participants with the %s role cannot %s", role, strings.ReplaceAll(string(permission), "_", " ")))
+		return "", false
+	}
+	return role, true
+}
+
+// canManageThreadRole reports whether a participant with actorRole may invite or remove a participant with role.
+// 売り手（案件のオーナー）はアドバイザー全員、買い手は自分側のアドバイザー、運営はアドバイザーと運営を管理できる。
+// 売り手・買い手そのものは追加・削除できない（売却リクエストの当事者のため）
+func canManageThreadRole(actorRole models.ThreadRole, role models.ThreadRole) bool {
+	if !actorRole.Can(models.ThreadPermissionInviteParticipants) {
+		return false
+	}
+	switch role {
+	case models.ThreadRoleSellerAdvisor:
+		return actorRole == models.ThreadRoleSeller || actorRole == models.ThreadRoleOperator
+	case models.ThreadRoleBuyerAdvisor:
+		return actorRole == models.ThreadRoleSeller || actorRole == models.ThreadRoleBuyer || actorRole == models.ThreadRoleOperator
+	case models.ThreadRoleOperator:
+		return actorRole == models.ThreadRoleOperator
+	}
+	return false
+}
+
+// HandleThreadParticipants routes /api/threads/:id/participants[/:userId] requests
+func (s *Server) HandleThreadParticipants(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/threads/"), "/")
+	threadID, participantID, _ := strings.Cut(rest, "/participants")
+	participantID = strings.Trim(participantID, "/")
+	if threadID == "" {
+		response.Error(w, http.StatusBadRequest, "Thread ID required")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && participantID == "":
+		s.GetThreadParticipants(w, r, threadID)
+	case r.Method == http.MethodPost && participantID == "":
+		s.AddThreadParticipant(w, r, threadID)
+	case r.Method == http.MethodDelete && participantID != "":
+		s.RemoveThreadParticipant(w, r, threadID, participantID)
+	default:
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// GetThreadParticipants returns the participants of a thread with their roles and permissions
+// GET /api/threads/:id/participants
+func (s *Server) GetThreadParticipants(w http.ResponseWriter, r *http.Request, threadID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	rows, err := s.threadParticipantRoles(serviceClient, threadID)
+	if err != nil {
+		log.Printf("[GetThreadParticipants] Failed to query participants of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query participants")
+		return
+	}
+	isParticipant := false
+	for _, row := range rows {
+		if row.UserID == userID {
+			isParticipant = true
+			break
+		}
+	}
+	if !isParticipant {
+		response.Error(w, http.StatusForbidden, "You are not a participant of this thread")
+		return
+	}
+
+	userIDs := make([]string, len(rows))
+	for i, row := range rows {
+		userIDs[i] = row.UserID
+	}
+	var profiles []profileRowSimple
+	profileMap := make(map[string]profileRowSimple)
+	if _, err := serviceClient.From("profiles").
+		Select("id, display_name, icon_url", "", false).
+		In("id", userIDs).
+		ExecuteTo(&profiles); err != nil {
+		log.Printf("[GetThreadParticipants] ⚠️ Failed to query profiles: %v", err)
+	}
+	for _, p := range profiles {
+		profileMap[p.ID] = p
+	}
+
+	participants := make([]models.ThreadParticipantWithRole, 0, len(rows))
+	for _, row := range rows {
+		role := models.ThreadRole(row.Role)
+		participants = append(participants, models.ThreadParticipantWithRole{
+			ThreadID:    row.ThreadID,
+			UserID:      row.UserID,
+			Role:        role,
+			DisplayName: profileMap[row.UserID].DisplayName,
+			IconURL:     profileMap[row.UserID].IconURL,
+			InvitedBy:   row.InvitedBy,
+			JoinedAt:    parseOptionalTime(row.JoinedAt),
+			Permissions: role.Permissions(),
+		})
+	}
+	response.Success(w, http.StatusOK, participants)
+}
+
+// AddThreadParticipant invites an advisor or an operator to a thread.
+// Advisors must have an advisor profile; operators must be in the operators table.
+// POST /api/threads/:id/participants
+func (s *Server) AddThreadParticipant(w http.ResponseWriter, r *http.Request, threadID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.AddThreadParticipantRequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	actorRole, ok := s.requireThreadPermission(w, "AddThreadParticipant", threadID, userID, models.ThreadPermissionInviteParticipants)
+	if !ok {
+		return
+	}
+	if !canManageThreadRole(actorRole, req.Role) {
+		response.Error(w, http.StatusForbidden, fmt.Sprintf("A %s cannot invite a %s", actorRole, req.Role))
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	existingRole, err := s.threadRoleOf(threadID, req.UserID)
+	if err != nil {
+		log.Printf("[AddThreadParticipant] Failed to query participants of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query participants")
+		return
+	}
+	if existingRole != "" {
+		response.Error(w, http.StatusConflict, fmt.Sprintf("The user already participates as %s", existingRole))
+		return
+	}
+
+	// 招待される側の資格を確認（アドバイザー登録・運営）
+	if req.Role == models.ThreadRoleOperator {
+		if !s.isOperator(serviceClient, req.UserID) {
+			response.Error(w, http.StatusBadRequest, "The user is not an operator")
+			return
+		}
+	} else {
+		var advisorProfiles []struct {
+			ID string `json:"id"`
+		}
+		_, err = serviceClient.From("profiles").
+			Select("id", "", false).
+			Eq("id", req.UserID).
+			Eq("role", "advisor").
+			ExecuteTo(&advisorProfiles)
+		if err != nil {
+			log.Printf("[AddThreadParticipant] Failed to query advisor profile of %s: %v", req.UserID, err)
+			response.Error(w, http.StatusInternalServerError, "Failed to verify the user")
+			return
+		}
+		if len(advisorProfiles) == 0 {
+			response.Error(w, http.StatusBadRequest, "The user is not registered as an advisor")
+			return
+		}
+	}
+
+	type participantRoleInsert struct {
+		ThreadID  string `json:"thread_id"`
+		UserID    string `json:"user_id"`
+		Role      string `json:"role"`
+		InvitedBy string `json:"invited_by"`
+	}
+	// 🔒 SECURITY: 招待の権限は上で確認済み。他ユーザーの行を作成するため service role で追加する
+	_, _, err = serviceClient.From("thread_participants").
+		Insert(participantRoleInsert{ThreadID: threadID, UserID: req.UserID, Role: string(req.Role), InvitedBy: userID}, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		log.Printf("[AddThreadParticipant] ❌ Failed to add %s to thread %s: %v", req.UserID, threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to add participant")
+		return
+	}
+
+	link := fmt.Sprintf("/messages/%s", threadID)
+	resourceType := "thread"
+	s.createNotifications([]notificationInsert{{
+		UserID:       req.UserID,
+		Type:         models.NotificationTypeThreadInvited,
+		Title:        "スレッドに招待されました",
+		Link:         &link,
+		ActorUserID:  &userID,
+		ResourceType: &resourceType,
+		ResourceID:   &threadID,
+		Data:         map[string]interface{}{"role": req.Role},
+	}})
+	s.publishThreadEvent("AddThreadParticipant", threadID, "", models.RealtimeEventParticipantsUpdated, models.RealtimeParticipantsUpdated{
+		UserID: req.UserID,
+		Role:   req.Role,
+		Action: "added",
+	})
+
+	log.Printf("[AddThreadParticipant] ✓ %s added %s to thread %s as %s", userID, req.UserID, threadID, req.Role)
+	response.Success(w, http.StatusCreated, models.ThreadParticipantWithRole{
+		ThreadID:    threadID,
+		UserID:      req.UserID,
+		Role:        req.Role,
+		DisplayName: s.fetchDisplayNames(serviceClient, req.UserID)[req.UserID],
+		InvitedBy:   &userID,
+		Permissions: req.Role.Permissions(),
+	})
+}
+
+// RemoveThreadParticipant removes an advisor or an operator from a thread. Advisors and operators can leave by themselves.
+// DELETE /api/threads/:id/participants/:userId
+func (s *Server) RemoveThreadParticipant(w http.ResponseWriter, r *http.Request, threadID string, participantID string) {
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	actorRole, err := s.threadRoleOf(threadID, userID)
+	if err != nil {
+		log.Printf("[RemoveThreadParticipant] Failed to query participants of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query participants")
+		return
+	}
+	if actorRole == "" {
+		response.Error(w, http.StatusForbidden, "You are not a participant of this thread")
+		return
+	}
+	role, err := s.threadRoleOf(threadID, participantID)
+	if err != nil {
+		log.Printf("[RemoveThreadParticipant] Failed to query participants of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query participants")
+		return
+	}
+	if role == "" {
+		response.Error(w, http.StatusNotFound, "Participant not found")
+		return
+	}
+
+	leaving := participantID == userID && role != models.ThreadRoleSeller && role != models.ThreadRoleBuyer
+	if !leaving && !canManageThreadRole(actorRole, role) {
+		response.Error(w, http.StatusForbidden, fmt.Sprintf("A %s cannot remove a %s", actorRole, role))
+		return
+	}
+
+	_, _, err = s.supabase.GetServiceClient().From("thread_participants").
+		Delete("minimal", "").
+		Eq("thread_id", threadID).
+		Eq("user_id", participantID).
+		Execute()
+	if err != nil {
+		log.Printf("[RemoveThreadParticipant] ❌ Failed to remove %s from thread %s: %v", participantID, threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to remove participant")
+		return
+	}
+
+	event := models.RealtimeParticipantsUpdated{UserID: participantID, Role: role, Action: "removed"}
+	s.publishThreadEvent("RemoveThreadParticipant", threadID, "", models.RealtimeEventParticipantsUpdated, event)
+	// 削除された本人の画面からもスレッドを閉じられるよう通知する
+	s.publishRealtimeEvent("RemoveThreadParticipant", []string{participantID}, models.RealtimeEventParticipantsUpdated, threadID, event)
+
+	log.Printf("[RemoveThreadParticipant] ✓ %s removed %s (%s) from thread %s", userID, participantID, role, threadID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+// inboxThreadRow is a row of the inbox_threads RPC
+type inboxThreadRow struct {
+	ThreadID       string   `json:"thread_id"`
+	ArchivedAt     *string  `json:"archived_at"`
+	Muted          bool     `json:"muted"`
+	PinnedAt       *string  `json:"pinned_at"`
+	Labels         []string `json:"labels"`
+	UnreadCount    int      `json:"unread_count"`
+	LastActivityAt string   `json:"last_activity_at"`
+}
+
+func (row inboxThreadRow) state() models.ThreadUserState {
+	labels := row.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	return models.ThreadUserState{
+		Archived: row.ArchivedAt != nil,
+		Muted:    row.Muted,
+		Pinned:   row.PinnedAt != nil,
+		Labels:   labels,
+	}
+}
+
+// threadUserStateRow is a row of thread_user_states
+type threadUserStateRow struct {
+	ThreadID   string   `json:"thread_id"`
+	UserID     string   `json:"user_id"`
+	ArchivedAt *string  `json:"archived_at"`
+	Muted      bool     `json:"muted"`
+	PinnedAt   *string  `json:"pinned_at"`
+	Labels     []string `json:"labels"`
+	UpdatedAt  string   `json:"updated_at"`
+}
+
+// UpdateThreadState archives, mutes, pins or labels a thread for the user only.
+// Archived threads come back to the inbox when a new message arrives, unless muted.
+// PUT /api/threads/:id/state
+func (s *Server) UpdateThreadState(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodPut) {
+		return
+	}
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	threadID := strings.TrimPrefix(r.URL.Path, "/api/threads/")
+	threadID = strings.Trim(strings.TrimSuffix(threadID, "/state"), "/")
+	if threadID == "" {
+		response.Error(w, http.StatusBadRequest, "Thread ID required")
+		return
+	}
+
+	var req models.UpdateThreadStateRequest
+	if !utils.DecodeAndValidate(r, w, &req) {
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	var threads []threadRow
+	_, err := serviceClient.From("threads").
+		Select(threadSelectColumns, "", false).
+		Eq("id", threadID).
+		ExecuteTo(&threads)
+	if err != nil {
+		log.Printf("[UpdateThreadState] Failed to query thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query thread")
+		return
+	}
+	participantIDs, err := s.threadParticipantIDs(serviceClient, threadID)
+	if err != nil {
+		log.Printf("[UpdateThreadState] Failed to query participants of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query thread")
+		return
+	}
+	// 🔒 SECURITY: 参加していないスレッドは存在も明かさない（作成者は thread_participants にない場合も参加者）
+	if len(threads) == 0 || (threads[0].CreatedBy != userID && !containsString(participantIDs, userID)) {
+		response.Error(w, http.StatusNotFound, "Thread not found")
+		return
+	}
+
+	var existing []threadUserStateRow
+	_, err = serviceClient.From("thread_user_states").
+		Select("thread_id, user_id, archived_at, muted, pinned_at, labels, updated_at", "", false).
+		Eq("thread_id", threadID).
+		Eq("user_id", userID).
+		ExecuteTo(&existing)
+	if err != nil {
+		log.Printf("[UpdateThreadState] Failed to query state of thread %s: %v", threadID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query thread state")
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	state := threadUserStateRow{ThreadID: threadID, UserID: userID, Labels: []string{}}
+	if len(existing) > 0 {
+		state = existing[0]
+	}
+	if req.Archived != nil {
+		state.ArchivedAt = nil
+		if *req.Archived {
+			state.ArchivedAt = &now
+		}
+	}
+	if req.Muted != nil {
+		state.Muted = *req.Muted
+	}
+	if req.Pinned != nil {
+		state.PinnedAt = nil
+		if *req.Pinned {
+			state.PinnedAt = &now
+		}
+	}
+	if req.Labels != nil {
+		state.Labels = normalizeThreadLabels(*req.Labels)
+	}
+	if state.Labels == nil {
+		state.Labels = []string{}
+	}
+	state.UpdatedAt = now
+
+	_, _, err = serviceClient.From("thread_user_states").
+		Upsert(state, "thread_id,user_id", "", "").
+		Execute()
+	if err != nil {
+		log.Printf("[UpdateThreadState] ❌ Failed to save state of thread %s for %s: %v", threadID, userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to update thread state")
+		return
+	}
+
+	result := inboxThreadRow{ArchivedAt: state.ArchivedAt, Muted: state.Muted, PinnedAt: state.PinnedAt, Labels: state.Labels}.state()
+	log.Printf("[UpdateThreadState] ✓ Thread %s state updated for %s (archived=%v muted=%v pinned=%v labels=%d)",
+		threadID, userID, result.Archived, result.Muted, result.Pinned, len(result.Labels))
+	response.Success(w, http.StatusOK, result)
+}
+
+// GetInboxCounts returns the number of threads in each inbox view
+// GET /api/threads/counts
+func (s *Server) GetInboxCounts(w http.ResponseWriter, r *http.Request) {
+	if !utils.RequireMethod(r, w, http.MethodGet) {
+		return
+	}
+	userID, ok := utils.RequireUserID(r, w)
+	if !ok {
+		return
+	}
+
+	var rows []models.InboxCounts
+	if err := s.supabase.CallRPC("inbox_counts", map[string]interface{}{"p_user_id": userID}, &rows); err != nil {
+		log.Printf("[GetInboxCounts] Failed to count threads for %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to count threads")
+		return
+	}
+
+	counts := models.InboxCounts{}
+	if len(rows) > 0 {
+		counts = rows[0]
+	}
+	response.Success(w, http.StatusOK, counts)
+}
+
+// normalizeThreadLabels trims labels and removes empty and duplicate ones, keeping the order
+func normalizeThreadLabels(labels []string) []string {
+	result := make([]string, 0, len(labels))
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label != "" && !containsString(result, label) {
+			result = append(result, label)
+		}
+	}
+	return result
+}
@@ -26,6 +26,13 @@ func (s *Server) GetUsers(w http.ResponseWriter, r *http.Request) {
 
 // HandleUserByIDRoute handles user profile by ID (public)
 func (s *Server) HandleUserByIDRoute(w http.ResponseWriter, r *http.Request) {
+	// /api/users/:id/structured-data (public JSON-LD)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) >= 4 && parts[3] == "structured-data" {
+		s.GetUserStructuredData(w, r)
+		return
+	}
+
 	if r.Method == http.MethodGet {
 		s.GetUserByID(w, r)
 	} else {
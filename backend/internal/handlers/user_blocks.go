@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	supabase "github.com/supabase-community/supabase-go"
+	"github.com/yourusername/appexit-backend/internal/models"
+	"github.com/yourusername/appexit-backend/internal/utils"
+	"github.com/yourusername/appexit-backend/pkg/response"
+)
+
+// userBlockRow is a row of user_blocks
+type userBlockRow struct {
+	BlockerID string `json:"blocker_id"`
+	BlockedID string `json:"blocked_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// userBlocks are the blocks a user is involved in
+type userBlocks struct {
+	blocking  map[string]bool // 自分がブロックした利用者
+	blockedBy map[string]bool // 自分をブロックした利用者
+}
+
+// between reports whether either user blocked the other
+func (b userBlocks) between(otherID string) bool {
+	return b.blocking[otherID] || b.blockedBy[otherID]
+}
+
+// userIDs returns the users on either side of a block
+func (b userBlocks) userIDs() []string {
+	ids := make([]string, 0, len(b.blocking)+len(b.blockedBy))
+	for id := range b.blocking {
+		ids = append(ids, id)
+	}
+	for id := range b.blockedBy {
+		if !b.blocking[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// fetchUserBlocks returns the blocks of a user in both directions.
+// 🔒 SECURITY: 相手からのブロックはRLSで参照できないため service role で取得する（相手の一覧は返さない）
+func (s *Server) fetchUserBlocks(userID string) (userBlocks, error) {
+	blocks := userBlocks{blocking: map[string]bool{}, blockedBy: map[string]bool{}}
+	var rows []userBlockRow
+	_, err := s.supabase.GetServiceClient().From("user_blocks").
+		Select("blocker_id, blocked_id, created_at", "", false).
+		Or(fmt.Sprintf("blocker_id.eq.%s,blocked_id.eq.%s", userID, userID), "").
+		ExecuteTo(&rows)
+	if err != nil {
+		return blocks, err
+	}
+	for _, row := range rows {
+		if row.BlockerID == userID {
+			blocks.blocking[row.BlockedID] = true
+		} else {
+			blocks.blockedBy[row.BlockerID] = true
+		}
+	}
+	return blocks, nil
+}
+
+// blockedAmong reports whether the user and any of the other users blocked each other
+func (s *Server) blockedAmong(userID string, otherIDs []string) (bool, error) {
+	if len(otherIDs) == 0 {
+		return false, nil
+	}
+	blocks, err := s.fetchUserBlocks(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range otherIDs {
+		if id != userID && blocks.between(id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// usersBlockedBy returns the users the viewer blocked (used to hide their comments from the viewer).
+// 取得に失敗した場合は何も隠さない
+func (s *Server) usersBlockedBy(client *supabase.Client, userID string) map[string]bool {
+	blocked := make(map[string]bool)
+	if userID == "" {
+		return blocked
+	}
+	var rows []userBlockRow
+	_, err := client.From("user_blocks").
+		Select("blocker_id, blocked_id, created_at", "", false).
+		Eq("blocker_id", userID).
+		ExecuteTo(&rows)
+	if err != nil {
+		log.Printf("[usersBlockedBy] ⚠️ Failed to query blocks of %s: %v", userID, err)
+		return blocked
+	}
+	for _, row := range rows {
+		blocked[row.BlockedID] = true
+	}
+	return blocked
+}
+
+// HandleBlocks routes /api/blocks requests
+func (s *Server) HandleBlocks(w http.ResponseWriter, r *http.Request) {
+	blockedID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/blocks"), "/")
+	switch {
+	case blockedID == "" && r.Method == http.MethodGet:
+		s.ListBlockedUsers(w, r)
+	case blockedID == "" && r.Method == http.MethodPost:
+		s.BlockUser(w, r)
+	case blockedID != "" && r.Method == http.MethodDelete:
+		s.UnblockUser(w, r, blockedID)
+	default:
+		response.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// ListBlockedUsers returns the users blocked by the authenticated user, newest first
+// GET /api/blocks
+func (s *Server) ListBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+	var rows []userBlockRow
+	_, err := client.From("user_blocks").
+		Select("blocker_id, blocked_id, created_at", "", false).
+		Eq("blocker_id", userID).
+		Order("created_at", nil).
+		ExecuteTo(&rows)
+	if err != nil {
+		log.Printf("[ListBlockedUsers] Failed to query blocks of %s: %v", userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to query blocked users")
+		return
+	}
+
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.BlockedID)
+	}
+	names := s.fetchDisplayNames(client, ids...)
+
+	users := make([]models.BlockedUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, models.BlockedUser{
+			UserID:      row.BlockedID,
+			DisplayName: names[row.BlockedID],
+			BlockedAt:   parseTime(row.CreatedAt),
+		})
+	}
+	response.Success(w, http.StatusOK, users)
+}
+
+// BlockUser blocks a user: neither side can start a thread with or send messages to the other,
+// and the blocked user's comments and replies are hidden from the blocker
+// POST /api/blocks
+func (s *Server) BlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var req models.BlockUserRequest
+	if !utils.DecodeJSONBody(r, w, &req) {
+		return
+	}
+	req.UserID = strings.TrimSpace(req.UserID)
+	if req.UserID == "" {
+		response.Error(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+	if req.UserID == userID {
+		response.Error(w, http.StatusBadRequest, "You cannot block yourself")
+		return
+	}
+
+	serviceClient := s.supabase.GetServiceClient()
+	var profiles []struct {
+		ID string `json:"id"`
+	}
+	_, err := serviceClient.From("profiles").
+		Select("id", "", false).
+		Eq("id", req.UserID).
+		ExecuteTo(&profiles)
+	if err != nil {
+		log.Printf("[BlockUser] Failed to query profile %s: %v", req.UserID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to block user")
+		return
+	}
+	if len(profiles) == 0 {
+		response.Error(w, http.StatusNotFound, "User not found")
+		return
+	}
+	// 運営は紛争対応のためスレッドに参加するため、ブロックの対象外（問題がある場合は通報を使う）
+	if s.isOperator(serviceClient, req.UserID) {
+		response.Error(w, http.StatusBadRequest, "Operators cannot be blocked. Please use a report instead")
+		return
+	}
+
+	client := s.supabase.GetAuthenticatedClient(accessToken)
+	var existing []userBlockRow
+	_, err = client.From("user_blocks").
+		Select("blocker_id, blocked_id, created_at", "", false).
+		Eq("blocker_id", userID).
+		Eq("blocked_id", req.UserID).
+		ExecuteTo(&existing)
+	if err != nil {
+		log.Printf("[BlockUser] Failed to query block %s -> %s: %v", userID, req.UserID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to block user")
+		return
+	}
+	if len(existing) > 0 {
+		response.Success(w, http.StatusOK, models.BlockedUser{
+			UserID:      req.UserID,
+			DisplayName: s.fetchDisplayNames(client, req.UserID)[req.UserID],
+			BlockedAt:   parseTime(existing[0].CreatedAt),
+		})
+		return
+	}
+
+	var inserted []userBlockRow
+	_, err = client.From("user_blocks").
+		Insert(map[string]string{"blocker_id": userID, "blocked_id": req.UserID}, false, "", "", "").
+		ExecuteTo(&inserted)
+	if err != nil || len(inserted) == 0 {
+		log.Printf("[BlockUser] ❌ Failed to block %s by %s: %v", req.UserID, userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to block user")
+		return
+	}
+
+	log.Printf("[BlockUser] ✓ %s blocked %s", userID, req.UserID)
+	response.Success(w, http.StatusCreated, models.BlockedUser{
+		UserID:      req.UserID,
+		DisplayName: s.fetchDisplayNames(client, req.UserID)[req.UserID],
+		BlockedAt:   parseTime(inserted[0].CreatedAt),
+	})
+}
+
+// UnblockUser removes a block
+// DELETE /api/blocks/:user_id
+func (s *Server) UnblockUser(w http.ResponseWriter, r *http.Request, blockedID string) {
+	userID, accessToken, ok := utils.RequireAuth(r, w)
+	if !ok {
+		return
+	}
+
+	var deleted []userBlockRow
+	_, err := s.supabase.GetAuthenticatedClient(accessToken).From("user_blocks").
+		Delete("", "").
+		Eq("blocker_id", userID).
+		Eq("blocked_id", blockedID).
+		ExecuteTo(&deleted)
+	if err != nil {
+		log.Printf("[UnblockUser] ❌ Failed to unblock %s by %s: %v", blockedID, userID, err)
+		response.Error(w, http.StatusInternalServerError, "Failed to unblock user")
+		return
+	}
+	if len(deleted) == 0 {
+		response.Error(w, http.StatusNotFound, "Block not found")
+		return
+	}
+
+	log.Printf("[UnblockUser] ✓ %s unblocked %s", userID, blockedID)
+	response.Success(w, http.StatusOK, map[string]string{"message": "User unblocked"})
+}
@@ -39,6 +39,8 @@ type PostCommentWithDetails struct {
 	IsDisliked    bool            `json:"is_disliked"`
 	ReplyCount    int             `json:"reply_count"`
 	Replies       []CommentReplyWithDetails `json:"replies,omitempty"`
+	// 連絡先を含むコメントを投稿した本人への警告（作成時のレスポンスのみ）
+	ContactWarning *ContactWarning `json:"contact_warning,omitempty"`
 }
 
 // CommentReplyWithDetails includes author profile and like/dislike counts
@@ -49,6 +51,8 @@ type CommentReplyWithDetails struct {
 	IsLiked       bool            `json:"is_liked"`
 	DislikeCount  int             `json:"dislike_count"`
 	IsDisliked    bool            `json:"is_disliked"`
+	// 連絡先を含む返信を投稿した本人への警告（作成・編集時のレスポンスのみ）
+	ContactWarning *ContactWarning `json:"contact_warning,omitempty"`
 }
 
 // CreateCommentRequest represents a request to create a new comment
@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// ContactKind is a kind of off-platform contact detail found in a text
+type ContactKind string
+
+const (
+	ContactKindPhone     ContactKind = "phone"
+	ContactKindEmail     ContactKind = "email"
+	ContactKindLineID    ContactKind = "line_id"
+	ContactKindMessenger ContactKind = "messenger" // Telegram・Discord・Instagram などのアカウント
+	ContactKindURL       ContactKind = "url"
+)
+
+// ContactAction is what happens to a text containing contact details
+type ContactAction string
+
+const (
+	ContactActionAllow ContactAction = "allow" // そのまま投稿（記録もしない）
+	ContactActionWarn  ContactAction = "warn"  // そのまま投稿し、送信者に警告を返す
+	ContactActionMask  ContactAction = "mask"  // 連絡先を伏せ字にして投稿
+	ContactActionBlock ContactAction = "block" // 投稿させない
+)
+
+// ContactContextPublic is the policy key of public texts (comments and replies on posts).
+// Messages use the deal stage of their thread (DealStage) as the key.
+const ContactContextPublic = "public"
+
+// ContactSource is the kind of text a flag was raised on
+type ContactSource string
+
+const (
+	ContactSourceMessage      ContactSource = "message"
+	ContactSourceComment      ContactSource = "comment"
+	ContactSourceCommentReply ContactSource = "comment_reply"
+)
+
+// ContactMatch is one contact detail found in a text
+type ContactMatch struct {
+	Kind  ContactKind `json:"kind"`
+	Value string      `json:"value"`
+	Start int         `json:"start"` // 元のテキストでの位置（コードポイント）
+	End   int         `json:"end"`
+}
+
+// ContactWarning is returned with a message or comment posted with contact details (warn or mask)
+type ContactWarning struct {
+	Action  ContactAction `json:"action"`
+	Kinds   []ContactKind `json:"kinds"`
+	Message string        `json:"message"`
+}
+
+// ContactFlag is a record of contact details posted (or attempted) by a user, for operators
+type ContactFlag struct {
+	ID         string         `json:"id"`
+	UserID     string         `json:"user_id"`
+	SourceType ContactSource  `json:"source_type"`
+	SourceID   *string        `json:"source_id,omitempty"` // block の場合は投稿されていないため null
+	ThreadID   *string        `json:"thread_id,omitempty"`
+	PostID     *string        `json:"post_id,omitempty"`
+	Context    string         `json:"context"` // 商談ステージ、または public
+	Action     ContactAction  `json:"action"`
+	Kinds      []ContactKind  `json:"kinds"`
+	Matches    []ContactMatch `json:"matches"`
+	Text       string         `json:"text"` // 伏せ字にする前の本文
+	ReviewedAt *time.Time     `json:"reviewed_at,omitempty"`
+	ReviewedBy *string        `json:"reviewed_by,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
@@ -0,0 +1,51 @@
+package models
+
+// ContractTemplateInfo describes an available contract template version
+type ContractTemplateInfo struct {
+	Type     ContractType `json:"type"`
+	Language string       `json:"language"`
+	Version  int          `json:"version"`
+	Title    string       `json:"title"`
+	Latest   bool         `json:"latest"`
+}
+
+// ContractTerms are the negotiated terms filled into a contract template.
+// All fields are optional; templates fall back to their default wording.
+type ContractTerms struct {
+	Price            *int64   `json:"price,omitempty"`              // 譲渡価格（円）
+	DepositAmount    *int64   `json:"deposit_amount,omitempty"`     // 手付金（円）
+	ClosingDate      string   `json:"closing_date,omitempty"`       // クロージング予定日 (YYYY-MM-DD)
+	PaymentDueDays   int      `json:"payment_due_days,omitempty"`   // 支払期限（契約締結後の日数）
+	ExclusivityDays  int      `json:"exclusivity_days,omitempty"`   // 独占交渉期間（日）
+	HandoverDays     int      `json:"handover_days,omitempty"`      // 引継ぎ期間（日）
+	SupportDays      int      `json:"support_days,omitempty"`       // 引継ぎ後のサポート期間（日）
+	NonCompeteMonths int      `json:"non_compete_months,omitempty"` // 競業避止期間（月）
+	ValidityYears    int      `json:"validity_years,omitempty"`     // NDAの有効期間（年）
+	Assets           []string `json:"assets,omitempty"`             // 譲渡対象資産
+	SpecialTerms     string   `json:"special_terms,omitempty"`      // 特約事項
+}
+
+// GenerateContractRequest is used to render a contract template to PDF and attach it to a thread
+// POST /api/contracts/generate (?preview=true returns the PDF without saving)
+type GenerateContractRequest struct {
+	ThreadID     string        `json:"thread_id" validate:"required"`
+	ContractType ContractType  `json:"contract_type" validate:"required,oneof=nda loi transfer handover"`
+	Language     string        `json:"language,omitempty"` // ja (default) | en
+	Version      int           `json:"version,omitempty"`  // 0 = latest
+	SellerUserID *string       `json:"seller_user_id,omitempty"`
+	BuyerUserID  *string       `json:"buyer_user_id,omitempty"`
+	Terms        ContractTerms `json:"terms"`
+}
+
+// GeneratedContract is the response of POST /api/contracts/generate
+type GeneratedContract struct {
+	ID           string               `json:"id,omitempty"`
+	ThreadID     string               `json:"thread_id"`
+	ContractType ContractType         `json:"contract_type"`
+	Template     ContractTemplateInfo `json:"template"`
+	FilePath     string               `json:"file_path"`
+	FileName     string               `json:"file_name"`
+	FileSize     int64                `json:"file_size"`
+	DocumentHash string               `json:"document_hash"`
+	SignedURL    string               `json:"signed_url,omitempty"`
+}
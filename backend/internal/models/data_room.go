@@ -0,0 +1,134 @@
+package models
+
+import "time"
+
+// DataRoom represents a row in the data_rooms table (one per post)
+type DataRoom struct {
+	ID          string     `json:"id"`
+	PostID      string     `json:"post_id"`
+	OwnerUserID string     `json:"owner_user_id"`
+	Title       string     `json:"title"`
+	Description *string    `json:"description,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// DataRoomFolder represents a row in the data_room_folders table
+type DataRoomFolder struct {
+	ID        string    `json:"id"`
+	RoomID    string    `json:"room_id"`
+	ParentID  *string   `json:"parent_id,omitempty"`
+	Name      string    `json:"name"`
+	CreatedBy *string   `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DataRoomFile represents a row in the data_room_files table.
+// The file is never exposed by a storage URL; it is served through the watermarking proxy.
+// Watermarked is false for formats that are served as uploaded (CSV, Office documents).
+type DataRoomFile struct {
+	ID          string     `json:"id"`
+	RoomID      string     `json:"room_id"`
+	FolderID    *string    `json:"folder_id,omitempty"`
+	FileName    string     `json:"file_name"`
+	FilePath    string     `json:"file_path"`
+	FileSize    int64      `json:"file_size"`
+	ContentType string     `json:"content_type"`
+	SHA256      string     `json:"sha256"`
+	UploadedBy  *string    `json:"uploaded_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	Watermarked bool       `json:"watermarked"`
+}
+
+// DataRoomGrant represents a row in the data_room_grants table
+type DataRoomGrant struct {
+	ID          string     `json:"id"`
+	RoomID      string     `json:"room_id"`
+	BuyerUserID string     `json:"buyer_user_id"`
+	FolderIDs   []string   `json:"folder_ids"` // nil = ルーム全体
+	CanDownload bool       `json:"can_download"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	GrantedBy   *string    `json:"granted_by,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy   *string    `json:"revoked_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+
+	BuyerDisplayName string `json:"buyer_display_name,omitempty"`
+}
+
+// Active reports whether the grant currently allows access
+func (g DataRoomGrant) Active(now time.Time) bool {
+	return g.RevokedAt == nil && (g.ExpiresAt == nil || g.ExpiresAt.After(now))
+}
+
+// DataRoomAccessLog represents a row in the data_room_access_logs table
+type DataRoomAccessLog struct {
+	ID        int64            `json:"id"`
+	RoomID    string           `json:"room_id"`
+	FileID    string           `json:"file_id"`
+	UserID    *string          `json:"user_id,omitempty"`
+	Action    FileAccessAction `json:"action"`
+	IPAddress *string          `json:"ip_address,omitempty"`
+	UserAgent *string          `json:"user_agent,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// DataRoomDetail is the response for GET /api/data-rooms/:id.
+// Buyers only receive the folders and files their grant covers.
+type DataRoomDetail struct {
+	DataRoom
+	IsOwner bool             `json:"is_owner"`
+	Grant   *DataRoomGrant   `json:"grant,omitempty"` // 買い手自身の付与内容
+	Folders []DataRoomFolder `json:"folders"`
+	Files   []DataRoomFile   `json:"files"`
+}
+
+// DataRoomFileAccess is one row of the access report (views / downloads of a file by a buyer)
+type DataRoomFileAccess struct {
+	FileID          string    `json:"file_id"`
+	FileName        string    `json:"file_name,omitempty"`
+	Views           int64     `json:"views"`
+	Downloads       int64     `json:"downloads"`
+	FirstAccessedAt time.Time `json:"first_accessed_at"`
+	LastAccessedAt  time.Time `json:"last_accessed_at"`
+}
+
+// DataRoomBuyerReport summarizes the access of one buyer for the seller
+type DataRoomBuyerReport struct {
+	UserID         string               `json:"user_id"`
+	DisplayName    string               `json:"display_name,omitempty"`
+	Grant          *DataRoomGrant       `json:"grant,omitempty"`
+	Views          int64                `json:"views"`
+	Downloads      int64                `json:"downloads"`
+	FilesAccessed  int                  `json:"files_accessed"`
+	LastAccessedAt *time.Time           `json:"last_accessed_at,omitempty"`
+	Files          []DataRoomFileAccess `json:"files"`
+}
+
+// CreateDataRoomRequest is used by the seller to open a data room for a post
+type CreateDataRoomRequest struct {
+	PostID      string  `json:"post_id"`
+	Title       *string `json:"title,omitempty"` // 省略時は案件タイトル
+	Description *string `json:"description,omitempty"`
+}
+
+// CreateDataRoomFolderRequest creates a folder (parent_id omitted = top level)
+type CreateDataRoomFolderRequest struct {
+	Name     string  `json:"name"`
+	ParentID *string `json:"parent_id,omitempty"`
+}
+
+// UpsertDataRoomGrantRequest grants (or updates the grant of) a buyer
+type UpsertDataRoomGrantRequest struct {
+	BuyerUserID string     `json:"buyer_user_id"`
+	FolderIDs   []string   `json:"folder_ids,omitempty"` // 省略時はルーム全体
+	CanDownload bool       `json:"can_download"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateFileURLRequest requests a proxy URL for viewing or downloading a protected file
+type CreateFileURLRequest struct {
+	Action FileAccessAction `json:"action"` // view | download（省略時: view）
+}
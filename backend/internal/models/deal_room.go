@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// DealStage is the progress of a deal room, derived from its NDA, contracts and sale request
+type DealStage string
+
+const (
+	DealStageInquiry       DealStage = "inquiry"        // NDA未申請
+	DealStageNDA           DealStage = "nda"            // NDA申請中・承認済み（未締結）
+	DealStageDueDiligence  DealStage = "due_diligence"  // NDA締結済み
+	DealStageLOI           DealStage = "loi"            // 意向表明書（LOI）提出済み
+	DealStageSaleRequested DealStage = "sale_requested" // 売却リクエスト作成済み（買い手の確定待ち）
+	DealStageClosing       DealStage = "closing"        // 購入確定・入金確認中
+	DealStageHandover      DealStage = "handover"       // 引き継ぎ書類の提出済み
+	DealStageCompleted     DealStage = "completed"      // 取引完了
+	DealStageCancelled     DealStage = "cancelled"      // 売却リクエストの取り消し
+)
+
+// DealRoomDocument is the latest contract document of one type in a deal room
+type DealRoomDocument struct {
+	ID             string    `json:"id"`
+	ContractType   string    `json:"contract_type"`
+	FileName       string    `json:"file_name"`
+	UploadedBy     string    `json:"uploaded_by"`
+	SignatureCount int       `json:"signature_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// DealRoomState is the response for GET /api/threads/:id/deal
+type DealRoomState struct {
+	ThreadID    string                       `json:"thread_id"`
+	PostID      string                       `json:"post_id"`
+	Stage       DealStage                    `json:"stage"`
+	NDA         *NDAAgreement                `json:"nda,omitempty"`
+	Documents   map[string]*DealRoomDocument `json:"documents"` // contract_type → 最新の書類
+	SaleRequest *SaleRequest                 `json:"sale_request,omitempty"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// EmailTemplate identifies a transactional email template (services/email_templates/{template}.{language}.tmpl)
+type EmailTemplate string
+
+const (
+	EmailTemplateSaleRequestCreated   EmailTemplate = "sale_request_created"   // 買い手へ: 売却リクエストが届いた
+	EmailTemplateSaleRequestPayment   EmailTemplate = "sale_request_payment"   // 買い手へ: 購入確定と振込先の案内
+	EmailTemplateSaleRequestConfirmed EmailTemplate = "sale_request_confirmed" // 売り手へ: 買い手が購入を確定した
+	EmailTemplateSaleRequestCancelled EmailTemplate = "sale_request_cancelled"
+	EmailTemplateNDAEvent             EmailTemplate = "nda_event"
+	EmailTemplateMessageDigest        EmailTemplate = "message_digest"
+	EmailTemplateListingModerated     EmailTemplate = "listing_moderated"
+)
+
+// EmailStatus is the delivery state of a message in the email outbox
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending" // 送信待ち（再送待ちを含む）
+	EmailStatusSending EmailStatus = "sending" // ワーカーが送信中
+	EmailStatusSent    EmailStatus = "sent"
+	EmailStatusFailed  EmailStatus = "failed"  // 再送の上限に達した
+	EmailStatusBounced EmailStatus = "bounced" // 宛先が恒久的に受信できない
+	EmailStatusSkipped EmailStatus = "skipped" // 送信前に宛先が配信停止になった
+)
+
+// EmailOutboxMessage is a row of the email_outbox table.
+// 件名・本文は登録時に描画して保存する（送信時点のデータ変更に影響されないようにするため）
+type EmailOutboxMessage struct {
+	ID            string        `json:"id"`
+	UserID        *string       `json:"user_id,omitempty"`
+	ToAddress     string        `json:"to_address"`
+	Template      EmailTemplate `json:"template"`
+	Language      string        `json:"language"`
+	Subject       string        `json:"subject"`
+	Body          string        `json:"body"`
+	Status        EmailStatus   `json:"status"`
+	Attempts      int           `json:"attempts"`
+	NextAttemptAt time.Time     `json:"next_attempt_at"`
+	LastError     *string       `json:"last_error,omitempty"`
+	SentAt        *time.Time    `json:"sent_at,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// EmailBounceRequest is posted by the mail provider when an address bounces: POST /api/email/bounces
+type EmailBounceRequest struct {
+	Email     string `json:"email"`
+	Reason    string `json:"reason,omitempty"`
+	Permanent *bool  `json:"permanent,omitempty"` // 省略時は恒久的なバウンスとして扱う
+}
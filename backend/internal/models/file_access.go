@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// FileAccessAction represents how a protected file was opened
+type FileAccessAction string
+
+const (
+	FileAccessView     FileAccessAction = "view"
+	FileAccessDownload FileAccessAction = "download"
+)
+
+// ProtectedFileResource is the kind of file served through the watermarking download proxy
+type ProtectedFileResource string
+
+const (
+	ProtectedFileDataRoom          ProtectedFileResource = "data_room_file"     // data_room_files.id
+	ProtectedFileContractDocument  ProtectedFileResource = "contract_document"  // thread_contract_documents.id
+	ProtectedFileMessageAttachment ProtectedFileResource = "message_attachment" // messages.id
+	ProtectedFileThreadExport      ProtectedFileResource = "thread_export"      // threads.id（スレッドの記録の出力）
+)
+
+// ProtectedFileURL is a short-lived, viewer-bound URL of the watermarking download proxy
+type ProtectedFileURL struct {
+	Resource   ProtectedFileResource `json:"resource"`
+	ResourceID string                `json:"resource_id"`
+	Action     FileAccessAction      `json:"action"`
+	URL        string                `json:"url"`
+	ExpiresAt  time.Time             `json:"expires_at"`
+}
+
+// FileAccessLog represents a row in the file_access_logs table (contract documents and message attachments;
+// data room access is recorded in data_room_access_logs)
+type FileAccessLog struct {
+	ID           int64                 `json:"id"`
+	ResourceType ProtectedFileResource `json:"resource_type"`
+	ResourceID   string                `json:"resource_id"`
+	ThreadID     *string               `json:"thread_id,omitempty"`
+	UserID       *string               `json:"user_id,omitempty"`
+	Action       FileAccessAction      `json:"action"`
+	IPAddress    *string               `json:"ip_address,omitempty"`
+	UserAgent    *string               `json:"user_agent,omitempty"`
+	CreatedAt    time.Time             `json:"created_at"`
+}
+
+// WatermarkTrace is one invisible watermark found in an inspected file, resolved to the access it was served for
+type WatermarkTrace struct {
+	UserID          string                `json:"user_id"`
+	UserDisplayName string                `json:"user_display_name,omitempty"`
+	Timestamp       time.Time             `json:"timestamp"`
+	TraceID         string                `json:"trace_id"`
+	Verified        bool                  `json:"verified"`
+	Resource        ProtectedFileResource `json:"resource,omitempty"`
+	ResourceID      string                `json:"resource_id,omitempty"`
+	FileName        string                `json:"file_name,omitempty"`
+	Action          FileAccessAction      `json:"action,omitempty"`
+	IPAddress       *string               `json:"ip_address,omitempty"`
+	AccessedAt      *time.Time            `json:"accessed_at,omitempty"`
+}
+
+// WatermarkInspection is the response for POST /api/watermarks/inspect
+type WatermarkInspection struct {
+	ContentType string           `json:"content_type"`
+	SHA256      string           `json:"sha256"`
+	Marks       []WatermarkTrace `json:"marks"`
+}
@@ -0,0 +1,39 @@
+package models
+
+// MatchCriteria represents the acquisition criteria of a buyer or advisor profile
+// (collected in RegisterStep4 as BuyerProfileInput / AdvisorProfileInput)
+type MatchCriteria struct {
+	UserID                   string   `json:"user_id"`
+	Role                     string   `json:"role"`
+	InvestmentMin            *int     `json:"investment_min,omitempty"`
+	InvestmentMax            *int     `json:"investment_max,omitempty"`
+	TargetCategories         []string `json:"target_categories,omitempty"`
+	OperationType            *string  `json:"operation_type,omitempty"`
+	DesiredAcquisitionTiming *string  `json:"desired_purchase_timing,omitempty"` // DBカラム名は desired_purchase_timing
+	Expertise                []string `json:"expertise,omitempty"`
+}
+
+// HasCriteria reports whether the profile has any criteria that can be matched
+func (c MatchCriteria) HasCriteria() bool {
+	return c.InvestmentMin != nil || c.InvestmentMax != nil || len(c.TargetCategories) > 0 ||
+		c.OperationType != nil || c.DesiredAcquisitionTiming != nil || len(c.Expertise) > 0
+}
+
+// MatchScore represents how well a listing matches a buyer's criteria (0-100)
+type MatchScore struct {
+	Score     int      `json:"score"`
+	Price     int      `json:"price"`
+	Category  int      `json:"category"`
+	Operation int      `json:"operation"`
+	Timing    int      `json:"timing"`
+	Reasons   []string `json:"reasons,omitempty"`
+}
+
+// MatchingBuyersSummary is returned to sellers for GET /api/posts/:id/matching-buyers
+type MatchingBuyersSummary struct {
+	PostID          string `json:"post_id"`
+	EvaluatedBuyers int    `json:"evaluated_buyers"`
+	MatchingBuyers  int    `json:"matching_buyers"`
+	StrongMatches   int    `json:"strong_matches"`
+	Threshold       int    `json:"threshold"`
+}
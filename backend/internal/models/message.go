@@ -13,13 +13,59 @@ const (
 	MessageTypeNDA        MessageType = "nda"
 )
 
-// Thread represents a conversation thread
+// ThreadType distinguishes general inquiries from the deal room of a listing
+type ThreadType string
+
+const (
+	ThreadTypeInquiry  ThreadType = "inquiry"   // 案件を指定しない一般的な問い合わせ
+	ThreadTypeDealRoom ThreadType = "deal_room" // 案件ごとの商談スレッド（NDA・LOI・売却リクエスト・引き継ぎの起点）
+)
+
+// Thread represents a conversation thread.
+// A thread is unique per (participants, related post); MergedInto is set on duplicates merged into another thread.
 type Thread struct {
-	ID            string    `json:"id"`
-	CreatedBy     string    `json:"created_by"`
-	RelatedPostID *string   `json:"related_post_id,omitempty"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            string     `json:"id"`
+	CreatedBy     string     `json:"created_by"`
+	RelatedPostID *string    `json:"related_post_id,omitempty"`
+	ThreadType    ThreadType `json:"thread_type"`
+	MergedInto    *string    `json:"merged_into,omitempty"`
+	// 最後のメッセージの時刻（一覧の並び順）
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ThreadView is an inbox view of GET /api/threads?view=
+type ThreadView string
+
+const (
+	ThreadViewActive   ThreadView = "active"   // アーカイブしていないスレッド（デフォルト）
+	ThreadViewArchived ThreadView = "archived" // アーカイブしたスレッド（新着メッセージでミュート以外は受信箱に戻る）
+	ThreadViewUnread   ThreadView = "unread"   // 未読のあるスレッド（アーカイブ・ミュートを除く）
+)
+
+// ThreadUserState is the per-participant state of a thread
+type ThreadUserState struct {
+	Archived bool     `json:"archived"`
+	Muted    bool     `json:"muted"`
+	Pinned   bool     `json:"pinned"`
+	Labels   []string `json:"labels"`
+}
+
+// UpdateThreadStateRequest changes the state of a thread for the user; omitted fields are unchanged
+type UpdateThreadStateRequest struct {
+	Archived *bool     `json:"archived,omitempty"`
+	Muted    *bool     `json:"muted,omitempty"`
+	Pinned   *bool     `json:"pinned,omitempty"`
+	Labels   *[]string `json:"labels,omitempty"`
+}
+
+// InboxCounts is the response for GET /api/threads/counts
+type InboxCounts struct {
+	Active         int `json:"active"`
+	Archived       int `json:"archived"`
+	Unread         int `json:"unread"`          // 未読のあるスレッド数
+	UnreadMessages int `json:"unread_messages"` // 未読メッセージの合計（バッジ用）
 }
 
 // Message represents a message in a thread
@@ -31,6 +77,8 @@ type Message struct {
 	Content      *string     `json:"content,omitempty"`
 	Text         *string     `json:"text,omitempty"`
 	ImageURL     *string     `json:"image_url,omitempty"`
+	EditedAt     *time.Time  `json:"edited_at,omitempty"`
+	DeletedAt    *time.Time  `json:"deleted_at,omitempty"` // 削除済み（本文・添付は返さない）
 	CreatedAt    time.Time   `json:"created_at"`
 }
 
@@ -56,6 +104,41 @@ type CreateThreadRequest struct {
 	ParticipantIDs []string `json:"participant_ids" validate:"required,min=1"`
 }
 
+// MergeThreadRequest merges a duplicate thread into the thread of the URL (operators only)
+type MergeThreadRequest struct {
+	SourceThreadID string `json:"source_thread_id"`
+}
+
+// UpdateMessageRequest edits the text of the sender's own message
+type UpdateMessageRequest struct {
+	Text string `json:"text"`
+}
+
+// MessageRevisionAction is what replaced a message version
+type MessageRevisionAction string
+
+const (
+	MessageRevisionEdit   MessageRevisionAction = "edit"
+	MessageRevisionDelete MessageRevisionAction = "delete"
+)
+
+// MessageRevision is a previous version of a message, kept for dispute handling (operators only)
+type MessageRevision struct {
+	ID           int64                 `json:"id"`
+	MessageID    string                `json:"message_id"`
+	ThreadID     string                `json:"thread_id"`
+	EditorUserID string                `json:"editor_user_id"`
+	Action       MessageRevisionAction `json:"action"`
+	PreviousText *string               `json:"previous_text"`
+	CreatedAt    time.Time             `json:"created_at"`
+}
+
+// MessageHistory is the response for GET /api/messages/:id/history
+type MessageHistory struct {
+	Message   Message           `json:"message"`
+	Revisions []MessageRevision `json:"revisions"` // 古い順
+}
+
 // ContractType represents the type of contract document
 type ContractType string
 
@@ -80,10 +163,11 @@ type CreateMessageRequest struct {
 // ThreadWithLastMessage includes thread info with the last message
 type ThreadWithLastMessage struct {
 	Thread
-	LastMessage     *Message  `json:"last_message,omitempty"`
-	ParticipantIDs  []string  `json:"participant_ids"`
-	Participants    []Profile `json:"participants"`
-	UnreadCount     int       `json:"unread_count"`
+	LastMessage    *Message        `json:"last_message,omitempty"`
+	ParticipantIDs []string        `json:"participant_ids"`
+	Participants   []Profile       `json:"participants"`
+	UnreadCount    int             `json:"unread_count"`
+	State          ThreadUserState `json:"state"`
 }
 
 // MessageWithSender includes message with sender info
@@ -92,6 +176,8 @@ type MessageWithSender struct {
 	SenderName    string  `json:"sender_name"`
 	SenderIconURL *string `json:"sender_icon_url,omitempty"`
 	ImageURL      *string `json:"image_url,omitempty"` // Signed URL for image attachments
+	// 連絡先を含むメッセージを送信した本人への警告（送信・編集のレスポンスのみ）
+	ContactWarning *ContactWarning `json:"contact_warning,omitempty"`
 }
 
 // ThreadDetail includes full thread information with participants
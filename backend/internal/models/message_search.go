@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// TextRange is a highlighted part of a snippet, in code points (Array.from(snippet) on the frontend)
+type TextRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// MessageSearchJump locates a hit inside its thread:
+// GET /api/messages?thread_id=<thread_id>&offset=<offset> returns a page starting at the hit
+type MessageSearchJump struct {
+	ThreadID  string `json:"thread_id"`
+	MessageID string `json:"message_id"`
+	Offset    int    `json:"offset"` // スレッド内でこのメッセージより新しいメッセージの件数
+}
+
+// MessageSearchHit is one message matching a search
+type MessageSearchHit struct {
+	ID            string            `json:"id"`
+	ThreadID      string            `json:"thread_id"`
+	ThreadType    ThreadType        `json:"thread_type"`
+	RelatedPostID *string           `json:"related_post_id,omitempty"`
+	SenderUserID  string            `json:"sender_user_id"`
+	SenderName    string            `json:"sender_name"`
+	Type          MessageType       `json:"type"`
+	Snippet       string            `json:"snippet"`
+	Highlights    []TextRange       `json:"highlights"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Jump          MessageSearchJump `json:"jump"`
+}
+
+// MessageSearchResponse is the response for GET /api/messages/search
+type MessageSearchResponse struct {
+	Hits       []MessageSearchHit `json:"hits"`
+	NextCursor string             `json:"next_cursor,omitempty"` // 次のページは ?cursor= に指定する
+}
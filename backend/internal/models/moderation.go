@@ -0,0 +1,111 @@
+package models
+
+import "time"
+
+// BlockedUser is a user blocked by the authenticated user
+type BlockedUser struct {
+	UserID      string    `json:"user_id"`
+	DisplayName string    `json:"display_name"`
+	BlockedAt   time.Time `json:"blocked_at"`
+}
+
+// BlockUserRequest blocks a user: POST /api/blocks
+type BlockUserRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// ReportTargetType is the kind of content a report is about
+type ReportTargetType string
+
+const (
+	ReportTargetMessage      ReportTargetType = "message"       // messages.id
+	ReportTargetComment      ReportTargetType = "comment"       // post_comments.id
+	ReportTargetCommentReply ReportTargetType = "comment_reply" // comment_replies.id
+	ReportTargetPost         ReportTargetType = "post"          // posts.id
+	ReportTargetProfile      ReportTargetType = "profile"       // profiles.id
+)
+
+// ReportReason is why a user reported content
+type ReportReason string
+
+const (
+	ReportReasonHarassment         ReportReason = "harassment" // 嫌がらせ・カスタマーハラスメント
+	ReportReasonSpam               ReportReason = "spam"
+	ReportReasonFraud              ReportReason = "fraud" // 詐欺・虚偽の掲載
+	ReportReasonOffPlatformContact ReportReason = "off_platform_contact"
+	ReportReasonInappropriate      ReportReason = "inappropriate"
+	ReportReasonOther              ReportReason = "other"
+)
+
+// ValidReportReason reports whether the reason is a known reason
+func ValidReportReason(reason ReportReason) bool {
+	switch reason {
+	case ReportReasonHarassment, ReportReasonSpam, ReportReasonFraud, ReportReasonOffPlatformContact,
+		ReportReasonInappropriate, ReportReasonOther:
+		return true
+	}
+	return false
+}
+
+// ReportStatus is the triage status of a report
+type ReportStatus string
+
+const (
+	ReportStatusOpen      ReportStatus = "open"      // 未対応
+	ReportStatusInReview  ReportStatus = "in_review" // 運営が確認中
+	ReportStatusResolved  ReportStatus = "resolved"  // 対応済み（警告・削除・利用停止など）
+	ReportStatusDismissed ReportStatus = "dismissed" // 問題なしとして却下
+)
+
+// Closed reports whether the report no longer needs action
+func (s ReportStatus) Closed() bool {
+	return s == ReportStatusResolved || s == ReportStatusDismissed
+}
+
+// Report represents a row in the reports table
+type Report struct {
+	ID           string           `json:"id"`
+	ReporterID   string           `json:"reporter_id"`
+	TargetType   ReportTargetType `json:"target_type"`
+	TargetID     string           `json:"target_id"`
+	TargetUserID *string          `json:"target_user_id,omitempty"` // 通報された内容の投稿者
+	ThreadID     *string          `json:"thread_id,omitempty"`
+	PostID       *string          `json:"post_id,omitempty"`
+	Reason       ReportReason     `json:"reason"`
+	Details      *string          `json:"details,omitempty"`
+	// 通報時点の内容（削除・編集されても確認できるように保存する）
+	TargetSnapshot *string      `json:"target_snapshot,omitempty"`
+	Status         ReportStatus `json:"status"`
+	// 以下は運営のみに返す
+	AssignedTo     *string    `json:"assigned_to,omitempty"`
+	ResolutionNote *string    `json:"resolution_note,omitempty"`
+	ResolvedBy     *string    `json:"resolved_by,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ReportQueueItem is a report in the operator triage queue with context on the reported user
+type ReportQueueItem struct {
+	Report
+	ReporterName   string `json:"reporter_name"`
+	TargetUserName string `json:"target_user_name,omitempty"`
+	// 通報された利用者に対する未対応の通報数と、未確認の連絡先検出数（contact_flags）
+	TargetOpenReports      int `json:"target_open_reports"`
+	TargetOpenContactFlags int `json:"target_open_contact_flags"`
+}
+
+// CreateReportRequest reports content: POST /api/reports
+type CreateReportRequest struct {
+	TargetType ReportTargetType `json:"target_type"`
+	TargetID   string           `json:"target_id"`
+	Reason     ReportReason     `json:"reason"`
+	Details    *string          `json:"details,omitempty"`
+}
+
+// UpdateReportRequest changes the triage status of a report: PUT /api/reports/:id (operators only)
+type UpdateReportRequest struct {
+	Status         *ReportStatus `json:"status,omitempty"`
+	ResolutionNote *string       `json:"resolution_note,omitempty"`
+	AssignedTo     *string       `json:"assigned_to,omitempty"` // 空文字で担当を外す
+}
@@ -0,0 +1,168 @@
+package models
+
+import "time"
+
+// NDAStatus represents the workflow status of an NDA agreement
+type NDAStatus string
+
+const (
+	NDAStatusRequested NDAStatus = "requested"
+	NDAStatusApproved  NDAStatus = "approved"
+	NDAStatusDeclined  NDAStatus = "declined"
+	NDAStatusCancelled NDAStatus = "cancelled"
+	NDAStatusSigned    NDAStatus = "signed"
+	NDAStatusRevoked   NDAStatus = "revoked" // 締結後に売り手が失効させた
+	NDAStatusExpired   NDAStatus = "expired" // 有効期限を過ぎて自動失効した
+)
+
+// NDAScope is the range of listings a signed NDA unlocks
+type NDAScope string
+
+const (
+	NDAScopeListing NDAScope = "listing" // post_id の案件のみ
+	NDAScopeSeller  NDAScope = "seller"  // 売り手（組織の場合は窓口ユーザー）の案件
+	NDAScopeOrg     NDAScope = "org"     // 売り手組織の全案件
+)
+
+// NDAParty identifies which side of an agreement a user is on
+type NDAParty string
+
+const (
+	NDAPartyBuyer  NDAParty = "buyer"
+	NDAPartySeller NDAParty = "seller"
+)
+
+// NDAEventType represents an entry in the nda_agreement_events table
+type NDAEventType string
+
+const (
+	NDAEventRequested      NDAEventType = "requested"
+	NDAEventApproved       NDAEventType = "approved"
+	NDAEventDeclined       NDAEventType = "declined"
+	NDAEventCancelled      NDAEventType = "cancelled"
+	NDAEventSignedByBuyer  NDAEventType = "signed_by_buyer"
+	NDAEventSignedBySeller NDAEventType = "signed_by_seller"
+	NDAEventSigned         NDAEventType = "signed"
+	NDAEventScopeChanged   NDAEventType = "scope_changed"
+	NDAEventRevoked        NDAEventType = "revoked"
+	NDAEventExpired        NDAEventType = "expired"
+)
+
+// NDAAgreement represents a row in the nda_agreements table
+// The agreement is made with the organization when buyer_org_id / seller_org_id is set
+type NDAAgreement struct {
+	ID                  string     `json:"id"`
+	BuyerUserID         *string    `json:"buyer_user_id,omitempty"`
+	BuyerOrgID          *string    `json:"buyer_org_id,omitempty"`
+	SellerUserID        *string    `json:"seller_user_id,omitempty"`
+	SellerOrgID         *string    `json:"seller_org_id,omitempty"`
+	SellerContactUserID *string    `json:"seller_contact_user_id,omitempty"`
+	RequestedBy         *string    `json:"requested_by,omitempty"`
+	PostID              *string    `json:"post_id,omitempty"`
+	ThreadID            *string    `json:"thread_id,omitempty"`
+	Status              NDAStatus  `json:"status"`
+	Scope               NDAScope   `json:"scope"`
+	ExpiresAt           *time.Time `json:"expires_at,omitempty"`
+	RequestMessage      *string    `json:"request_message,omitempty"`
+	DeclineReason       *string    `json:"decline_reason,omitempty"`
+	DocumentVersion     *string    `json:"document_version,omitempty"`
+	DocumentContent     *string    `json:"document_content,omitempty"` // レスポンスでは /document でのみ返す
+	DocumentHash        *string    `json:"document_hash,omitempty"`
+	BuyerSignedBy       *string    `json:"buyer_signed_by,omitempty"`
+	BuyerSignedAt       *time.Time `json:"buyer_signed_at,omitempty"`
+	BuyerSignedIP       *string    `json:"buyer_signed_ip,omitempty"`
+	BuyerDocumentHash   *string    `json:"buyer_document_hash,omitempty"`
+	SellerSignedBy      *string    `json:"seller_signed_by,omitempty"`
+	SellerSignedAt      *time.Time `json:"seller_signed_at,omitempty"`
+	SellerSignedIP      *string    `json:"seller_signed_ip,omitempty"`
+	SellerDocumentHash  *string    `json:"seller_document_hash,omitempty"`
+	ApprovedAt          *time.Time `json:"approved_at,omitempty"`
+	DeclinedAt          *time.Time `json:"declined_at,omitempty"`
+	CancelledAt         *time.Time `json:"cancelled_at,omitempty"`
+	SignedAt            *time.Time `json:"signed_at,omitempty"`
+	ExpiredAt           *time.Time `json:"expired_at,omitempty"`
+	RevokedAt           *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy           *string    `json:"revoked_by,omitempty"`
+	RevokeReason        *string    `json:"revoke_reason,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           *time.Time `json:"updated_at,omitempty"`
+}
+
+// NDAAgreementEvent represents a row in the nda_agreement_events table
+type NDAAgreementEvent struct {
+	ID           int64           `json:"id"`
+	AgreementID  string          `json:"agreement_id"`
+	ActorUserID  *string         `json:"actor_user_id,omitempty"`
+	Event        NDAEventType    `json:"event"`
+	FromStatus   *NDAStatus      `json:"from_status,omitempty"`
+	ToStatus     NDAStatus       `json:"to_status"`
+	IPAddress    *string         `json:"ip_address,omitempty"`
+	DocumentHash *string         `json:"document_hash,omitempty"`
+	Note         *string         `json:"note,omitempty"`
+	Details      *NDAScopeChange `json:"details,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// NDAScopeChange records the scope and expiry before and after an event (nda_agreement_events.details)
+type NDAScopeChange struct {
+	FromScope     NDAScope   `json:"from_scope,omitempty"`
+	ToScope       NDAScope   `json:"to_scope,omitempty"`
+	FromExpiresAt *time.Time `json:"from_expires_at,omitempty"`
+	ToExpiresAt   *time.Time `json:"to_expires_at,omitempty"`
+}
+
+// NDAAgreementDetail is the response for GET /api/nda-agreements/:id
+type NDAAgreementDetail struct {
+	NDAAgreement
+	MyParty NDAParty            `json:"my_party"`
+	Events  []NDAAgreementEvent `json:"events"`
+}
+
+// NDADocument is the document both parties sign (GET /api/nda-agreements/:id/document)
+type NDADocument struct {
+	AgreementID string `json:"agreement_id"`
+	Version     string `json:"version"`
+	Content     string `json:"content"`
+	Hash        string `json:"hash"`
+}
+
+// CreateNDARequest is used by a buyer to request an NDA for a listing (post_id) or a seller (seller_user_id)
+type CreateNDARequest struct {
+	PostID       *string   `json:"post_id,omitempty"`
+	SellerUserID *string   `json:"seller_user_id,omitempty"`
+	BuyerOrgID   *string   `json:"buyer_org_id,omitempty"` // 組織として申請する場合
+	Scope        *NDAScope `json:"scope,omitempty"`        // 希望するスコープ（省略時: post_id指定なら listing、なければ seller）
+	Message      *string   `json:"message,omitempty"`
+}
+
+// ApproveNDARequest is used by the seller to approve an NDA request.
+// The seller may change the requested scope and set an expiry; both are written into the document to be signed.
+type ApproveNDARequest struct {
+	Scope     *NDAScope  `json:"scope,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UpdateNDAScopeRequest is used by the seller to narrow the scope or change the expiry of a signed NDA.
+// Broadening the scope requires a new agreement.
+type UpdateNDAScopeRequest struct {
+	Scope        *NDAScope  `json:"scope,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RemoveExpiry bool       `json:"remove_expiry,omitempty"`
+	Note         *string    `json:"note,omitempty"`
+}
+
+// RevokeNDARequest is used by the seller to revoke a signed NDA
+type RevokeNDARequest struct {
+	Reason *string `json:"reason,omitempty"`
+}
+
+// DeclineNDARequest is used by the seller to decline an NDA request
+type DeclineNDARequest struct {
+	Reason *string `json:"reason,omitempty"`
+}
+
+// SignNDARequest is used by either party to sign an approved NDA
+// document_hash must match the hash of the document returned by GET /api/nda-agreements/:id/document
+type SignNDARequest struct {
+	DocumentHash string `json:"document_hash" validate:"required"`
+}
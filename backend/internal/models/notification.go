@@ -0,0 +1,112 @@
+package models
+
+import "time"
+
+// NotificationType represents the kind of event a notification is about
+type NotificationType string
+
+const (
+	NotificationTypeNDARequested NotificationType = "nda_requested"
+	NotificationTypeNDAApproved  NotificationType = "nda_approved"
+	NotificationTypeNDADeclined  NotificationType = "nda_declined"
+	NotificationTypeNDACancelled NotificationType = "nda_cancelled"
+	NotificationTypeNDASignature NotificationType = "nda_signature"
+	NotificationTypeNDASigned    NotificationType = "nda_signed"
+	NotificationTypeNDAScope     NotificationType = "nda_scope_changed"
+	NotificationTypeNDARevoked   NotificationType = "nda_revoked"
+	NotificationTypeNDAExpired   NotificationType = "nda_expired"
+
+	NotificationTypeDataRoomGranted NotificationType = "data_room_granted"
+
+	NotificationTypeThreadInvited   NotificationType = "thread_invited"
+	NotificationTypeMessageReceived NotificationType = "message_received" // 未読の間は同じスレッドの通知にまとめる
+
+	NotificationTypePostCommented  NotificationType = "post_commented"
+	NotificationTypeCommentReplied NotificationType = "comment_replied"
+	NotificationTypePostLiked      NotificationType = "post_liked"
+	NotificationTypeCommentLiked   NotificationType = "comment_liked"
+	NotificationTypeReplyLiked     NotificationType = "reply_liked"
+
+	NotificationTypeSaleRequestCreated   NotificationType = "sale_request_created"
+	NotificationTypeSaleRequestConfirmed NotificationType = "sale_request_confirmed"
+	NotificationTypeSaleRequestCancelled NotificationType = "sale_request_cancelled"
+
+	NotificationTypeListingModerated NotificationType = "listing_moderated" // 掲載への通報に運営が対応した
+)
+
+// NotificationTypes are the types a user can turn on or off in the notification preferences
+var NotificationTypes = []NotificationType{
+	NotificationTypeMessageReceived,
+	NotificationTypeThreadInvited,
+	NotificationTypePostCommented,
+	NotificationTypeCommentReplied,
+	NotificationTypePostLiked,
+	NotificationTypeCommentLiked,
+	NotificationTypeReplyLiked,
+	NotificationTypeNDARequested,
+	NotificationTypeNDAApproved,
+	NotificationTypeNDADeclined,
+	NotificationTypeNDACancelled,
+	NotificationTypeNDASignature,
+	NotificationTypeNDASigned,
+	NotificationTypeNDAScope,
+	NotificationTypeNDARevoked,
+	NotificationTypeNDAExpired,
+	NotificationTypeDataRoomGranted,
+	NotificationTypeSaleRequestCreated,
+	NotificationTypeSaleRequestConfirmed,
+	NotificationTypeSaleRequestCancelled,
+	NotificationTypeListingModerated,
+}
+
+// Valid reports whether the type is a known notification type
+func (t NotificationType) Valid() bool {
+	for _, v := range NotificationTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification represents a row in the notifications table
+type Notification struct {
+	ID           string                 `json:"id"`
+	UserID       string                 `json:"user_id"`
+	Type         NotificationType       `json:"type"`
+	Title        string                 `json:"title"`
+	Body         *string                `json:"body,omitempty"`
+	Link         *string                `json:"link,omitempty"`
+	ActorUserID  *string                `json:"actor_user_id,omitempty"`
+	ResourceType *string                `json:"resource_type,omitempty"`
+	ResourceID   *string                `json:"resource_id,omitempty"`
+	Data         map[string]interface{} `json:"data,omitempty"`
+	ReadAt       *time.Time             `json:"read_at,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// NotificationUnreadCount is returned by GET /api/notifications/unread-count
+type NotificationUnreadCount struct {
+	Total  int                      `json:"total"`
+	ByType map[NotificationType]int `json:"by_type"`
+}
+
+// NotificationPreference is whether a user receives a type of notification in the app and by email
+// (types without a row are on; email applies only to the types that have an email template)
+type NotificationPreference struct {
+	Type  NotificationType `json:"type"`
+	InApp bool             `json:"in_app"`
+	Email bool             `json:"email"`
+}
+
+// NotificationPreferenceUpdate changes the channels given for a type (omitted channels are left as they are)
+type NotificationPreferenceUpdate struct {
+	Type  NotificationType `json:"type"`
+	InApp *bool            `json:"in_app,omitempty"`
+	Email *bool            `json:"email,omitempty"`
+}
+
+// UpdateNotificationPreferencesRequest changes the preferences of the given types: PUT /api/notifications/preferences
+type UpdateNotificationPreferencesRequest struct {
+	Preferences []NotificationPreferenceUpdate `json:"preferences"`
+}
@@ -57,6 +57,10 @@ type Post struct {
 	ExtraImageURLs          []string          `json:"extra_image_urls,omitempty"`
 	MonthlyProfit           *int64            `json:"monthly_profit,omitempty"`
 	Subscribe               *bool             `json:"subscribe,omitempty"`
+	RevenueVerified         *bool             `json:"revenue_verified,omitempty"`
+	RevenueVerifiedFrom     *Date             `json:"revenue_verified_from,omitempty"`
+	RevenueVerifiedTo       *Date             `json:"revenue_verified_to,omitempty"`
+	RevenueVerifiedAt       *time.Time        `json:"revenue_verified_at,omitempty"`
 }
 
 // AuthorProfile represents the profile of the post author
@@ -73,6 +77,8 @@ type PostWithDetails struct {
 	Post
 	AuthorProfile   *AuthorProfile `json:"author_profile,omitempty"`
 	ActiveViewCount int            `json:"active_view_count"`
+	Match           *MatchScore    `json:"match,omitempty"`
+	MaskedFields    []string       `json:"masked_fields,omitempty"` // 閲覧者に非表示の項目（秘匿投稿）
 }
 
 
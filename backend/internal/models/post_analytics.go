@@ -0,0 +1,45 @@
+package models
+
+// PostAnalyticsDay represents one day of listing analytics (returned by get_post_analytics)
+type PostAnalyticsDay struct {
+	Day           string `json:"day"`
+	Views         int64  `json:"views"`
+	UniqueViewers int64  `json:"unique_viewers"`
+	WatchAdds     int64  `json:"watch_adds"`
+	WatchRemoves  int64  `json:"watch_removes"`
+	NewThreads    int64  `json:"new_threads"`
+	NDARequests   int64  `json:"nda_requests"`
+	SaleRequests  int64  `json:"sale_requests"`
+}
+
+// PostAnalyticsTotals represents the totals over the requested period
+type PostAnalyticsTotals struct {
+	Views         int64 `json:"views"`
+	UniqueViewers int64 `json:"unique_viewers"`
+	WatchAdds     int64 `json:"watch_adds"`
+	WatchRemoves  int64 `json:"watch_removes"`
+	NetWatchers   int64 `json:"net_watchers"`
+	NewThreads    int64 `json:"new_threads"`
+	NDARequests   int64 `json:"nda_requests"`
+	SaleRequests  int64 `json:"sale_requests"`
+}
+
+// PostAnalyticsConversion represents conversion ratios between funnel steps (0-1, nil when the base is 0)
+type PostAnalyticsConversion struct {
+	ViewToWatch   *float64 `json:"view_to_watch"`
+	ViewToInquiry *float64 `json:"view_to_inquiry"`
+	InquiryToNDA  *float64 `json:"inquiry_to_nda"`
+	NDAToSale     *float64 `json:"nda_to_sale"`
+	ViewToSale    *float64 `json:"view_to_sale"`
+}
+
+// PostAnalytics is the response for GET /api/posts/:id/analytics
+type PostAnalytics struct {
+	PostID          string                  `json:"post_id"`
+	From            string                  `json:"from"`
+	To              string                  `json:"to"`
+	ActiveViewCount int                     `json:"active_view_count"`
+	Totals          PostAnalyticsTotals     `json:"totals"`
+	Conversion      PostAnalyticsConversion `json:"conversion"`
+	Series          []PostAnalyticsDay      `json:"series"`
+}
@@ -0,0 +1,32 @@
+package models
+
+// ComparisonPost describes one column of a comparison matrix
+type ComparisonPost struct {
+	ID          string   `json:"id"`
+	Type        PostType `json:"type"`
+	Title       string   `json:"title"`
+	EyecatchURL *string  `json:"eyecatch_url,omitempty"`
+	Masked      bool     `json:"masked"` // 秘匿投稿でNDA未締結の場合true
+}
+
+// ComparisonValue is a single cell of the comparison matrix
+type ComparisonValue struct {
+	PostID string      `json:"post_id"`
+	Value  interface{} `json:"value"`
+	Masked bool        `json:"masked,omitempty"`
+	Best   bool        `json:"best,omitempty"`
+}
+
+// ComparisonRow is one metric across all compared posts
+type ComparisonRow struct {
+	Key    string            `json:"key"`
+	Unit   string            `json:"unit,omitempty"`
+	Values []ComparisonValue `json:"values"`
+}
+
+// PostComparison is the response for GET /api/posts/compare
+type PostComparison struct {
+	Posts    []ComparisonPost `json:"posts"`
+	Rows     []ComparisonRow  `json:"rows"`
+	NotFound []string         `json:"not_found,omitempty"`
+}
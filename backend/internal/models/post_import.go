@@ -0,0 +1,32 @@
+package models
+
+// PostImportRowStatus represents the outcome of one imported row
+type PostImportRowStatus string
+
+const (
+	PostImportRowValid   PostImportRowStatus = "valid"   // dry_run で検証のみ成功
+	PostImportRowCreated PostImportRowStatus = "created" // 投稿を作成済み
+	PostImportRowInvalid PostImportRowStatus = "invalid" // 解析・検証エラー
+	PostImportRowFailed  PostImportRowStatus = "failed"  // DBへの登録に失敗
+)
+
+// PostImportRowResult is the per-row report of a bulk import
+type PostImportRowResult struct {
+	Row    int                 `json:"row"`
+	Status PostImportRowStatus `json:"status"`
+	PostID string              `json:"post_id,omitempty"`
+	Title  string              `json:"title,omitempty"`
+	Errors []string            `json:"errors,omitempty"`
+}
+
+// PostImportReport is the response for POST /api/posts/import
+type PostImportReport struct {
+	DryRun  bool                  `json:"dry_run"`
+	Format  string                `json:"format"`
+	Total   int                   `json:"total"`
+	Valid   int                   `json:"valid"`
+	Created int                   `json:"created"`
+	Invalid int                   `json:"invalid"`
+	Failed  int                   `json:"failed"`
+	Rows    []PostImportRowResult `json:"rows"`
+}
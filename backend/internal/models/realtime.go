@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// Realtime event types pushed on GET /api/realtime/stream
+const (
+	RealtimeEventReady               = "ready"
+	RealtimeEventMessageCreated      = "message.created"      // data: MessageWithSender
+	RealtimeEventMessageUpdated      = "message.updated"      // data: MessageWithSender
+	RealtimeEventMessageDeleted      = "message.deleted"      // data: RealtimeMessageDeleted
+	RealtimeEventTyping              = "typing"               // data: RealtimeTyping
+	RealtimeEventMessagesRead        = "messages.read"        // data: RealtimeMessagesRead
+	RealtimeEventContractUploaded    = "contract.uploaded"    // data: RealtimeContractUploaded
+	RealtimeEventSaleRequestUpdated  = "sale_request.updated" // data: RealtimeSaleRequestStatus
+	RealtimeEventParticipantsUpdated = "participants.updated" // data: RealtimeParticipantsUpdated
+	RealtimeEventNotificationCreated = "notification.created" // data: Notification
+)
+
+// RealtimeReady is sent once when the stream is opened
+type RealtimeReady struct {
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"` // 認証トークンの期限でストリームを閉じる（クライアントは再接続する）
+}
+
+// RealtimeTyping tells the other participants that a user is (or stopped) typing
+type RealtimeTyping struct {
+	UserID    string    `json:"user_id"`
+	Typing    bool      `json:"typing"`
+	ExpiresAt time.Time `json:"expires_at"` // この時刻までに更新がなければ入力終了とみなす
+}
+
+// RealtimeMessagesRead is a read receipt for messages of a thread
+type RealtimeMessagesRead struct {
+	UserID     string    `json:"user_id"`
+	MessageIDs []string  `json:"message_ids"`
+	ReadAt     time.Time `json:"read_at"`
+}
+
+// RealtimeMessageDeleted announces that the sender deleted a message
+type RealtimeMessageDeleted struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// RealtimeContractUploaded announces a new contract document in a thread.
+// The file URL is bound to the viewer, so clients fetch it from GET /api/threads/:id/contracts.
+type RealtimeContractUploaded struct {
+	ID           string `json:"id"`
+	ContractType string `json:"contract_type"`
+	FileName     string `json:"file_name"`
+	UploadedBy   string `json:"uploaded_by"`
+}
+
+// RealtimeSaleRequestStatus announces a new sale request or a status change
+type RealtimeSaleRequestStatus struct {
+	ID     string            `json:"id"`
+	PostID string            `json:"post_id"`
+	Status SaleRequestStatus `json:"status"`
+}
+
+// RealtimeParticipantsUpdated announces that a participant was added to or removed from a thread
+type RealtimeParticipantsUpdated struct {
+	UserID string     `json:"user_id"`
+	Role   ThreadRole `json:"role"`
+	Action string     `json:"action"` // added / removed
+}
+
+// TypingRequest is sent while the user is typing in a thread
+type TypingRequest struct {
+	Typing bool `json:"typing"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// RevenueProvider represents the source of an uploaded revenue export
+type RevenueProvider string
+
+const (
+	RevenueProviderStripe     RevenueProvider = "stripe"
+	RevenueProviderAppStore   RevenueProvider = "app_store"
+	RevenueProviderGooglePlay RevenueProvider = "google_play"
+)
+
+// RevenueVerificationStatus represents the result of comparing exports with the claimed revenue
+type RevenueVerificationStatus string
+
+const (
+	RevenueVerificationStatusVerified RevenueVerificationStatus = "verified"
+	RevenueVerificationStatusMismatch RevenueVerificationStatus = "mismatch"
+)
+
+// MonthlyRevenueAmount represents aggregated revenue for a single month (YYYY-MM)
+type MonthlyRevenueAmount struct {
+	Month    string `json:"month"`
+	Amount   int64  `json:"amount"`
+	RowCount int    `json:"row_count"`
+}
+
+// RevenueReport represents a parsed payment-provider export aggregated by month
+type RevenueReport struct {
+	Provider    RevenueProvider        `json:"provider"`
+	Currency    string                 `json:"currency"`
+	Months      []MonthlyRevenueAmount `json:"months"`
+	ParsedRows  int                    `json:"parsed_rows"`
+	SkippedRows int                    `json:"skipped_rows"`
+}
+
+// RevenueVerification represents a row in the revenue_verifications table
+type RevenueVerification struct {
+	ID                     string                    `json:"id"`
+	PostID                 string                    `json:"post_id"`
+	SellerUserID           string                    `json:"seller_user_id"`
+	Status                 RevenueVerificationStatus `json:"status"`
+	Currency               string                    `json:"currency"`
+	PeriodStart            *Date                     `json:"period_start,omitempty"`
+	PeriodEnd              *Date                     `json:"period_end,omitempty"`
+	ClaimedMonthlyRevenue  *int64                    `json:"claimed_monthly_revenue,omitempty"`
+	VerifiedMonthlyRevenue *int64                    `json:"verified_monthly_revenue,omitempty"`
+	DifferenceRatio        *float64                  `json:"difference_ratio,omitempty"`
+	MonthlyBreakdown       []MonthlyRevenueAmount    `json:"monthly_breakdown,omitempty"`
+	CreatedAt              time.Time                 `json:"created_at"`
+}
+
+// RevenueVerificationFile represents a raw export stored in the private revenue-reports bucket
+type RevenueVerificationFile struct {
+	ID             string          `json:"id"`
+	VerificationID string          `json:"verification_id"`
+	PostID         string          `json:"post_id"`
+	Provider       RevenueProvider `json:"provider"`
+	FilePath       string          `json:"file_path"`
+	FileName       string          `json:"file_name"`
+	FileSize       int64           `json:"file_size"`
+	ContentType    string          `json:"content_type"`
+	CreatedAt      time.Time       `json:"created_at"`
+	SignedURL      string          `json:"signed_url,omitempty"`
+}
+
+// RevenueVerificationDetail is the response for GET /api/posts/:id/revenue-verifications
+// Breakdown and files are only populated for the owner and NDA holders
+type RevenueVerificationDetail struct {
+	PostID          string                    `json:"post_id"`
+	RevenueVerified bool                      `json:"revenue_verified"`
+	Verification    *RevenueVerification      `json:"verification,omitempty"`
+	Files           []RevenueVerificationFile `json:"files,omitempty"`
+	CanViewFiles    bool                      `json:"can_view_files"`
+}
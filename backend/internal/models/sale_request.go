@@ -17,6 +17,7 @@ type SaleRequest struct {
 	ID              string            `json:"id"`
 	ThreadID        string            `json:"thread_id"`
 	UserID          string            `json:"user_id"`
+	BuyerUserID     *string           `json:"buyer_user_id,omitempty"` // 購入を確定できる買い手
 	PostID          string            `json:"post_id"`
 	Price           int64             `json:"price"`
 	PhoneNumber     string            `json:"phone_number,omitempty"`
@@ -32,6 +33,8 @@ type CreateSaleRequestRequest struct {
 	PostID      string `json:"post_id" validate:"required"`
 	Price       int64  `json:"price" validate:"required,min=1"`
 	PhoneNumber string `json:"phone_number,omitempty" validate:"omitempty,e164"`
+	// 買い手が複数いるスレッドでは必須（1人の場合は省略可）
+	BuyerUserID *string `json:"buyer_user_id,omitempty"`
 }
 
 // ConfirmSaleRequestRequest is used to confirm a sale request
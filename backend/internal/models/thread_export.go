@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// ThreadExportFormat is the format of GET /api/threads/:id/export
+type ThreadExportFormat string
+
+const (
+	ThreadExportPDF ThreadExportFormat = "pdf" // 商談記録（トランスクリプト）のPDFのみ
+	ThreadExportZIP ThreadExportFormat = "zip" // トランスクリプト・添付画像・契約書・署名記録・チェックサム
+)
+
+// ThreadExportFile is one file in the export archive
+type ThreadExportFile struct {
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`                // transcript, message_attachment, contract_document, signatures
+	SourceID string `json:"source_id,omitempty"` // messages.id または thread_contract_documents.id
+	Size     int    `json:"size"`
+	SHA256   string `json:"sha256"`
+	// 保存されている原本のSHA-256（透かしを入れたファイルはアーカイブ内のファイルと異なる）
+	OriginalSHA256 string `json:"original_sha256,omitempty"`
+	Watermarked    bool   `json:"watermarked"`
+}
+
+// ThreadExportSignature is a contract_signatures record in the export archive
+type ThreadExportSignature struct {
+	ContractID      string    `json:"contract_id"`
+	ContractFile    string    `json:"contract_file,omitempty"` // アーカイブ内の契約書のパス
+	DocumentHash    string    `json:"document_hash,omitempty"` // 署名対象の契約書（原本）のSHA-256
+	UserID          string    `json:"user_id"`
+	DisplayName     string    `json:"display_name"`
+	SignedAt        time.Time `json:"signed_at"`
+	SignatureData   string    `json:"signature_data"`
+	SignatureSHA256 string    `json:"signature_sha256"`
+}
+
+// ThreadExportManifest is manifest.json of the export archive
+type ThreadExportManifest struct {
+	ThreadID   string             `json:"thread_id"`
+	ThreadType ThreadType         `json:"thread_type"`
+	ExportedBy string             `json:"exported_by"`
+	ExportedAt time.Time          `json:"exported_at"`
+	TraceID    string             `json:"trace_id"` // 透かしに埋め込んだアクセスログのID
+	Files      []ThreadExportFile `json:"files"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// ThreadRole is the role of a participant in a thread
+type ThreadRole string
+
+const (
+	ThreadRoleSeller        ThreadRole = "seller"
+	ThreadRoleBuyer         ThreadRole = "buyer"
+	ThreadRoleSellerAdvisor ThreadRole = "seller_advisor" // 売り手側のアドバイザー
+	ThreadRoleBuyerAdvisor  ThreadRole = "buyer_advisor"  // 買い手側のアドバイザー
+	ThreadRoleOperator      ThreadRole = "operator"       // 運営（仲介・紛争対応）
+)
+
+// ThreadPermission is an action in a thread that depends on the participant role
+type ThreadPermission string
+
+const (
+	ThreadPermissionMessage            ThreadPermission = "message"
+	ThreadPermissionUploadDocument     ThreadPermission = "upload_document" // DD資料・その他の資料
+	ThreadPermissionUploadContract     ThreadPermission = "upload_contract" // NDA・LOI・譲渡契約など当事者間の契約書
+	ThreadPermissionSignContract       ThreadPermission = "sign_contract"
+	ThreadPermissionCreateSaleRequest  ThreadPermission = "create_sale_request"
+	ThreadPermissionConfirmPurchase    ThreadPermission = "confirm_purchase"
+	ThreadPermissionInviteParticipants ThreadPermission = "invite_participants"
+)
+
+// threadRolePermissions: アドバイザーはコメントとDD資料の提出のみ（契約・署名・購入確定は当事者のみ）
+var threadRolePermissions = map[ThreadRole][]ThreadPermission{
+	ThreadRoleSeller: {
+		ThreadPermissionMessage, ThreadPermissionUploadDocument, ThreadPermissionUploadContract,
+		ThreadPermissionSignContract, ThreadPermissionCreateSaleRequest, ThreadPermissionInviteParticipants,
+	},
+	ThreadRoleBuyer: {
+		ThreadPermissionMessage, ThreadPermissionUploadDocument, ThreadPermissionUploadContract,
+		ThreadPermissionSignContract, ThreadPermissionConfirmPurchase, ThreadPermissionInviteParticipants,
+	},
+	ThreadRoleSellerAdvisor: {ThreadPermissionMessage, ThreadPermissionUploadDocument},
+	ThreadRoleBuyerAdvisor:  {ThreadPermissionMessage, ThreadPermissionUploadDocument},
+	ThreadRoleOperator:      {ThreadPermissionMessage, ThreadPermissionUploadDocument, ThreadPermissionInviteParticipants},
+}
+
+// Valid reports whether the role is a known role
+func (r ThreadRole) Valid() bool {
+	_, ok := threadRolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role is allowed the action
+func (r ThreadRole) Can(permission ThreadPermission) bool {
+	for _, p := range threadRolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the actions allowed to the role
+func (r ThreadRole) Permissions() []ThreadPermission {
+	return append([]ThreadPermission{}, threadRolePermissions[r]...)
+}
+
+// ThreadParticipantWithRole is a participant of a thread with its role
+type ThreadParticipantWithRole struct {
+	ThreadID    string             `json:"thread_id"`
+	UserID      string             `json:"user_id"`
+	Role        ThreadRole         `json:"role"`
+	DisplayName string             `json:"display_name"`
+	IconURL     *string            `json:"icon_url,omitempty"`
+	InvitedBy   *string            `json:"invited_by,omitempty"`
+	JoinedAt    *time.Time         `json:"joined_at,omitempty"`
+	Permissions []ThreadPermission `json:"permissions"`
+}
+
+// AddThreadParticipantRequest invites a user to a thread with a role
+type AddThreadParticipantRequest struct {
+	UserID string     `json:"user_id"`
+	Role   ThreadRole `json:"role"`
+}
@@ -38,6 +38,7 @@ type Profile struct {
 	PortfolioSummary         *string    `json:"portfolio_summary,omitempty"`
 	ProposalStyle            *string    `json:"proposal_style,omitempty"`
 	Public                   bool       `json:"public"`
+	PreferredLanguage        string     `json:"preferred_language,omitempty"` // メールの言語（ja | en）
 	CreatedAt         time.Time  `json:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
 }
@@ -79,6 +80,7 @@ type UpdateProfileRequest struct {
 	Age         *int    `json:"age,omitempty" validate:"omitempty,min=13,max=120"`
 	IconURL     *string `json:"icon_url,omitempty"`
 	NDAFlag     *bool   `json:"nda_flag,omitempty"`
+	PreferredLanguage *string `json:"preferred_language,omitempty" validate:"omitempty,oneof=ja en"`
 }
 
 type LoginRequest struct {
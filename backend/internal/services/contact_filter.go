@@ -0,0 +1,270 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+// ContactMask replaces a masked contact detail
+const ContactMask = "***"
+
+// defaultContactPolicy: NDA締結前は連絡先を伏せ、DD以降は警告のみ、売却リクエスト以降は許可する。
+// 公開コメントは誰でも読めるため常に投稿させない。
+var defaultContactPolicy = map[string]models.ContactAction{
+	models.ContactContextPublic:           models.ContactActionBlock,
+	string(models.DealStageInquiry):       models.ContactActionMask,
+	string(models.DealStageNDA):           models.ContactActionMask,
+	string(models.DealStageDueDiligence):  models.ContactActionWarn,
+	string(models.DealStageLOI):           models.ContactActionWarn,
+	string(models.DealStageSaleRequested): models.ContactActionAllow,
+	string(models.DealStageClosing):       models.ContactActionAllow,
+	string(models.DealStageHandover):      models.ContactActionAllow,
+	string(models.DealStageCompleted):     models.ContactActionAllow,
+	string(models.DealStageCancelled):     models.ContactActionMask,
+}
+
+var (
+	// 電話番号: 0始まりの国内番号（10〜11桁）と + 始まりの国際番号。
+	// 前後が数字の場合（金額など）は除く。隣り合う番号を取りこぼさないよう、前後の文字は detectPhoneNumbers で確認する
+	contactPhonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ \-.]?(?:\(0\))?|\(?0)\d{1,4}\)?[ \-.]?\d{1,4}[ \-.]?\d{3,4}`)
+	// メールアドレス: (at)・アットマーク・ドット などの言い換えを含む
+	contactEmailPattern = regexp.MustCompile(`[a-z0-9._%+\-]+\s*(?:@|\(at\)|\[at\]|アットマーク|あっとまーく|アット|あっと)\s*[a-z0-9\-]+(?:(?:\.|\s*(?:\(dot\)|\[dot\]|ドット|どっと)\s*)[a-z0-9\-]+)+`)
+	contactURLPattern   = regexp.MustCompile(`(?:https?://|www\.)[^\s<>"'）」]+|\b[a-z0-9][a-z0-9\-]*(?:\.[a-z0-9\-]+)*\.(?:com|net|org|jp|io|me|co|app|dev|info|biz|link|page|ly|gl|gg|tv|xyz)\b(?:/[^\s<>"'）」]*)?`)
+	// LINE ID: 「LINE ID: xxx」「ラインは xxx」「LINE@xxx」など、区切りのあるものだけを検出する
+	contactLinePattern      = regexp.MustCompile(`(?:\bline|ライン)\s*(?:id)?\s*(?:[:=]|は|→|@)\s*@?[a-z0-9._\-]{4,20}`)
+	contactMessengerPattern = regexp.MustCompile(`(?:\b(?:telegram|discord|skype|wechat|whatsapp|kakaotalk|kakao|instagram|insta|twitter|facebook|chatwork|signal)|テレグラム|ディスコード|スカイプ|インスタグラム|インスタ|ツイッター|フェイスブック|チャットワーク|カカオ)\s*(?:id)?\s*(?:[:=]|は|→|@)\s*@?[a-z0-9._\-]{3,32}`)
+	// 単独の @ハンドル（メールアドレスの一部は除く）
+	contactHandlePattern = regexp.MustCompile(`(?:^|[^a-z0-9._%+\-])(@[a-z0-9_]{3,30})`)
+)
+
+// ContactFilter detects off-platform contact details (phone numbers, emails, LINE IDs,
+// messenger handles and URLs) and decides per deal stage what to do with them
+type ContactFilter struct {
+	policy       map[string]models.ContactAction
+	allowedHosts []string
+}
+
+// NewContactFilter creates a filter from a policy spec such as "inquiry=block,due_diligence=mask".
+// Keys are deal stages or "public"; stages not in the spec keep the default action.
+// Links to allowedHosts (and their subdomains) are not treated as contact details.
+func NewContactFilter(policySpec string, allowedHosts ...string) (*ContactFilter, error) {
+	policy := make(map[string]models.ContactAction, len(defaultContactPolicy))
+	for key, action := range defaultContactPolicy {
+		policy[key] = action
+	}
+	for _, entry := range strings.Split(policySpec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid contact policy entry %q (expected stage=action)", entry)
+		}
+		key = strings.TrimSpace(key)
+		if _, known := defaultContactPolicy[key]; !known {
+			return nil, fmt.Errorf("unknown deal stage %q in contact policy", key)
+		}
+		action := models.ContactAction(strings.TrimSpace(value))
+		switch action {
+		case models.ContactActionAllow, models.ContactActionWarn, models.ContactActionMask, models.ContactActionBlock:
+			policy[key] = action
+		default:
+			return nil, fmt.Errorf("unknown action %q for %s in contact policy", action, key)
+		}
+	}
+
+	hosts := make([]string, 0, len(allowedHosts))
+	for _, host := range allowedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, strings.TrimPrefix(host, "www."))
+		}
+	}
+	return &ContactFilter{policy: policy, allowedHosts: hosts}, nil
+}
+
+// Action returns what to do with contact details in the context (deal stage or "public").
+// Unknown contexts are masked.
+func (f *ContactFilter) Action(context string) models.ContactAction {
+	if action, ok := f.policy[context]; ok {
+		return action
+	}
+	return models.ContactActionMask
+}
+
+// Detect returns the contact details in text, in order and without overlaps
+func (f *ContactFilter) Detect(text string) []models.ContactMatch {
+	normalized, runeAt := normalizeContactText(text)
+	original := []rune(text)
+
+	var found []models.ContactMatch
+	add := func(kind models.ContactKind, start, end int) {
+		found = append(found, models.ContactMatch{Kind: kind, Start: runeAt[start], End: runeAt[end]})
+	}
+
+	for _, loc := range contactEmailPattern.FindAllStringIndex(normalized, -1) {
+		add(models.ContactKindEmail, loc[0], loc[1])
+	}
+	for _, loc := range contactLinePattern.FindAllStringIndex(normalized, -1) {
+		add(models.ContactKindLineID, loc[0], loc[1])
+	}
+	for _, loc := range contactMessengerPattern.FindAllStringIndex(normalized, -1) {
+		add(models.ContactKindMessenger, loc[0], loc[1])
+	}
+	for _, loc := range contactHandlePattern.FindAllStringSubmatchIndex(normalized, -1) {
+		add(models.ContactKindMessenger, loc[2], loc[3])
+	}
+	for _, loc := range contactURLPattern.FindAllStringIndex(normalized, -1) {
+		if !f.isAllowedLink(normalized[loc[0]:loc[1]]) {
+			add(models.ContactKindURL, loc[0], loc[1])
+		}
+	}
+	for _, loc := range detectPhoneNumbers(normalized) {
+		add(models.ContactKindPhone, loc[0], loc[1])
+	}
+
+	// 重なる検出は先に始まるもの（同じ位置なら長いもの）を残す
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Start != found[j].Start {
+			return found[i].Start < found[j].Start
+		}
+		return found[i].End > found[j].End
+	})
+	matches := make([]models.ContactMatch, 0, len(found))
+	end := 0
+	for _, m := range found {
+		if m.Start < end {
+			continue
+		}
+		m.Value = string(original[m.Start:m.End])
+		matches = append(matches, m)
+		end = m.End
+	}
+	return matches
+}
+
+// Mask replaces the matches in text with ContactMask
+func (f *ContactFilter) Mask(text string, matches []models.ContactMatch) string {
+	runes := []rune(text)
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(string(runes[last:m.Start]))
+		b.WriteString(ContactMask)
+		last = m.End
+	}
+	b.WriteString(string(runes[last:]))
+	return b.String()
+}
+
+// ContactKinds returns the distinct kinds of the matches, in order of appearance
+func ContactKinds(matches []models.ContactMatch) []models.ContactKind {
+	kinds := make([]models.ContactKind, 0, len(matches))
+	for _, m := range matches {
+		if !slices.Contains(kinds, m.Kind) {
+			kinds = append(kinds, m.Kind)
+		}
+	}
+	return kinds
+}
+
+// isAllowedLink reports whether the link points to the platform itself
+func (f *ContactFilter) isAllowedLink(link string) bool {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	for _, allowed := range f.allowedHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectPhoneNumbers returns the byte ranges of the phone numbers in normalized text.
+// 前後が数字（または番号の前が +）の候補は数字列の一部として除き、候補の次の位置から探し直す
+func detectPhoneNumbers(normalized string) [][2]int {
+	var found [][2]int
+	for offset := 0; offset < len(normalized); {
+		loc := contactPhonePattern.FindStringIndex(normalized[offset:])
+		if loc == nil {
+			break
+		}
+		start, end := offset+loc[0], offset+loc[1]
+		if (start > 0 && isDigitOrPlus(normalized[start-1])) ||
+			(end < len(normalized) && isDigit(normalized[end])) ||
+			!isPhoneNumber(normalized[start:end]) {
+			offset = start + 1
+			continue
+		}
+		found = append(found, [2]int{start, end})
+		offset = end
+	}
+	return found
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isDigitOrPlus(c byte) bool {
+	return isDigit(c) || c == '+'
+}
+
+// isPhoneNumber checks the number of digits: 10-11 for domestic numbers, 10-15 with a country code
+func isPhoneNumber(candidate string) bool {
+	digits := 0
+	for _, r := range candidate {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	if strings.HasPrefix(candidate, "+") {
+		return digits >= 10 && digits <= 15
+	}
+	return digits >= 10 && digits <= 11
+}
+
+// normalizeContactText folds full-width ASCII, ideographic spaces and dash variants to ASCII and lowercases,
+// one rune for one rune. runeAt maps each byte offset of the result to the rune offset in the original text.
+func normalizeContactText(text string) (string, []int) {
+	var b strings.Builder
+	b.Grow(len(text))
+	runeAt := make([]int, 0, len(text)+1)
+	var prev rune
+	i := 0
+	for _, r := range text {
+		switch {
+		case r >= 0xFF01 && r <= 0xFF5E: // 全角英数字・記号
+			r -= 0xFEE0
+		case r == 0x3000: // 全角スペース
+			r = ' '
+		case r == 0x2010 || r == 0x2011 || r == 0x2012 || r == 0x2013 || r == 0x2014 || r == 0x2015 || r == 0x2212:
+			r = '-'
+		case r == 'ー' && prev >= '0' && prev <= '9': // 数字の後の長音記号は区切りのハイフンとみなす
+			r = '-'
+		}
+		r = unicode.ToLower(r)
+		b.WriteRune(r)
+		for n := utf8.RuneLen(r); n > 0; n-- {
+			runeAt = append(runeAt, i)
+		}
+		prev = r
+		i++
+	}
+	runeAt = append(runeAt, i)
+	return b.String(), runeAt
+}
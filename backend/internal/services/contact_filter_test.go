@@ -0,0 +1,49 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+func TestContactFilterDetectPhoneNumbers(t *testing.T) {
+	filter, err := NewContactFilter("")
+	if err != nil {
+		t.Fatalf("NewContactFilter: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"domestic", "電話は090-1234-5678です", []string{"090-1234-5678"}},
+		{"adjacent with space", "090-1234-5678 080-1234-5678", []string{"090-1234-5678", "080-1234-5678"}},
+		{"adjacent with comma", "090-1234-5678,080-1234-5678", []string{"090-1234-5678", "080-1234-5678"}},
+		{"adjacent with slash", "03-1234-5678/06-1234-5678", []string{"03-1234-5678", "06-1234-5678"}},
+		{"full-width digits", "０９０－１２３４－５６７８", []string{"０９０－１２３４－５６７８"}},
+		{"full-width adjacent", "０９０１２３４５６７８、０８０１２３４５６７８", []string{"０９０１２３４５６７８", "０８０１２３４５６７８"}},
+		{"long vowel mark as hyphen", "090ー1234ー5678", []string{"090ー1234ー5678"}},
+		{"international", "+81 90-1234-5678", []string{"+81 90-1234-5678"}},
+		{"parentheses", "(03)1234-5678", []string{"(03)1234-5678"}},
+		{"amount", "希望価格は1,200,000円です", nil},
+		{"amount without separators", "売上 12000000 円", nil},
+		{"part of a longer number", "注文番号 1090123456789", nil},
+		{"too short", "内線 0123-456", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range filter.Detect(tt.text) {
+				if m.Kind == models.ContactKindPhone {
+					got = append(got, m.Value)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Detect(%q) phone numbers = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
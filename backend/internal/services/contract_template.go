@@ -0,0 +1,310 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+// Contract templates are plain-text Go templates named {type}.{language}.v{version}.tmpl.
+// 文面を変更する場合は既存ファイルを編集せず、新しいバージョンのファイルを追加する
+// （生成済みの契約書がどの文面で作られたかを追跡できるようにするため）
+//
+// Markup (one directive per line):
+//
+//	# Title        centered document title
+//	## Heading     section heading
+//	> text         right-aligned line (dates, signatures)
+//	- text         indented bullet
+//	\text          literal paragraph (user-supplied text; markup is not interpreted)
+//	(blank)        paragraph break
+//
+//go:embed contract_templates/*.tmpl
+var contractTemplateFiles embed.FS
+
+// ErrContractTemplateNotFound is returned when no template matches the type, language and version
+var ErrContractTemplateNotFound = errors.New("contract template not found")
+
+// ContractParty is a contracting party filled from profile data
+type ContractParty struct {
+	DisplayName string
+	CompanyName string
+	Prefecture  string
+}
+
+// Name returns the company name for corporate parties, otherwise the display name
+func (p ContractParty) Name() string {
+	if p.CompanyName != "" {
+		return p.CompanyName
+	}
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+	return "＿＿＿＿＿＿＿＿"
+}
+
+// ContractListing is the listing a contract refers to.
+// 秘匿投稿は買い手の公開範囲でマスク済みの値が入る（未締結ならタイトル等は空）
+type ContractListing struct {
+	ID    string
+	Title string
+	Price *int64
+}
+
+// ContractTemplateData is the data passed to a contract template
+type ContractTemplateData struct {
+	DocumentID string
+	Date       time.Time
+	Language   string
+	Seller     ContractParty
+	Buyer      ContractParty
+	Listing    ContractListing
+	Terms      models.ContractTerms
+}
+
+// ListingLabel returns the listing title, or its ID when the title is not disclosed
+func (d ContractTemplateData) ListingLabel() string {
+	if d.Listing.Title != "" {
+		return d.Listing.Title
+	}
+	if d.Listing.ID == "" {
+		return ""
+	}
+	if d.Language == "en" {
+		return "Listing ID " + d.Listing.ID
+	}
+	return "案件ID " + d.Listing.ID
+}
+
+type contractTemplate struct {
+	info models.ContractTemplateInfo
+	tmpl *template.Template
+}
+
+var contractTemplates = mustLoadContractTemplates()
+
+var contractTemplateFuncs = template.FuncMap{
+	"yen": func(v interface{}) string {
+		switch n := v.(type) {
+		case int64:
+			return FormatYen(n)
+		case *int64:
+			if n == nil {
+				return ""
+			}
+			return FormatYen(*n)
+		case int:
+			return FormatYen(int64(n))
+		}
+		return fmt.Sprint(v)
+	},
+	"jaDate": func(t time.Time) string {
+		return t.In(contractTimeZone).Format("2006年1月2日")
+	},
+	"enDate": func(t time.Time) string {
+		return t.In(contractTimeZone).Format("January 2, 2006")
+	},
+}
+
+var contractTimeZone = func() *time.Location {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		return time.FixedZone("JST", 9*60*60)
+	}
+	return loc
+}()
+
+func mustLoadContractTemplates() []contractTemplate {
+	entries, err := contractTemplateFiles.ReadDir("contract_templates")
+	if err != nil {
+		panic(err)
+	}
+
+	var templates []contractTemplate
+	for _, entry := range entries {
+		name := entry.Name()
+		parts := strings.Split(strings.TrimSuffix(name, ".tmpl"), ".")
+		if len(parts) != 3 || !strings.HasPrefix(parts[2], "v") {
+			panic(fmt.Sprintf("invalid contract template name: %s", name))
+		}
+		version, err := strconv.Atoi(strings.TrimPrefix(parts[2], "v"))
+		if err != nil {
+			panic(fmt.Sprintf("invalid contract template version: %s", name))
+		}
+
+		source, err := contractTemplateFiles.ReadFile(path.Join("contract_templates", name))
+		if err != nil {
+			panic(err)
+		}
+		title := strings.TrimPrefix(strings.SplitN(string(source), "\n", 2)[0], "# ")
+
+		templates = append(templates, contractTemplate{
+			info: models.ContractTemplateInfo{
+				Type:     models.ContractType(parts[0]),
+				Language: parts[1],
+				Version:  version,
+				Title:    title,
+			},
+			tmpl: template.Must(template.New(name).Funcs(contractTemplateFuncs).Option("missingkey=error").Parse(string(source))),
+		})
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		a, b := templates[i].info, templates[j].info
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Language != b.Language {
+			return a.Language < b.Language
+		}
+		return a.Version > b.Version
+	})
+	// 種別・言語ごとに最新バージョンを印付け
+	for i := range templates {
+		if i == 0 || templates[i-1].info.Type != templates[i].info.Type || templates[i-1].info.Language != templates[i].info.Language {
+			templates[i].info.Latest = true
+		}
+	}
+	return templates
+}
+
+// ListContractTemplates returns all template versions (latest first for each type and language)
+func ListContractTemplates() []models.ContractTemplateInfo {
+	infos := make([]models.ContractTemplateInfo, 0, len(contractTemplates))
+	for _, t := range contractTemplates {
+		infos = append(infos, t.info)
+	}
+	return infos
+}
+
+func findContractTemplate(contractType models.ContractType, language string, version int) (*contractTemplate, error) {
+	for i, t := range contractTemplates {
+		if t.info.Type != contractType || t.info.Language != language {
+			continue
+		}
+		if (version == 0 && t.info.Latest) || t.info.Version == version {
+			return &contractTemplates[i], nil
+		}
+	}
+	return nil, ErrContractTemplateNotFound
+}
+
+// RenderContractText fills a template and returns the template used and the rendered markup
+func RenderContractText(contractType models.ContractType, language string, version int, data ContractTemplateData) (models.ContractTemplateInfo, string, error) {
+	t, err := findContractTemplate(contractType, language, version)
+	if err != nil {
+		return models.ContractTemplateInfo{}, "", err
+	}
+	data.Language = t.info.Language
+	escapeContractData(&data)
+
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return t.info, "", fmt.Errorf("failed to render %s template: %w", t.info.Type, err)
+	}
+	return t.info, buf.String(), nil
+}
+
+// escapeContractData keeps user-supplied values from being interpreted as markup.
+// 🔒 SECURITY: 1行の値は改行を空白にし、特約事項は各行を \ で始まる本文行にする
+// （"# " や "> " で始まる行が表題や署名行として描画されないようにするため）。
+// テンプレートで行頭に名前などを差し込む場合は、その行を \ で始める
+func escapeContractData(data *ContractTemplateData) {
+	for _, party := range []*ContractParty{&data.Seller, &data.Buyer} {
+		party.DisplayName = singleLine(party.DisplayName)
+		party.CompanyName = singleLine(party.CompanyName)
+		party.Prefecture = singleLine(party.Prefecture)
+	}
+	data.Listing.ID = singleLine(data.Listing.ID)
+	data.Listing.Title = singleLine(data.Listing.Title)
+	data.Terms.ClosingDate = singleLine(data.Terms.ClosingDate)
+	if len(data.Terms.Assets) > 0 {
+		assets := make([]string, len(data.Terms.Assets))
+		for i, asset := range data.Terms.Assets {
+			assets[i] = singleLine(asset)
+		}
+		data.Terms.Assets = assets
+	}
+
+	if strings.TrimSpace(data.Terms.SpecialTerms) == "" {
+		data.Terms.SpecialTerms = ""
+		return
+	}
+	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(data.Terms.SpecialTerms), "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line != "" {
+			line = `\` + line
+		}
+		lines[i] = line
+	}
+	data.Terms.SpecialTerms = strings.Join(lines, "\n")
+}
+
+// singleLine replaces line breaks with spaces
+func singleLine(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == '\r' }), " ")
+}
+
+// RenderContractPDF renders contract markup (see the markup description at the top of this file) to PDF
+func RenderContractPDF(info models.ContractTemplateInfo, text string, created time.Time) []byte {
+	pdf := NewPDFWriter(info.Title, "APPEXIT", created)
+	bullet := "・"
+	if info.Language == "en" {
+		bullet = "• "
+	}
+	blank := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		switch {
+		case line == "":
+			// 連続する空行は1つにまとめる
+			if !blank {
+				pdf.Space(5)
+			}
+			blank = true
+			continue
+		case strings.HasPrefix(line, `\`):
+			pdf.Paragraph(strings.TrimPrefix(line, `\`))
+		case strings.HasPrefix(line, "# "):
+			pdf.Title(strings.TrimPrefix(line, "# "))
+		case strings.HasPrefix(line, "## "):
+			pdf.Heading(strings.TrimPrefix(line, "## "))
+		case strings.HasPrefix(line, "> "):
+			pdf.Text(strings.TrimPrefix(line, "> "), 10.5, PDFAlignRight, 0)
+		case strings.HasPrefix(line, "- "):
+			pdf.Text(bullet+strings.TrimPrefix(line, "- "), 10.5, PDFAlignLeft, 12)
+		default:
+			pdf.Paragraph(line)
+		}
+		blank = false
+	}
+	return pdf.Bytes()
+}
+
+// FormatYen formats an amount with thousands separators (e.g. 1,200,000)
+func FormatYen(v int64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	digits := fmt.Sprintf("%d", v)
+	var b strings.Builder
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return sign + b.String()
+}
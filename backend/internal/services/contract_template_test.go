@@ -0,0 +1,39 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+func TestRenderContractTextEscapesUserMarkup(t *testing.T) {
+	names := []string{"# Evil", "## Evil", "> Evil", "- Evil", `\# Evil`}
+
+	for _, info := range ListContractTemplates() {
+		for _, name := range names {
+			data := ContractTemplateData{
+				DocumentID: "doc",
+				Date:       time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+				Seller:     ContractParty{CompanyName: name},
+				Buyer:      ContractParty{DisplayName: name},
+				Listing:    ContractListing{ID: "post", Title: name},
+				Terms: models.ContractTerms{
+					ClosingDate:  name,
+					Assets:       []string{name},
+					SpecialTerms: name + "\n" + name,
+				},
+			}
+			_, text, err := RenderContractText(info.Type, info.Language, info.Version, data)
+			if err != nil {
+				t.Fatalf("%s.%s.v%d: %v", info.Type, info.Language, info.Version, err)
+			}
+			for _, line := range strings.Split(text, "\n") {
+				if strings.HasPrefix(line, name) {
+					t.Errorf("%s.%s.v%d: user value at the start of a line is not escaped: %q", info.Type, info.Language, info.Version, line)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const downloadTokenAudience = "appexit-download"
+
+// ErrInvalidDownloadToken is returned when a download token is malformed, expired or signed with another key
+var ErrInvalidDownloadToken = errors.New("invalid or expired download token")
+
+// DownloadClaims binds a proxy URL to one viewer, one file and one action
+type DownloadClaims struct {
+	Resource   string `json:"res"` // data_room_file | contract_document | message_attachment
+	ResourceID string `json:"rid"`
+	Action     string `json:"act"` // view | download
+	jwt.RegisteredClaims
+}
+
+// downloadTokenKey derives the signing key from the JWT secret.
+// 🔒 SECURITY: 認証トークンと同じ鍵で署名しないことで、ダウンロード用トークンをAPIの認証に流用できないようにする
+func downloadTokenKey(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("appexit-download-token"))
+	return mac.Sum(nil)
+}
+
+// SignDownloadToken issues a short-lived token for the download proxy
+func SignDownloadToken(secret, userID, resource, resourceID, action string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := DownloadClaims{
+		Resource:   resource,
+		ResourceID: resourceID,
+		Action:     action,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{downloadTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(downloadTokenKey(secret))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign download token: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+// VerifyDownloadToken validates a token issued by SignDownloadToken.
+// The caller dispatches on claims.Resource and must check the viewer's access again.
+func VerifyDownloadToken(secret, tokenString string) (*DownloadClaims, error) {
+	claims := &DownloadClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return downloadTokenKey(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(downloadTokenAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, ErrInvalidDownloadToken
+	}
+	if claims.Resource == "" || claims.Subject == "" || claims.ResourceID == "" {
+		return nil, ErrInvalidDownloadToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds a whole SMTP conversation (接続から送信完了まで)
+const smtpTimeout = 30 * time.Second
+
+var (
+	// ErrEmailBounced is returned when the server permanently rejects the recipient.
+	// 宛先は配信停止リストに入れ、以降は送信しない
+	ErrEmailBounced = errors.New("recipient rejected")
+	// ErrEmailRejected is returned when the server permanently rejects the message for another reason
+	ErrEmailRejected = errors.New("message rejected")
+)
+
+// EmailMessage is a plain-text email to send
+type EmailMessage struct {
+	ID      string // outboxのID（Message-IDに使う）
+	From    string // "Name <address>" または "address"
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails. Errors wrap ErrEmailBounced or ErrEmailRejected when retrying would not help.
+type Mailer interface {
+	Send(msg EmailMessage) error
+}
+
+// SMTPMailer sends emails over SMTP (STARTTLS when offered, implicit TLS on port 465).
+// 認証情報が空の場合は認証しない（MailHog などローカルの受信サーバー向け）
+type SMTPMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+}
+
+// NewSMTPMailer creates a mailer for the given server
+func NewSMTPMailer(host string, port int, username, password string) *SMTPMailer {
+	return &SMTPMailer{host: host, port: port, username: username, password: password}
+}
+
+// Send delivers a message
+func (m *SMTPMailer) Send(msg EmailMessage) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("%w: invalid sender address: %v", ErrEmailRejected, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%w: invalid recipient address: %v", ErrEmailBounced, err)
+	}
+	raw := buildEmail(msg, from, to)
+
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	if m.port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: m.host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if m.port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+				return fmt.Errorf("STARTTLS failed: %w", err)
+			}
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return classifySMTPError("MAIL FROM", err, ErrEmailRejected)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return classifySMTPError("RCPT TO", err, ErrEmailBounced)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return classifySMTPError("DATA", err, ErrEmailRejected)
+	}
+	if _, err := w.Write(raw); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return classifySMTPError("DATA", err, ErrEmailRejected)
+	}
+	return client.Quit()
+}
+
+// classifySMTPError wraps permanent (5xx) replies with the given error so that they are not retried
+func classifySMTPError(command string, err error, permanent error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return fmt.Errorf("%w: %s: %d %s", permanent, command, reply.Code, reply.Msg)
+	}
+	return fmt.Errorf("%s failed: %w", command, err)
+}
+
+// buildEmail encodes a plain-text UTF-8 message (本文はbase64で送る)
+func buildEmail(msg EmailMessage, from, to *mail.Address) []byte {
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+
+	var b bytes.Buffer
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", msg.ID, domain))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=UTF-8")
+	header("Content-Transfer-Encoding", "base64")
+	header("Auto-Submitted", "auto-generated")
+	b.WriteString("\r\n")
+
+	body := strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return b.Bytes()
+}
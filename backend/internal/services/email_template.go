@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+// Email templates are plain-text Go templates named {template}.{language}.tmpl.
+// The first line is the subject ("Subject: ..."), followed by a blank line and the body.
+// 差し込む値は Fields に入れる（未定義のキーを参照するとエラーになる）
+//
+//go:embed email_templates/*.tmpl
+var emailTemplateFiles embed.FS
+
+// ErrEmailTemplateNotFound is returned when no template matches the name
+var ErrEmailTemplateNotFound = errors.New("email template not found")
+
+// defaultEmailLanguage is used when the recipient's language has no template
+const defaultEmailLanguage = "ja"
+
+// EmailTemplateData is the data passed to an email template
+type EmailTemplateData struct {
+	Language      string
+	RecipientName string
+	AppURL        string // フロントエンドのURL
+	Link          string // 関連ページの絶対URL（ない場合は空）
+	Fields        map[string]interface{}
+}
+
+// emailFooters are appended to every email
+var emailFooters = map[string]string{
+	"ja": "\n\n――――――――――――――――\nAPPEXIT\nこのメールは送信専用です。返信いただいてもお答えできません。\nメール通知の設定はサイトの通知設定から変更できます: %s/settings/notifications\n",
+	"en": "\n\n----------------\nAPPEXIT\nThis is an automated message. Replies to this address are not monitored.\nYou can change your email notification settings here: %s/settings/notifications\n",
+}
+
+// defaultRecipientNames are used in the salutation when the recipient has no display name
+var defaultRecipientNames = map[string]string{
+	"ja": "ご利用者",
+	"en": "Customer",
+}
+
+var emailTemplates = mustLoadEmailTemplates()
+
+func mustLoadEmailTemplates() map[string]*template.Template {
+	entries, err := emailTemplateFiles.ReadDir("email_templates")
+	if err != nil {
+		panic(err)
+	}
+
+	templates := make(map[string]*template.Template, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".tmpl")
+		parts := strings.Split(name, ".")
+		if len(parts) != 2 || emailFooters[parts[1]] == "" {
+			panic(fmt.Sprintf("invalid email template name: %s", entry.Name()))
+		}
+		source, err := emailTemplateFiles.ReadFile(path.Join("email_templates", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		if !strings.HasPrefix(string(source), "Subject: ") {
+			panic(fmt.Sprintf("email template %s has no subject line", entry.Name()))
+		}
+		templates[name] = template.Must(template.New(name).Funcs(contractTemplateFuncs).Option("missingkey=error").Parse(string(source)))
+	}
+	return templates
+}
+
+// RenderEmail fills a template in the given language (Japanese if there is none) and returns
+// the language used, the subject and the body
+func RenderEmail(name models.EmailTemplate, language string, data EmailTemplateData) (string, string, string, error) {
+	t, ok := emailTemplates[string(name)+"."+language]
+	if !ok {
+		language = defaultEmailLanguage
+		if t, ok = emailTemplates[string(name)+"."+language]; !ok {
+			return "", "", "", ErrEmailTemplateNotFound
+		}
+	}
+	data.Language = language
+	if data.RecipientName == "" {
+		data.RecipientName = defaultRecipientNames[language]
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return language, "", "", fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+	subject, body, _ := strings.Cut(buf.String(), "\n")
+	subject = strings.TrimSpace(strings.TrimPrefix(subject, "Subject: "))
+	body = strings.TrimSpace(body) + fmt.Sprintf(emailFooters[language], data.AppURL)
+	return language, subject, body, nil
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+// 各観点の配点（合計100）
+const (
+	matchWeightPrice     = 35
+	matchWeightCategory  = 30
+	matchWeightOperation = 15
+	matchWeightTiming    = 20
+
+	// MatchThreshold is the minimum score counted as a matching buyer
+	MatchThreshold = 60
+	// StrongMatchThreshold is the minimum score counted as a strong match
+	StrongMatchThreshold = 80
+)
+
+// 買い手の運営体制（RegisterPageClient の operationTypes と対応）
+const (
+	operationTypeInHouse    = "内製"
+	operationTypeOutsourced = "外注"
+	operationTypeFund       = "ファンド"
+	operationTypeIndividual = "個人投資"
+)
+
+var (
+	timingPattern = regexp.MustCompile(`(\d+)\s*(ヶ月|か月|カ月|ケ月|箇月|ヵ月|months?|年|years?|週間|週|weeks?)`)
+	hoursPattern  = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(時間|h|hours?|hrs?)`)
+	fullWidth     = strings.NewReplacer("０", "0", "１", "1", "２", "2", "３", "3", "４", "4", "５", "5", "６", "6", "７", "7", "８", "8", "９", "9", "．", ".")
+)
+
+// ScoreListing scores a listing against a buyer's criteria.
+// Dimensions where either side has no data get half of their weight so that
+// incomplete profiles are neither rewarded nor excluded.
+func ScoreListing(criteria models.MatchCriteria, post models.Post) models.MatchScore {
+	var score models.MatchScore
+
+	score.Price = scorePrice(criteria, post, &score.Reasons)
+	score.Category = scoreCategory(criteria, post, &score.Reasons)
+	score.Operation = scoreOperation(criteria, post, &score.Reasons)
+	score.Timing = scoreTiming(criteria, post, &score.Reasons)
+	score.Score = score.Price + score.Category + score.Operation + score.Timing
+
+	return score
+}
+
+// BestScore returns the highest score of a listing across several criteria rows of the same user
+// (a user can have both buyer and advisor profiles)
+func BestScore(criteriaList []models.MatchCriteria, post models.Post) (models.MatchScore, bool) {
+	var best models.MatchScore
+	found := false
+	for _, c := range criteriaList {
+		if !c.HasCriteria() {
+			continue
+		}
+		s := ScoreListing(c, post)
+		if !found || s.Score > best.Score {
+			best = s
+			found = true
+		}
+	}
+	return best, found
+}
+
+func scorePrice(c models.MatchCriteria, post models.Post, reasons *[]string) int {
+	if post.Price == nil || (c.InvestmentMin == nil && c.InvestmentMax == nil) {
+		return matchWeightPrice / 2
+	}
+	price := float64(*post.Price)
+
+	var ratio float64
+	switch {
+	case c.InvestmentMin != nil && price < float64(*c.InvestmentMin):
+		minBudget := float64(*c.InvestmentMin)
+		if minBudget > 0 {
+			ratio = (minBudget - price) / minBudget
+		}
+	case c.InvestmentMax != nil && price > float64(*c.InvestmentMax):
+		maxBudget := float64(*c.InvestmentMax)
+		if maxBudget <= 0 {
+			return 0
+		}
+		ratio = (price - maxBudget) / maxBudget
+	default:
+		*reasons = append(*reasons, "price_in_range")
+		return matchWeightPrice
+	}
+
+	// 予算から50%以上外れたら0点
+	points := int(math.Round(float64(matchWeightPrice) * (1 - ratio*2)))
+	if points < 0 {
+		return 0
+	}
+	if points > 0 {
+		*reasons = append(*reasons, "price_near_range")
+	}
+	return points
+}
+
+func scoreCategory(c models.MatchCriteria, post models.Post, reasons *[]string) int {
+	targets := normalizeSet(c.TargetCategories)
+	expertise := normalizeSet(c.Expertise)
+	if len(targets) == 0 && len(expertise) == 0 {
+		return matchWeightCategory / 2
+	}
+
+	categories := normalizeSet(post.AppCategories)
+	if len(categories) == 0 && len(post.TechStack) == 0 {
+		return matchWeightCategory / 2
+	}
+
+	overlap := 0
+	for cat := range categories {
+		if targets[cat] {
+			overlap++
+		}
+	}
+
+	points := 0
+	if overlap > 0 {
+		points = 20 + int(math.Round(10*math.Min(1, float64(overlap)/float64(len(categories)))))
+		*reasons = append(*reasons, "category_match")
+	}
+
+	// アドバイザーの専門領域がカテゴリまたは技術スタックに含まれる場合は加点
+	if len(expertise) > 0 {
+		for _, v := range append(append([]string{}, post.AppCategories...), post.TechStack...) {
+			if expertise[normalizeTerm(v)] {
+				points += 10
+				*reasons = append(*reasons, "expertise_match")
+				break
+			}
+		}
+	}
+
+	if points > matchWeightCategory {
+		points = matchWeightCategory
+	}
+	return points
+}
+
+func scoreOperation(c models.MatchCriteria, post models.Post, reasons *[]string) int {
+	if c.OperationType == nil || strings.TrimSpace(*c.OperationType) == "" {
+		return matchWeightOperation / 2
+	}
+	operationType := strings.TrimSpace(*c.OperationType)
+
+	hours, hasHours := -1.0, false
+	if post.OperationEffort != nil {
+		hours, hasHours = ParseWeeklyHours(*post.OperationEffort)
+	}
+	corporate := post.OperationForm != nil && *post.OperationForm == "corporate"
+
+	switch operationType {
+	case operationTypeInHouse:
+		// 自社で運営できるため工数は問わない
+		*reasons = append(*reasons, "operation_in_house")
+		return matchWeightOperation
+	case operationTypeFund:
+		if corporate {
+			*reasons = append(*reasons, "operation_corporate")
+			return matchWeightOperation
+		}
+		return 10
+	case operationTypeIndividual:
+		if !hasHours {
+			return matchWeightOperation / 2
+		}
+		if hours <= 10 {
+			*reasons = append(*reasons, "low_operation_effort")
+			return matchWeightOperation
+		}
+		if hours <= 20 {
+			return 8
+		}
+		return 2
+	case operationTypeOutsourced:
+		if !hasHours {
+			return matchWeightOperation / 2
+		}
+		if hours <= 20 {
+			*reasons = append(*reasons, "low_operation_effort")
+			return matchWeightOperation
+		}
+		return 8
+	default:
+		return matchWeightOperation / 2
+	}
+}
+
+func scoreTiming(c models.MatchCriteria, post models.Post, reasons *[]string) int {
+	if c.DesiredAcquisitionTiming == nil || post.DesiredTransferTiming == nil {
+		return matchWeightTiming / 2
+	}
+	buyerMonths, ok := ParseTimingMonths(*c.DesiredAcquisitionTiming)
+	if !ok {
+		return matchWeightTiming / 2
+	}
+	sellerMonths, ok := ParseTimingMonths(*post.DesiredTransferTiming)
+	if !ok {
+		return matchWeightTiming / 2
+	}
+
+	if sellerMonths <= buyerMonths {
+		*reasons = append(*reasons, "timing_match")
+		return matchWeightTiming
+	}
+	// 1ヶ月ずれるごとに3点減点
+	points := matchWeightTiming - (sellerMonths-buyerMonths)*3
+	if points < 0 {
+		return 0
+	}
+	return points
+}
+
+// ParseTimingMonths converts free-form timing text such as "3ヶ月以内", "半年", "1年", "即時" into months
+func ParseTimingMonths(text string) (int, bool) {
+	t := strings.ToLower(fullWidth.Replace(strings.TrimSpace(text)))
+	if t == "" {
+		return 0, false
+	}
+	if strings.Contains(t, "即") || strings.Contains(t, "すぐ") || strings.Contains(t, "immediate") || strings.Contains(t, "asap") {
+		return 0, true
+	}
+	if strings.Contains(t, "半年") {
+		return 6, true
+	}
+
+	m := timingPattern.FindStringSubmatch(t)
+	if m == nil {
+		// "3" のように数字だけの場合は月数とみなす
+		if n, err := strconv.Atoi(t); err == nil && n >= 0 {
+			return n, true
+		}
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	switch {
+	case strings.HasPrefix(m[2], "年") || strings.HasPrefix(m[2], "year"):
+		return n * 12, true
+	case strings.HasPrefix(m[2], "週") || strings.HasPrefix(m[2], "week"):
+		return (n + 3) / 4, true
+	default:
+		return n, true
+	}
+}
+
+// ParseWeeklyHours converts free-form effort text such as "週10時間", "月20時間", "1日2時間" into hours per week
+func ParseWeeklyHours(text string) (float64, bool) {
+	t := strings.ToLower(fullWidth.Replace(strings.TrimSpace(text)))
+	loc := hoursPattern.FindStringSubmatchIndex(t)
+	if loc == nil {
+		return 0, false
+	}
+	hours, err := strconv.ParseFloat(t[loc[2]:loc[3]], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	prefix := t[:loc[0]]
+	suffix := t[loc[1]:]
+	switch {
+	case strings.Contains(prefix, "月") || strings.Contains(suffix, "/月") || strings.Contains(suffix, "month"):
+		return hours / 4.3, true
+	case strings.Contains(prefix, "日") || strings.Contains(suffix, "/日") || strings.Contains(suffix, "day"):
+		return hours * 5, true
+	default:
+		return hours, true
+	}
+}
+
+func normalizeSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		if n := normalizeTerm(v); n != "" {
+			set[n] = true
+		}
+	}
+	return set
+}
+
+func normalizeTerm(v string) string {
+	return strings.ToLower(strings.TrimSpace(v))
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+// NDADocumentVersion identifies the wording of the standard NDA.
+// 文面を変更した場合はバージョンを上げる（締結済みのハッシュは旧バージョンの文面で検証できるようにする）
+const NDADocumentVersion = "appexit-nda-2025-02"
+
+// ndaTransitions lists the allowed status transitions of the NDA workflow.
+// 署名は両当事者が揃うまで approved のまま、揃った時点で signed になる
+var ndaTransitions = map[models.NDAStatus][]models.NDAStatus{
+	models.NDAStatusRequested: {models.NDAStatusApproved, models.NDAStatusDeclined, models.NDAStatusCancelled},
+	models.NDAStatusApproved:  {models.NDAStatusSigned, models.NDAStatusCancelled},
+	models.NDAStatusSigned:    {models.NDAStatusRevoked, models.NDAStatusExpired},
+}
+
+// ndaScopeRank orders scopes from narrowest to broadest
+var ndaScopeRank = map[models.NDAScope]int{
+	models.NDAScopeListing: 1,
+	models.NDAScopeSeller:  2,
+	models.NDAScopeOrg:     3,
+}
+
+// ValidNDAScope reports whether the scope is known
+func ValidNDAScope(scope models.NDAScope) bool {
+	_, ok := ndaScopeRank[scope]
+	return ok
+}
+
+// NDAScopeIncludes reports whether scope a unlocks at least everything scope b does
+func NDAScopeIncludes(a, b models.NDAScope) bool {
+	return ndaScopeRank[a] >= ndaScopeRank[b]
+}
+
+// NDAGrant is the part of a signed agreement that decides which listings it unlocks
+type NDAGrant struct {
+	Scope         models.NDAScope
+	PostID        string // listing スコープの対象案件
+	ContactUserID string // seller スコープの対象（組織の場合は窓口ユーザー）
+	ExpiresAt     *time.Time
+}
+
+// Active reports whether the grant has not lapsed at the given time
+func (g NDAGrant) Active(now time.Time) bool {
+	return g.ExpiresAt == nil || g.ExpiresAt.After(now)
+}
+
+// Covers reports whether the grant unlocks a post of the same seller.
+// postID が空の場合は売り手単位の判定（listing スコープは該当しない）
+// 判定条件はDBの nda_covers_post() と揃える
+func (g NDAGrant) Covers(authorUserID, postID string) bool {
+	switch g.Scope {
+	case models.NDAScopeOrg:
+		return true
+	case models.NDAScopeSeller:
+		return g.ContactUserID == "" || g.ContactUserID == authorUserID
+	case models.NDAScopeListing:
+		return postID != "" && g.PostID == postID
+	default:
+		return false
+	}
+}
+
+// NDAScopeLabel returns the Japanese description of a scope used in documents and messages
+func NDAScopeLabel(scope models.NDAScope, postID string) string {
+	switch scope {
+	case models.NDAScopeListing:
+		if postID == "" {
+			return "対象案件のみ"
+		}
+		return "案件ID " + postID + " の案件のみ"
+	case models.NDAScopeOrg:
+		return "売り手組織が開示する全ての案件"
+	default:
+		return "売り手が開示する全ての案件"
+	}
+}
+
+// NDAExpiryLabel returns the expiry shown in documents and messages
+func NDAExpiryLabel(expiresAt *time.Time) string {
+	if expiresAt == nil {
+		return "定めなし"
+	}
+	return expiresAt.UTC().Format(time.RFC3339)
+}
+
+// CanTransitionNDA reports whether an agreement may move from one status to another
+func CanTransitionNDA(from, to models.NDAStatus) bool {
+	for _, next := range ndaTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// NDADocumentParams are the values filled into the standard NDA
+type NDADocumentParams struct {
+	AgreementID string
+	BuyerName   string
+	SellerName  string
+	PostID      string
+	Scope       models.NDAScope
+	ExpiresAt   *time.Time
+	ApprovedAt  time.Time
+}
+
+// BuildNDADocument renders the standard NDA as canonical plain text.
+// The output must be deterministic for the same params because its hash is what both parties sign.
+func BuildNDADocument(p NDADocumentParams) string {
+	lines := []string{
+		"秘密保持契約書",
+		"",
+		"契約ID: " + p.AgreementID,
+		"文面バージョン: " + NDADocumentVersion,
+		"開示者（売り手）: " + p.SellerName,
+		"受領者（買い手）: " + p.BuyerName,
+		"対象: " + NDAScopeLabel(p.Scope, p.PostID),
+		"開示期限: " + NDAExpiryLabel(p.ExpiresAt),
+		"承認日時: " + p.ApprovedAt.UTC().Format(time.RFC3339),
+		"",
+		"第1条（秘密情報）",
+		"本契約において秘密情報とは、開示者がAPPEXITを通じて受領者に開示する、対象案件に関する技術情報、売上・利益等の財務情報、顧客情報その他一切の情報をいう。",
+		"",
+		"第2条（秘密保持義務）",
+		"受領者は、秘密情報を厳重に管理し、開示者の事前の書面による承諾なく第三者に開示・漏洩してはならない。",
+		"",
+		"第3条（目的外使用の禁止）",
+		"受領者は、秘密情報を対象案件の買収検討の目的以外に使用してはならない。",
+		"",
+		"第4条（秘密情報から除かれるもの）",
+		"開示時に既に公知であった情報、受領者の責によらず公知となった情報、正当な権限を有する第三者から秘密保持義務を負わずに取得した情報は、秘密情報に含まれない。",
+		"",
+		"第5条（返還・破棄）",
+		"受領者は、取引の検討を終了した場合または開示者から請求を受けた場合、秘密情報を速やかに返還または破棄する。",
+		"",
+		"第6条（有効期間）",
+		"本契約は両当事者の署名が揃った日から効力を生じ、3年間有効とする。",
+		"",
+		"第7条（開示の終了）",
+		"開示期限の到来または開示者による失効の通知により、受領者は対象案件の秘密情報を以後閲覧できなくなる。この場合も第2条から第5条の義務は前条の期間存続する。",
+		"",
+		"第8条（電子署名）",
+		"両当事者は、APPEXIT上で本文書のハッシュ値を確認の上で署名することにより、本契約に同意したものとする。",
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// HashNDADocument returns the hex-encoded SHA-256 of a rendered NDA
+func HashNDADocument(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// NDAStatusMessage returns the thread message posted when an agreement changes status
+func NDAStatusMessage(event models.NDAEventType, note string) string {
+	var text string
+	switch event {
+	case models.NDAEventRequested:
+		text = "秘密保持契約（NDA）の締結を申請しました。"
+	case models.NDAEventApproved:
+		text = "NDAの申請を承認しました。内容を確認の上、署名してください。"
+	case models.NDAEventDeclined:
+		text = "NDAの申請を見送りました。"
+	case models.NDAEventCancelled:
+		text = "NDAの申請を取り下げました。"
+	case models.NDAEventSignedByBuyer:
+		text = "買い手がNDAに署名しました。"
+	case models.NDAEventSignedBySeller:
+		text = "売り手がNDAに署名しました。"
+	case models.NDAEventSigned:
+		text = "両当事者の署名が揃い、NDAが締結されました。"
+	case models.NDAEventScopeChanged:
+		text = "NDAの対象範囲・開示期限が変更されました。"
+	case models.NDAEventRevoked:
+		text = "売り手がNDAを失効させました。対象案件の秘密情報は閲覧できなくなります。"
+	case models.NDAEventExpired:
+		text = "NDAの開示期限が到来し、失効しました。"
+	default:
+		text = fmt.Sprintf("NDAのステータスが更新されました（%s）。", event)
+	}
+	if note != "" {
+		text += "\n" + note
+	}
+	return text
+}
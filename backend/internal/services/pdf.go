@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// A4 in points and page margins (20mm)
+const (
+	pdfPageWidth    = 595.28
+	pdfPageHeight   = 841.89
+	pdfMargin       = 56.69
+	pdfFooterOffset = 28.0
+	pdfLineSpacing  = 1.6
+)
+
+// PDF text alignment
+const (
+	PDFAlignLeft = iota
+	PDFAlignCenter
+	PDFAlignRight
+)
+
+// pdfNoLineStart are characters that must not start a line (禁則処理: 行頭禁則)
+const pdfNoLineStart = "、。，．・：；？！）」』】〕〉》’”ー々ぁぃぅぇぉっゃゅょァィゥェォッャュョ,.:;?!)]}"
+
+// PDFWriter is a minimal pure-Go PDF writer for text documents (contracts, exports).
+//
+// Text is set in the non-embedded Adobe-Japan1 CID font "HeiseiKakuGo-W5" with the UniJIS-UCS2-HW-H CMap,
+// which every conforming PDF viewer can render without shipping a font file.
+// With this CMap ASCII is half-width (500/1000 em) and everything else full-width (1000/1000 em),
+// so line breaking can be computed exactly without font metrics.
+type PDFWriter struct {
+	title   string
+	author  string
+	created time.Time
+	pages   []*bytes.Buffer
+	current *bytes.Buffer
+	y       float64
+	footer  bool
+}
+
+// NewPDFWriter creates a writer. created is stored as the document creation date (output is deterministic for the same input).
+func NewPDFWriter(title, author string, created time.Time) *PDFWriter {
+	return &PDFWriter{title: title, author: author, created: created, footer: true}
+}
+
+// SetPageNumbers enables or disables the "n / N" footer (enabled by default)
+func (p *PDFWriter) SetPageNumbers(enabled bool) {
+	p.footer = enabled
+}
+
+// Title writes a centered document title
+func (p *PDFWriter) Title(text string) {
+	p.Space(6)
+	p.Text(text, 16, PDFAlignCenter, 0)
+	p.Space(10)
+}
+
+// Heading writes a section heading
+func (p *PDFWriter) Heading(text string) {
+	p.Space(6)
+	p.Text(text, 11.5, PDFAlignLeft, 0)
+	p.Space(2)
+}
+
+// Paragraph writes body text, wrapped to the page width
+func (p *PDFWriter) Paragraph(text string) {
+	p.Text(text, 10.5, PDFAlignLeft, 0)
+}
+
+// Space adds vertical space in points
+func (p *PDFWriter) Space(points float64) {
+	p.ensurePage()
+	p.y -= points
+}
+
+// Text writes wrapped text with the given font size, alignment and left indent (points)
+func (p *PDFWriter) Text(text string, size float64, align int, indent float64) {
+	p.ensurePage()
+	maxWidth := pdfPageWidth - 2*pdfMargin - indent
+	lineHeight := size * pdfLineSpacing
+
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		for _, line := range wrapPDFText(paragraph, maxWidth, size) {
+			if p.y-lineHeight < pdfMargin+pdfFooterOffset {
+				p.newPage()
+			}
+			p.y -= lineHeight
+			width := pdfTextWidth(line, size)
+			x := pdfMargin + indent
+			switch align {
+			case PDFAlignCenter:
+				x = (pdfPageWidth - width) / 2
+			case PDFAlignRight:
+				x = pdfPageWidth - pdfMargin - width
+			}
+			writePDFText(p.current, line, size, x, p.y)
+		}
+	}
+}
+
+// PageCount returns the number of pages written so far
+func (p *PDFWriter) PageCount() int {
+	return len(p.pages)
+}
+
+// Bytes assembles the PDF file
+func (p *PDFWriter) Bytes() []byte {
+	p.ensurePage()
+
+	var out bytes.Buffer
+	offsets := []int{0}
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets)-1, body)
+	}
+	stream := func(dict string, data []byte) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n<< %s /Length %d >>\nstream\n", len(offsets)-1, dict, len(data))
+		out.Write(data)
+		out.WriteString("\nendstream\nendobj\n")
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1: Catalog, 2: Pages, 3-5: Font, 6: Info, 7..: page + content pairs
+	const firstPageObj = 7
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObj+i*2)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /HeiseiKakuGo-W5-UniJIS-UCS2-HW-H /Encoding /UniJIS-UCS2-HW-H /DescendantFonts [4 0 R] >>")
+	object("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /HeiseiKakuGo-W5 " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (Japan1) /Supplement 2 >> " +
+		"/FontDescriptor 5 0 R /DW 1000 /W [231 389 500] >>")
+	object("<< /Type /FontDescriptor /FontName /HeiseiKakuGo-W5 /Flags 4 /FontBBox [-92 -250 1010 922] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 736 /StemV 69 >>")
+	object(fmt.Sprintf("<< /Title %s /Author %s /Producer (APPEXIT) /CreationDate (%s) >>",
+		pdfUTF16String(p.title), pdfUTF16String(p.author), pdfDate(p.created)))
+
+	for i, content := range p.pages {
+		data := content.Bytes()
+		if p.footer {
+			var footer bytes.Buffer
+			label := fmt.Sprintf("%d / %d", i+1, len(p.pages))
+			writePDFText(&footer, label, 8, (pdfPageWidth-pdfTextWidth(label, 8))/2, pdfMargin)
+			data = append(append([]byte{}, data...), footer.Bytes()...)
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, firstPageObj+i*2+1))
+		stream("", data)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets), xref)
+	return out.Bytes()
+}
+
+func (p *PDFWriter) ensurePage() {
+	if p.current == nil {
+		p.newPage()
+	}
+}
+
+func (p *PDFWriter) newPage() {
+	p.current = &bytes.Buffer{}
+	p.pages = append(p.pages, p.current)
+	p.y = pdfPageHeight - pdfMargin
+}
+
+// writePDFText writes one line of text at (x, y) as UCS-2 (UniJIS-UCS2-HW-H)
+func writePDFText(buf *bytes.Buffer, text string, size, x, y float64) {
+	fmt.Fprintf(buf, "BT /F1 %.2f Tf %.2f %.2f Td <%s> Tj ET\n", size, x, y, pdfUCS2Hex(text))
+}
+
+// pdfUCS2Hex encodes text as big-endian UCS-2. Characters outside the BMP are replaced with 〓 (U+3013)
+func pdfUCS2Hex(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r == '\t' {
+			r = ' '
+		}
+		if r > 0xFFFF || r < 0x20 {
+			r = 0x3013
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	return b.String()
+}
+
+// pdfUTF16String encodes a string for the document information dictionary (UTF-16BE with BOM)
+func pdfUTF16String(text string) string {
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+func pdfDate(t time.Time) string {
+	return "D:" + t.UTC().Format("20060102150405") + "Z"
+}
+
+// pdfRuneWidth returns the advance width of a rune in 1/1000 em
+func pdfRuneWidth(r rune) float64 {
+	if (r >= 0x20 && r <= 0x7E) || (r >= 0xFF61 && r <= 0xFF9F) {
+		return 500
+	}
+	return 1000
+}
+
+func pdfTextWidth(text string, size float64) float64 {
+	width := 0.0
+	for _, r := range text {
+		width += pdfRuneWidth(r)
+	}
+	return width * size / 1000
+}
+
+// wrapPDFText breaks a paragraph into lines that fit maxWidth.
+// Runs of ASCII letters/digits are kept together (English words); other characters may break anywhere,
+// except that punctuation which must not start a line hangs at the end of the previous line.
+func wrapPDFText(text string, maxWidth, size float64) []string {
+	if text == "" {
+		return []string{""}
+	}
+
+	limit := maxWidth * 1000 / size
+	var lines []string
+	var line []rune
+	lineWidth := 0.0
+
+	flush := func() {
+		lines = append(lines, strings.TrimRight(string(line), " "))
+		line = line[:0]
+		lineWidth = 0
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		// 次のトークン（英単語はひとまとまり、それ以外は1文字）
+		j := i + 1
+		if isPDFWordRune(runes[i]) {
+			for j < len(runes) && isPDFWordRune(runes[j]) {
+				j++
+			}
+		}
+		token := runes[i:j]
+		tokenWidth := 0.0
+		for _, r := range token {
+			tokenWidth += pdfRuneWidth(r)
+		}
+
+		switch {
+		case lineWidth+tokenWidth <= limit:
+			line = append(line, token...)
+			lineWidth += tokenWidth
+		case len(token) == 1 && strings.ContainsRune(pdfNoLineStart, token[0]) && len(line) > 0:
+			// ぶら下げ
+			line = append(line, token...)
+			flush()
+		case token[0] == ' ':
+			flush()
+		case tokenWidth > limit:
+			// 1行に収まらない長い単語は文字単位で分割する
+			for _, r := range token {
+				w := pdfRuneWidth(r)
+				if lineWidth+w > limit && len(line) > 0 {
+					flush()
+				}
+				line = append(line, r)
+				lineWidth += w
+			}
+		default:
+			flush()
+			line = append(line, token...)
+			lineWidth = tokenWidth
+		}
+		i = j
+	}
+	if len(line) > 0 {
+		flush()
+	}
+	return lines
+}
+
+func isPDFWordRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		r == '-' || r == '_' || r == '/' || r == '@' || r == '.' || r == ','
+}
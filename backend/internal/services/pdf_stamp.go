@@ -0,0 +1,1105 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Minimal PDF reader used to stamp existing documents (watermarks).
+// 既存のPDFは書き換えず、末尾に増分更新（incremental update）としてページの差し替えと追加オブジェクトを書き足す。
+// 対応: 通常のxrefテーブル / xrefストリーム / オブジェクトストリーム（FlateDecode, PNG predictor）
+// 非対応: 暗号化されたPDF
+
+// ErrPDFUnsupported is returned for PDFs that cannot be stamped (encrypted or unreadable)
+var ErrPDFUnsupported = errors.New("unsupported PDF")
+
+type pdfName string
+type pdfNumber string
+type pdfString []byte
+type pdfArray []interface{}
+type pdfDict map[pdfName]interface{}
+type pdfNull struct{}
+
+type pdfRef struct {
+	Num int
+	Gen int
+}
+
+type pdfStream struct {
+	Dict pdfDict
+	Data []byte
+}
+
+type pdfXrefEntry struct {
+	Type   int // 1: offset, 2: in object stream
+	Offset int // type 1: byte offset / type 2: object stream number
+	Gen    int // type 1: generation / type 2: index in the stream
+}
+
+// pdfPage is a leaf of the page tree with its inherited attributes resolved
+type pdfPage struct {
+	Ref       pdfRef
+	Dict      pdfDict
+	Resources pdfDict
+	MediaBox  [4]float64
+	Rotate    int
+}
+
+type pdfDocument struct {
+	data      []byte
+	xref      map[int]pdfXrefEntry
+	trailer   pdfDict
+	startxref int
+	objStms   map[int]*pdfObjStm
+}
+
+type pdfObjStm struct {
+	data    []byte
+	first   int
+	offsets []int
+}
+
+// ---- lexer / parser ----
+
+type pdfParser struct {
+	data []byte
+	pos  int
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if isPDFWhitespace(c) {
+			p.pos++
+		} else if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// token reads a regular token (number or keyword)
+func (p *pdfParser) token() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.data) && !isPDFWhitespace(p.data[p.pos]) && !isPDFDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+func (p *pdfParser) peekToken() string {
+	saved := p.pos
+	t := p.token()
+	p.pos = saved
+	return t
+}
+
+func (p *pdfParser) parseObject() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch c := p.data[p.pos]; {
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		p.pos += 2
+		dict := pdfDict{}
+		for {
+			p.skipSpace()
+			if p.pos+1 < len(p.data) && p.data[p.pos] == '>' && p.data[p.pos+1] == '>' {
+				p.pos += 2
+				return dict, nil
+			}
+			key, err := p.parseObject()
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(pdfName)
+			if !ok {
+				return nil, fmt.Errorf("dictionary key is not a name at %d", p.pos)
+			}
+			value, err := p.parseObject()
+			if err != nil {
+				return nil, err
+			}
+			dict[name] = value
+		}
+	case c == '<':
+		p.pos++
+		end := bytes.IndexByte(p.data[p.pos:], '>')
+		if end < 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		hex := strings.Map(func(r rune) rune {
+			if isPDFWhitespace(byte(r)) {
+				return -1
+			}
+			return r
+		}, string(p.data[p.pos:p.pos+end]))
+		p.pos += end + 1
+		if len(hex)%2 == 1 {
+			hex += "0"
+		}
+		out := make([]byte, len(hex)/2)
+		for i := range out {
+			v, err := strconv.ParseUint(hex[2*i:2*i+2], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex string")
+			}
+			out[i] = byte(v)
+		}
+		return pdfString(out), nil
+	case c == '(':
+		return p.parseLiteralString()
+	case c == '[':
+		p.pos++
+		arr := pdfArray{}
+		for {
+			p.skipSpace()
+			if p.pos < len(p.data) && p.data[p.pos] == ']' {
+				p.pos++
+				return arr, nil
+			}
+			v, err := p.parseObject()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	case c == '/':
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.data) && !isPDFWhitespace(p.data[p.pos]) && !isPDFDelimiter(p.data[p.pos]) {
+			p.pos++
+		}
+		raw := string(p.data[start:p.pos])
+		// #xx エスケープを復元
+		if strings.Contains(raw, "#") {
+			var b strings.Builder
+			for i := 0; i < len(raw); i++ {
+				if raw[i] == '#' && i+2 < len(raw) {
+					if v, err := strconv.ParseUint(raw[i+1:i+3], 16, 8); err == nil {
+						b.WriteByte(byte(v))
+						i += 2
+						continue
+					}
+				}
+				b.WriteByte(raw[i])
+			}
+			raw = b.String()
+		}
+		return pdfName(raw), nil
+	default:
+		tok := p.token()
+		switch tok {
+		case "":
+			return nil, fmt.Errorf("unexpected character %q at %d", c, p.pos)
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return pdfNull{}, nil
+		}
+		if _, err := strconv.ParseFloat(tok, 64); err != nil {
+			return nil, fmt.Errorf("unexpected token %q at %d", tok, p.pos)
+		}
+		// "n g R" は参照
+		if num, err := strconv.Atoi(tok); err == nil {
+			saved := p.pos
+			if gen, err := strconv.Atoi(p.token()); err == nil && p.token() == "R" {
+				return pdfRef{Num: num, Gen: gen}, nil
+			}
+			p.pos = saved
+		}
+		return pdfNumber(tok), nil
+	}
+}
+
+func (p *pdfParser) parseLiteralString() (interface{}, error) {
+	p.pos++ // (
+	var out []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(out), nil
+			}
+			out = append(out, c)
+		case '\\':
+			if p.pos >= len(p.data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// ---- document loading ----
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func loadPDF(data []byte) (*pdfDocument, error) {
+	doc := &pdfDocument{data: data, xref: make(map[int]pdfXrefEntry), objStms: make(map[int]*pdfObjStm)}
+
+	idx := bytes.LastIndex(data, []byte("startxref"))
+	if idx < 0 {
+		return doc, doc.rebuildXref()
+	}
+	p := &pdfParser{data: data, pos: idx + len("startxref")}
+	offset, err := strconv.Atoi(p.token())
+	if err != nil || offset <= 0 || offset >= len(data) {
+		return doc, doc.rebuildXref()
+	}
+	// startxref を設定するのはxrefを辿れた場合のみ（再構築時は増分更新に全オブジェクトのxrefを書く）
+	doc.startxref = offset
+
+	visited := make(map[int]bool)
+	for offset > 0 && !visited[offset] {
+		visited[offset] = true
+		trailer, err := doc.readXrefSection(offset)
+		if err != nil {
+			// xrefが壊れている場合はファイルを走査して再構築する
+			doc.xref = make(map[int]pdfXrefEntry)
+			doc.trailer = nil
+			doc.startxref = 0
+			return doc, doc.rebuildXref()
+		}
+		if doc.trailer == nil {
+			doc.trailer = trailer
+		}
+		// ハイブリッド形式のxrefストリーム
+		if stm, ok := trailer["XRefStm"].(pdfNumber); ok {
+			if o, err := strconv.Atoi(string(stm)); err == nil && !visited[o] {
+				visited[o] = true
+				doc.readXrefSection(o)
+			}
+		}
+		prev, ok := trailer["Prev"].(pdfNumber)
+		if !ok {
+			break
+		}
+		offset, _ = strconv.Atoi(string(prev))
+	}
+	if doc.trailer == nil {
+		return nil, ErrPDFUnsupported
+	}
+	return doc, nil
+}
+
+// readXrefSection reads a classic xref table or an xref stream at offset. Entries already known (newer) win.
+func (d *pdfDocument) readXrefSection(offset int) (pdfDict, error) {
+	p := &pdfParser{data: d.data, pos: offset}
+	if p.peekToken() == "xref" {
+		p.token()
+		for {
+			tok := p.peekToken()
+			if tok == "trailer" {
+				p.token()
+				obj, err := p.parseObject()
+				if err != nil {
+					return nil, err
+				}
+				trailer, ok := obj.(pdfDict)
+				if !ok {
+					return nil, ErrPDFUnsupported
+				}
+				return trailer, nil
+			}
+			start, err1 := strconv.Atoi(p.token())
+			count, err2 := strconv.Atoi(p.token())
+			if err1 != nil || err2 != nil {
+				return nil, ErrPDFUnsupported
+			}
+			for i := 0; i < count; i++ {
+				off, err1 := strconv.Atoi(p.token())
+				gen, err2 := strconv.Atoi(p.token())
+				kind := p.token()
+				if err1 != nil || err2 != nil {
+					return nil, ErrPDFUnsupported
+				}
+				if _, exists := d.xref[start+i]; !exists && kind == "n" {
+					d.xref[start+i] = pdfXrefEntry{Type: 1, Offset: off, Gen: gen}
+				} else if !exists {
+					d.xref[start+i] = pdfXrefEntry{Type: 0}
+				}
+			}
+		}
+	}
+
+	_, obj, err := d.parseIndirectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(*pdfStream)
+	if !ok || stream.Dict["Type"] != pdfName("XRef") {
+		return nil, ErrPDFUnsupported
+	}
+	raw, err := decodePDFStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	widths := pdfInts(stream.Dict["W"])
+	if len(widths) != 3 {
+		return nil, ErrPDFUnsupported
+	}
+	index := pdfInts(stream.Dict["Index"])
+	if len(index) == 0 {
+		index = []int{0, pdfInt(stream.Dict["Size"])}
+	}
+	rowLen := widths[0] + widths[1] + widths[2]
+	if rowLen == 0 {
+		return nil, ErrPDFUnsupported
+	}
+	field := func(row []byte, start, width int, def int) int {
+		if width == 0 {
+			return def
+		}
+		v := 0
+		for _, b := range row[start : start+width] {
+			v = v<<8 | int(b)
+		}
+		return v
+	}
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		for n := 0; n < index[i+1]; n++ {
+			if pos+rowLen > len(raw) {
+				break
+			}
+			row := raw[pos : pos+rowLen]
+			pos += rowLen
+			num := index[i] + n
+			if _, exists := d.xref[num]; exists {
+				continue
+			}
+			d.xref[num] = pdfXrefEntry{
+				Type:   field(row, 0, widths[0], 1),
+				Offset: field(row, widths[0], widths[1], 0),
+				Gen:    field(row, widths[0]+widths[1], widths[2], 0),
+			}
+		}
+	}
+	return stream.Dict, nil
+}
+
+// rebuildXref scans the file for "n g obj" headers (damaged or missing xref)
+func (d *pdfDocument) rebuildXref() error {
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(d.data, -1) {
+		num, _ := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(d.data[m[4]:m[5]]))
+		d.xref[num] = pdfXrefEntry{Type: 1, Offset: m[0], Gen: gen}
+	}
+	if idx := bytes.LastIndex(d.data, []byte("trailer")); idx >= 0 {
+		p := &pdfParser{data: d.data, pos: idx + len("trailer")}
+		if obj, err := p.parseObject(); err == nil {
+			if trailer, ok := obj.(pdfDict); ok {
+				d.trailer = trailer
+			}
+		}
+	}
+	if d.trailer == nil {
+		// xrefストリーム形式: /Root を持つ XRef ストリームを探す
+		for num := range d.xref {
+			if obj, err := d.object(num); err == nil {
+				if s, ok := obj.(*pdfStream); ok && s.Dict["Type"] == pdfName("XRef") && s.Dict["Root"] != nil {
+					d.trailer = s.Dict
+					break
+				}
+			}
+		}
+	}
+	if d.trailer == nil || d.trailer["Root"] == nil {
+		return ErrPDFUnsupported
+	}
+	size := 0
+	for num := range d.xref {
+		if num+1 > size {
+			size = num + 1
+		}
+	}
+	if pdfInt(d.trailer["Size"]) < size {
+		d.trailer["Size"] = pdfNumber(strconv.Itoa(size))
+	}
+	return nil
+}
+
+func (d *pdfDocument) parseIndirectAt(offset int) (pdfRef, interface{}, error) {
+	p := &pdfParser{data: d.data, pos: offset}
+	num, err1 := strconv.Atoi(p.token())
+	gen, err2 := strconv.Atoi(p.token())
+	if err1 != nil || err2 != nil || p.token() != "obj" {
+		return pdfRef{}, nil, fmt.Errorf("no object at offset %d", offset)
+	}
+	obj, err := p.parseObject()
+	if err != nil {
+		return pdfRef{}, nil, err
+	}
+	ref := pdfRef{Num: num, Gen: gen}
+
+	dict, ok := obj.(pdfDict)
+	if !ok || p.peekToken() != "stream" {
+		return ref, obj, nil
+	}
+	p.token()
+	if p.pos < len(p.data) && p.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+	length := -1
+	switch l := dict["Length"].(type) {
+	case pdfNumber:
+		length, _ = strconv.Atoi(string(l))
+	case pdfRef:
+		if v, err := d.object(l.Num); err == nil {
+			length = pdfInt(v)
+		}
+	}
+	end := start + length
+	if length < 0 || end > len(d.data) || !bytes.Contains(d.data[end:min(end+32, len(d.data))], []byte("endstream")) {
+		// /Length が不正な場合は endstream を探す
+		idx := bytes.Index(d.data[start:], []byte("endstream"))
+		if idx < 0 {
+			return ref, nil, io.ErrUnexpectedEOF
+		}
+		end = start + idx
+		for end > start && (d.data[end-1] == '\n' || d.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return ref, &pdfStream{Dict: dict, Data: d.data[start:end]}, nil
+}
+
+// object returns the object with the given number (parsed from the file or an object stream)
+func (d *pdfDocument) object(num int) (interface{}, error) {
+	entry, ok := d.xref[num]
+	if !ok || entry.Type == 0 {
+		return pdfNull{}, nil
+	}
+	if entry.Type == 1 {
+		_, obj, err := d.parseIndirectAt(entry.Offset)
+		return obj, err
+	}
+
+	stm, ok := d.objStms[entry.Offset]
+	if !ok {
+		container, err := d.object(entry.Offset)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := container.(*pdfStream)
+		if !ok {
+			return nil, ErrPDFUnsupported
+		}
+		raw, err := decodePDFStream(s)
+		if err != nil {
+			return nil, err
+		}
+		stm = &pdfObjStm{data: raw, first: pdfInt(s.Dict["First"])}
+		p := &pdfParser{data: raw}
+		for i := 0; i < pdfInt(s.Dict["N"]); i++ {
+			p.token() // object number
+			off, err := strconv.Atoi(p.token())
+			if err != nil {
+				return nil, ErrPDFUnsupported
+			}
+			stm.offsets = append(stm.offsets, off)
+		}
+		d.objStms[entry.Offset] = stm
+	}
+	if entry.Gen >= len(stm.offsets) {
+		return nil, ErrPDFUnsupported
+	}
+	p := &pdfParser{data: stm.data, pos: stm.first + stm.offsets[entry.Gen]}
+	return p.parseObject()
+}
+
+func (d *pdfDocument) resolve(v interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		obj, err := d.object(ref.Num)
+		if err != nil {
+			return pdfNull{}
+		}
+		v = obj
+	}
+	return pdfNull{}
+}
+
+func (d *pdfDocument) resolveDict(v interface{}) pdfDict {
+	switch o := d.resolve(v).(type) {
+	case pdfDict:
+		return o
+	case *pdfStream:
+		return o.Dict
+	}
+	return nil
+}
+
+// pages walks the page tree and returns the leaf pages in order
+func (d *pdfDocument) pages() ([]pdfPage, error) {
+	root := d.resolveDict(d.trailer["Root"])
+	if root == nil {
+		return nil, ErrPDFUnsupported
+	}
+	var pages []pdfPage
+	visited := make(map[int]bool)
+	var walk func(node interface{}, resources interface{}, mediaBox interface{}, rotate interface{}) error
+	walk = func(node interface{}, resources interface{}, mediaBox interface{}, rotate interface{}) error {
+		ref, isRef := node.(pdfRef)
+		if isRef {
+			if visited[ref.Num] {
+				return nil
+			}
+			visited[ref.Num] = true
+		}
+		dict := d.resolveDict(node)
+		if dict == nil {
+			return nil
+		}
+		if v, ok := dict["Resources"]; ok {
+			resources = v
+		}
+		if v, ok := dict["MediaBox"]; ok {
+			mediaBox = v
+		}
+		if v, ok := dict["Rotate"]; ok {
+			rotate = v
+		}
+		if kids, ok := d.resolve(dict["Kids"]).(pdfArray); ok && dict["Type"] != pdfName("Page") {
+			for _, kid := range kids {
+				if err := walk(kid, resources, mediaBox, rotate); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if !isRef {
+			return ErrPDFUnsupported
+		}
+		page := pdfPage{Ref: ref, Dict: dict, Resources: d.resolveDict(resources), MediaBox: [4]float64{0, 0, 595.28, 841.89}, Rotate: pdfInt(d.resolve(rotate))}
+		if box, ok := d.resolve(mediaBox).(pdfArray); ok && len(box) == 4 {
+			for i := range box {
+				page.MediaBox[i] = pdfFloat(d.resolve(box[i]))
+			}
+		}
+		pages = append(pages, page)
+		return nil
+	}
+	if err := walk(root["Pages"], nil, nil, nil); err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, ErrPDFUnsupported
+	}
+	return pages, nil
+}
+
+// ---- stream decoding ----
+
+func decodePDFStream(s *pdfStream) ([]byte, error) {
+	filters := []interface{}{}
+	switch f := s.Dict["Filter"].(type) {
+	case pdfName:
+		filters = append(filters, f)
+	case pdfArray:
+		filters = f
+	}
+	data := s.Data
+	for i, f := range filters {
+		if f != pdfName("FlateDecode") {
+			return nil, ErrPDFUnsupported
+		}
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out, err := io.ReadAll(r)
+		if err != nil && len(out) == 0 {
+			return nil, err
+		}
+		data = out
+
+		var params pdfDict
+		switch p := s.Dict["DecodeParms"].(type) {
+		case pdfDict:
+			params = p
+		case pdfArray:
+			if i < len(p) {
+				params, _ = p[i].(pdfDict)
+			}
+		}
+		if params != nil && pdfInt(params["Predictor"]) >= 10 {
+			columns := pdfIntDefault(params["Columns"], 1)
+			colors := pdfIntDefault(params["Colors"], 1)
+			bpc := pdfIntDefault(params["BitsPerComponent"], 8)
+			data, err = unfilterPNG(data, (columns*colors*bpc+7)/8, (colors*bpc+7)/8)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return data, nil
+}
+
+// unfilterPNG reverses PNG row filters (PDF predictors 10-15)
+func unfilterPNG(data []byte, rowLen, bpp int) ([]byte, error) {
+	if bpp < 1 {
+		bpp = 1
+	}
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+rowLen+1 <= len(data); pos += rowLen + 1 {
+		filter := data[pos]
+		row := append([]byte{}, data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, up, upLeft int
+			if i >= bpp {
+				left = int(row[i-bpp])
+				upLeft = int(prev[i-bpp])
+			}
+			up = int(prev[i])
+			switch filter {
+			case 1:
+				row[i] += byte(left)
+			case 2:
+				row[i] += byte(up)
+			case 3:
+				row[i] += byte((left + up) / 2)
+			case 4:
+				p := left + up - upLeft
+				pa, pb, pc := pdfAbs(p-left), pdfAbs(p-up), pdfAbs(p-upLeft)
+				switch {
+				case pa <= pb && pa <= pc:
+					row[i] += byte(left)
+				case pb <= pc:
+					row[i] += byte(up)
+				default:
+					row[i] += byte(upLeft)
+				}
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func pdfAbs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func pdfFloat(v interface{}) float64 {
+	if n, ok := v.(pdfNumber); ok {
+		f, _ := strconv.ParseFloat(string(n), 64)
+		return f
+	}
+	return 0
+}
+
+func pdfInt(v interface{}) int {
+	return int(math.Round(pdfFloat(v)))
+}
+
+func pdfIntDefault(v interface{}, def int) int {
+	if _, ok := v.(pdfNumber); !ok {
+		return def
+	}
+	return pdfInt(v)
+}
+
+func pdfInts(v interface{}) []int {
+	arr, ok := v.(pdfArray)
+	if !ok {
+		return nil
+	}
+	out := make([]int, 0, len(arr))
+	for _, item := range arr {
+		out = append(out, pdfInt(item))
+	}
+	return out
+}
+
+// ---- serialization ----
+
+func writePDFValue(buf *bytes.Buffer, v interface{}) {
+	switch o := v.(type) {
+	case pdfName:
+		buf.WriteByte('/')
+		for i := 0; i < len(o); i++ {
+			c := o[i]
+			if c < 0x21 || c > 0x7E || c == '#' || isPDFDelimiter(c) {
+				fmt.Fprintf(buf, "#%02X", c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	case pdfNumber:
+		buf.WriteString(string(o))
+	case pdfString:
+		fmt.Fprintf(buf, "<%X>", []byte(o))
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", o.Num, o.Gen)
+	case bool:
+		buf.WriteString(strconv.FormatBool(o))
+	case pdfArray:
+		buf.WriteByte('[')
+		for i, item := range o {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writePDFValue(buf, item)
+		}
+		buf.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(o))
+		for k := range o {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, k := range keys {
+			writePDFValue(buf, pdfName(k))
+			buf.WriteByte(' ')
+			writePDFValue(buf, o[pdfName(k)])
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(">>")
+	default:
+		buf.WriteString("null")
+	}
+}
+
+func copyPDFDict(d pdfDict) pdfDict {
+	out := make(pdfDict, len(d))
+	for k, v := range d {
+		out[k] = v
+	}
+	return out
+}
+
+// ---- incremental update ----
+
+// pdfUpdate collects objects appended to a document as an incremental update
+type pdfUpdate struct {
+	doc     *pdfDocument
+	buf     bytes.Buffer
+	offsets map[int]pdfXrefEntry
+	nextNum int
+}
+
+func newPDFUpdate(doc *pdfDocument) *pdfUpdate {
+	u := &pdfUpdate{doc: doc, offsets: make(map[int]pdfXrefEntry), nextNum: pdfInt(doc.trailer["Size"])}
+	for num := range doc.xref {
+		if num >= u.nextNum {
+			u.nextNum = num + 1
+		}
+	}
+	u.buf.WriteByte('\n')
+	return u
+}
+
+func (u *pdfUpdate) base() int {
+	return len(u.doc.data)
+}
+
+// add appends a new object and returns its reference
+func (u *pdfUpdate) add(v interface{}) pdfRef {
+	ref := pdfRef{Num: u.nextNum}
+	u.nextNum++
+	u.replace(ref, v)
+	return ref
+}
+
+// addStream appends a new Flate-compressed stream object
+func (u *pdfUpdate) addStream(dict pdfDict, data []byte) pdfRef {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+
+	ref := pdfRef{Num: u.nextNum}
+	u.nextNum++
+	d := copyPDFDict(dict)
+	d["Filter"] = pdfName("FlateDecode")
+	d["Length"] = pdfNumber(strconv.Itoa(compressed.Len()))
+	u.offsets[ref.Num] = pdfXrefEntry{Type: 1, Offset: u.base() + u.buf.Len(), Gen: 0}
+	fmt.Fprintf(&u.buf, "%d 0 obj\n", ref.Num)
+	writePDFValue(&u.buf, d)
+	u.buf.WriteString("\nstream\n")
+	u.buf.Write(compressed.Bytes())
+	u.buf.WriteString("\nendstream\nendobj\n")
+	return ref
+}
+
+// replace writes a new version of an existing object
+func (u *pdfUpdate) replace(ref pdfRef, v interface{}) {
+	u.offsets[ref.Num] = pdfXrefEntry{Type: 1, Offset: u.base() + u.buf.Len(), Gen: ref.Gen}
+	fmt.Fprintf(&u.buf, "%d %d obj\n", ref.Num, ref.Gen)
+	writePDFValue(&u.buf, v)
+	u.buf.WriteString("\nendobj\n")
+}
+
+// bytes returns the original document followed by the update, its xref table and trailer
+func (u *pdfUpdate) bytes(extraTrailer pdfDict) []byte {
+	// xrefを再構築した文書は /Prev で辿れないため、既存オブジェクトの位置も書き出す
+	if u.doc.startxref == 0 {
+		for num, e := range u.doc.xref {
+			if _, ok := u.offsets[num]; !ok && e.Type == 1 {
+				u.offsets[num] = e
+			}
+		}
+	}
+	nums := make([]int, 0, len(u.offsets))
+	for num := range u.offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	xrefOffset := u.base() + u.buf.Len()
+	u.buf.WriteString("xref\n")
+	if u.doc.startxref == 0 {
+		u.buf.WriteString("0 1\n0000000000 65535 f \n")
+	}
+	for i := 0; i < len(nums); {
+		j := i
+		for j+1 < len(nums) && nums[j+1] == nums[j]+1 {
+			j++
+		}
+		fmt.Fprintf(&u.buf, "%d %d\n", nums[i], j-i+1)
+		for _, num := range nums[i : j+1] {
+			e := u.offsets[num]
+			fmt.Fprintf(&u.buf, "%010d %05d n \n", e.Offset, e.Gen)
+		}
+		i = j + 1
+	}
+
+	trailer := pdfDict{
+		"Size": pdfNumber(strconv.Itoa(u.nextNum)),
+		"Root": u.doc.trailer["Root"],
+	}
+	if u.doc.startxref > 0 {
+		trailer["Prev"] = pdfNumber(strconv.Itoa(u.doc.startxref))
+	}
+	for _, key := range []pdfName{"Info", "ID"} {
+		if v, ok := u.doc.trailer[key]; ok {
+			trailer[key] = v
+		}
+	}
+	for k, v := range extraTrailer {
+		trailer[k] = v
+	}
+	u.buf.WriteString("trailer\n")
+	writePDFValue(&u.buf, trailer)
+	fmt.Fprintf(&u.buf, "\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	out := make([]byte, 0, len(u.doc.data)+u.buf.Len())
+	out = append(out, u.doc.data...)
+	return append(out, u.buf.Bytes()...)
+}
+
+// StampPDFPages overlays text on every page of an existing PDF.
+// overlay receives the page media box [x0 y0 x1 y1] and returns content stream operators that may use
+// the font /APXWMF (HeiseiKakuGo-W5, UCS-2 hex strings as in PDFWriter) and the graphics states
+// /APXWMGS (faint) and /APXWMGF (footer). trailerEntries are written as strings into the trailer of the update.
+func StampPDFPages(data []byte, overlay func(mediaBox [4]float64, rotate int) string, trailerEntries map[string]string) ([]byte, error) {
+	doc, err := loadPDF(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, encrypted := doc.trailer["Encrypt"]; encrypted {
+		return nil, ErrPDFUnsupported
+	}
+	pages, err := doc.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	u := newPDFUpdate(doc)
+	descriptor := u.add(pdfDict{
+		"Type":        pdfName("FontDescriptor"),
+		"FontName":    pdfName("HeiseiKakuGo-W5"),
+		"Flags":       pdfNumber("4"),
+		"FontBBox":    pdfArray{pdfNumber("-92"), pdfNumber("-250"), pdfNumber("1010"), pdfNumber("922")},
+		"ItalicAngle": pdfNumber("0"),
+		"Ascent":      pdfNumber("880"),
+		"Descent":     pdfNumber("-120"),
+		"CapHeight":   pdfNumber("736"),
+		"StemV":       pdfNumber("69"),
+	})
+	cidFont := u.add(pdfDict{
+		"Type":           pdfName("Font"),
+		"Subtype":        pdfName("CIDFontType0"),
+		"BaseFont":       pdfName("HeiseiKakuGo-W5"),
+		"CIDSystemInfo":  pdfDict{"Registry": pdfString("Adobe"), "Ordering": pdfString("Japan1"), "Supplement": pdfNumber("2")},
+		"FontDescriptor": descriptor,
+		"DW":             pdfNumber("1000"),
+		"W":              pdfArray{pdfNumber("231"), pdfNumber("389"), pdfNumber("500")},
+	})
+	font := u.add(pdfDict{
+		"Type":            pdfName("Font"),
+		"Subtype":         pdfName("Type0"),
+		"BaseFont":        pdfName("HeiseiKakuGo-W5-UniJIS-UCS2-HW-H"),
+		"Encoding":        pdfName("UniJIS-UCS2-HW-H"),
+		"DescendantFonts": pdfArray{cidFont},
+	})
+	faint := u.add(pdfDict{"Type": pdfName("ExtGState"), "ca": pdfNumber("0.16"), "CA": pdfNumber("0.16")})
+	footer := u.add(pdfDict{"Type": pdfName("ExtGState"), "ca": pdfNumber("0.7"), "CA": pdfNumber("0.7")})
+	// 元のコンテンツの描画状態を q/Q で閉じてから重ねる
+	open := u.addStream(pdfDict{}, []byte("q\n"))
+
+	overlays := make(map[string]pdfRef)
+	for _, page := range pages {
+		key := fmt.Sprintf("%v/%d", page.MediaBox, page.Rotate)
+		overlayRef, ok := overlays[key]
+		if !ok {
+			overlayRef = u.addStream(pdfDict{}, []byte("Q\n"+overlay(page.MediaBox, page.Rotate)))
+			overlays[key] = overlayRef
+		}
+
+		resources := copyPDFDict(page.Resources)
+		fonts := copyPDFDict(doc.resolveDict(resources["Font"]))
+		fonts["APXWMF"] = font
+		resources["Font"] = fonts
+		states := copyPDFDict(doc.resolveDict(resources["ExtGState"]))
+		states["APXWMGS"] = faint
+		states["APXWMGF"] = footer
+		resources["ExtGState"] = states
+
+		contents := pdfArray{open}
+		switch c := page.Dict["Contents"].(type) {
+		case pdfRef:
+			if arr, ok := doc.resolve(c).(pdfArray); ok {
+				contents = append(contents, arr...)
+			} else {
+				contents = append(contents, c)
+			}
+		case pdfArray:
+			contents = append(contents, c...)
+		}
+		contents = append(contents, overlayRef)
+
+		dict := copyPDFDict(page.Dict)
+		dict["Resources"] = resources
+		dict["Contents"] = contents
+		u.replace(page.Ref, dict)
+	}
+
+	extra := make(pdfDict, len(trailerEntries))
+	for k, v := range trailerEntries {
+		extra[pdfName(k)] = pdfString(v)
+	}
+	return u.bytes(extra), nil
+}
+
+// pdfTrailerString returns a string entry of the latest trailer
+func pdfTrailerString(data []byte, key string) (string, error) {
+	doc, err := loadPDF(data)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := doc.trailer[pdfName(key)].(pdfString); ok {
+		return string(v), nil
+	}
+	return "", nil
+}
+
+// pdfPageContents returns the decoded content streams of every page
+func pdfPageContents(data []byte) ([][]byte, error) {
+	doc, err := loadPDF(data)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := doc.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	var contents [][]byte
+	for _, page := range pages {
+		refs := pdfArray{}
+		switch c := doc.resolve(page.Dict["Contents"]).(type) {
+		case pdfArray:
+			refs = c
+		case *pdfStream:
+			refs = pdfArray{c}
+		}
+		for _, ref := range refs {
+			stream, ok := doc.resolve(ref).(*pdfStream)
+			if !ok {
+				continue
+			}
+			if decoded, err := decodePDFStream(stream); err == nil {
+				contents = append(contents, decoded)
+			}
+		}
+	}
+	return contents, nil
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+// Bulk import/export formats
+const (
+	PostImportFormatCSV   = "csv"
+	PostImportFormatJSONL = "jsonl"
+)
+
+// CSVの配列セルの区切り文字（"[...]" で始まる場合はJSON配列として解釈）
+const postCSVListSeparator = "|"
+
+type postColumnKind int
+
+const (
+	postColumnString postColumnKind = iota
+	postColumnInt
+	postColumnBool
+	postColumnList
+	postColumnDate
+)
+
+type postColumn struct {
+	name string
+	kind postColumnKind
+}
+
+// postImportColumns is derived from the json tags of CreatePostRequest so that the
+// import/export format always matches the create API
+var postImportColumns = func() []postColumn {
+	t := reflect.TypeOf(models.CreatePostRequest{})
+	dateType := reflect.TypeOf(models.Date{})
+	columns := make([]postColumn, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		kind := postColumnString
+		switch {
+		case ft == dateType:
+			kind = postColumnDate
+		case ft.Kind() == reflect.Slice:
+			kind = postColumnList
+		case ft.Kind() == reflect.Int || ft.Kind() == reflect.Int64:
+			kind = postColumnInt
+		case ft.Kind() == reflect.Bool:
+			kind = postColumnBool
+		}
+		columns = append(columns, postColumn{name: name, kind: kind})
+	}
+	return columns
+}()
+
+// PostImportColumnNames returns the column names accepted by the import and produced by the export
+func PostImportColumnNames() []string {
+	names := make([]string, 0, len(postImportColumns))
+	for _, c := range postImportColumns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// PostImportRow is one parsed row of a bulk import (Line is 1-based, header excluded for CSV)
+type PostImportRow struct {
+	Line    int
+	Request *models.CreatePostRequest
+	Err     error
+}
+
+// ParsePostImport parses CSV (header row = CreatePostRequest json names) or JSON lines into requests.
+// Row-level problems are returned in PostImportRow.Err; only structural problems return an error.
+func ParsePostImport(format string, data []byte) ([]PostImportRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	switch format {
+	case PostImportFormatCSV:
+		return parsePostImportCSV(data)
+	case PostImportFormatJSONL:
+		return parsePostImportJSONL(data)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func parsePostImportCSV(data []byte) ([]PostImportRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	known := make(map[string]postColumn, len(postImportColumns))
+	for _, c := range postImportColumns {
+		known[c.name] = c
+	}
+	columns := make([]postColumn, len(header))
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(h))
+		c, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column: %s", h)
+		}
+		columns[i] = c
+	}
+
+	rows := make([]PostImportRow, 0)
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rows = append(rows, PostImportRow{Line: line, Err: err})
+			continue
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+
+		values := make(map[string]interface{})
+		var rowErr error
+		for i, cell := range record {
+			if i >= len(columns) {
+				rowErr = fmt.Errorf("too many fields (expected %d)", len(columns))
+				break
+			}
+			cell = strings.TrimSpace(cell)
+			if cell == "" {
+				continue
+			}
+			v, err := parsePostCell(columns[i], cell)
+			if err != nil {
+				rowErr = err
+				break
+			}
+			values[columns[i].name] = v
+		}
+		if rowErr != nil {
+			rows = append(rows, PostImportRow{Line: line, Err: rowErr})
+			continue
+		}
+
+		req, err := decodeCreatePostRequest(values)
+		rows = append(rows, PostImportRow{Line: line, Request: req, Err: err})
+	}
+	return rows, nil
+}
+
+func parsePostImportJSONL(data []byte) ([]PostImportRow, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	rows := make([]PostImportRow, 0)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+		var req models.CreatePostRequest
+		if err := decoder.Decode(&req); err != nil {
+			rows = append(rows, PostImportRow{Line: line, Err: fmt.Errorf("invalid JSON: %v", err)})
+			continue
+		}
+		rows = append(rows, PostImportRow{Line: line, Request: &req})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read JSON lines: %w", err)
+	}
+	return rows, nil
+}
+
+func parsePostCell(c postColumn, cell string) (interface{}, error) {
+	switch c.kind {
+	case postColumnInt:
+		n, err := strconv.ParseInt(strings.ReplaceAll(cell, ",", ""), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an integer", c.name)
+		}
+		return n, nil
+	case postColumnBool:
+		b, err := strconv.ParseBool(strings.ToLower(cell))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", c.name)
+		}
+		return b, nil
+	case postColumnList:
+		if strings.HasPrefix(cell, "[") {
+			var list []string
+			if err := json.Unmarshal([]byte(cell), &list); err != nil {
+				return nil, fmt.Errorf("%s must be a JSON array of strings or %q separated values", c.name, postCSVListSeparator)
+			}
+			return list, nil
+		}
+		parts := strings.Split(cell, postCSVListSeparator)
+		list := make([]string, 0, len(parts))
+		for _, p := range parts {
+			if p = strings.TrimSpace(p); p != "" {
+				list = append(list, p)
+			}
+		}
+		return list, nil
+	default:
+		return cell, nil
+	}
+}
+
+// decodeCreatePostRequest goes through JSON so that custom types (e.g. Date) use their own unmarshalers
+func decodeCreatePostRequest(values map[string]interface{}) (*models.CreatePostRequest, error) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	var req models.CreatePostRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, fmt.Errorf("invalid value: %v", err)
+	}
+	return &req, nil
+}
+
+// EncodePostExport writes posts in the same format accepted by ParsePostImport
+func EncodePostExport(format string, posts []models.Post, w io.Writer) error {
+	switch format {
+	case PostImportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(PostImportColumnNames()); err != nil {
+			return err
+		}
+		for _, post := range posts {
+			values, err := postExportValues(post)
+			if err != nil {
+				return err
+			}
+			record := make([]string, len(postImportColumns))
+			for i, c := range postImportColumns {
+				record[i] = formatPostCell(c, values[c.name])
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case PostImportFormatJSONL:
+		encoder := json.NewEncoder(w)
+		for _, post := range posts {
+			values, err := postExportValues(post)
+			if err != nil {
+				return err
+			}
+			// CreatePostRequest の項目のみ出力（id や author などは含めない）
+			row := make(map[string]interface{})
+			for _, c := range postImportColumns {
+				if v, ok := values[c.name]; ok && v != nil {
+					row[c.name] = v
+				}
+			}
+			if err := encoder.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func postExportValues(post models.Post) (map[string]interface{}, error) {
+	b, err := json.Marshal(post)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func formatPostCell(c postColumn, v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	switch c.kind {
+	case postColumnList:
+		items, ok := v.([]interface{})
+		if !ok {
+			return ""
+		}
+		list := make([]string, 0, len(items))
+		needsJSON := false
+		for _, item := range items {
+			s := fmt.Sprint(item)
+			if strings.Contains(s, postCSVListSeparator) {
+				needsJSON = true
+			}
+			list = append(list, s)
+		}
+		if needsJSON {
+			b, _ := json.Marshal(list)
+			return string(b)
+		}
+		return strings.Join(list, postCSVListSeparator)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// realtimeBufferSize is the number of undelivered events a stream may hold before it is dropped
+const realtimeBufferSize = 64
+
+// ErrRealtimeTooManyStreams is returned when a user already has the maximum number of open streams
+var ErrRealtimeTooManyStreams = errors.New("too many realtime streams for this user")
+
+// RealtimeEvent is an event pushed to the streams of a user
+type RealtimeEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	ThreadID  string          `json:"thread_id,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewRealtimeEvent encodes data into an event
+func NewRealtimeEvent(eventType, threadID string, data interface{}) (RealtimeEvent, error) {
+	event := RealtimeEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		ThreadID:  threadID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return RealtimeEvent{}, fmt.Errorf("failed to encode realtime event: %w", err)
+		}
+		event.Data = raw
+	}
+	return event, nil
+}
+
+// RealtimeEnvelope is what a broker carries between instances: an event and its recipients
+type RealtimeEnvelope struct {
+	UserIDs []string      `json:"user_ids"`
+	Event   RealtimeEvent `json:"event"`
+}
+
+// RealtimeBroker carries events between API instances.
+// Publish must hand the envelope to the deliver function given to Start on every instance, including
+// the publishing one. LocalRealtimeBroker is enough for a single instance; multi-instance deploys plug in
+// an implementation backed by a shared pub/sub (Redis, Postgres LISTEN/NOTIFY, ...).
+type RealtimeBroker interface {
+	Start(deliver func(RealtimeEnvelope)) error
+	Publish(envelope RealtimeEnvelope) error
+}
+
+// LocalRealtimeBroker delivers envelopes in-process
+type LocalRealtimeBroker struct {
+	mu      sync.RWMutex
+	deliver func(RealtimeEnvelope)
+}
+
+// NewLocalRealtimeBroker creates a broker for a single instance
+func NewLocalRealtimeBroker() *LocalRealtimeBroker {
+	return &LocalRealtimeBroker{}
+}
+
+// Start implements RealtimeBroker
+func (b *LocalRealtimeBroker) Start(deliver func(RealtimeEnvelope)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deliver = deliver
+	return nil
+}
+
+// Publish implements RealtimeBroker
+func (b *LocalRealtimeBroker) Publish(envelope RealtimeEnvelope) error {
+	b.mu.RLock()
+	deliver := b.deliver
+	b.mu.RUnlock()
+	if deliver == nil {
+		return errors.New("realtime broker is not started")
+	}
+	deliver(envelope)
+	return nil
+}
+
+// RealtimeSubscription is one open stream of a user
+type RealtimeSubscription struct {
+	UserID    string
+	events    chan RealtimeEvent
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Events returns the events for the stream
+func (s *RealtimeSubscription) Events() <-chan RealtimeEvent {
+	return s.events
+}
+
+// Done is closed when the hub drops the stream (the client could not keep up and should reconnect)
+func (s *RealtimeSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *RealtimeSubscription) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// RealtimeHub fans events out to the streams connected to this instance
+type RealtimeHub struct {
+	broker            RealtimeBroker
+	maxStreamsPerUser int
+
+	mu          sync.RWMutex
+	subscribers map[string]map[*RealtimeSubscription]struct{}
+}
+
+// NewRealtimeHub creates a hub and starts receiving envelopes from the broker
+func NewRealtimeHub(broker RealtimeBroker, maxStreamsPerUser int) (*RealtimeHub, error) {
+	h := &RealtimeHub{
+		broker:            broker,
+		maxStreamsPerUser: maxStreamsPerUser,
+		subscribers:       make(map[string]map[*RealtimeSubscription]struct{}),
+	}
+	if err := broker.Start(h.dispatch); err != nil {
+		return nil, fmt.Errorf("failed to start realtime broker: %w", err)
+	}
+	return h, nil
+}
+
+// Subscribe opens a stream for the user
+// 🔒 SECURITY: 1ユーザーあたりの同時接続数を制限し、接続の張りっぱなしによるリソース枯渇を防ぐ
+func (h *RealtimeHub) Subscribe(userID string) (*RealtimeSubscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs := h.subscribers[userID]
+	if h.maxStreamsPerUser > 0 && len(subs) >= h.maxStreamsPerUser {
+		return nil, ErrRealtimeTooManyStreams
+	}
+	if subs == nil {
+		subs = make(map[*RealtimeSubscription]struct{})
+		h.subscribers[userID] = subs
+	}
+	sub := &RealtimeSubscription{
+		UserID: userID,
+		events: make(chan RealtimeEvent, realtimeBufferSize),
+		done:   make(chan struct{}),
+	}
+	subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Unsubscribe closes a stream
+func (h *RealtimeHub) Unsubscribe(sub *RealtimeSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(sub)
+}
+
+func (h *RealtimeHub) removeLocked(sub *RealtimeSubscription) {
+	if subs, ok := h.subscribers[sub.UserID]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.subscribers, sub.UserID)
+		}
+	}
+	sub.close()
+}
+
+// Publish sends an event to all streams of the users (on every instance through the broker)
+func (h *RealtimeHub) Publish(userIDs []string, event RealtimeEvent) error {
+	recipients := make([]string, 0, len(userIDs))
+	seen := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			recipients = append(recipients, id)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+	return h.broker.Publish(RealtimeEnvelope{UserIDs: recipients, Event: event})
+}
+
+// dispatch delivers an envelope to the streams of this instance without blocking the publisher
+func (h *RealtimeHub) dispatch(envelope RealtimeEnvelope) {
+	var slow []*RealtimeSubscription
+
+	h.mu.RLock()
+	for _, userID := range envelope.UserIDs {
+		for sub := range h.subscribers[userID] {
+			select {
+			case sub.events <- envelope.Event:
+			default:
+				slow = append(slow, sub)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	// 受信が追いつかないストリームは切断し、再接続時にAPIから取り直してもらう
+	if len(slow) > 0 {
+		h.mu.Lock()
+		for _, sub := range slow {
+			log.Printf("[RealtimeHub] ⚠️ Dropping slow stream of user %s", sub.UserID)
+			h.removeLocked(sub)
+		}
+		h.mu.Unlock()
+	}
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+// revenueColumnAliases maps a logical column to the header names used by each provider export
+// ヘッダー名はエクスポートの種類（残高/支払い/財務レポートなど）で揺れがあるため複数候補を持つ
+var revenueColumnAliases = map[models.RevenueProvider]map[string][]string{
+	models.RevenueProviderStripe: {
+		"date":     {"created (utc)", "created date (utc)", "created", "available on (utc)", "available_on"},
+		"amount":   {"amount", "gross"},
+		"refunded": {"amount refunded", "amount_refunded"},
+		"currency": {"currency"},
+		"status":   {"status"},
+		"captured": {"captured"},
+		"type":     {"type", "reporting_category", "reporting category"},
+	},
+	models.RevenueProviderAppStore: {
+		"date":     {"begin date", "start date", "transaction date"},
+		"units":    {"units", "quantity"},
+		"proceeds": {"developer proceeds", "partner share"},
+		"extended": {"extended partner share"},
+		"currency": {"currency of proceeds", "partner share currency"},
+	},
+	models.RevenueProviderGooglePlay: {
+		"date":     {"transaction date", "order charged date", "date"},
+		"amount":   {"amount (merchant currency)", "charged amount", "amount (buyer currency)"},
+		"currency": {"merchant currency", "currency of sale", "buyer currency"},
+		"type":     {"transaction type", "financial status"},
+	},
+}
+
+// Stripe balance exports contain payouts, fees and transfers that are not revenue
+var stripeRevenueTypes = map[string]bool{
+	"charge":         true,
+	"payment":        true,
+	"refund":         true,
+	"payment_refund": true,
+}
+
+// Google Play earnings contain fees and taxes that are reported separately from the sale.
+// The value is true for refunds, which are subtracted from the revenue
+var googlePlayRevenueTypes = map[string]bool{
+	"charge":        false,
+	"charged":       false,
+	"refund":        true,
+	"charge refund": true,
+}
+
+var revenueDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"01/02/2006",
+	"1/2/2006",
+	"Jan 2, 2006",
+	"Jan 2, 2006 3:04:05 PM MST",
+	"2006-01",
+}
+
+// ParseRevenueReport parses a Stripe / App Store Connect / Google Play export and aggregates it by month.
+// Amounts are returned in major currency units (e.g. yen, dollars) rounded to the nearest integer.
+// When several currencies appear, JPY is preferred, otherwise the currency with the most rows is used.
+func ParseRevenueReport(provider models.RevenueProvider, data []byte) (*models.RevenueReport, error) {
+	aliases, ok := revenueColumnAliases[provider]
+	if !ok {
+		return nil, fmt.Errorf("unsupported revenue provider: %s", provider)
+	}
+
+	// UTF-8 BOMを除去（Excel経由のCSVに付くことがある）
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	columns := resolveRevenueColumns(header, aliases)
+	if _, ok := columns["date"]; !ok {
+		return nil, fmt.Errorf("date column not found in %s export", provider)
+	}
+	if provider == models.RevenueProviderAppStore {
+		if _, ok := columns["extended"]; !ok {
+			if _, ok := columns["proceeds"]; !ok {
+				return nil, fmt.Errorf("proceeds column not found in app_store export")
+			}
+		}
+	} else if _, ok := columns["amount"]; !ok {
+		return nil, fmt.Errorf("amount column not found in %s export", provider)
+	}
+
+	// currency -> month -> amount
+	totals := make(map[string]map[string]float64)
+	rowCounts := make(map[string]map[string]int)
+	currencyRows := make(map[string]int)
+	parsed, skipped := 0, 0
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row %d: %w", parsed+skipped+2, err)
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+
+		month, amount, currency, ok := parseRevenueRecord(provider, record, columns)
+		if !ok {
+			skipped++
+			continue
+		}
+		if totals[currency] == nil {
+			totals[currency] = make(map[string]float64)
+			rowCounts[currency] = make(map[string]int)
+		}
+		totals[currency][month] += amount
+		rowCounts[currency][month]++
+		currencyRows[currency]++
+		parsed++
+	}
+
+	if parsed == 0 {
+		return nil, fmt.Errorf("no revenue rows found in %s export", provider)
+	}
+
+	currency := selectReportCurrency(currencyRows)
+	// 採用しなかった通貨の行はスキップ扱い
+	for c, n := range currencyRows {
+		if c != currency {
+			skipped += n
+			parsed -= n
+		}
+	}
+
+	report := &models.RevenueReport{
+		Provider:    provider,
+		Currency:    currency,
+		ParsedRows:  parsed,
+		SkippedRows: skipped,
+	}
+	for month, amount := range totals[currency] {
+		report.Months = append(report.Months, models.MonthlyRevenueAmount{
+			Month:    month,
+			Amount:   int64(math.Round(amount)),
+			RowCount: rowCounts[currency][month],
+		})
+	}
+	sort.Slice(report.Months, func(i, j int) bool {
+		return report.Months[i].Month < report.Months[j].Month
+	})
+
+	return report, nil
+}
+
+// MergeRevenueReports sums monthly amounts across reports of the same currency
+// (e.g. an app sold on both App Store and Google Play).
+func MergeRevenueReports(reports []*models.RevenueReport) (string, []models.MonthlyRevenueAmount, error) {
+	if len(reports) == 0 {
+		return "", nil, fmt.Errorf("no reports to merge")
+	}
+
+	currency := reports[0].Currency
+	byMonth := make(map[string]*models.MonthlyRevenueAmount)
+	for _, report := range reports {
+		if report.Currency != currency {
+			return "", nil, fmt.Errorf("reports use different currencies (%s, %s)", currency, report.Currency)
+		}
+		for _, m := range report.Months {
+			if existing, ok := byMonth[m.Month]; ok {
+				existing.Amount += m.Amount
+				existing.RowCount += m.RowCount
+			} else {
+				copied := m
+				byMonth[m.Month] = &copied
+			}
+		}
+	}
+
+	months := make([]models.MonthlyRevenueAmount, 0, len(byMonth))
+	for _, m := range byMonth {
+		months = append(months, *m)
+	}
+	sort.Slice(months, func(i, j int) bool {
+		return months[i].Month < months[j].Month
+	})
+
+	return currency, months, nil
+}
+
+// CompareRevenue compares the average of the aggregated months with the claimed monthly revenue.
+// The difference ratio is |verified - claimed| / claimed; verification passes when it is within tolerance.
+func CompareRevenue(months []models.MonthlyRevenueAmount, claimed int64, tolerance float64) (int64, float64, bool) {
+	if len(months) == 0 {
+		return 0, 1, false
+	}
+
+	var total int64
+	for _, m := range months {
+		total += m.Amount
+	}
+	average := int64(math.Round(float64(total) / float64(len(months))))
+
+	if claimed <= 0 {
+		return average, 1, false
+	}
+
+	ratio := math.Abs(float64(average-claimed)) / float64(claimed)
+	return average, ratio, ratio <= tolerance
+}
+
+// RevenuePeriod returns the first day of the first month and the last day of the last month
+func RevenuePeriod(months []models.MonthlyRevenueAmount) (time.Time, time.Time, error) {
+	if len(months) == 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("no months")
+	}
+	start, err := time.Parse("2006-01", months[0].Month)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	last, err := time.Parse("2006-01", months[len(months)-1].Month)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end := last.AddDate(0, 1, -1)
+	return start, end, nil
+}
+
+func parseRevenueRecord(provider models.RevenueProvider, record []string, columns map[string]int) (string, float64, string, bool) {
+	date, ok := parseRevenueDate(revenueField(record, columns, "date"))
+	if !ok {
+		return "", 0, "", false
+	}
+	currency := strings.ToUpper(strings.TrimSpace(revenueField(record, columns, "currency")))
+	if currency == "" {
+		currency = "JPY"
+	}
+
+	var amount float64
+	switch provider {
+	case models.RevenueProviderStripe:
+		if status := strings.ToLower(revenueField(record, columns, "status")); status != "" &&
+			status != "paid" && status != "succeeded" && status != "available" && status != "refunded" {
+			return "", 0, "", false
+		}
+		if strings.EqualFold(revenueField(record, columns, "captured"), "false") {
+			return "", 0, "", false
+		}
+		if t := strings.ToLower(revenueField(record, columns, "type")); t != "" && !stripeRevenueTypes[t] {
+			return "", 0, "", false
+		}
+		value, ok := parseRevenueAmount(revenueField(record, columns, "amount"))
+		if !ok {
+			return "", 0, "", false
+		}
+		if refunded, ok := parseRevenueAmount(revenueField(record, columns, "refunded")); ok {
+			value -= refunded
+		}
+		amount = value
+
+	case models.RevenueProviderAppStore:
+		if extended, ok := parseRevenueAmount(revenueField(record, columns, "extended")); ok {
+			amount = extended
+			break
+		}
+		proceeds, ok := parseRevenueAmount(revenueField(record, columns, "proceeds"))
+		if !ok {
+			return "", 0, "", false
+		}
+		units, ok := parseRevenueAmount(revenueField(record, columns, "units"))
+		if !ok {
+			units = 1
+		}
+		amount = proceeds * units
+
+	case models.RevenueProviderGooglePlay:
+		refund := false
+		if t := strings.ToLower(strings.TrimSpace(revenueField(record, columns, "type"))); t != "" {
+			var known bool
+			if refund, known = googlePlayRevenueTypes[t]; !known {
+				return "", 0, "", false
+			}
+		}
+		value, ok := parseRevenueAmount(revenueField(record, columns, "amount"))
+		if !ok {
+			return "", 0, "", false
+		}
+		// 返金の金額は負の値で出力されるが、正の値の場合も差し引く
+		if refund && value > 0 {
+			value = -value
+		}
+		amount = value
+	}
+
+	return date.Format("2006-01"), amount, currency, true
+}
+
+func resolveRevenueColumns(header []string, aliases map[string][]string) map[string]int {
+	normalized := make(map[string]int, len(header))
+	for i, h := range header {
+		key := strings.ToLower(strings.TrimSpace(h))
+		if _, exists := normalized[key]; !exists {
+			normalized[key] = i
+		}
+	}
+
+	columns := make(map[string]int)
+	for logical, names := range aliases {
+		for _, name := range names {
+			if idx, ok := normalized[name]; ok {
+				columns[logical] = idx
+				break
+			}
+		}
+	}
+	return columns
+}
+
+func revenueField(record []string, columns map[string]int, name string) string {
+	idx, ok := columns[name]
+	if !ok || idx >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[idx])
+}
+
+func parseRevenueDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range revenueDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseRevenueAmount(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	// 会計表記の (123.45) はマイナス
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = strings.Trim(value, "()")
+	}
+	value = strings.NewReplacer(",", "", "¥", "", "$", "", "€", "", " ", "").Replace(value)
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, true
+}
+
+func detectDelimiter(data []byte) rune {
+	firstLine := data
+	if idx := bytes.IndexByte(data, '\n'); idx >= 0 {
+		firstLine = data[:idx]
+	}
+	if bytes.Count(firstLine, []byte("\t")) > bytes.Count(firstLine, []byte(",")) {
+		return '\t'
+	}
+	return ','
+}
+
+func isBlankRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func selectReportCurrency(currencyRows map[string]int) string {
+	if _, ok := currencyRows["JPY"]; ok {
+		return "JPY"
+	}
+	best, bestCount := "", -1
+	for c, n := range currencyRows {
+		if n > bestCount || (n == bestCount && c < best) {
+			best, bestCount = c, n
+		}
+	}
+	return best
+}
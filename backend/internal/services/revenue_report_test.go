@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+func TestParseRevenueReportGooglePlayRefunds(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int64
+	}{
+		{
+			name: "charge refund with negative amount",
+			data: "Transaction Date,Transaction Type,Amount (Merchant Currency),Merchant Currency\n" +
+				"2024-05-01,Charge,1000,JPY\n" +
+				"2024-05-02,Charge,500,JPY\n" +
+				"2024-05-03,Charge refund,-500,JPY\n",
+			want: 1000,
+		},
+		{
+			name: "charge refund with positive amount",
+			data: "Transaction Date,Transaction Type,Amount (Merchant Currency),Merchant Currency\n" +
+				"2024-05-01,Charge,1000,JPY\n" +
+				"2024-05-03,Charge refund,300,JPY\n",
+			want: 700,
+		},
+		{
+			name: "fees are not revenue",
+			data: "Transaction Date,Transaction Type,Amount (Merchant Currency),Merchant Currency\n" +
+				"2024-05-01,Charge,1000,JPY\n" +
+				"2024-05-01,Google fee,-150,JPY\n",
+			want: 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := ParseRevenueReport(models.RevenueProviderGooglePlay, []byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseRevenueReport: %v", err)
+			}
+			if len(report.Months) != 1 {
+				t.Fatalf("got %d months, want 1", len(report.Months))
+			}
+			if got := report.Months[0].Amount; got != tt.want {
+				t.Errorf("amount = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
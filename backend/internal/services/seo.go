@@ -0,0 +1,224 @@
+package services
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+// SitemapAlternate is a localized version of a sitemap URL (hreflang)
+type SitemapAlternate struct {
+	Lang string
+	Href string
+}
+
+// SitemapURL is one <url> entry of a sitemap
+type SitemapURL struct {
+	Loc        string
+	LastMod    time.Time
+	ChangeFreq string
+	Priority   float64
+	Alternates []SitemapAlternate
+}
+
+// SitemapRef is one <sitemap> entry of a sitemap index
+type SitemapRef struct {
+	Loc     string
+	LastMod time.Time
+}
+
+type xmlSitemapLink struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+type xmlSitemapURL struct {
+	Loc        string           `xml:"loc"`
+	LastMod    string           `xml:"lastmod,omitempty"`
+	ChangeFreq string           `xml:"changefreq,omitempty"`
+	Priority   string           `xml:"priority,omitempty"`
+	Links      []xmlSitemapLink `xml:"xhtml:link"`
+}
+
+type xmlURLSet struct {
+	XMLName xml.Name        `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	XHTMLNS string          `xml:"xmlns:xhtml,attr"`
+	URLs    []xmlSitemapURL `xml:"url"`
+}
+
+type xmlSitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type xmlSitemapIndex struct {
+	XMLName  xml.Name        `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []xmlSitemapRef `xml:"sitemap"`
+}
+
+// RenderSitemap writes a <urlset> sitemap
+func RenderSitemap(urls []SitemapURL, w io.Writer) error {
+	out := xmlURLSet{
+		XHTMLNS: "http://www.w3.org/1999/xhtml",
+		URLs:    make([]xmlSitemapURL, 0, len(urls)),
+	}
+	for _, u := range urls {
+		entry := xmlSitemapURL{
+			Loc:        u.Loc,
+			ChangeFreq: u.ChangeFreq,
+		}
+		if !u.LastMod.IsZero() {
+			entry.LastMod = u.LastMod.UTC().Format(time.RFC3339)
+		}
+		if u.Priority > 0 {
+			entry.Priority = formatSitemapPriority(u.Priority)
+		}
+		for _, alt := range u.Alternates {
+			entry.Links = append(entry.Links, xmlSitemapLink{Rel: "alternate", Hreflang: alt.Lang, Href: alt.Href})
+		}
+		out.URLs = append(out.URLs, entry)
+	}
+	return writeXML(w, out)
+}
+
+// RenderSitemapIndex writes a <sitemapindex>
+func RenderSitemapIndex(refs []SitemapRef, w io.Writer) error {
+	out := xmlSitemapIndex{Sitemaps: make([]xmlSitemapRef, 0, len(refs))}
+	for _, ref := range refs {
+		entry := xmlSitemapRef{Loc: ref.Loc}
+		if !ref.LastMod.IsZero() {
+			entry.LastMod = ref.LastMod.UTC().Format(time.RFC3339)
+		}
+		out.Sitemaps = append(out.Sitemaps, entry)
+	}
+	return writeXML(w, out)
+}
+
+func formatSitemapPriority(p float64) string {
+	if p > 1 {
+		p = 1
+	}
+	return strconv.FormatFloat(p, 'f', 1, 64)
+}
+
+// PostJSONLD builds schema.org Product/Offer structured data for a listing page
+// (DiscussionForumPosting for board posts).
+// 🔒 SECURITY: 秘匿投稿は未ログイン閲覧者としての公開範囲（visibility.go）のみ出力する
+func PostJSONLD(post models.Post, pageURL string, authorName string) map[string]interface{} {
+	data := map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    "Product",
+		"@id":      pageURL + "#product",
+		"url":      pageURL,
+	}
+
+	if post.Type == models.PostTypeSecret {
+		ApplyPostVisibility(&post, ViewerAnonymous)
+		data["name"] = "非公開案件"
+		data["description"] = "NDA締結後に詳細を閲覧できる非公開の売却案件です。"
+		if post.Price != nil {
+			data["offers"] = postOffer(post, pageURL, "")
+		}
+		return data
+	}
+
+	// 掲示板の投稿は商品ではなくディスカッションとして表現する
+	if post.Type == models.PostTypeBoard {
+		data["@type"] = "DiscussionForumPosting"
+		data["@id"] = pageURL + "#posting"
+		data["headline"] = post.Title
+		data["datePublished"] = post.CreatedAt.UTC().Format(time.RFC3339)
+		data["dateModified"] = post.UpdatedAt.UTC().Format(time.RFC3339)
+		if authorName != "" {
+			data["author"] = map[string]interface{}{"@type": "Person", "name": authorName}
+		}
+		if post.EyecatchURL != nil && *post.EyecatchURL != "" {
+			data["image"] = *post.EyecatchURL
+		}
+		return data
+	}
+
+	data["name"] = post.Title
+	if post.AppealText != nil && *post.AppealText != "" {
+		data["description"] = *post.AppealText
+	}
+	if post.EyecatchURL != nil && *post.EyecatchURL != "" {
+		images := []string{*post.EyecatchURL}
+		images = append(images, post.ExtraImageURLs...)
+		data["image"] = images
+	}
+	if len(post.AppCategories) > 0 {
+		data["category"] = post.AppCategories[0]
+		data["keywords"] = post.AppCategories
+	}
+	if !post.CreatedAt.IsZero() {
+		data["releaseDate"] = post.CreatedAt.UTC().Format("2006-01-02")
+	}
+	if post.Price != nil && post.Type == models.PostTypeTransaction {
+		data["offers"] = postOffer(post, pageURL, authorName)
+	}
+	return data
+}
+
+func postOffer(post models.Post, pageURL string, sellerName string) map[string]interface{} {
+	availability := "https://schema.org/InStock"
+	if !post.IsActive {
+		availability = "https://schema.org/SoldOut"
+	}
+	offer := map[string]interface{}{
+		"@type":         "Offer",
+		"url":           pageURL,
+		"price":         *post.Price,
+		"priceCurrency": "JPY",
+		"availability":  availability,
+	}
+	if sellerName != "" {
+		offer["seller"] = map[string]interface{}{
+			"@type": "Person",
+			"name":  sellerName,
+		}
+	}
+	return offer
+}
+
+// ProfileJSONLD builds schema.org Person/Organization structured data for a public profile
+func ProfileJSONLD(profile models.Profile, links []models.UserLink, pageURL string) map[string]interface{} {
+	schemaType := "Person"
+	if profile.Party == "organization" {
+		schemaType = "Organization"
+	}
+	data := map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    schemaType,
+		"@id":      pageURL + "#profile",
+		"url":      pageURL,
+		"name":     profile.DisplayName,
+	}
+	if profile.IconURL != nil && *profile.IconURL != "" {
+		if schemaType == "Organization" {
+			data["logo"] = *profile.IconURL
+		} else {
+			data["image"] = *profile.IconURL
+		}
+	}
+	if profile.PortfolioSummary != nil && *profile.PortfolioSummary != "" {
+		data["description"] = *profile.PortfolioSummary
+	}
+	if len(profile.Expertise) > 0 {
+		data["knowsAbout"] = profile.Expertise
+	}
+	sameAs := make([]string, 0, len(links))
+	for _, link := range links {
+		if link.URL != "" {
+			sameAs = append(sameAs, link.URL)
+		}
+	}
+	if len(sameAs) > 0 {
+		data["sameAs"] = sameAs
+	}
+	return data
+}
@@ -97,9 +97,39 @@ func (s *SupabaseService) getAdminAuthRequest(method, path string, body io.Reade
 }
 
 type authUserResponse struct {
+	Email        string                 `json:"email"`
 	UserMetadata map[string]interface{} `json:"user_metadata"`
 }
 
+// GetUserEmail returns the email address of an auth user ("" if the user has none or does not exist)
+func (s *SupabaseService) GetUserEmail(userID string) (string, error) {
+	req, err := s.getAdminAuthRequest(http.MethodGet, fmt.Sprintf("/auth/v1/admin/users/%s", userID), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build admin auth request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch user: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to fetch user: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result authUserResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode user response: %w", err)
+	}
+	return result.Email, nil
+}
+
 func (s *SupabaseService) GetUserMetadata(userID string) (map[string]interface{}, error) {
 	req, err := s.getAdminAuthRequest(http.MethodGet, fmt.Sprintf("/auth/v1/admin/users/%s", userID), nil)
 	if err != nil {
@@ -241,6 +271,8 @@ func (s *SupabaseService) IsBucketPublic(bucketName string) (bool, error) {
 		"message-images":     false, // private: メッセージ添付画像
 		"post-images":        false, // private: 投稿画像
 		"contract-documents": false, // private: 契約書
+		"revenue-reports":    false, // private: 売上検証用の決済エクスポート（NDA締結者のみ）
+		"data-room-files":    false, // private: データルーム資料（透かし付きでバックエンド経由でのみ配信）
 	}
 	
 	isPublic, exists := knownBuckets[bucketName]
@@ -367,6 +399,18 @@ func (s *SupabaseService) GetBatchSignedURLs(bucketName string, filePaths []stri
 	return s.GetBatchImageURLs(bucketName, filePaths, expiresIn)
 }
 
+// DownloadFile downloads a file from Supabase Storage with the service client
+func (s *SupabaseService) DownloadFile(bucketName string, filePath string) ([]byte, error) {
+	client := s.GetServiceClient()
+
+	data, err := client.Storage.DownloadFile(bucketName, strings.TrimPrefix(filePath, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	return data, nil
+}
+
 // DeleteFile deletes a file from Supabase Storage
 func (s *SupabaseService) DeleteFile(bucketName string, filePath string) error {
 	client := s.GetServiceClient()
@@ -438,3 +482,42 @@ func (s *SupabaseService) GetActiveViewCounts(postIDs []string) (map[string]int,
 
 	return countMap, nil
 }
+
+// CallRPC calls a PostgreSQL function through PostgREST with the service key and decodes the result into out.
+// 🔒 SECURITY: RLSを回避するため、呼び出し側で権限チェックを済ませてから使用すること
+func (s *SupabaseService) CallRPC(functionName string, payload interface{}, out interface{}) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal RPC payload: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/rest/v1/rpc/%s", s.cfg.SupabaseURL, functionName)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create RPC request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", s.cfg.SupabaseServiceKey)
+	req.Header.Set("Authorization", "Bearer "+s.cfg.SupabaseServiceKey)
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute RPC request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("RPC %s returned status %d: %s", functionName, resp.StatusCode, string(body))
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode RPC response: %w", err)
+	}
+	return nil
+}
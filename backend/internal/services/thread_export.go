@@ -0,0 +1,309 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+// TranscriptParticipant is a participant listed in a thread transcript
+type TranscriptParticipant struct {
+	UserID   string
+	Name     string
+	Role     models.ThreadRole
+	JoinedAt *time.Time
+}
+
+// TranscriptMessage is a message in a thread transcript.
+// Text is stored HTML-escaped (utils.SanitizeText) and is unescaped when rendered.
+type TranscriptMessage struct {
+	ID         string
+	SenderName string
+	SenderRole models.ThreadRole
+	Type       models.MessageType
+	Text       string
+	Attachment string // アーカイブ内の添付ファイルのパス（PDFのみの出力では元のファイル名）
+	CreatedAt  time.Time
+	EditedAt   *time.Time
+	DeletedAt  *time.Time
+}
+
+// TranscriptSignature is a signature of a contract document in a thread transcript
+type TranscriptSignature struct {
+	Name     string
+	SignedAt time.Time
+}
+
+// TranscriptContract is a contract document in a thread transcript
+type TranscriptContract struct {
+	ID           string
+	ContractType string
+	FileName     string
+	UploadedBy   string
+	CreatedAt    time.Time
+	DocumentHash string // 原本のSHA-256
+	Signatures   []TranscriptSignature
+}
+
+// ThreadTranscript is the content of the transcript PDF of a thread export
+type ThreadTranscript struct {
+	ThreadID      string
+	ThreadType    models.ThreadType
+	RelatedPostID string
+	Language      string // ja / en
+	ExportedBy    string
+	ExportedAt    time.Time
+	Participants  []TranscriptParticipant
+	Messages      []TranscriptMessage
+	Contracts     []TranscriptContract
+}
+
+// transcriptLabels are the fixed texts of the transcript per language
+var transcriptLabels = map[string]map[string]string{
+	"ja": {
+		"title":        "商談記録",
+		"thread":       "スレッドID",
+		"type":         "種別",
+		"post":         "案件ID",
+		"exported_at":  "出力日時",
+		"exported_by":  "出力者",
+		"note":         "本書は出力時点のスレッドの記録です。編集されたメッセージは最新の内容、削除されたメッセージは削除された旨のみを記載しています。",
+		"participants": "参加者",
+		"joined":       "参加",
+		"messages":     "メッセージ",
+		"no_messages":  "メッセージはありません",
+		"edited":       "（編集済み %s）",
+		"deleted":      "（このメッセージは削除されました）",
+		"attachment":   "添付: %s",
+		"contracts":    "契約書",
+		"uploaded_by":  "アップロード: %s（%s）",
+		"signed":       "署名: %s（%s）",
+		"unsigned":     "署名なし",
+		"deal_room":    "商談",
+		"inquiry":      "問い合わせ",
+		"unknown_user": "不明なユーザー",
+	},
+	"en": {
+		"title":        "Thread Transcript",
+		"thread":       "Thread ID",
+		"type":         "Type",
+		"post":         "Listing ID",
+		"exported_at":  "Exported at",
+		"exported_by":  "Exported by",
+		"note":         "This document records the thread as of the export. Edited messages show their latest text; deleted messages are only noted as deleted.",
+		"participants": "Participants",
+		"joined":       "joined",
+		"messages":     "Messages",
+		"no_messages":  "No messages",
+		"edited":       "(edited %s)",
+		"deleted":      "(This message was deleted)",
+		"attachment":   "Attachment: %s",
+		"contracts":    "Contract documents",
+		"uploaded_by":  "Uploaded by %s (%s)",
+		"signed":       "Signed by %s (%s)",
+		"unsigned":     "Not signed",
+		"deal_room":    "Deal room",
+		"inquiry":      "Inquiry",
+		"unknown_user": "Unknown user",
+	},
+}
+
+var transcriptRoleLabels = map[string]map[models.ThreadRole]string{
+	"ja": {
+		models.ThreadRoleSeller:        "売り手",
+		models.ThreadRoleBuyer:         "買い手",
+		models.ThreadRoleSellerAdvisor: "売り手側アドバイザー",
+		models.ThreadRoleBuyerAdvisor:  "買い手側アドバイザー",
+		models.ThreadRoleOperator:      "運営",
+	},
+	"en": {
+		models.ThreadRoleSeller:        "Seller",
+		models.ThreadRoleBuyer:         "Buyer",
+		models.ThreadRoleSellerAdvisor: "Seller's advisor",
+		models.ThreadRoleBuyerAdvisor:  "Buyer's advisor",
+		models.ThreadRoleOperator:      "Operator",
+	},
+}
+
+var transcriptTypeLabels = map[string]map[models.MessageType]string{
+	"ja": {
+		models.MessageTypeImage:    "画像",
+		models.MessageTypeFile:     "ファイル",
+		models.MessageTypeContract: "契約書",
+		models.MessageTypeNDA:      "NDA",
+	},
+	"en": {
+		models.MessageTypeImage:    "Image",
+		models.MessageTypeFile:     "File",
+		models.MessageTypeContract: "Contract",
+		models.MessageTypeNDA:      "NDA",
+	},
+}
+
+// RenderThreadTranscriptPDF renders the participants, messages (with timestamps and types) and
+// contract documents of a thread to PDF
+func RenderThreadTranscriptPDF(t ThreadTranscript) []byte {
+	lang := t.Language
+	if _, ok := transcriptLabels[lang]; !ok {
+		lang = "ja"
+	}
+	label := transcriptLabels[lang]
+	role := func(r models.ThreadRole) string {
+		if v, ok := transcriptRoleLabels[lang][r]; ok {
+			return v
+		}
+		return string(r)
+	}
+	name := func(n string) string {
+		if n == "" {
+			return label["unknown_user"]
+		}
+		return n
+	}
+	at := func(v time.Time) string {
+		return v.In(contractTimeZone).Format("2006-01-02 15:04:05 MST")
+	}
+
+	pdf := NewPDFWriter(label["title"], "APPEXIT", t.ExportedAt)
+	pdf.Title(label["title"])
+
+	threadType := string(t.ThreadType)
+	if v, ok := label[threadType]; ok {
+		threadType = v
+	}
+	pdf.Text(fmt.Sprintf("%s: %s", label["thread"], t.ThreadID), 9, PDFAlignLeft, 0)
+	pdf.Text(fmt.Sprintf("%s: %s", label["type"], threadType), 9, PDFAlignLeft, 0)
+	if t.RelatedPostID != "" {
+		pdf.Text(fmt.Sprintf("%s: %s", label["post"], t.RelatedPostID), 9, PDFAlignLeft, 0)
+	}
+	pdf.Text(fmt.Sprintf("%s: %s", label["exported_at"], at(t.ExportedAt)), 9, PDFAlignLeft, 0)
+	pdf.Text(fmt.Sprintf("%s: %s", label["exported_by"], name(t.ExportedBy)), 9, PDFAlignLeft, 0)
+	pdf.Space(4)
+	pdf.Text(label["note"], 9, PDFAlignLeft, 0)
+
+	pdf.Heading(label["participants"])
+	for _, p := range t.Participants {
+		line := fmt.Sprintf("%s（%s）", name(p.Name), role(p.Role))
+		if lang == "en" {
+			line = fmt.Sprintf("%s (%s)", name(p.Name), role(p.Role))
+		}
+		if p.JoinedAt != nil {
+			line += fmt.Sprintf(" - %s %s", label["joined"], at(*p.JoinedAt))
+		}
+		pdf.Text(line, 10, PDFAlignLeft, 12)
+	}
+
+	pdf.Heading(label["messages"])
+	if len(t.Messages) == 0 {
+		pdf.Paragraph(label["no_messages"])
+	}
+	for _, m := range t.Messages {
+		header := fmt.Sprintf("%s  %s [%s]", at(m.CreatedAt), name(m.SenderName), role(m.SenderRole))
+		if typeLabel, ok := transcriptTypeLabels[lang][m.Type]; ok {
+			header += fmt.Sprintf(" <%s>", typeLabel)
+		}
+		if m.EditedAt != nil && m.DeletedAt == nil {
+			header += " " + fmt.Sprintf(label["edited"], at(*m.EditedAt))
+		}
+		pdf.Text(header, 8.5, PDFAlignLeft, 0)
+		switch {
+		case m.DeletedAt != nil:
+			pdf.Text(label["deleted"], 10.5, PDFAlignLeft, 12)
+		default:
+			if text := strings.TrimSpace(html.UnescapeString(m.Text)); text != "" {
+				pdf.Text(text, 10.5, PDFAlignLeft, 12)
+			}
+			if m.Attachment != "" {
+				pdf.Text(fmt.Sprintf(label["attachment"], m.Attachment), 9, PDFAlignLeft, 12)
+			}
+		}
+		pdf.Space(5)
+	}
+
+	if len(t.Contracts) > 0 {
+		pdf.Heading(label["contracts"])
+		for _, c := range t.Contracts {
+			pdf.Text(fmt.Sprintf("[%s] %s", c.ContractType, c.FileName), 10, PDFAlignLeft, 0)
+			pdf.Text(fmt.Sprintf(label["uploaded_by"], name(c.UploadedBy), at(c.CreatedAt)), 9, PDFAlignLeft, 12)
+			if c.DocumentHash != "" {
+				pdf.Text("SHA-256: "+c.DocumentHash, 8.5, PDFAlignLeft, 12)
+			}
+			if len(c.Signatures) == 0 {
+				pdf.Text(label["unsigned"], 9, PDFAlignLeft, 12)
+			}
+			for _, sig := range c.Signatures {
+				pdf.Text(fmt.Sprintf(label["signed"], name(sig.Name), at(sig.SignedAt)), 9, PDFAlignLeft, 12)
+			}
+			pdf.Space(5)
+		}
+	}
+
+	return pdf.Bytes()
+}
+
+// ThreadArchiveEntry is a file to put in a thread export archive.
+// Size and SHA256 of File are filled in by BuildThreadArchive.
+type ThreadArchiveEntry struct {
+	File models.ThreadExportFile
+	Data []byte
+}
+
+// BuildThreadArchive writes the entries, manifest.json (with the SHA-256 of every file) and
+// SHA256SUMS (verifiable with `sha256sum -c SHA256SUMS`) into a ZIP archive
+func BuildThreadArchive(manifest models.ThreadExportManifest, entries []ThreadArchiveEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var sums strings.Builder
+
+	write := func(name string, data []byte) error {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: manifest.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	}
+
+	manifest.Files = make([]models.ThreadExportFile, 0, len(entries))
+	for _, entry := range entries {
+		sum := sha256.Sum256(entry.Data)
+		file := entry.File
+		file.Size = len(entry.Data)
+		file.SHA256 = hex.EncodeToString(sum[:])
+		if err := write(file.Path, entry.Data); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", file.SHA256, file.Path)
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := write("manifest.json", manifestJSON); err != nil {
+		return nil, fmt.Errorf("failed to write manifest.json: %w", err)
+	}
+	manifestSum := sha256.Sum256(manifestJSON)
+	fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(manifestSum[:]), "manifest.json")
+
+	if err := write("SHA256SUMS", []byte(sums.String())); err != nil {
+		return nil, fmt.Errorf("failed to write SHA256SUMS: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/yourusername/appexit-backend/internal/models"
+)
+
+// ViewerRelation is the relationship between the viewer and a listing
+type ViewerRelation int
+
+const (
+	ViewerAnonymous ViewerRelation = iota // 未ログイン
+	ViewerMember                          // ログイン済み（NDA未締結）
+	ViewerNDA                             // NDA締結済み
+	ViewerOwner                           // 投稿者本人
+	ViewerOperator                        // 運営
+)
+
+func (v ViewerRelation) String() string {
+	switch v {
+	case ViewerAnonymous:
+		return "anonymous"
+	case ViewerMember:
+		return "member"
+	case ViewerNDA:
+		return "nda"
+	case ViewerOwner:
+		return "owner"
+	case ViewerOperator:
+		return "operator"
+	default:
+		return "unknown"
+	}
+}
+
+// FieldAccess is the level required to see a field of a secret post
+type FieldAccess int
+
+const (
+	AccessPublic FieldAccess = iota // 誰でも（掲載が存在すること・種別・日時）
+	AccessMember                    // ログインユーザー
+	AccessPrice                     // secret_visibility=price_only なら誰でも、それ以外はNDA締結者
+	AccessNDA                       // NDA締結者
+	AccessOwner                     // 投稿者・運営のみ
+)
+
+// secretPostFieldAccess declares, per JSON field of models.Post, who may see it on a secret post.
+// 🔒 SECURITY: ここに無い項目はAccessNDAとして扱う（項目追加時のマスク漏れを防ぐ）
+var secretPostFieldAccess = map[string]FieldAccess{
+	"id":                AccessPublic,
+	"type":              AccessPublic,
+	"secret_visibility": AccessPublic,
+	"is_active":         AccessPublic,
+	"created_at":        AccessPublic,
+	"updated_at":        AccessPublic,
+
+	"price": AccessPrice,
+
+	// 売上検証済みバッジのみ会員に表示（検証期間は詳細扱い）
+	"revenue_verified": AccessMember,
+
+	// 出品者の特定につながる項目
+	"author_user_id": AccessNDA,
+	"author_org_id":  AccessNDA,
+
+	"title":                   AccessNDA,
+	"body":                    AccessNDA,
+	"eyecatch_url":            AccessNDA,
+	"dashboard_url":           AccessNDA,
+	"user_ui_url":             AccessNDA,
+	"performance_url":         AccessNDA,
+	"app_categories":          AccessNDA,
+	"service_urls":            AccessNDA,
+	"revenue_models":          AccessNDA,
+	"monthly_revenue":         AccessNDA,
+	"monthly_cost":            AccessNDA,
+	"monthly_profit":          AccessNDA,
+	"appeal_text":             AccessNDA,
+	"tech_stack":              AccessNDA,
+	"user_count":              AccessNDA,
+	"release_date":            AccessNDA,
+	"operation_form":          AccessNDA,
+	"operation_effort":        AccessNDA,
+	"transfer_items":          AccessNDA,
+	"desired_transfer_timing": AccessNDA,
+	"growth_potential":        AccessNDA,
+	"target_customers":        AccessNDA,
+	"marketing_channels":      AccessNDA,
+	"media_mentions":          AccessNDA,
+	"extra_image_urls":        AccessNDA,
+	"revenue_verified_from":   AccessNDA,
+	"revenue_verified_to":     AccessNDA,
+	"revenue_verified_at":     AccessNDA,
+
+	"subscribe": AccessOwner,
+}
+
+// postFieldIndex maps JSON names to struct field indexes of models.Post
+var postFieldIndex = func() map[string]int {
+	t := reflect.TypeOf(models.Post{})
+	index := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			index[name] = i
+		}
+	}
+	return index
+}()
+
+// EffectiveSecretVisibility returns the visibility of a secret post.
+// 未設定・未知の値（フロントエンドの partial など）は最も厳しい full（NDA締結後のみ全公開）として扱う
+func EffectiveSecretVisibility(post models.Post) models.SecretVisibility {
+	if post.SecretVisibility != nil {
+		switch *post.SecretVisibility {
+		case models.SecretVisibilityPriceOnly, models.SecretVisibilityHidden:
+			return *post.SecretVisibility
+		}
+	}
+	return models.SecretVisibilityFull
+}
+
+// CanViewField reports whether a viewer with the given relation may see a field with the given access level
+func CanViewField(access FieldAccess, relation ViewerRelation, visibility models.SecretVisibility) bool {
+	switch access {
+	case AccessPublic:
+		return true
+	case AccessMember:
+		return relation >= ViewerMember
+	case AccessPrice:
+		return relation >= ViewerNDA || visibility == models.SecretVisibilityPriceOnly
+	case AccessNDA:
+		return relation >= ViewerNDA
+	default:
+		return relation >= ViewerOwner
+	}
+}
+
+// PostFieldAccess returns the declared access level of a post field (JSON name)
+func PostFieldAccess(field string) FieldAccess {
+	if access, ok := secretPostFieldAccess[field]; ok {
+		return access
+	}
+	return AccessNDA
+}
+
+// PostListable reports whether the post may appear at all for the viewer
+// (secret_visibility=hidden の投稿はNDA締結者・投稿者・運営以外には存在自体を見せない)
+func PostListable(post models.Post, relation ViewerRelation) bool {
+	if post.Type != models.PostTypeSecret {
+		return true
+	}
+	return relation >= ViewerNDA || EffectiveSecretVisibility(post) != models.SecretVisibilityHidden
+}
+
+// ApplyPostVisibility masks the fields of a post that the viewer may not see and returns their JSON names.
+// Only secret posts are masked.
+func ApplyPostVisibility(post *models.Post, relation ViewerRelation) []string {
+	if post.Type != models.PostTypeSecret || relation >= ViewerOwner {
+		return nil
+	}
+
+	visibility := EffectiveSecretVisibility(*post)
+	v := reflect.ValueOf(post).Elem()
+	masked := make([]string, 0)
+	for name, i := range postFieldIndex {
+		if CanViewField(PostFieldAccess(name), relation, visibility) {
+			continue
+		}
+		field := v.Field(i)
+		if !field.IsZero() {
+			field.Set(reflect.Zero(field.Type()))
+		}
+		masked = append(masked, name)
+	}
+	sort.Strings(masked)
+	return masked
+}
+
+// ApplyPostDetailsVisibility masks a post with details, including the author profile when the author is hidden
+func ApplyPostDetailsVisibility(details *models.PostWithDetails, relation ViewerRelation) {
+	details.MaskedFields = ApplyPostVisibility(&details.Post, relation)
+	for _, name := range details.MaskedFields {
+		if name == "author_user_id" {
+			details.AuthorProfile = nil
+			break
+		}
+	}
+}
@@ -0,0 +1,506 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// ErrWatermarkUnsupported is returned for content types that cannot be watermarked
+var ErrWatermarkUnsupported = errors.New("watermark is not supported for this file type")
+
+const (
+	// 不可視の透かしの識別子。"APX1;<user id>;<unix time>;<trace id>;<mac>"
+	watermarkPayloadPrefix = "APX1;"
+	// PDFの増分更新のトレーラーに書き込むキー
+	watermarkTrailerKey = "APXWatermark"
+)
+
+// 画像のLSBに埋め込むペイロードの先頭（magic + 長さ2バイト）
+var watermarkImageMagic = []byte{0xA9, 0x5E, 0x1C, 0x37}
+
+// Watermark identifies the viewer a confidential file was served to
+type Watermark struct {
+	ViewerName string
+	UserID     string
+	Timestamp  time.Time
+	TraceID    string // アクセスログのID（流出元の特定用）
+	// FooterOnly stamps the visible text only as a footer (message images); the invisible mark is always embedded
+	FooterOnly bool
+}
+
+// WatermarkMark is an invisible watermark recovered from a file
+type WatermarkMark struct {
+	UserID    string    `json:"user_id"`
+	Timestamp time.Time `json:"timestamp"`
+	TraceID   string    `json:"trace_id"`
+	// Verified is false when the MAC does not match (forged or altered mark)
+	Verified bool `json:"verified"`
+}
+
+// Text returns the watermark line, e.g. "CONFIDENTIAL / 山田太郎 / <user id> / 2025-01-02 03:04 UTC / #<trace>"
+func (wm Watermark) Text() string {
+	parts := []string{"CONFIDENTIAL"}
+	if wm.ViewerName != "" {
+		parts = append(parts, wm.ViewerName)
+	}
+	parts = append(parts, wm.UserID, wm.Timestamp.UTC().Format("2006-01-02 15:04")+" UTC")
+	if wm.TraceID != "" {
+		parts = append(parts, "#"+wm.TraceID)
+	}
+	return strings.Join(parts, " / ")
+}
+
+// asciiText is the watermark line for bitmap rendering (images).
+// 画像用のビットマップフォントはASCIIのみのため、表示名のASCII以外の文字は除く
+func (wm Watermark) asciiText() string {
+	ascii := wm
+	ascii.ViewerName = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r >= 0x20 && r <= 0x7E {
+			return r
+		}
+		return -1
+	}, wm.ViewerName))
+	return ascii.Text()
+}
+
+// payload returns the invisible mark. The MAC prevents a leaker from forging a mark that points at someone else.
+func (wm Watermark) payload(secret string) string {
+	body := fmt.Sprintf("%s%s;%d;%s", watermarkPayloadPrefix, wm.UserID, wm.Timestamp.Unix(), wm.TraceID)
+	return body + ";" + watermarkMAC(secret, body)
+}
+
+func watermarkMAC(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("appexit-watermark\x00" + body))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// parseWatermarkPayload parses a payload produced by Watermark.payload
+func parseWatermarkPayload(secret, payload string) (WatermarkMark, bool) {
+	if !strings.HasPrefix(payload, watermarkPayloadPrefix) {
+		return WatermarkMark{}, false
+	}
+	fields := strings.Split(strings.TrimPrefix(payload, watermarkPayloadPrefix), ";")
+	if len(fields) != 4 {
+		return WatermarkMark{}, false
+	}
+	unix, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return WatermarkMark{}, false
+	}
+	body := payload[:strings.LastIndex(payload, ";")]
+	return WatermarkMark{
+		UserID:    fields[0],
+		Timestamp: time.Unix(unix, 0).UTC(),
+		TraceID:   fields[2],
+		Verified:  hmac.Equal([]byte(fields[3]), []byte(watermarkMAC(secret, body))),
+	}, true
+}
+
+// WatermarkSupported reports whether files of the content type can be watermarked
+func WatermarkSupported(contentType string) bool {
+	switch contentType {
+	case "application/pdf", "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// ApplyWatermark stamps the viewer identity into a PDF or image as visible text and as an invisible, signed mark,
+// and returns the result and its content type.
+//   - PDF:  invisible text (render mode 3) on every page and an entry in the trailer of the incremental update
+//   - PNG / GIF: least significant bits of the blue channel (GIFは最初のフレームのみPNGとして返す)
+//   - JPEG: a COM segment (再圧縮でLSBが失われるため)
+func ApplyWatermark(secret, contentType string, data []byte, wm Watermark) ([]byte, string, error) {
+	payload := wm.payload(secret)
+	switch contentType {
+	case "application/pdf":
+		out, err := StampPDFPages(data, func(box [4]float64, rotate int) string {
+			return pdfWatermarkOverlay(box, wm.Text(), payload, wm.FooterOnly)
+		}, map[string]string{watermarkTrailerKey: payload})
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrWatermarkUnsupported, err)
+		}
+		return out, contentType, nil
+	case "image/png", "image/jpeg", "image/gif":
+		return watermarkImage(contentType, data, wm.asciiText(), payload, wm.FooterOnly)
+	}
+	return nil, "", ErrWatermarkUnsupported
+}
+
+// ExtractWatermarks recovers the invisible marks from a file served by ApplyWatermark.
+// A file passed on through several viewers can carry more than one mark.
+func ExtractWatermarks(secret, contentType string, data []byte) ([]WatermarkMark, error) {
+	var payloads []string
+	switch contentType {
+	case "application/pdf":
+		if v, err := pdfTrailerString(data, watermarkTrailerKey); err == nil && v != "" {
+			payloads = append(payloads, v)
+		}
+		contents, err := pdfPageContents(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWatermarkUnsupported, err)
+		}
+		for _, content := range contents {
+			payloads = append(payloads, pdfHexPayloads(content)...)
+		}
+	case "image/jpeg":
+		payloads = jpegCommentPayloads(data)
+		if len(payloads) > 0 {
+			break
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWatermarkUnsupported, err)
+		}
+		// PNGで配信した画像をJPEGに変換された場合に備えてLSBも確認する
+		payloads = imageLSBPayloads(img)
+	case "image/png", "image/gif":
+		var img image.Image
+		var err error
+		if contentType == "image/png" {
+			img, err = png.Decode(bytes.NewReader(data))
+		} else {
+			img, err = gif.Decode(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWatermarkUnsupported, err)
+		}
+		payloads = imageLSBPayloads(img)
+	default:
+		return nil, ErrWatermarkUnsupported
+	}
+
+	marks := make([]WatermarkMark, 0, len(payloads))
+	seen := make(map[string]bool)
+	for _, p := range payloads {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if mark, ok := parseWatermarkPayload(secret, p); ok {
+			marks = append(marks, mark)
+		}
+	}
+	return marks, nil
+}
+
+// pdfHexPayloads finds the invisible marks written by pdfWatermarkOverlay in a content stream
+func pdfHexPayloads(content []byte) []string {
+	prefix := []byte("<" + pdfUCS2Hex(watermarkPayloadPrefix))
+	var payloads []string
+	for {
+		i := bytes.Index(content, prefix)
+		if i < 0 {
+			return payloads
+		}
+		content = content[i+1:]
+		end := bytes.IndexByte(content, '>')
+		if end < 0 {
+			return payloads
+		}
+		raw, err := hex.DecodeString(string(content[:end]))
+		if err != nil || len(raw)%2 != 0 {
+			continue
+		}
+		units := make([]uint16, len(raw)/2)
+		for j := range units {
+			units[j] = uint16(raw[2*j])<<8 | uint16(raw[2*j+1])
+		}
+		payloads = append(payloads, string(utf16.Decode(units)))
+	}
+}
+
+// pdfWatermarkOverlay tiles the text diagonally over the page, writes it once more as a footer
+// and hides the payload as invisible text
+func pdfWatermarkOverlay(box [4]float64, text, payload string, footerOnly bool) string {
+	const size = 13.0
+	textHex := pdfUCS2Hex(text)
+	width := pdfTextWidth(text, size)
+	pageW, pageH := box[2]-box[0], box[3]-box[1]
+	diagonal := math.Hypot(pageW, pageH)
+
+	var b strings.Builder
+	if !footerOnly {
+		b.WriteString("q /APXWMGS gs 0.35 g BT /APXWMF 13 Tf\n")
+		cos, sin := math.Cos(math.Pi/6), math.Sin(math.Pi/6)
+		row := 0
+		for y := -diagonal; y < diagonal; y += 110 {
+			// 行ごとに開始位置をずらして、文字が縦に揃わないようにする
+			offset := math.Mod(float64(row)*width/3, width+60)
+			for x := -diagonal - offset; x < diagonal; x += width + 60 {
+				// ページ中心を原点に30度回転
+				px := box[0] + pageW/2 + x*cos - y*sin
+				py := box[1] + pageH/2 + x*sin + y*cos
+				fmt.Fprintf(&b, "%.4f %.4f %.4f %.4f %.2f %.2f Tm <%s> Tj\n", cos, sin, -sin, cos, px, py, textHex)
+			}
+			row++
+		}
+		b.WriteString("ET Q\n")
+	}
+	fmt.Fprintf(&b, "q /APXWMGF gs 0.2 g BT /APXWMF 7 Tf 1 0 0 1 %.2f %.2f Tm <%s> Tj ET Q\n", box[0]+12, box[1]+10, textHex)
+	// 不可視テキスト（描画モード3）。表示されないがテキスト抽出やコピーでは残る
+	fmt.Fprintf(&b, "q BT 3 Tr /APXWMF 1 Tf 1 0 0 1 %.2f %.2f Tm <%s> Tj ET Q\n", box[0]+1, box[1]+1, pdfUCS2Hex(payload))
+	return b.String()
+}
+
+// watermarkImage draws the text tiled over the image and as a footer band, then embeds the payload
+func watermarkImage(contentType string, data []byte, text, payload string, footerOnly bool) ([]byte, string, error) {
+	var src image.Image
+	var err error
+	switch contentType {
+	case "image/png":
+		src, err = png.Decode(bytes.NewReader(data))
+	case "image/jpeg":
+		src, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/gif":
+		src, err = gif.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrWatermarkUnsupported, err)
+	}
+
+	bounds := src.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), src, bounds.Min, draw.Src)
+
+	w, h := canvas.Bounds().Dx(), canvas.Bounds().Dy()
+	scale := min(w, h) / 320
+	if scale < 1 {
+		scale = 1
+	}
+	textW := len(text) * 6 * scale
+	lineH := 8 * scale
+
+	// 全体に薄く敷き詰める（行ごとにずらす）
+	if !footerOnly {
+		faint := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+		for row, y := 0, lineH; y < h; row, y = row+1, y+lineH*5 {
+			offset := (row * textW / 3) % (textW + 12*scale)
+			for x := -offset; x < w; x += textW + 12*scale {
+				drawBitmapText(canvas, text, x, y, scale, faint, 0.22)
+			}
+		}
+	}
+
+	// 下端に帯と識別情報
+	band := image.Rect(0, h-lineH-4*scale, w, h)
+	blendRect(canvas, band, color.RGBA{A: 255}, 0.55)
+	drawBitmapText(canvas, text, 2*scale, h-lineH-2*scale, scale, color.RGBA{R: 255, G: 255, B: 255, A: 255}, 1)
+
+	var out bytes.Buffer
+	if contentType == "image/jpeg" {
+		if err := jpeg.Encode(&out, canvas, &jpeg.Options{Quality: 92}); err != nil {
+			return nil, "", err
+		}
+		return jpegInsertComment(out.Bytes(), payload), contentType, nil
+	}
+	embedImageLSB(canvas, payload)
+	if err := png.Encode(&out, canvas); err != nil {
+		return nil, "", err
+	}
+	return out.Bytes(), "image/png", nil
+}
+
+// embedImageLSB writes magic + length + payload into the least significant bit of the blue channel
+// of opaque pixels, repeated over the whole image so that a cropped copy still carries the mark
+func embedImageLSB(img *image.RGBA, payload string) {
+	if len(payload) > 0xFFFF {
+		return
+	}
+	msg := append(append([]byte{}, watermarkImageMagic...), byte(len(payload)>>8), byte(len(payload)))
+	msg = append(msg, payload...)
+	bits := len(msg) * 8
+
+	i := 0
+	for p := 0; p+3 < len(img.Pix); p += 4 {
+		// 半透明のピクセルはPNGの書き出し（非乗算アルファへの変換）で値が変わるため使わない
+		if img.Pix[p+3] != 0xFF {
+			continue
+		}
+		bit := msg[(i%bits)/8] >> (7 - uint(i%8)) & 1
+		img.Pix[p+2] = img.Pix[p+2]&^1 | bit
+		i++
+	}
+}
+
+// imageLSBPayloads reads the payloads embedded by embedImageLSB
+func imageLSBPayloads(src image.Image) []string {
+	bounds := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Bounds(), src, bounds.Min, draw.Src)
+
+	stream := make([]byte, 0, len(img.Pix)/4)
+	for p := 0; p+3 < len(img.Pix); p += 4 {
+		if img.Pix[p+3] == 0xFF {
+			stream = append(stream, img.Pix[p+2]&1)
+		}
+	}
+	readByte := func(at int) byte {
+		var b byte
+		for k := 0; k < 8; k++ {
+			b = b<<1 | stream[at+k]
+		}
+		return b
+	}
+
+	var payloads []string
+	seen := make(map[string]bool)
+	magic := uint32(watermarkImageMagic[0])<<24 | uint32(watermarkImageMagic[1])<<16 | uint32(watermarkImageMagic[2])<<8 | uint32(watermarkImageMagic[3])
+	var window uint32
+	for i := 0; i < len(stream); i++ {
+		window = window<<1 | uint32(stream[i])
+		if i < 31 || window != magic {
+			continue
+		}
+		start := i + 1
+		if start+16 > len(stream) {
+			break
+		}
+		length := int(readByte(start))<<8 | int(readByte(start+8))
+		if length == 0 || start+16+length*8 > len(stream) {
+			continue
+		}
+		buf := make([]byte, length)
+		for j := range buf {
+			buf[j] = readByte(start + 16 + j*8)
+		}
+		if p := string(buf); strings.HasPrefix(p, watermarkPayloadPrefix) && !seen[p] {
+			seen[p] = true
+			payloads = append(payloads, p)
+		}
+		// 同じ埋め込みの繰り返しは読み飛ばす
+		i = start + 16 + length*8 - 1
+	}
+	return payloads
+}
+
+// jpegInsertComment adds a COM segment right after SOI
+func jpegInsertComment(data []byte, comment string) []byte {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 || len(comment) > 0xFFFF-2 {
+		return data
+	}
+	segment := []byte{0xFF, 0xFE, byte((len(comment) + 2) >> 8), byte(len(comment) + 2)}
+	out := make([]byte, 0, len(data)+len(segment)+len(comment))
+	out = append(out, data[:2]...)
+	out = append(out, segment...)
+	out = append(out, comment...)
+	return append(out, data[2:]...)
+}
+
+// jpegCommentPayloads returns the watermark payloads found in COM segments
+func jpegCommentPayloads(data []byte) []string {
+	var payloads []string
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	for p := 2; p+4 <= len(data) && data[p] == 0xFF; {
+		marker := data[p+1]
+		// SOS以降は画像データ
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(data[p+2])<<8 | int(data[p+3])
+		if length < 2 || p+2+length > len(data) {
+			break
+		}
+		if marker == 0xFE {
+			if c := string(data[p+4 : p+2+length]); strings.HasPrefix(c, watermarkPayloadPrefix) {
+				payloads = append(payloads, c)
+			}
+		}
+		p += 2 + length
+	}
+	return payloads
+}
+
+func blendRect(img *image.RGBA, r image.Rectangle, c color.RGBA, alpha float64) {
+	r = r.Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			blendPixel(img, x, y, c, alpha)
+		}
+	}
+}
+
+func blendPixel(img *image.RGBA, x, y int, c color.RGBA, alpha float64) {
+	i := img.PixOffset(x, y)
+	p := img.Pix[i : i+4]
+	p[0] = uint8(float64(p[0])*(1-alpha) + float64(c.R)*alpha)
+	p[1] = uint8(float64(p[1])*(1-alpha) + float64(c.G)*alpha)
+	p[2] = uint8(float64(p[2])*(1-alpha) + float64(c.B)*alpha)
+	if p[3] < 255 {
+		p[3] = uint8(float64(p[3])*(1-alpha) + 255*alpha)
+	}
+}
+
+// drawBitmapText draws ASCII text with the 5x8 bitmap font. (x, y) is the top-left corner.
+func drawBitmapText(img *image.RGBA, text string, x, y, scale int, c color.RGBA, alpha float64) {
+	bounds := img.Bounds()
+	for _, r := range text {
+		if r < 0x20 || r > 0x7E {
+			r = '?'
+		}
+		glyph := bitmapFont5x8[r-0x20]
+		for col := 0; col < 5; col++ {
+			bits := glyph[col]
+			for row := 0; row < 8; row++ {
+				if bits&(1<<row) == 0 {
+					continue
+				}
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						px, py := x+col*scale+dx, y+row*scale+dy
+						if image.Pt(px, py).In(bounds) {
+							blendPixel(img, px, py, c, alpha)
+						}
+					}
+				}
+			}
+		}
+		x += 6 * scale
+	}
+}
+
+// bitmapFont5x8 is a 5x8 column-major bitmap font for ASCII 0x20-0x7E (bit 0 = top row)
+var bitmapFont5x8 = [95][5]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00}, {0x00, 0x00, 0x5F, 0x00, 0x00}, {0x00, 0x07, 0x00, 0x07, 0x00}, {0x14, 0x7F, 0x14, 0x7F, 0x14}, // space ! " #
+	{0x24, 0x2A, 0x7F, 0x2A, 0x12}, {0x23, 0x13, 0x08, 0x64, 0x62}, {0x36, 0x49, 0x56, 0x20, 0x50}, {0x00, 0x08, 0x07, 0x03, 0x00}, // $ % & '
+	{0x00, 0x1C, 0x22, 0x41, 0x00}, {0x00, 0x41, 0x22, 0x1C, 0x00}, {0x2A, 0x1C, 0x7F, 0x1C, 0x2A}, {0x08, 0x08, 0x3E, 0x08, 0x08}, // ( ) * +
+	{0x00, 0x80, 0x70, 0x30, 0x00}, {0x08, 0x08, 0x08, 0x08, 0x08}, {0x00, 0x00, 0x60, 0x60, 0x00}, {0x20, 0x10, 0x08, 0x04, 0x02}, // , - . /
+	{0x3E, 0x51, 0x49, 0x45, 0x3E}, {0x00, 0x42, 0x7F, 0x40, 0x00}, {0x72, 0x49, 0x49, 0x49, 0x46}, {0x21, 0x41, 0x49, 0x4D, 0x33}, // 0 1 2 3
+	{0x18, 0x14, 0x12, 0x7F, 0x10}, {0x27, 0x45, 0x45, 0x45, 0x39}, {0x3C, 0x4A, 0x49, 0x49, 0x31}, {0x41, 0x21, 0x11, 0x09, 0x07}, // 4 5 6 7
+	{0x36, 0x49, 0x49, 0x49, 0x36}, {0x46, 0x49, 0x49, 0x29, 0x1E}, {0x00, 0x00, 0x14, 0x00, 0x00}, {0x00, 0x40, 0x34, 0x00, 0x00}, // 8 9 : ;
+	{0x00, 0x08, 0x14, 0x22, 0x41}, {0x14, 0x14, 0x14, 0x14, 0x14}, {0x00, 0x41, 0x22, 0x14, 0x08}, {0x02, 0x01, 0x59, 0x09, 0x06}, // < = > ?
+	{0x3E, 0x41, 0x5D, 0x59, 0x4E}, {0x7C, 0x12, 0x11, 0x12, 0x7C}, {0x7F, 0x49, 0x49, 0x49, 0x36}, {0x3E, 0x41, 0x41, 0x41, 0x22}, // @ A B C
+	{0x7F, 0x41, 0x41, 0x41, 0x3E}, {0x7F, 0x49, 0x49, 0x49, 0x41}, {0x7F, 0x09, 0x09, 0x09, 0x01}, {0x3E, 0x41, 0x41, 0x51, 0x73}, // D E F G
+	{0x7F, 0x08, 0x08, 0x08, 0x7F}, {0x00, 0x41, 0x7F, 0x41, 0x00}, {0x20, 0x40, 0x41, 0x3F, 0x01}, {0x7F, 0x08, 0x14, 0x22, 0x41}, // H I J K
+	{0x7F, 0x40, 0x40, 0x40, 0x40}, {0x7F, 0x02, 0x1C, 0x02, 0x7F}, {0x7F, 0x04, 0x08, 0x10, 0x7F}, {0x3E, 0x41, 0x41, 0x41, 0x3E}, // L M N O
+	{0x7F, 0x09, 0x09, 0x09, 0x06}, {0x3E, 0x41, 0x51, 0x21, 0x5E}, {0x7F, 0x09, 0x19, 0x29, 0x46}, {0x26, 0x49, 0x49, 0x49, 0x32}, // P Q R S
+	{0x03, 0x01, 0x7F, 0x01, 0x03}, {0x3F, 0x40, 0x40, 0x40, 0x3F}, {0x1F, 0x20, 0x40, 0x20, 0x1F}, {0x3F, 0x40, 0x38, 0x40, 0x3F}, // T U V W
+	{0x63, 0x14, 0x08, 0x14, 0x63}, {0x03, 0x04, 0x78, 0x04, 0x03}, {0x61, 0x59, 0x49, 0x4D, 0x43}, {0x00, 0x7F, 0x41, 0x41, 0x41}, // X Y Z [
+	{0x02, 0x04, 0x08, 0x10, 0x20}, {0x00, 0x41, 0x41, 0x41, 0x7F}, {0x04, 0x02, 0x01, 0x02, 0x04}, {0x40, 0x40, 0x40, 0x40, 0x40}, // \ ] ^ _
+	{0x00, 0x03, 0x07, 0x08, 0x00}, {0x20, 0x54, 0x54, 0x78, 0x40}, {0x7F, 0x28, 0x44, 0x44, 0x38}, {0x38, 0x44, 0x44, 0x44, 0x28}, // ` a b c
+	{0x38, 0x44, 0x44, 0x28, 0x7F}, {0x38, 0x54, 0x54, 0x54, 0x18}, {0x00, 0x08, 0x7E, 0x09, 0x02}, {0x18, 0xA4, 0xA4, 0x9C, 0x78}, // d e f g
+	{0x7F, 0x08, 0x04, 0x04, 0x78}, {0x00, 0x44, 0x7D, 0x40, 0x00}, {0x20, 0x40, 0x40, 0x3D, 0x00}, {0x7F, 0x10, 0x28, 0x44, 0x00}, // h i j k
+	{0x00, 0x41, 0x7F, 0x40, 0x00}, {0x7C, 0x04, 0x78, 0x04, 0x78}, {0x7C, 0x08, 0x04, 0x04, 0x78}, {0x38, 0x44, 0x44, 0x44, 0x38}, // l m n o
+	{0xFC, 0x18, 0x24, 0x24, 0x18}, {0x18, 0x24, 0x24, 0x18, 0xFC}, {0x7C, 0x08, 0x04, 0x04, 0x08}, {0x48, 0x54, 0x54, 0x54, 0x24}, // p q r s
+	{0x04, 0x04, 0x3F, 0x44, 0x24}, {0x3C, 0x40, 0x40, 0x20, 0x7C}, {0x1C, 0x20, 0x40, 0x20, 0x1C}, {0x3C, 0x40, 0x30, 0x40, 0x3C}, // t u v w
+	{0x44, 0x28, 0x10, 0x28, 0x44}, {0x4C, 0x90, 0x90, 0x90, 0x7C}, {0x44, 0x64, 0x54, 0x4C, 0x44}, {0x00, 0x08, 0x36, 0x41, 0x00}, // x y z {
+	{0x00, 0x00, 0x77, 0x00, 0x00}, {0x00, 0x41, 0x36, 0x08, 0x00}, {0x02, 0x01, 0x02, 0x04, 0x02}, // | } ~
+}
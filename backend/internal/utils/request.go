@@ -3,7 +3,9 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/yourusername/appexit-backend/pkg/response"
 )
@@ -85,6 +87,39 @@ func RequireMethod(r *http.Request, w http.ResponseWriter, method string) bool {
 	return true
 }
 
+// trustedProxyHops is the number of reverse proxies in front of the backend that append to X-Forwarded-For
+var trustedProxyHops int
+
+// SetTrustedProxyHops configures how many X-Forwarded-For entries are added by trusted proxies.
+// 0 の場合はヘッダーを信用せず接続元アドレスを使う
+func SetTrustedProxyHops(hops int) {
+	trustedProxyHops = hops
+}
+
+// ClientIP returns the IP address of the client
+// 🔒 SECURITY: X-Forwarded-For の先頭はクライアントが自由に設定できるため、
+// 信頼するプロキシが追加した右から hops 番目のエントリを使う（プロキシ未設定時は RemoteAddr）
+func ClientIP(r *http.Request) string {
+	if trustedProxyHops > 0 {
+		var entries []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, entry := range strings.Split(header, ",") {
+				entries = append(entries, strings.TrimSpace(entry))
+			}
+		}
+		if len(entries) >= trustedProxyHops {
+			if ip := entries[len(entries)-trustedProxyHops]; net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // ExtractIDFromPath extracts an ID from the URL path at the specified position
 // Example: "/api/posts/123/comments" with position 2 returns "123"
 func ExtractIDFromPath(path string, position int) (string, error) {
@@ -3,6 +3,8 @@ package utils
 import (
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/yourusername/appexit-backend/internal/models"
 )
@@ -99,6 +101,66 @@ func ValidateStruct(s interface{}) error {
 		return validateUpdateProfileRequest(v)
 	case *models.UpdateProfileRequest:
 		return validateUpdateProfileRequest(*v)
+	case models.CreateNDARequest:
+		return validateCreateNDARequest(v)
+	case *models.CreateNDARequest:
+		return validateCreateNDARequest(*v)
+	case models.DeclineNDARequest:
+		return validateDeclineNDARequest(v)
+	case *models.DeclineNDARequest:
+		return validateDeclineNDARequest(*v)
+	case models.SignNDARequest:
+		return validateSignNDARequest(v)
+	case *models.SignNDARequest:
+		return validateSignNDARequest(*v)
+	case models.ApproveNDARequest:
+		return validateApproveNDARequest(v)
+	case *models.ApproveNDARequest:
+		return validateApproveNDARequest(*v)
+	case models.UpdateNDAScopeRequest:
+		return validateUpdateNDAScopeRequest(v)
+	case *models.UpdateNDAScopeRequest:
+		return validateUpdateNDAScopeRequest(*v)
+	case models.RevokeNDARequest:
+		return validateRevokeNDARequest(v)
+	case *models.RevokeNDARequest:
+		return validateRevokeNDARequest(*v)
+	case models.GenerateContractRequest:
+		return validateGenerateContractRequest(v)
+	case *models.GenerateContractRequest:
+		return validateGenerateContractRequest(*v)
+	case models.MergeThreadRequest:
+		return validateMergeThreadRequest(v)
+	case *models.MergeThreadRequest:
+		return validateMergeThreadRequest(*v)
+	case models.UpdateMessageRequest:
+		return validateUpdateMessageRequest(v)
+	case *models.UpdateMessageRequest:
+		return validateUpdateMessageRequest(*v)
+	case models.AddThreadParticipantRequest:
+		return validateAddThreadParticipantRequest(v)
+	case *models.AddThreadParticipantRequest:
+		return validateAddThreadParticipantRequest(*v)
+	case models.UpdateThreadStateRequest:
+		return validateUpdateThreadStateRequest(v)
+	case *models.UpdateThreadStateRequest:
+		return validateUpdateThreadStateRequest(*v)
+	case models.CreateDataRoomRequest:
+		return validateCreateDataRoomRequest(v)
+	case *models.CreateDataRoomRequest:
+		return validateCreateDataRoomRequest(*v)
+	case models.CreateDataRoomFolderRequest:
+		return validateCreateDataRoomFolderRequest(v)
+	case *models.CreateDataRoomFolderRequest:
+		return validateCreateDataRoomFolderRequest(*v)
+	case models.UpsertDataRoomGrantRequest:
+		return validateUpsertDataRoomGrantRequest(v)
+	case *models.UpsertDataRoomGrantRequest:
+		return validateUpsertDataRoomGrantRequest(*v)
+	case models.CreateFileURLRequest:
+		return validateCreateFileURLRequest(v)
+	case *models.CreateFileURLRequest:
+		return validateCreateFileURLRequest(*v)
 	default:
 		return fmt.Errorf("validation not implemented for type %T", s)
 	}
@@ -407,6 +469,266 @@ func validateConfirmSaleRequestRequest(req models.ConfirmSaleRequestRequest) err
 	return nil
 }
 
+func validateCreateNDARequest(req models.CreateNDARequest) error {
+	// Validate either post_id or seller_user_id is provided
+	hasPost := req.PostID != nil && *req.PostID != ""
+	hasSeller := req.SellerUserID != nil && *req.SellerUserID != ""
+	if !hasPost && !hasSeller {
+		return fmt.Errorf("post_id or seller_user_id is required")
+	}
+
+	// Validate scope if provided
+	if err := validateNDAScope(req.Scope); err != nil {
+		return err
+	}
+
+	// Validate message length if provided
+	if req.Message != nil && len([]rune(*req.Message)) > 2000 {
+		return fmt.Errorf("message must be at most 2000 characters long")
+	}
+
+	return nil
+}
+
+func validateApproveNDARequest(req models.ApproveNDARequest) error {
+	// Validate scope if provided
+	if err := validateNDAScope(req.Scope); err != nil {
+		return err
+	}
+
+	// Validate expires_at is in the future
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+
+	return nil
+}
+
+func validateUpdateNDAScopeRequest(req models.UpdateNDAScopeRequest) error {
+	// Validate at least one change is requested
+	if req.Scope == nil && req.ExpiresAt == nil && !req.RemoveExpiry {
+		return fmt.Errorf("scope, expires_at or remove_expiry is required")
+	}
+	if req.ExpiresAt != nil && req.RemoveExpiry {
+		return fmt.Errorf("expires_at and remove_expiry cannot be used together")
+	}
+
+	// Validate scope if provided
+	if err := validateNDAScope(req.Scope); err != nil {
+		return err
+	}
+
+	// Validate expires_at is in the future
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expires_at must be in the future. Use revoke to end the NDA now")
+	}
+
+	// Validate note length if provided
+	if req.Note != nil && len([]rune(*req.Note)) > 2000 {
+		return fmt.Errorf("note must be at most 2000 characters long")
+	}
+
+	return nil
+}
+
+func validateRevokeNDARequest(req models.RevokeNDARequest) error {
+	// Validate reason length if provided
+	if req.Reason != nil && len([]rune(*req.Reason)) > 2000 {
+		return fmt.Errorf("reason must be at most 2000 characters long")
+	}
+
+	return nil
+}
+
+func validateNDAScope(scope *models.NDAScope) error {
+	if scope == nil {
+		return nil
+	}
+	switch *scope {
+	case models.NDAScopeListing, models.NDAScopeSeller, models.NDAScopeOrg:
+		return nil
+	default:
+		return fmt.Errorf("scope must be listing, seller or org")
+	}
+}
+
+func validateDeclineNDARequest(req models.DeclineNDARequest) error {
+	// Validate reason length if provided
+	if req.Reason != nil && len([]rune(*req.Reason)) > 2000 {
+		return fmt.Errorf("reason must be at most 2000 characters long")
+	}
+
+	return nil
+}
+
+func validateSignNDARequest(req models.SignNDARequest) error {
+	// Validate document_hash is required
+	if err := ValidateRequired("document_hash", req.DocumentHash); err != nil {
+		return err
+	}
+
+	// Validate document_hash is a hex-encoded SHA-256
+	if len(req.DocumentHash) != 64 {
+		return fmt.Errorf("document_hash must be a SHA-256 hex string")
+	}
+
+	return nil
+}
+
+func validateGenerateContractRequest(req models.GenerateContractRequest) error {
+	// Validate thread_id is required
+	if err := ValidateRequired("thread_id", req.ThreadID); err != nil {
+		return err
+	}
+
+	// Validate contract type (templates exist for these types only)
+	switch req.ContractType {
+	case models.ContractTypeNDA, models.ContractTypeLOI, models.ContractTypeTransfer, models.ContractTypeHandover:
+	default:
+		return fmt.Errorf("contract_type must be one of: nda, loi, transfer, handover")
+	}
+
+	// Validate language if provided
+	if req.Language != "" && req.Language != "ja" && req.Language != "en" {
+		return fmt.Errorf("language must be ja or en")
+	}
+
+	// Validate terms
+	terms := req.Terms
+	if (terms.Price != nil && *terms.Price < 0) || (terms.DepositAmount != nil && *terms.DepositAmount < 0) {
+		return fmt.Errorf("amounts must not be negative")
+	}
+	if terms.PaymentDueDays < 0 || terms.ExclusivityDays < 0 || terms.HandoverDays < 0 ||
+		terms.SupportDays < 0 || terms.NonCompeteMonths < 0 || terms.ValidityYears < 0 {
+		return fmt.Errorf("periods must not be negative")
+	}
+	if terms.ClosingDate != "" {
+		if _, err := time.Parse("2006-01-02", terms.ClosingDate); err != nil {
+			return fmt.Errorf("closing_date must be in YYYY-MM-DD format")
+		}
+	}
+	if len(terms.Assets) > 50 {
+		return fmt.Errorf("assets must contain at most 50 items")
+	}
+	if len([]rune(terms.SpecialTerms)) > 5000 {
+		return fmt.Errorf("special_terms must be at most 5000 characters long")
+	}
+
+	return nil
+}
+
+func validateMergeThreadRequest(req models.MergeThreadRequest) error {
+	// Validate source_thread_id is required
+	return ValidateRequired("source_thread_id", req.SourceThreadID)
+}
+
+func validateUpdateMessageRequest(req models.UpdateMessageRequest) error {
+	// Validate text is required
+	if strings.TrimSpace(req.Text) == "" {
+		return fmt.Errorf("text is required")
+	}
+
+	// Validate text length (max=5000)
+	if len([]rune(req.Text)) > MaxTextareaLength {
+		return fmt.Errorf("text must be at most %d characters long", MaxTextareaLength)
+	}
+
+	return nil
+}
+
+func validateAddThreadParticipantRequest(req models.AddThreadParticipantRequest) error {
+	// Validate user_id is required
+	if err := ValidateRequired("user_id", req.UserID); err != nil {
+		return err
+	}
+
+	// 招待できるのはアドバイザーと運営のみ（売り手・買い手はスレッド作成時に決まる）
+	switch req.Role {
+	case models.ThreadRoleSellerAdvisor, models.ThreadRoleBuyerAdvisor, models.ThreadRoleOperator:
+		return nil
+	}
+	return fmt.Errorf("role must be one of: seller_advisor, buyer_advisor, operator")
+}
+
+func validateUpdateThreadStateRequest(req models.UpdateThreadStateRequest) error {
+	if req.Archived == nil && req.Muted == nil && req.Pinned == nil && req.Labels == nil {
+		return fmt.Errorf("at least one of archived, muted, pinned or labels is required")
+	}
+
+	// Validate labels (max 20 labels, each at most 30 characters)
+	if req.Labels != nil {
+		if len(*req.Labels) > 20 {
+			return fmt.Errorf("labels must be at most 20")
+		}
+		for _, label := range *req.Labels {
+			if len([]rune(strings.TrimSpace(label))) > 30 {
+				return fmt.Errorf("each label must be at most 30 characters long")
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateCreateDataRoomRequest(req models.CreateDataRoomRequest) error {
+	// Validate post_id is required
+	if err := ValidateRequired("post_id", req.PostID); err != nil {
+		return err
+	}
+
+	// Validate title and description length if provided
+	if req.Title != nil && (len(strings.TrimSpace(*req.Title)) == 0 || len([]rune(*req.Title)) > 200) {
+		return fmt.Errorf("title must be between 1 and 200 characters long")
+	}
+	if req.Description != nil && len([]rune(*req.Description)) > 2000 {
+		return fmt.Errorf("description must be at most 2000 characters long")
+	}
+
+	return nil
+}
+
+func validateCreateDataRoomFolderRequest(req models.CreateDataRoomFolderRequest) error {
+	// Validate name is required
+	name := strings.TrimSpace(req.Name)
+	if err := ValidateRequired("name", name); err != nil {
+		return err
+	}
+	if len([]rune(name)) > 100 {
+		return fmt.Errorf("name must be at most 100 characters long")
+	}
+	if strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("name must not contain slashes")
+	}
+
+	return nil
+}
+
+func validateUpsertDataRoomGrantRequest(req models.UpsertDataRoomGrantRequest) error {
+	// Validate buyer_user_id is required
+	if err := ValidateRequired("buyer_user_id", req.BuyerUserID); err != nil {
+		return err
+	}
+	if len(req.FolderIDs) > 100 {
+		return fmt.Errorf("folder_ids must contain at most 100 items")
+	}
+
+	// Validate expires_at is in the future
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+
+	return nil
+}
+
+func validateCreateFileURLRequest(req models.CreateFileURLRequest) error {
+	switch req.Action {
+	case "", models.FileAccessView, models.FileAccessDownload:
+		return nil
+	default:
+		return fmt.Errorf("action must be view or download")
+	}
+}
+
 func validateUpdateProfileRequest(req models.UpdateProfileRequest) error {
 	// All fields are optional, but if provided, must be valid
 
@@ -420,5 +742,10 @@ func validateUpdateProfileRequest(req models.UpdateProfileRequest) error {
 		return fmt.Errorf("display_name must not be empty if provided")
 	}
 
+	// Validate preferred_language if provided (メールの言語)
+	if req.PreferredLanguage != nil && *req.PreferredLanguage != "ja" && *req.PreferredLanguage != "en" {
+		return fmt.Errorf("preferred_language must be either 'ja' or 'en'")
+	}
+
 	return nil
 }
@@ -0,0 +1,9 @@
+-- Contract documents generated from templates (POST /api/contracts/generate)
+
+ALTER TABLE thread_contract_documents ADD COLUMN IF NOT EXISTS template_version INT;
+ALTER TABLE thread_contract_documents ADD COLUMN IF NOT EXISTS template_language TEXT;
+ALTER TABLE thread_contract_documents ADD COLUMN IF NOT EXISTS document_hash TEXT;
+
+COMMENT ON COLUMN thread_contract_documents.template_version IS 'Version of the contract template used (NULL for uploaded files)';
+COMMENT ON COLUMN thread_contract_documents.template_language IS 'Language of the contract template used (ja / en)';
+COMMENT ON COLUMN thread_contract_documents.document_hash IS 'SHA-256 of the generated PDF';
@@ -0,0 +1,125 @@
+-- Message editing and deletion by the sender, with the previous versions kept for operators
+
+-- 編集・削除の目印（削除はトゥームストーン: 行は残し本文を消す）
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Create message_revisions table (one row per edit or deletion, holding the version before it)
+CREATE TABLE IF NOT EXISTS message_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    thread_id UUID NOT NULL,
+    editor_user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    action TEXT NOT NULL CHECK (action IN ('edit', 'delete')),
+    previous_text TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_revisions_message_id ON message_revisions(message_id, created_at);
+
+-- Enable Row Level Security (RLS)
+-- 紛争対応のため運営のみがバックエンド（service role）経由で参照する。ポリシーは作成しない
+ALTER TABLE message_revisions ENABLE ROW LEVEL SECURITY;
+
+-- revise_message stores the current version in message_revisions and edits or tombstones the message
+-- 🔒 SECURITY: 送信者本人・編集可能期間の確認はバックエンドで行い、service role からのみ呼び出す
+CREATE OR REPLACE FUNCTION revise_message(
+    p_message_id UUID,
+    p_editor_id UUID,
+    p_action TEXT,
+    p_text TEXT DEFAULT NULL
+)
+RETURNS SETOF messages AS $$
+DECLARE
+    m messages%ROWTYPE;
+BEGIN
+    SELECT * INTO m FROM messages WHERE id = p_message_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'message not found';
+    END IF;
+    IF m.deleted_at IS NOT NULL THEN
+        RAISE EXCEPTION 'message already deleted';
+    END IF;
+
+    INSERT INTO message_revisions (message_id, thread_id, editor_user_id, action, previous_text)
+    VALUES (m.id, m.thread_id, p_editor_id, p_action, m.text);
+
+    IF p_action = 'edit' THEN
+        UPDATE messages SET text = p_text, edited_at = CURRENT_TIMESTAMP WHERE id = m.id;
+    ELSIF p_action = 'delete' THEN
+        -- 添付ファイルの行・ストレージ上のファイルは残す（配信はバックエンドで止める）
+        UPDATE messages SET text = NULL, deleted_at = CURRENT_TIMESTAMP WHERE id = m.id;
+    ELSE
+        RAISE EXCEPTION 'invalid action: %', p_action;
+    END IF;
+
+    RETURN QUERY SELECT * FROM messages WHERE id = m.id;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public;
+
+REVOKE EXECUTE ON FUNCTION revise_message(UUID, UUID, TEXT, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION revise_message(UUID, UUID, TEXT, TEXT) TO service_role;
+
+-- Deleted messages are no longer searchable (same as create_message_search.sql plus the deleted_at filter)
+CREATE OR REPLACE FUNCTION search_messages(
+    p_user_id UUID,
+    p_terms TEXT[] DEFAULT '{}',
+    p_thread_id UUID DEFAULT NULL,
+    p_sender_id UUID DEFAULT NULL,
+    p_types TEXT[] DEFAULT NULL,
+    p_from TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    p_to TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    p_before_created_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    p_before_id UUID DEFAULT NULL,
+    p_limit INT DEFAULT 20
+)
+RETURNS TABLE (
+    id UUID,
+    thread_id UUID,
+    thread_type TEXT,
+    related_post_id UUID,
+    sender_user_id UUID,
+    type TEXT,
+    text TEXT,
+    created_at TIMESTAMP WITH TIME ZONE,
+    thread_offset BIGINT
+) AS $$
+    WITH my_threads AS (
+        SELECT t.id, t.thread_type, t.related_post_id
+        FROM threads t
+        WHERE t.merged_into IS NULL
+          AND (t.created_by = p_user_id
+               OR EXISTS (SELECT 1 FROM thread_participants tp WHERE tp.thread_id = t.id AND tp.user_id = p_user_id))
+          AND (p_thread_id IS NULL OR t.id = p_thread_id)
+    ),
+    patterns AS (
+        SELECT '%' || replace(replace(replace(lower(normalize(term, NFKC)), '\', '\\'), '%', '\%'), '_', '\_') || '%' AS pattern
+        FROM unnest(p_terms) AS term
+        WHERE btrim(term) <> ''
+    ),
+    hits AS (
+        SELECT m.id, m.thread_id, mt.thread_type, mt.related_post_id, m.sender_user_id, m.type, m.text, m.created_at
+        FROM messages m
+        JOIN my_threads mt ON mt.id = m.thread_id
+        WHERE m.deleted_at IS NULL
+          AND (p_sender_id IS NULL OR m.sender_user_id = p_sender_id)
+          AND (p_types IS NULL OR m.type = ANY (p_types))
+          AND (p_from IS NULL OR m.created_at >= p_from)
+          AND (p_to IS NULL OR m.created_at < p_to)
+          AND (p_before_created_at IS NULL OR (m.created_at, m.id) < (p_before_created_at, p_before_id))
+          AND NOT EXISTS (
+              SELECT 1 FROM patterns p
+              WHERE lower(normalize(COALESCE(m.text, ''), NFKC)) NOT LIKE p.pattern
+          )
+        ORDER BY m.created_at DESC, m.id DESC
+        LIMIT LEAST(GREATEST(p_limit, 1), 100)
+    )
+    SELECT h.id, h.thread_id, h.thread_type, h.related_post_id, h.sender_user_id, h.type, h.text, h.created_at,
+           (SELECT count(*) FROM messages n
+            WHERE n.thread_id = h.thread_id AND n.created_at > h.created_at) AS thread_offset
+    FROM hits h
+    ORDER BY h.created_at DESC, h.id DESC;
+$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public, extensions;
+
+COMMENT ON COLUMN messages.edited_at IS 'Last edit by the sender';
+COMMENT ON COLUMN messages.deleted_at IS 'Deleted by the sender (tombstone); the original is kept in message_revisions';
@@ -0,0 +1,78 @@
+-- NDA scope (listing / seller / org), expiry and revocation
+
+-- listing: post_id の案件のみ / seller: 売り手（組織の場合は窓口ユーザー）の案件 / org: 組織の全案件
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS scope TEXT;
+-- 既存の締結済みNDAはこれまで通り売り手（組織）単位で有効とする
+UPDATE nda_agreements
+SET scope = CASE WHEN seller_org_id IS NOT NULL THEN 'org' ELSE 'seller' END
+WHERE scope IS NULL;
+ALTER TABLE nda_agreements ALTER COLUMN scope SET DEFAULT 'seller';
+ALTER TABLE nda_agreements ALTER COLUMN scope SET NOT NULL;
+ALTER TABLE nda_agreements DROP CONSTRAINT IF EXISTS nda_agreements_scope_check;
+ALTER TABLE nda_agreements ADD CONSTRAINT nda_agreements_scope_check
+    CHECK (scope IN ('listing', 'seller', 'org') AND (scope <> 'listing' OR post_id IS NOT NULL));
+
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS expired_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS revoked_by UUID REFERENCES auth.users(id) ON DELETE SET NULL;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS revoke_reason TEXT;
+
+ALTER TABLE nda_agreements DROP CONSTRAINT IF EXISTS nda_agreements_status_check;
+ALTER TABLE nda_agreements ADD CONSTRAINT nda_agreements_status_check
+    CHECK (status IN ('requested', 'approved', 'declined', 'cancelled', 'signed', 'revoked', 'expired')) NOT VALID;
+
+-- 案件単位の申請は案件ごとに1件まで進行できる
+DROP INDEX IF EXISTS idx_nda_agreements_open_request;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_nda_agreements_open_request ON nda_agreements (
+    COALESCE(buyer_org_id::text, buyer_user_id::text),
+    COALESCE(seller_org_id::text, seller_user_id::text),
+    COALESCE(CASE WHEN scope = 'listing' THEN post_id::text END, '')
+) WHERE status IN ('requested', 'approved');
+
+-- 期限切れの掃除（バックエンドの定期処理）用
+CREATE INDEX IF NOT EXISTS idx_nda_agreements_signed_expires_at ON nda_agreements(expires_at)
+    WHERE status = 'signed' AND expires_at IS NOT NULL;
+
+-- Event history: scope / expiry changes, revocation and lapse
+ALTER TABLE nda_agreement_events DROP CONSTRAINT IF EXISTS nda_agreement_events_event_check;
+ALTER TABLE nda_agreement_events ADD CONSTRAINT nda_agreement_events_event_check
+    CHECK (event IN ('requested', 'approved', 'declined', 'cancelled', 'signed_by_buyer', 'signed_by_seller', 'signed',
+                     'scope_changed', 'revoked', 'expired'));
+-- 変更前後のスコープと期限（{"from_scope","to_scope","from_expires_at","to_expires_at"}）
+ALTER TABLE nda_agreement_events ADD COLUMN IF NOT EXISTS details JSONB;
+
+-- nda_covers_post reports whether the user (or one of their organizations) holds a signed,
+-- unexpired NDA whose scope covers the post. Mirrors ndaResolver in the backend.
+CREATE OR REPLACE FUNCTION nda_covers_post(p_post_id UUID, p_user_id UUID)
+RETURNS BOOLEAN AS $$
+    SELECT EXISTS (
+        SELECT 1
+        FROM posts
+        JOIN nda_agreements na ON na.status = 'signed'
+            AND (na.expires_at IS NULL OR na.expires_at > NOW())
+            AND (
+                (posts.author_org_id IS NOT NULL AND na.seller_org_id = posts.author_org_id)
+                OR (posts.author_org_id IS NULL AND na.seller_user_id = posts.author_user_id)
+            )
+            AND (
+                na.scope = 'org'
+                OR (na.scope = 'seller' AND (na.seller_contact_user_id IS NULL OR na.seller_contact_user_id = posts.author_user_id))
+                OR (na.scope = 'listing' AND na.post_id = posts.id)
+            )
+        WHERE posts.id = p_post_id
+          AND (
+              na.buyer_user_id = p_user_id
+              OR na.buyer_org_id IN (SELECT org_id FROM org_memberships WHERE user_id = p_user_id)
+          )
+    );
+$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public;
+
+-- 売上証明ファイルの閲覧もスコープ・期限・失効を反映する
+DROP POLICY IF EXISTS "NDA holders can view revenue files" ON revenue_verification_files;
+CREATE POLICY "NDA holders can view revenue files" ON revenue_verification_files
+    FOR SELECT USING (nda_covers_post(post_id, auth.uid()));
+
+COMMENT ON COLUMN nda_agreements.scope IS 'listing (post_id only) / seller (posts of the seller contact) / org (all posts of the seller organization)';
+COMMENT ON COLUMN nda_agreements.expires_at IS 'The NDA lapses automatically at this time (NULL = no expiry)';
+COMMENT ON COLUMN nda_agreements.revoked_at IS 'Set when the seller revokes a signed NDA; secret listings are masked again immediately';
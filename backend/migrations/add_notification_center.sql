@@ -0,0 +1,34 @@
+-- Notification center: per-type preferences and grouping of unread message notifications
+
+-- 種別ごとの受信設定（行がない種別は受信する）
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    in_app BOOLEAN NOT NULL DEFAULT true,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, type)
+);
+
+ALTER TABLE notification_preferences ENABLE ROW LEVEL SECURITY;
+
+-- 自分の設定のみ参照・変更できる（通知の作成時はバックエンドが service role で参照する）
+DROP POLICY IF EXISTS "Users can view own notification preferences" ON notification_preferences;
+CREATE POLICY "Users can view own notification preferences"
+    ON notification_preferences FOR SELECT
+    USING (auth.uid() = user_id);
+
+DROP POLICY IF EXISTS "Users can insert own notification preferences" ON notification_preferences;
+CREATE POLICY "Users can insert own notification preferences"
+    ON notification_preferences FOR INSERT
+    WITH CHECK (auth.uid() = user_id);
+
+DROP POLICY IF EXISTS "Users can update own notification preferences" ON notification_preferences;
+CREATE POLICY "Users can update own notification preferences"
+    ON notification_preferences FOR UPDATE
+    USING (auth.uid() = user_id);
+
+-- 未読のメッセージ通知をスレッドごとにまとめるための検索
+CREATE INDEX IF NOT EXISTS idx_notifications_unread_resource
+    ON notifications(user_id, type, resource_id) WHERE read_at IS NULL;
+
+COMMENT ON TABLE notification_preferences IS 'Per-type notification settings; types without a row are delivered';
@@ -0,0 +1,8 @@
+-- Thread exports (transcript PDF / ZIP archive) are logged in file_access_logs with resource_type 'thread_export'
+-- (resource_id = threads.id); the log ID is embedded in the watermark of every exported file
+
+ALTER TABLE file_access_logs DROP CONSTRAINT IF EXISTS file_access_logs_resource_type_check;
+ALTER TABLE file_access_logs ADD CONSTRAINT file_access_logs_resource_type_check
+    CHECK (resource_type IN ('contract_document', 'message_attachment', 'thread_export'));
+
+COMMENT ON COLUMN file_access_logs.resource_id IS 'thread_contract_documents.id (contract_document), messages.id (message_attachment) or threads.id (thread_export)';
@@ -0,0 +1,123 @@
+-- Multi-party deal threads: explicit participant roles (seller, buyer, advisors of each side, operator)
+
+ALTER TABLE thread_participants ADD COLUMN IF NOT EXISTS role TEXT
+    CHECK (role IN ('seller', 'buyer', 'seller_advisor', 'buyer_advisor', 'operator'));
+ALTER TABLE thread_participants ADD COLUMN IF NOT EXISTS invited_by UUID REFERENCES auth.users(id) ON DELETE SET NULL;
+ALTER TABLE thread_participants ADD COLUMN IF NOT EXISTS joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+-- 役割を指定せずに追加された参加者（スレッド作成時・スレッド統合時など）の役割
+-- 商談スレッド: 案件の投稿者が売り手、それ以外は買い手 / 問い合わせ: 作成者が買い手、相手が売り手
+CREATE OR REPLACE FUNCTION default_thread_participant_role(p_thread_id UUID, p_user_id UUID)
+RETURNS TEXT AS $$
+    SELECT CASE
+               WHEN t.related_post_id IS NOT NULL THEN
+                   CASE WHEN p.author_user_id = p_user_id THEN 'seller' ELSE 'buyer' END
+               WHEN t.created_by = p_user_id THEN 'buyer'
+               ELSE 'seller'
+           END
+    FROM threads t
+    LEFT JOIN posts p ON p.id = t.related_post_id
+    WHERE t.id = p_thread_id;
+$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public;
+
+CREATE OR REPLACE FUNCTION set_thread_participant_role()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.role IS NULL THEN
+        NEW.role := COALESCE(default_thread_participant_role(NEW.thread_id, NEW.user_id), 'buyer');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public;
+
+DROP TRIGGER IF EXISTS trg_thread_participants_role ON thread_participants;
+CREATE TRIGGER trg_thread_participants_role
+    BEFORE INSERT ON thread_participants
+    FOR EACH ROW EXECUTE FUNCTION set_thread_participant_role();
+
+-- スレッド作成者が thread_participants にないスレッドを補完する（作成者を参加者とみなす扱いを行に揃える）
+INSERT INTO thread_participants (thread_id, user_id)
+SELECT t.id, t.created_by
+FROM threads t
+WHERE NOT EXISTS (
+    SELECT 1 FROM thread_participants tp WHERE tp.thread_id = t.id AND tp.user_id = t.created_by
+);
+
+UPDATE thread_participants tp
+SET role = COALESCE(default_thread_participant_role(tp.thread_id, tp.user_id), 'buyer')
+WHERE tp.role IS NULL;
+
+ALTER TABLE thread_participants ALTER COLUMN role SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_thread_participants_thread_id_role ON thread_participants(thread_id, role);
+
+-- スレッド統合で参加者の役割・招待者と、各参加者のスレッド状態（ピン・ラベル・ミュート）も引き継ぐ
+CREATE OR REPLACE FUNCTION merge_threads(p_source_id UUID, p_target_id UUID)
+RETURNS VOID AS $$
+BEGIN
+    IF p_source_id = p_target_id THEN
+        RAISE EXCEPTION 'cannot merge a thread into itself';
+    END IF;
+
+    UPDATE messages SET thread_id = p_target_id WHERE thread_id = p_source_id;
+    UPDATE thread_contract_documents SET thread_id = p_target_id WHERE thread_id = p_source_id;
+    UPDATE sale_requests SET thread_id = p_target_id WHERE thread_id = p_source_id;
+    UPDATE nda_agreements SET thread_id = p_target_id WHERE thread_id = p_source_id;
+    UPDATE file_access_logs SET thread_id = p_target_id WHERE thread_id = p_source_id;
+
+    -- 統合先にすでにいる参加者は統合先の役割を優先する
+    INSERT INTO thread_participants (thread_id, user_id, role, invited_by, joined_at)
+    SELECT p_target_id, sp.user_id, sp.role, sp.invited_by, sp.joined_at
+    FROM thread_participants sp
+    WHERE sp.thread_id = p_source_id
+      AND NOT EXISTS (
+          SELECT 1 FROM thread_participants tp
+          WHERE tp.thread_id = p_target_id AND tp.user_id = sp.user_id
+      );
+
+    -- 両方に状態がある場合: ラベルは和集合、ミュート・ピンはどちらかにあれば維持、
+    -- アーカイブは両方でアーカイブしていた場合のみ維持する
+    INSERT INTO thread_user_states (thread_id, user_id, archived_at, muted, pinned_at, labels, updated_at)
+    SELECT p_target_id, ss.user_id, ss.archived_at, ss.muted, ss.pinned_at, ss.labels, CURRENT_TIMESTAMP
+    FROM thread_user_states ss
+    WHERE ss.thread_id = p_source_id
+    ON CONFLICT (thread_id, user_id) DO UPDATE
+    SET archived_at = CASE
+                          WHEN thread_user_states.archived_at IS NOT NULL AND EXCLUDED.archived_at IS NOT NULL
+                              THEN GREATEST(thread_user_states.archived_at, EXCLUDED.archived_at)
+                      END,
+        muted = thread_user_states.muted OR EXCLUDED.muted,
+        pinned_at = COALESCE(thread_user_states.pinned_at, EXCLUDED.pinned_at),
+        labels = ARRAY(SELECT DISTINCT l FROM unnest(thread_user_states.labels || EXCLUDED.labels) AS l ORDER BY l),
+        updated_at = CURRENT_TIMESTAMP;
+    DELETE FROM thread_user_states WHERE thread_id = p_source_id;
+
+    -- 統合元に統合済みだったスレッドも統合先に付け替える
+    UPDATE threads SET merged_into = p_target_id WHERE merged_into = p_source_id;
+    UPDATE threads SET merged_into = p_target_id, merged_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+    WHERE id = p_source_id;
+    UPDATE threads SET updated_at = CURRENT_TIMESTAMP WHERE id = p_target_id;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public;
+
+REVOKE EXECUTE ON FUNCTION merge_threads(UUID, UUID) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION merge_threads(UUID, UUID) TO service_role;
+
+-- 売却リクエストの買い手を明示する（複数の買い手側参加者がいるスレッドのため）
+ALTER TABLE sale_requests ADD COLUMN IF NOT EXISTS buyer_user_id UUID REFERENCES auth.users(id) ON DELETE SET NULL;
+
+UPDATE sale_requests sr
+SET buyer_user_id = b.user_id
+FROM (
+    SELECT tp.thread_id, min(tp.user_id::text)::uuid AS user_id
+    FROM thread_participants tp
+    WHERE tp.role = 'buyer'
+    GROUP BY tp.thread_id
+    HAVING count(*) = 1
+) b
+WHERE sr.thread_id = b.thread_id AND sr.buyer_user_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sale_requests_buyer_user_id ON sale_requests(buyer_user_id);
+
+COMMENT ON COLUMN thread_participants.role IS 'seller, buyer, seller_advisor, buyer_advisor or operator; permissions are enforced by the backend';
+COMMENT ON COLUMN sale_requests.buyer_user_id IS 'Buyer who can confirm the purchase';
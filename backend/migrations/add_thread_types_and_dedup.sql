@@ -0,0 +1,91 @@
+-- Thread deduplication and deal rooms:
+-- a thread is unique per (participants, related post); threads with a related post are the deal room of that listing
+
+-- 重複判定のキー（スレッド作成時の参加者IDをソートしてカンマ区切りにしたもの）
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS participant_key TEXT;
+-- inquiry: 一般の問い合わせ / deal_room: 案件ごとの商談スレッド（NDA・LOI・売却リクエスト・引き継ぎの起点）
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS thread_type TEXT
+    GENERATED ALWAYS AS (CASE WHEN related_post_id IS NULL THEN 'inquiry' ELSE 'deal_room' END) STORED;
+-- 統合された重複スレッドは統合先を指す（古いリンクのリダイレクト用に行は残す）
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS merged_into UUID REFERENCES threads(id) ON DELETE SET NULL;
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS merged_at TIMESTAMP WITH TIME ZONE;
+
+-- Backfill the key of existing threads (participants and the creator)
+UPDATE threads t
+SET participant_key = k.participant_key
+FROM (
+    SELECT m.thread_id, string_agg(DISTINCT m.user_id::text, ',' ORDER BY m.user_id::text) AS participant_key
+    FROM (
+        SELECT thread_id, user_id FROM thread_participants
+        UNION
+        SELECT id, created_by FROM threads
+    ) m
+    GROUP BY m.thread_id
+) k
+WHERE t.id = k.thread_id AND t.participant_key IS NULL;
+
+-- Merge a duplicate thread into another thread
+-- 🔒 SECURITY: 権限確認（運営のみ・同じ案件のスレッドのみ）はバックエンドで行い、service role からのみ呼び出す
+CREATE OR REPLACE FUNCTION merge_threads(p_source_id UUID, p_target_id UUID)
+RETURNS VOID AS $$
+BEGIN
+    IF p_source_id = p_target_id THEN
+        RAISE EXCEPTION 'cannot merge a thread into itself';
+    END IF;
+
+    UPDATE messages SET thread_id = p_target_id WHERE thread_id = p_source_id;
+    UPDATE thread_contract_documents SET thread_id = p_target_id WHERE thread_id = p_source_id;
+    UPDATE sale_requests SET thread_id = p_target_id WHERE thread_id = p_source_id;
+    UPDATE nda_agreements SET thread_id = p_target_id WHERE thread_id = p_source_id;
+    UPDATE file_access_logs SET thread_id = p_target_id WHERE thread_id = p_source_id;
+
+    INSERT INTO thread_participants (thread_id, user_id)
+    SELECT p_target_id, sp.user_id
+    FROM thread_participants sp
+    WHERE sp.thread_id = p_source_id
+      AND NOT EXISTS (
+          SELECT 1 FROM thread_participants tp
+          WHERE tp.thread_id = p_target_id AND tp.user_id = sp.user_id
+      );
+
+    -- 統合元に統合済みだったスレッドも統合先に付け替える
+    UPDATE threads SET merged_into = p_target_id WHERE merged_into = p_source_id;
+    UPDATE threads SET merged_into = p_target_id, merged_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+    WHERE id = p_source_id;
+    UPDATE threads SET updated_at = CURRENT_TIMESTAMP WHERE id = p_target_id;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public;
+
+REVOKE EXECUTE ON FUNCTION merge_threads(UUID, UUID) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION merge_threads(UUID, UUID) TO service_role;
+
+-- Merge the existing duplicates into the oldest thread of each (participants, related post)
+DO $$
+DECLARE
+    r RECORD;
+BEGIN
+    FOR r IN
+        SELECT id, target_id FROM (
+            SELECT t.id,
+                   first_value(t.id) OVER (
+                       PARTITION BY t.participant_key, COALESCE(t.related_post_id::text, '')
+                       ORDER BY t.created_at, t.id
+                   ) AS target_id
+            FROM threads t
+            WHERE t.merged_into IS NULL AND t.participant_key IS NOT NULL
+        ) d
+        WHERE d.id <> d.target_id
+    LOOP
+        PERFORM merge_threads(r.id, r.target_id);
+    END LOOP;
+END $$;
+
+-- 同じ参加者・同じ案件の未統合スレッドは1件のみ（get-or-create の競合もここで防ぐ）
+CREATE UNIQUE INDEX IF NOT EXISTS idx_threads_participant_key ON threads (
+    participant_key, COALESCE(related_post_id::text, '')
+) WHERE merged_into IS NULL AND participant_key IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_threads_thread_type ON threads(thread_type) WHERE merged_into IS NULL;
+
+COMMENT ON COLUMN threads.participant_key IS 'Sorted participant IDs at creation; unique per related post among unmerged threads';
+COMMENT ON COLUMN threads.merged_into IS 'Thread this duplicate was merged into';
@@ -0,0 +1,32 @@
+-- Off-platform contact detection: texts with phone numbers, emails, LINE IDs, messenger handles or URLs
+-- that were warned, masked or blocked, kept for operators (the original text is kept before masking)
+
+CREATE TABLE IF NOT EXISTS contact_flags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    source_type TEXT NOT NULL CHECK (source_type IN ('message', 'comment', 'comment_reply')),
+    -- 投稿されたメッセージ・コメントのID（block の場合は投稿されていないため NULL）
+    source_id UUID,
+    thread_id UUID REFERENCES threads(id) ON DELETE SET NULL,
+    post_id UUID REFERENCES posts(id) ON DELETE SET NULL,
+    -- 適用したポリシーのキー（商談ステージ、または公開コメントの public）
+    context TEXT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('warn', 'mask', 'block')),
+    kinds TEXT[] NOT NULL DEFAULT '{}',
+    matches JSONB NOT NULL DEFAULT '[]',
+    text TEXT NOT NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    reviewed_by UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_contact_flags_open ON contact_flags(created_at DESC) WHERE reviewed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_contact_flags_user_id ON contact_flags(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_contact_flags_thread_id ON contact_flags(thread_id);
+
+-- Enable Row Level Security (RLS)
+-- 🔒 SECURITY: 伏せ字にする前の連絡先を含むためポリシーは作らない（バックエンドが運営を確認してから service role で参照する）
+ALTER TABLE contact_flags ENABLE ROW LEVEL SECURITY;
+
+COMMENT ON TABLE contact_flags IS 'Messages and comments with off-platform contact details, for operators; service role only';
+COMMENT ON COLUMN contact_flags.matches IS 'Detected contact details: [{kind, value, start, end}], offsets in code points of text';
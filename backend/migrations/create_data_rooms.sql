@@ -0,0 +1,126 @@
+-- Per-listing virtual data room: folders, files in the private data-room-files bucket,
+-- per-buyer access grants and an access log of every view / download
+
+-- Create data_rooms table (one per post)
+CREATE TABLE IF NOT EXISTS data_rooms (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    post_id UUID NOT NULL UNIQUE REFERENCES posts(id) ON DELETE CASCADE,
+    owner_user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create data_room_folders table (parent_id NULL = top level)
+CREATE TABLE IF NOT EXISTS data_room_folders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    room_id UUID NOT NULL REFERENCES data_rooms(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES data_room_folders(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_by UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 同じ階層に同名のフォルダは作れない
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_room_folders_name ON data_room_folders (
+    room_id, COALESCE(parent_id::text, ''), name
+);
+
+-- Create data_room_files table (folder_id NULL = top level)
+CREATE TABLE IF NOT EXISTS data_room_files (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    room_id UUID NOT NULL REFERENCES data_rooms(id) ON DELETE CASCADE,
+    folder_id UUID REFERENCES data_room_folders(id) ON DELETE SET NULL,
+    file_name TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    file_size BIGINT NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    uploaded_by UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    -- 削除してもアクセスログの参照先として残す
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create data_room_grants table (access of one buyer to the room)
+CREATE TABLE IF NOT EXISTS data_room_grants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    room_id UUID NOT NULL REFERENCES data_rooms(id) ON DELETE CASCADE,
+    buyer_user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    -- NULL = ルーム全体。指定した場合はそのフォルダ（配下を含む）のみ
+    folder_ids UUID[],
+    can_download BOOLEAN NOT NULL DEFAULT false,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    granted_by UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    revoked_by UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (room_id, buyer_user_id)
+);
+
+-- Create data_room_access_logs table
+CREATE TABLE IF NOT EXISTS data_room_access_logs (
+    id BIGSERIAL PRIMARY KEY,
+    room_id UUID NOT NULL REFERENCES data_rooms(id) ON DELETE CASCADE,
+    file_id UUID NOT NULL REFERENCES data_room_files(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL CHECK (action IN ('view', 'download')),
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_data_room_folders_room_id ON data_room_folders(room_id);
+CREATE INDEX IF NOT EXISTS idx_data_room_files_room_id ON data_room_files(room_id, folder_id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_data_room_grants_buyer_user_id ON data_room_grants(buyer_user_id);
+CREATE INDEX IF NOT EXISTS idx_data_room_access_logs_room_id ON data_room_access_logs(room_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_data_room_access_logs_user_id ON data_room_access_logs(room_id, user_id);
+
+-- Enable Row Level Security (RLS)
+-- 閲覧権限（NDA・付与・フォルダ範囲）はバックエンドで確認した上でservice role経由で読み書きするため、ポリシーは作成しない
+ALTER TABLE data_rooms ENABLE ROW LEVEL SECURITY;
+ALTER TABLE data_room_folders ENABLE ROW LEVEL SECURITY;
+ALTER TABLE data_room_files ENABLE ROW LEVEL SECURITY;
+ALTER TABLE data_room_grants ENABLE ROW LEVEL SECURITY;
+ALTER TABLE data_room_access_logs ENABLE ROW LEVEL SECURITY;
+
+-- Access report: views / downloads per buyer and file (aggregated in the database)
+CREATE OR REPLACE FUNCTION get_data_room_access_report(p_room_id UUID)
+RETURNS TABLE (
+    user_id UUID,
+    file_id UUID,
+    views BIGINT,
+    downloads BIGINT,
+    first_accessed_at TIMESTAMP WITH TIME ZONE,
+    last_accessed_at TIMESTAMP WITH TIME ZONE
+) AS $$
+BEGIN
+    RETURN QUERY
+    SELECT
+        l.user_id,
+        l.file_id,
+        COUNT(*) FILTER (WHERE l.action = 'view') AS views,
+        COUNT(*) FILTER (WHERE l.action = 'download') AS downloads,
+        MIN(l.created_at) AS first_accessed_at,
+        MAX(l.created_at) AS last_accessed_at
+    FROM data_room_access_logs l
+    WHERE l.room_id = p_room_id
+    GROUP BY l.user_id, l.file_id;
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+-- 売り手の確認はバックエンドで行い、service role からのみ呼び出す
+REVOKE EXECUTE ON FUNCTION get_data_room_access_report(UUID) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION get_data_room_access_report(UUID) TO service_role;
+
+-- Private bucket for data room files (served only through the watermarking proxy)
+INSERT INTO storage.buckets (id, name, public)
+VALUES ('data-room-files', 'data-room-files', false)
+ON CONFLICT (id) DO NOTHING;
+
+COMMENT ON TABLE data_rooms IS 'Due diligence data room of a listing (one per post)';
+COMMENT ON COLUMN data_room_grants.folder_ids IS 'Folders the buyer may open (including subfolders); NULL = the whole room';
+COMMENT ON TABLE data_room_access_logs IS 'Every watermarked view / download served from a data room';
@@ -0,0 +1,54 @@
+-- Transactional email: persistent outbox with retries, suppression list for bounced addresses,
+-- per-type email preferences and the recipient's language
+
+-- 送信待ちのメール（件名・本文は登録時に描画済み）。送信はバックエンドのワーカーが service role で行う
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    to_address TEXT NOT NULL,
+    template TEXT NOT NULL,
+    language TEXT NOT NULL DEFAULT 'ja',
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'sending', 'sent', 'failed', 'bounced', 'skipped')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_due
+    ON email_outbox(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_email_outbox_sending
+    ON email_outbox(updated_at) WHERE status = 'sending';
+CREATE INDEX IF NOT EXISTS idx_email_outbox_to_address ON email_outbox(lower(to_address));
+
+-- 恒久的に受信できない宛先（SMTPの5xx応答・プロバイダからのバウンス通知）。登録された宛先には送信しない
+CREATE TABLE IF NOT EXISTS email_suppressions (
+    address TEXT PRIMARY KEY, -- 小文字で保存
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- RLSを有効にし、ポリシーは作らない（利用者からは参照できない）
+ALTER TABLE email_outbox ENABLE ROW LEVEL SECURITY;
+ALTER TABLE email_suppressions ENABLE ROW LEVEL SECURITY;
+
+-- 種別ごとのメール受信設定（行がない種別は受信する）
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS email BOOLEAN NOT NULL DEFAULT true;
+
+-- 未読メッセージのダイジェストに含めた通知
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS emailed_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_notifications_message_digest
+    ON notifications(created_at) WHERE type = 'message_received' AND read_at IS NULL AND emailed_at IS NULL;
+
+-- メールの言語
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS preferred_language TEXT NOT NULL DEFAULT 'ja';
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_preferred_language_check;
+ALTER TABLE profiles ADD CONSTRAINT profiles_preferred_language_check CHECK (preferred_language IN ('ja', 'en'));
+
+COMMENT ON TABLE email_outbox IS 'Transactional emails waiting to be sent over SMTP, with retry state';
+COMMENT ON TABLE email_suppressions IS 'Addresses that bounced permanently; no email is sent to them';
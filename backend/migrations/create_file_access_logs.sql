@@ -0,0 +1,27 @@
+-- Access log of contract documents and message attachments served through the watermarking download proxy
+-- (data room files are logged in data_room_access_logs)
+-- The log ID is embedded in the invisible watermark as the trace ID ("fa-<id>")
+
+CREATE TABLE IF NOT EXISTS file_access_logs (
+    id BIGSERIAL PRIMARY KEY,
+    resource_type TEXT NOT NULL CHECK (resource_type IN ('contract_document', 'message_attachment')),
+    -- thread_contract_documents.id または messages.id
+    resource_id UUID NOT NULL,
+    thread_id UUID REFERENCES threads(id) ON DELETE SET NULL,
+    user_id UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL CHECK (action IN ('view', 'download')),
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_file_access_logs_resource ON file_access_logs(resource_type, resource_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_file_access_logs_user_id ON file_access_logs(user_id, created_at DESC);
+
+-- Enable Row Level Security (RLS)
+-- 書き込み・参照はバックエンドのservice role経由のみのため、ポリシーは作成しない
+ALTER TABLE file_access_logs ENABLE ROW LEVEL SECURITY;
+
+COMMENT ON TABLE file_access_logs IS 'Every watermarked view / download of a contract document or message attachment';
+COMMENT ON COLUMN file_access_logs.resource_id IS 'thread_contract_documents.id (contract_document) or messages.id (message_attachment)';
@@ -0,0 +1,77 @@
+-- Message search across the threads a user participates in
+
+-- 日本語は単語の区切りがないため全文検索（tsvector）ではなく、トライグラムによる部分一致で検索する
+CREATE EXTENSION IF NOT EXISTS pg_trgm WITH SCHEMA extensions;
+
+-- 全角英数字・半角カナを NFKC で正規化し、大文字小文字を区別しない
+-- 2文字以下のキーワードはトライグラムを使えないため、参加スレッドに絞り込んだ上での走査になる
+CREATE INDEX IF NOT EXISTS idx_messages_text_search ON messages
+    USING gin ((lower(normalize(COALESCE(text, ''), NFKC))) extensions.gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_messages_thread_id_created_at ON messages(thread_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_thread_participants_user_id ON thread_participants(user_id);
+
+-- search_messages returns the messages matching every term, newest first (keyset pagination on created_at, id)
+-- thread_offset is the number of newer messages in the same thread (offset for GET /api/messages)
+-- 🔒 SECURITY: p_user_id はバックエンドで認証済みのユーザーを渡す。service role からのみ呼び出す
+CREATE OR REPLACE FUNCTION search_messages(
+    p_user_id UUID,
+    p_terms TEXT[] DEFAULT '{}',
+    p_thread_id UUID DEFAULT NULL,
+    p_sender_id UUID DEFAULT NULL,
+    p_types TEXT[] DEFAULT NULL,
+    p_from TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    p_to TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    p_before_created_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    p_before_id UUID DEFAULT NULL,
+    p_limit INT DEFAULT 20
+)
+RETURNS TABLE (
+    id UUID,
+    thread_id UUID,
+    thread_type TEXT,
+    related_post_id UUID,
+    sender_user_id UUID,
+    type TEXT,
+    text TEXT,
+    created_at TIMESTAMP WITH TIME ZONE,
+    thread_offset BIGINT
+) AS $$
+    WITH my_threads AS (
+        SELECT t.id, t.thread_type, t.related_post_id
+        FROM threads t
+        WHERE t.merged_into IS NULL
+          AND (t.created_by = p_user_id
+               OR EXISTS (SELECT 1 FROM thread_participants tp WHERE tp.thread_id = t.id AND tp.user_id = p_user_id))
+          AND (p_thread_id IS NULL OR t.id = p_thread_id)
+    ),
+    -- キーワードも同じ正規化を行い、LIKE の特殊文字をエスケープする（正規化で全角の％・＿が変換されるため後で行う）
+    patterns AS (
+        SELECT '%' || replace(replace(replace(lower(normalize(term, NFKC)), '\', '\\'), '%', '\%'), '_', '\_') || '%' AS pattern
+        FROM unnest(p_terms) AS term
+        WHERE btrim(term) <> ''
+    ),
+    hits AS (
+        SELECT m.id, m.thread_id, mt.thread_type, mt.related_post_id, m.sender_user_id, m.type, m.text, m.created_at
+        FROM messages m
+        JOIN my_threads mt ON mt.id = m.thread_id
+        WHERE (p_sender_id IS NULL OR m.sender_user_id = p_sender_id)
+          AND (p_types IS NULL OR m.type = ANY (p_types))
+          AND (p_from IS NULL OR m.created_at >= p_from)
+          AND (p_to IS NULL OR m.created_at < p_to)
+          AND (p_before_created_at IS NULL OR (m.created_at, m.id) < (p_before_created_at, p_before_id))
+          AND NOT EXISTS (
+              SELECT 1 FROM patterns p
+              WHERE lower(normalize(COALESCE(m.text, ''), NFKC)) NOT LIKE p.pattern
+          )
+        ORDER BY m.created_at DESC, m.id DESC
+        LIMIT LEAST(GREATEST(p_limit, 1), 100)
+    )
+    SELECT h.id, h.thread_id, h.thread_type, h.related_post_id, h.sender_user_id, h.type, h.text, h.created_at,
+           (SELECT count(*) FROM messages n
+            WHERE n.thread_id = h.thread_id AND n.created_at > h.created_at) AS thread_offset
+    FROM hits h
+    ORDER BY h.created_at DESC, h.id DESC;
+$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public, extensions;
+
+REVOKE EXECUTE ON FUNCTION search_messages(UUID, TEXT[], UUID, UUID, TEXT[], TIMESTAMP WITH TIME ZONE, TIMESTAMP WITH TIME ZONE, TIMESTAMP WITH TIME ZONE, UUID, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION search_messages(UUID, TEXT[], UUID, UUID, TEXT[], TIMESTAMP WITH TIME ZONE, TIMESTAMP WITH TIME ZONE, TIMESTAMP WITH TIME ZONE, UUID, INT) TO service_role;
@@ -0,0 +1,63 @@
+-- NDA workflow: buyer requests → seller approves/declines → both parties sign → signed
+
+-- Workflow columns on nda_agreements
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS requested_by UUID REFERENCES auth.users(id) ON DELETE SET NULL;
+-- 売り手が組織の場合の窓口ユーザー（投稿者）。スレッドと通知の宛先に使う
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS seller_contact_user_id UUID REFERENCES auth.users(id) ON DELETE SET NULL;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS thread_id UUID REFERENCES threads(id) ON DELETE SET NULL;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS request_message TEXT;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS decline_reason TEXT;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS document_version TEXT;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS document_content TEXT;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS document_hash TEXT;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS buyer_signed_by UUID REFERENCES auth.users(id) ON DELETE SET NULL;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS buyer_signed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS buyer_signed_ip TEXT;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS buyer_document_hash TEXT;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS seller_signed_by UUID REFERENCES auth.users(id) ON DELETE SET NULL;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS seller_signed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS seller_signed_ip TEXT;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS seller_document_hash TEXT;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS approved_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS declined_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS signed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+-- 既存行は検証せず、新しい行のみステータスを制限する
+ALTER TABLE nda_agreements DROP CONSTRAINT IF EXISTS nda_agreements_status_check;
+ALTER TABLE nda_agreements ADD CONSTRAINT nda_agreements_status_check
+    CHECK (status IN ('requested', 'approved', 'declined', 'cancelled', 'signed')) NOT VALID;
+
+-- 同じ買い手・売り手の組み合わせで進行中の申請は1件のみ
+CREATE UNIQUE INDEX IF NOT EXISTS idx_nda_agreements_open_request ON nda_agreements (
+    COALESCE(buyer_org_id::text, buyer_user_id::text),
+    COALESCE(seller_org_id::text, seller_user_id::text)
+) WHERE status IN ('requested', 'approved');
+
+CREATE INDEX IF NOT EXISTS idx_nda_agreements_requested_by ON nda_agreements(requested_by);
+CREATE INDEX IF NOT EXISTS idx_nda_agreements_seller_contact ON nda_agreements(seller_contact_user_id);
+
+-- Create nda_agreement_events table (status history of each agreement)
+CREATE TABLE IF NOT EXISTS nda_agreement_events (
+    id BIGSERIAL PRIMARY KEY,
+    agreement_id UUID NOT NULL REFERENCES nda_agreements(id) ON DELETE CASCADE,
+    actor_user_id UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    event TEXT NOT NULL CHECK (event IN ('requested', 'approved', 'declined', 'cancelled', 'signed_by_buyer', 'signed_by_seller', 'signed')),
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    ip_address TEXT,
+    document_hash TEXT,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_nda_agreement_events_agreement_id ON nda_agreement_events(agreement_id, created_at);
+
+-- Enable Row Level Security (RLS)
+-- 状態遷移と履歴の参照はバックエンドで当事者を確認した上でservice role経由で行うため、ポリシーは作成しない
+ALTER TABLE nda_agreement_events ENABLE ROW LEVEL SECURITY;
+
+COMMENT ON TABLE nda_agreement_events IS 'Audit trail of NDA workflow transitions (request, approval, signatures)';
+COMMENT ON COLUMN nda_agreements.document_content IS 'NDA document fixed at approval (the text both parties sign)';
+COMMENT ON COLUMN nda_agreements.document_hash IS 'SHA-256 of document_content; both signatures must reference this hash';
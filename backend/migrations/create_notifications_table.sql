@@ -0,0 +1,31 @@
+-- In-app notifications (one row per recipient)
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT,
+    link TEXT,
+    actor_user_id UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    resource_type TEXT,
+    resource_id TEXT,
+    data JSONB NOT NULL DEFAULT '{}'::jsonb,
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_created_at ON notifications(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
+
+-- Enable Row Level Security (RLS)
+ALTER TABLE notifications ENABLE ROW LEVEL SECURITY;
+
+-- 通知の作成はバックエンド（service role）のみ。受信者は自分宛ての通知の参照・既読化のみ可能
+CREATE POLICY "Users can view own notifications" ON notifications
+    FOR SELECT USING (auth.uid() = user_id);
+
+CREATE POLICY "Users can update own notifications" ON notifications
+    FOR UPDATE USING (auth.uid() = user_id);
+
+COMMENT ON TABLE notifications IS 'In-app notifications created by the backend for status changes (NDA, messages, ...)';
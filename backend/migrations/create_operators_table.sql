@@ -0,0 +1,18 @@
+-- Platform operators (運営スタッフ)
+-- 秘匿投稿の全項目の閲覧や通報対応など、運営のみが行える操作の判定に使用する
+
+CREATE TABLE IF NOT EXISTS operators (
+    user_id UUID PRIMARY KEY REFERENCES auth.users(id) ON DELETE CASCADE,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE operators ENABLE ROW LEVEL SECURITY;
+
+-- 自分が運営かどうかのみ確認できる（追加・削除はservice_roleのみ）
+DROP POLICY IF EXISTS "Users can view their own operator row" ON operators;
+CREATE POLICY "Users can view their own operator row"
+    ON operators FOR SELECT
+    USING (auth.uid() = user_id);
+
+COMMENT ON TABLE operators IS 'Platform operators; rows are managed with the service role only';
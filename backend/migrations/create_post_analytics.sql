@@ -0,0 +1,168 @@
+-- Seller listing analytics: detail-page views, watchlist events and inquiry funnel
+
+-- Create post_views table (one row per deduplicated detail-page view)
+CREATE TABLE IF NOT EXISTS post_views (
+    id BIGSERIAL PRIMARY KEY,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    viewer_key TEXT NOT NULL, -- "user:<uuid>" または セッションIDのSHA-256
+    viewer_user_id UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_views_post_id_created_at ON post_views(post_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_post_views_dedup ON post_views(post_id, viewer_key, created_at DESC);
+
+-- Create product_active_view_events table
+-- product_active_views は解除時に行が削除されるため、追加/解除の履歴はトリガーで記録する
+CREATE TABLE IF NOT EXISTS product_active_view_events (
+    id BIGSERIAL PRIMARY KEY,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id UUID,
+    event TEXT NOT NULL CHECK (event IN ('add', 'remove')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_active_view_events_post_id ON product_active_view_events(post_id, created_at);
+
+CREATE OR REPLACE FUNCTION log_product_active_view_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO product_active_view_events (post_id, user_id, event) VALUES (NEW.post_id, NEW.user_id, 'add');
+        RETURN NEW;
+    ELSIF TG_OP = 'DELETE' THEN
+        INSERT INTO product_active_view_events (post_id, user_id, event) VALUES (OLD.post_id, OLD.user_id, 'remove');
+        RETURN OLD;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS trg_product_active_view_events ON product_active_views;
+CREATE TRIGGER trg_product_active_view_events
+    AFTER INSERT OR DELETE ON product_active_views
+    FOR EACH ROW EXECUTE FUNCTION log_product_active_view_event();
+
+-- NDA requests are attributed to a listing when post_id is set
+ALTER TABLE nda_agreements ADD COLUMN IF NOT EXISTS post_id UUID REFERENCES posts(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_nda_agreements_post_id ON nda_agreements(post_id);
+CREATE INDEX IF NOT EXISTS idx_threads_related_post_id ON threads(related_post_id);
+CREATE INDEX IF NOT EXISTS idx_sale_requests_post_id ON sale_requests(post_id);
+
+-- Enable Row Level Security (RLS)
+-- 集計はバックエンド（service role）経由のRPCのみで行うため、ポリシーは作成しない
+ALTER TABLE post_views ENABLE ROW LEVEL SECURITY;
+ALTER TABLE product_active_view_events ENABLE ROW LEVEL SECURITY;
+
+-- record_post_view inserts a view unless the same viewer viewed the post within the dedup window
+CREATE OR REPLACE FUNCTION record_post_view(
+    p_post_id UUID,
+    p_viewer_key TEXT,
+    p_viewer_user_id UUID DEFAULT NULL,
+    p_dedup_minutes INT DEFAULT 30
+)
+RETURNS BOOLEAN AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM post_views
+        WHERE post_id = p_post_id
+          AND viewer_key = p_viewer_key
+          AND created_at > NOW() - make_interval(mins => p_dedup_minutes)
+    ) THEN
+        RETURN false;
+    END IF;
+
+    INSERT INTO post_views (post_id, viewer_key, viewer_user_id)
+    VALUES (p_post_id, p_viewer_key, p_viewer_user_id);
+    RETURN true;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- get_post_analytics returns one row per day (Asia/Tokyo) in [p_from, p_to]
+CREATE OR REPLACE FUNCTION get_post_analytics(p_post_id UUID, p_from DATE, p_to DATE)
+RETURNS TABLE (
+    day DATE,
+    views BIGINT,
+    unique_viewers BIGINT,
+    watch_adds BIGINT,
+    watch_removes BIGINT,
+    new_threads BIGINT,
+    nda_requests BIGINT,
+    sale_requests BIGINT
+) AS $$
+BEGIN
+    RETURN QUERY
+    WITH days AS (
+        SELECT generate_series(p_from, p_to, INTERVAL '1 day')::date AS day
+    ),
+    v AS (
+        SELECT (pv.created_at AT TIME ZONE 'Asia/Tokyo')::date AS day,
+               COUNT(*) AS views,
+               COUNT(DISTINCT pv.viewer_key) AS unique_viewers
+        FROM post_views pv
+        WHERE pv.post_id = p_post_id
+        GROUP BY 1
+    ),
+    w AS (
+        SELECT (e.created_at AT TIME ZONE 'Asia/Tokyo')::date AS day,
+               COUNT(*) FILTER (WHERE e.event = 'add') AS adds,
+               COUNT(*) FILTER (WHERE e.event = 'remove') AS removes
+        FROM product_active_view_events e
+        WHERE e.post_id = p_post_id
+        GROUP BY 1
+    ),
+    t AS (
+        SELECT (th.created_at AT TIME ZONE 'Asia/Tokyo')::date AS day, COUNT(*) AS cnt
+        FROM threads th
+        WHERE th.related_post_id = p_post_id
+        GROUP BY 1
+    ),
+    n AS (
+        SELECT (na.created_at AT TIME ZONE 'Asia/Tokyo')::date AS day, COUNT(*) AS cnt
+        FROM nda_agreements na
+        WHERE na.post_id = p_post_id
+        GROUP BY 1
+    ),
+    s AS (
+        SELECT (sr.created_at AT TIME ZONE 'Asia/Tokyo')::date AS day, COUNT(*) AS cnt
+        FROM sale_requests sr
+        WHERE sr.post_id = p_post_id
+        GROUP BY 1
+    )
+    SELECT d.day,
+           COALESCE(v.views, 0),
+           COALESCE(v.unique_viewers, 0),
+           COALESCE(w.adds, 0),
+           COALESCE(w.removes, 0),
+           COALESCE(t.cnt, 0),
+           COALESCE(n.cnt, 0),
+           COALESCE(s.cnt, 0)
+    FROM days d
+    LEFT JOIN v ON v.day = d.day
+    LEFT JOIN w ON w.day = d.day
+    LEFT JOIN t ON t.day = d.day
+    LEFT JOIN n ON n.day = d.day
+    LEFT JOIN s ON s.day = d.day
+    ORDER BY d.day;
+END;
+$$ LANGUAGE plpgsql STABLE SECURITY DEFINER;
+
+-- get_post_unique_viewers returns distinct viewers over the whole period (not the sum of daily uniques)
+CREATE OR REPLACE FUNCTION get_post_unique_viewers(p_post_id UUID, p_from DATE, p_to DATE)
+RETURNS BIGINT AS $$
+    SELECT COUNT(DISTINCT viewer_key)
+    FROM post_views
+    WHERE post_id = p_post_id
+      AND (created_at AT TIME ZONE 'Asia/Tokyo')::date BETWEEN p_from AND p_to;
+$$ LANGUAGE sql STABLE SECURITY DEFINER;
+
+-- Only the backend (service role) may call these functions; ownership is checked in the API
+REVOKE EXECUTE ON FUNCTION record_post_view(UUID, TEXT, UUID, INT) FROM PUBLIC, anon, authenticated;
+REVOKE EXECUTE ON FUNCTION get_post_analytics(UUID, DATE, DATE) FROM PUBLIC, anon, authenticated;
+REVOKE EXECUTE ON FUNCTION get_post_unique_viewers(UUID, DATE, DATE) FROM PUBLIC, anon, authenticated;
+GRANT EXECUTE ON FUNCTION record_post_view(UUID, TEXT, UUID, INT) TO service_role;
+GRANT EXECUTE ON FUNCTION get_post_analytics(UUID, DATE, DATE) TO service_role;
+GRANT EXECUTE ON FUNCTION get_post_unique_viewers(UUID, DATE, DATE) TO service_role;
+
+COMMENT ON TABLE post_views IS 'Detail-page views of posts, deduplicated per viewer within 30 minutes';
+COMMENT ON TABLE product_active_view_events IS 'Watchlist add/remove history populated by trigger on product_active_views';
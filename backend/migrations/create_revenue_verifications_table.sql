@@ -0,0 +1,132 @@
+-- Revenue verification from payment-provider exports (Stripe / App Store Connect / Google Play)
+
+-- Badge columns on posts
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS revenue_verified BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS revenue_verified_from DATE;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS revenue_verified_to DATE;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS revenue_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Create revenue_verifications table
+CREATE TABLE IF NOT EXISTS revenue_verifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    seller_user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('verified', 'mismatch')),
+    currency TEXT NOT NULL DEFAULT 'JPY',
+    period_start DATE,
+    period_end DATE,
+    claimed_monthly_revenue BIGINT,
+    verified_monthly_revenue BIGINT,
+    difference_ratio DOUBLE PRECISION,
+    monthly_breakdown JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create revenue_verification_files table (raw exports in the private revenue-reports bucket)
+CREATE TABLE IF NOT EXISTS revenue_verification_files (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    verification_id UUID NOT NULL REFERENCES revenue_verifications(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL CHECK (provider IN ('stripe', 'app_store', 'google_play')),
+    file_path TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    file_size BIGINT NOT NULL DEFAULT 0,
+    content_type TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_revenue_verifications_post_id ON revenue_verifications(post_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_revenue_verification_files_verification_id ON revenue_verification_files(verification_id);
+CREATE INDEX IF NOT EXISTS idx_revenue_verification_files_post_id ON revenue_verification_files(post_id);
+
+-- Enable Row Level Security (RLS)
+ALTER TABLE revenue_verifications ENABLE ROW LEVEL SECURITY;
+ALTER TABLE revenue_verification_files ENABLE ROW LEVEL SECURITY;
+
+-- RLS Policies for revenue_verifications
+-- 🔒 SECURITY: 金額・月別内訳を含むため投稿者とNDA締結者のみ参照可能。
+-- バッジ（期間）は posts の revenue_verified* 列で公開し、それ以外への表示はAPIが公開範囲を確認してから行う。
+-- 検証結果の登録はバックエンドが service role で行う（投稿者が自分で検証済みにできないよう INSERT ポリシーは作らない）
+CREATE POLICY "Post authors can view revenue verifications" ON revenue_verifications
+    FOR SELECT USING (
+        EXISTS (SELECT 1 FROM posts WHERE posts.id = post_id AND posts.author_user_id = auth.uid())
+    );
+
+CREATE POLICY "NDA holders can view revenue verifications" ON revenue_verifications
+    FOR SELECT USING (
+        EXISTS (
+            SELECT 1 FROM posts
+            JOIN nda_agreements ON nda_agreements.status = 'signed'
+                AND (
+                    (posts.author_org_id IS NOT NULL AND nda_agreements.seller_org_id = posts.author_org_id)
+                    OR (posts.author_org_id IS NULL AND nda_agreements.seller_user_id = posts.author_user_id)
+                )
+            WHERE posts.id = post_id
+              AND (
+                  nda_agreements.buyer_user_id = auth.uid()
+                  OR nda_agreements.buyer_org_id IN (SELECT org_id FROM org_memberships WHERE user_id = auth.uid())
+              )
+        )
+    );
+
+-- RLS Policies for revenue_verification_files
+CREATE POLICY "Post authors can view revenue files" ON revenue_verification_files
+    FOR SELECT USING (
+        EXISTS (SELECT 1 FROM posts WHERE posts.id = post_id AND posts.author_user_id = auth.uid())
+    );
+
+CREATE POLICY "NDA holders can view revenue files" ON revenue_verification_files
+    FOR SELECT USING (
+        EXISTS (
+            SELECT 1 FROM posts
+            JOIN nda_agreements ON nda_agreements.status = 'signed'
+                AND (
+                    (posts.author_org_id IS NOT NULL AND nda_agreements.seller_org_id = posts.author_org_id)
+                    OR (posts.author_org_id IS NULL AND nda_agreements.seller_user_id = posts.author_user_id)
+                )
+            WHERE posts.id = post_id
+              AND (
+                  nda_agreements.buyer_user_id = auth.uid()
+                  OR nda_agreements.buyer_org_id IN (SELECT org_id FROM org_memberships WHERE user_id = auth.uid())
+              )
+        )
+    );
+
+-- 🔒 SECURITY: 利用者（anon / authenticated）は売上検証バッジを設定できない。
+-- 作成時は未検証にし、更新時は元の値を保つ（申告売上が変わった場合のみバッジを外す）。設定は service role で行う
+CREATE OR REPLACE FUNCTION protect_post_revenue_verification()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF COALESCE(auth.role(), '') NOT IN ('anon', 'authenticated') THEN
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'INSERT' OR NEW.monthly_revenue IS DISTINCT FROM OLD.monthly_revenue THEN
+        NEW.revenue_verified := false;
+        NEW.revenue_verified_from := NULL;
+        NEW.revenue_verified_to := NULL;
+        NEW.revenue_verified_at := NULL;
+    ELSE
+        NEW.revenue_verified := OLD.revenue_verified;
+        NEW.revenue_verified_from := OLD.revenue_verified_from;
+        NEW.revenue_verified_to := OLD.revenue_verified_to;
+        NEW.revenue_verified_at := OLD.revenue_verified_at;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_posts_protect_revenue_verification ON posts;
+CREATE TRIGGER trg_posts_protect_revenue_verification
+    BEFORE INSERT OR UPDATE ON posts
+    FOR EACH ROW EXECUTE FUNCTION protect_post_revenue_verification();
+
+-- Private storage bucket for raw exports
+INSERT INTO storage.buckets (id, name, public)
+VALUES ('revenue-reports', 'revenue-reports', false)
+ON CONFLICT (id) DO NOTHING;
+
+COMMENT ON TABLE revenue_verifications IS 'Result of comparing uploaded payment-provider exports with the claimed monthly revenue of a post';
+COMMENT ON TABLE revenue_verification_files IS 'Raw payment-provider exports stored in the private revenue-reports bucket (owner and NDA holders only); written by the backend with the service role';
+COMMENT ON COLUMN posts.revenue_verified IS 'True when the latest revenue verification matched the claimed monthly_revenue';
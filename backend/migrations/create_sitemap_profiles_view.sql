@@ -0,0 +1,17 @@
+-- Public profiles for the sitemap, one row per user
+-- profiles はロールごとに1行のため、複数ロールのユーザーが重複しないよう id で集約する
+
+CREATE OR REPLACE VIEW sitemap_profiles
+WITH (security_invoker = true) -- 呼び出し元のRLSを適用する
+AS
+SELECT
+    id,
+    MAX(updated_at) AS updated_at
+FROM profiles
+WHERE public = true
+GROUP BY id;
+
+GRANT SELECT ON sitemap_profiles TO anon;
+GRANT SELECT ON sitemap_profiles TO authenticated;
+
+COMMENT ON VIEW sitemap_profiles IS 'Public profiles deduplicated by user id, for paginating the sitemap';
@@ -0,0 +1,147 @@
+-- Inbox: per-participant thread state (archive, mute, pin, labels) and ordering by last activity
+
+-- 最後のメッセージの時刻（メッセージがなければ作成日時）。一覧はこの順に並べる
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS last_activity_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE threads t
+SET last_activity_at = GREATEST(t.created_at, COALESCE((SELECT max(m.created_at) FROM messages m WHERE m.thread_id = t.id), t.created_at))
+WHERE t.last_activity_at IS NULL;
+
+ALTER TABLE threads ALTER COLUMN last_activity_at SET DEFAULT CURRENT_TIMESTAMP;
+
+-- Create thread_user_states table (one row per user who changed the state of a thread)
+CREATE TABLE IF NOT EXISTS thread_user_states (
+    thread_id UUID NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    archived_at TIMESTAMP WITH TIME ZONE,
+    muted BOOLEAN NOT NULL DEFAULT false,
+    pinned_at TIMESTAMP WITH TIME ZONE,
+    labels TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (thread_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_thread_user_states_user_id ON thread_user_states(user_id);
+CREATE INDEX IF NOT EXISTS idx_threads_last_activity_at ON threads(last_activity_at DESC) WHERE merged_into IS NULL;
+CREATE INDEX IF NOT EXISTS idx_message_reads_user_id ON message_reads(user_id, message_id);
+
+-- Enable Row Level Security (RLS)
+ALTER TABLE thread_user_states ENABLE ROW LEVEL SECURITY;
+
+-- 自分の状態のみ参照できる（更新はバックエンドが参加者を確認してから service role で行う）
+DROP POLICY IF EXISTS "Users can view their own thread states" ON thread_user_states;
+CREATE POLICY "Users can view their own thread states"
+    ON thread_user_states FOR SELECT
+    USING (auth.uid() = user_id);
+
+-- New messages move the thread up and bring it back from the archive of the other participants (unless muted)
+CREATE OR REPLACE FUNCTION touch_thread_activity()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE threads
+    SET last_activity_at = GREATEST(COALESCE(last_activity_at, NEW.created_at), NEW.created_at)
+    WHERE id = NEW.thread_id;
+
+    IF TG_OP = 'INSERT' THEN
+        UPDATE thread_user_states
+        SET archived_at = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE thread_id = NEW.thread_id
+          AND user_id <> NEW.sender_user_id
+          AND archived_at IS NOT NULL
+          AND NOT muted;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public;
+
+-- UPDATE OF thread_id: スレッド統合でメッセージが移動した場合も統合先の最終更新を進める
+DROP TRIGGER IF EXISTS trg_messages_touch_thread_activity ON messages;
+CREATE TRIGGER trg_messages_touch_thread_activity
+    AFTER INSERT OR UPDATE OF thread_id ON messages
+    FOR EACH ROW EXECUTE FUNCTION touch_thread_activity();
+
+-- inbox_thread_states returns every unmerged thread of a user with its state and unread messages
+-- 🔒 SECURITY: p_user_id はバックエンドで認証済みのユーザーを渡す。service role からのみ呼び出す
+CREATE OR REPLACE FUNCTION inbox_thread_states(
+    p_user_id UUID,
+    p_label TEXT DEFAULT NULL,
+    p_thread_type TEXT DEFAULT NULL
+)
+RETURNS TABLE (
+    thread_id UUID,
+    archived_at TIMESTAMP WITH TIME ZONE,
+    muted BOOLEAN,
+    pinned_at TIMESTAMP WITH TIME ZONE,
+    labels TEXT[],
+    unread_count BIGINT,
+    last_activity_at TIMESTAMP WITH TIME ZONE
+) AS $$
+    SELECT t.id, s.archived_at, COALESCE(s.muted, false), s.pinned_at, COALESCE(s.labels, '{}'),
+           (SELECT count(*) FROM messages m
+            WHERE m.thread_id = t.id
+              AND m.sender_user_id <> p_user_id
+              AND m.deleted_at IS NULL
+              AND NOT EXISTS (SELECT 1 FROM message_reads mr WHERE mr.message_id = m.id AND mr.user_id = p_user_id)),
+           COALESCE(t.last_activity_at, t.created_at)
+    FROM threads t
+    LEFT JOIN thread_user_states s ON s.thread_id = t.id AND s.user_id = p_user_id
+    WHERE t.merged_into IS NULL
+      AND (t.created_by = p_user_id
+           OR EXISTS (SELECT 1 FROM thread_participants tp WHERE tp.thread_id = t.id AND tp.user_id = p_user_id))
+      AND (p_thread_type IS NULL OR t.thread_type = p_thread_type)
+      AND (p_label IS NULL OR p_label = ANY (s.labels));
+$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public;
+
+-- inbox_threads lists the threads of a view, pinned first and then by last activity
+-- views: active (not archived), archived, unread (not archived, not muted, with unread messages)
+CREATE OR REPLACE FUNCTION inbox_threads(
+    p_user_id UUID,
+    p_view TEXT DEFAULT 'active',
+    p_label TEXT DEFAULT NULL,
+    p_thread_type TEXT DEFAULT NULL,
+    p_limit INT DEFAULT 50,
+    p_offset INT DEFAULT 0
+)
+RETURNS TABLE (
+    thread_id UUID,
+    archived_at TIMESTAMP WITH TIME ZONE,
+    muted BOOLEAN,
+    pinned_at TIMESTAMP WITH TIME ZONE,
+    labels TEXT[],
+    unread_count BIGINT,
+    last_activity_at TIMESTAMP WITH TIME ZONE
+) AS $$
+    SELECT st.*
+    FROM inbox_thread_states(p_user_id, p_label, p_thread_type) st
+    WHERE CASE p_view
+              WHEN 'archived' THEN st.archived_at IS NOT NULL
+              WHEN 'unread' THEN st.archived_at IS NULL AND NOT st.muted AND st.unread_count > 0
+              ELSE st.archived_at IS NULL
+          END
+    ORDER BY st.pinned_at DESC NULLS LAST, st.last_activity_at DESC, st.thread_id
+    LIMIT LEAST(GREATEST(p_limit, 1), 100) OFFSET GREATEST(p_offset, 0);
+$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public;
+
+-- inbox_counts returns the number of threads in each view and the total of unread messages (for the badge)
+CREATE OR REPLACE FUNCTION inbox_counts(p_user_id UUID)
+RETURNS TABLE (
+    active BIGINT,
+    archived BIGINT,
+    unread BIGINT,
+    unread_messages BIGINT
+) AS $$
+    SELECT count(*) FILTER (WHERE st.archived_at IS NULL),
+           count(*) FILTER (WHERE st.archived_at IS NOT NULL),
+           count(*) FILTER (WHERE st.archived_at IS NULL AND NOT st.muted AND st.unread_count > 0),
+           COALESCE(sum(st.unread_count) FILTER (WHERE st.archived_at IS NULL AND NOT st.muted), 0)::BIGINT
+    FROM inbox_thread_states(p_user_id, NULL, NULL) st;
+$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public;
+
+REVOKE EXECUTE ON FUNCTION inbox_thread_states(UUID, TEXT, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION inbox_thread_states(UUID, TEXT, TEXT) TO service_role;
+REVOKE EXECUTE ON FUNCTION inbox_threads(UUID, TEXT, TEXT, TEXT, INT, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION inbox_threads(UUID, TEXT, TEXT, TEXT, INT, INT) TO service_role;
+REVOKE EXECUTE ON FUNCTION inbox_counts(UUID) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION inbox_counts(UUID) TO service_role;
+
+COMMENT ON COLUMN threads.last_activity_at IS 'Time of the last message (creation time if none)';
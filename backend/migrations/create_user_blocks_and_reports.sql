@@ -0,0 +1,67 @@
+-- User blocking and reports (harassment, spam, fraud ...) with an operator triage queue
+
+-- Create user_blocks table (blocker_id がブロックした側)
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    blocked_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+-- ブロックされた側からの確認（スレッド作成・メッセージ送信の拒否）に使用
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked_id ON user_blocks(blocked_id);
+
+ALTER TABLE user_blocks ENABLE ROW LEVEL SECURITY;
+
+-- 自分がブロックした利用者のみ参照・追加・解除できる（ブロックされたことは相手に見せない）
+DROP POLICY IF EXISTS "Users can view their own blocks" ON user_blocks;
+CREATE POLICY "Users can view their own blocks"
+    ON user_blocks FOR SELECT
+    USING (auth.uid() = blocker_id);
+
+DROP POLICY IF EXISTS "Users can block other users" ON user_blocks;
+CREATE POLICY "Users can block other users"
+    ON user_blocks FOR INSERT
+    WITH CHECK (auth.uid() = blocker_id);
+
+DROP POLICY IF EXISTS "Users can unblock users" ON user_blocks;
+CREATE POLICY "Users can unblock users"
+    ON user_blocks FOR DELETE
+    USING (auth.uid() = blocker_id);
+
+-- Create reports table
+CREATE TABLE IF NOT EXISTS reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    reporter_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    target_type TEXT NOT NULL CHECK (target_type IN ('message', 'comment', 'comment_reply', 'post', 'profile')),
+    -- messages.id / post_comments.id / comment_replies.id / posts.id / profiles.id（削除されても通報は残す）
+    target_id UUID NOT NULL,
+    target_user_id UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    thread_id UUID REFERENCES threads(id) ON DELETE SET NULL,
+    post_id UUID REFERENCES posts(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('harassment', 'spam', 'fraud', 'off_platform_contact', 'inappropriate', 'other')),
+    details TEXT,
+    target_snapshot TEXT,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'in_review', 'resolved', 'dismissed')),
+    assigned_to UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    resolution_note TEXT,
+    resolved_by UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 同じ利用者が同じ内容を対応中に重ねて通報しないように
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_active_unique
+    ON reports(reporter_id, target_type, target_id) WHERE status IN ('open', 'in_review');
+CREATE INDEX IF NOT EXISTS idx_reports_queue ON reports(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_reports_target_user_id ON reports(target_user_id, status);
+CREATE INDEX IF NOT EXISTS idx_reports_reporter_id ON reports(reporter_id, created_at DESC);
+
+-- Enable Row Level Security (RLS)
+-- 🔒 SECURITY: 通報者・対応メモを含むためポリシーは作らない（バックエンドが通報者本人・運営を確認してから service role で参照する）
+ALTER TABLE reports ENABLE ROW LEVEL SECURITY;
+
+COMMENT ON TABLE reports IS 'Reports of messages, comments, posts and profiles, triaged by operators; service role only';
+COMMENT ON COLUMN reports.target_snapshot IS 'Content of the target when it was reported';